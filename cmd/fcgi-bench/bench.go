@@ -0,0 +1,231 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// templateData is the data of templates of parameters.
+type templateData struct {
+	N      int
+	Worker int
+}
+
+// sample is the result of a request.
+type sample struct {
+	latency time.Duration
+
+	// Statuses are known when the request is ended, even when it is
+	// rejected.
+	isEnded        bool
+	appStatus      uint32
+	protocolStatus byte
+
+	// The error which has stopped a request which is not ended.
+	err error
+}
+
+// benchmark runs the load in a mode of the client.
+type benchmark struct {
+	opts *options
+	mode string
+
+	// Pool of connections shared by the workers. It is not used in the
+	// new-conn mode.
+	pool *cl.Pool
+}
+
+func newBenchmark(opts *options, mode string) (b *benchmark) {
+	return &benchmark{
+		opts: opts,
+		mode: mode,
+	}
+}
+
+// run sends requests until their number or the duration is reached, or the
+// context is done. Requests being sent when the duration is reached are
+// finished.
+func (b *benchmark) run(ctx context.Context) (rep *report) {
+	switch b.mode {
+	case ModeKeepAlive:
+		b.pool = cl.NewMultiplexingPool(b.opts.network, b.opts.address, b.opts.concurrency, 1)
+	case ModeMultiplexed:
+		b.pool = cl.NewMultiplexingPool(b.opts.network, b.opts.address, b.opts.conns, b.opts.concurrency)
+	}
+	if b.pool != nil {
+		defer func() { _ = b.pool.Close() }()
+	}
+
+	stopCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if b.opts.duration > 0 {
+		stopCtx, stop = context.WithTimeout(stopCtx, b.opts.duration)
+		defer stop()
+	}
+
+	tokens := startLimiter(stopCtx, b.opts.rate)
+
+	var counter atomic.Int64
+	samples := make([][]*sample, b.opts.concurrency)
+	wg := new(sync.WaitGroup)
+
+	startedAt := time.Now()
+	for w := range b.opts.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			for stopCtx.Err() == nil {
+				if tokens != nil {
+					select {
+					case <-tokens:
+					case <-stopCtx.Done():
+						return
+					}
+				}
+
+				n := int(counter.Add(1))
+				if (b.opts.requests > 0) && (n > b.opts.requests) {
+					return
+				}
+
+				samples[w] = append(samples[w], b.doRequest(ctx, templateData{N: n, Worker: w + 1}))
+			}
+		}()
+	}
+	wg.Wait()
+
+	rep = newReport(b.mode, time.Since(startedAt), samples)
+	if b.mode == ModeMultiplexed {
+		rep.isMultiplexed = b.pool.IsMultiplexed()
+	}
+
+	return rep
+}
+
+// startLimiter starts a generator of tokens at the rate. Ticks are dropped
+// while all the workers are busy, so the rate is an upper limit. There is no
+// generator when the rate is not limited.
+func startLimiter(ctx context.Context, rate float64) (tokens <-chan struct{}) {
+	if rate <= 0 {
+		return nil
+	}
+
+	ch := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(max(time.Duration(float64(time.Second)/rate), time.Nanosecond))
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C:
+				select {
+				case ch <- struct{}{}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return ch
+}
+
+// doRequest sends a request and drains its response. In the new-conn mode,
+// the latency includes dialling of the connection.
+func (b *benchmark) doRequest(ctx context.Context, td templateData) (s *sample) {
+	s = &sample{}
+
+	var params []*nvpair.NameValuePair
+	params, s.err = b.newParams(td)
+	if s.err != nil {
+		return s
+	}
+
+	req := &cl.Request{
+		Role:     dm.FCGI_RESPONDER,
+		KeepConn: b.pool != nil,
+		Params:   params,
+		Stderr:   io.Discard,
+	}
+	if b.opts.stdin != nil {
+		req.Stdin = bytes.NewReader(b.opts.stdin)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, b.opts.timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	defer func() {
+		s.latency = time.Since(startedAt)
+	}()
+
+	var doer cl.Doer = b.pool
+	if b.pool == nil {
+		var c *cl.Client
+		c, s.err = cl.New(b.opts.network, b.opts.address)
+		if s.err != nil {
+			return s
+		}
+		defer func() { _ = c.Close() }()
+
+		doer = c
+	}
+
+	var rsp *cl.Response
+	rsp, s.err = doer.Do(ctx, req)
+	if s.err != nil {
+		return s
+	}
+	defer func() { _ = rsp.Close() }()
+
+	_, s.err = io.Copy(io.Discard, rsp.Stdout)
+
+	_, err := rsp.EndRequest()
+	if err == nil {
+		s.isEnded = true
+		s.appStatus = rsp.AppStatus()
+		s.protocolStatus = rsp.ProtocolStatus()
+		s.err = nil
+		return s
+	}
+
+	if s.err == nil {
+		s.err = err
+	}
+
+	return s
+}
+
+// newParams makes parameters of a request by the templates.
+func (b *benchmark) newParams(td templateData) (params []*nvpair.NameValuePair, err error) {
+	params = make([]*nvpair.NameValuePair, 0, len(b.opts.params))
+
+	var sb strings.Builder
+	for _, p := range b.opts.params {
+		value := p.value
+		if p.tmpl != nil {
+			sb.Reset()
+			err = p.tmpl.Execute(&sb, td)
+			if err != nil {
+				return nil, err
+			}
+			value = sb.String()
+		}
+
+		params = append(params, nvpair.NewNameValuePairWithTextValueU(p.name, value))
+	}
+
+	return params, nil
+}
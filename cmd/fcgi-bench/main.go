@@ -0,0 +1,273 @@
+// Fcgi-bench drives a FastCGI backend directly with a load of requests and
+// reports throughput, latency, protocol statuses and errors.
+//
+// Usage examples:
+//
+//	fcgi-bench -connect 127.0.0.1:9000 -param SCRIPT_FILENAME=/srv/index.php -c 32 -n 10000
+//	fcgi-bench -connect /run/php/php-fpm.sock -param SCRIPT_FILENAME=/srv/form.php -stdin form.txt -rate 500 -duration 1m
+//	fcgi-bench -connect 127.0.0.1:9000 -param SCRIPT_FILENAME=/srv/item.php -param 'QUERY_STRING=id={{.N}}' -mode keep-alive,multiplexed,new-conn
+//
+// Values of parameters are templates of the 'text/template' package. The '.N'
+// field is the number of the request, counted from 1, and the '.Worker' field
+// is the number of the worker sending it, counted from 1.
+//
+// Modes of the client are:
+//   - keep-alive: each worker keeps its own connection open between requests;
+//   - multiplexed: workers share '-conns' connections when the backend
+//     supports multiplexing, otherwise they share them one request at a time;
+//   - new-conn: each request dials a new connection, which is closed by the
+//     backend at the end of the request.
+//
+// Several modes, separated by commas, are run one after another with the same
+// load, and a report is printed for each of them.
+//
+// The tool exits with code 1 when no request has been completed and with code
+// 2 when the arguments are wrong.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/template"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	ExitCodeOk      = 0
+	ExitCodeFailure = 1
+	ExitCodeUsage   = 2
+)
+
+// Modes of the client.
+const (
+	ModeKeepAlive   = "keep-alive"
+	ModeMultiplexed = "multiplexed"
+	ModeNewConn     = "new-conn"
+)
+
+const (
+	ConcurrencyDefault = 8
+	RequestsDefault    = 1000
+	ConnsDefault       = 1
+	TimeoutDefault     = 30 * time.Second
+)
+
+const (
+	ErrConnectIsNotSet    = "address of the backend is not set"
+	ErrModeIsUnknown      = "mode is unknown: %v"
+	ErrParamSyntax        = "parameter is not in the NAME=VALUE form: %v"
+	ErrParamTemplate      = "template of parameter %v is wrong: %w"
+	ErrLimitIsNotPositive = "%v must be positive"
+	ErrLimitIsNegative    = "%v must not be negative"
+	ErrLoadIsUnbounded    = "either the number of requests or the duration must be set"
+	ErrArgumentsAreExcess = "excess arguments: %v"
+	ErrNothingIsCompleted = "no request has been completed"
+)
+
+type options struct {
+	network     string
+	address     string
+	modes       []string
+	concurrency int
+	conns       int
+	requests    int
+	duration    time.Duration
+	rate        float64
+	timeout     time.Duration
+	params      []*paramTemplate
+	stdin       []byte
+}
+
+// paramTemplate is a parameter of requests whose value is a template.
+type paramTemplate struct {
+	name  string
+	value string
+
+	// Template of a value having actions. Other values are used as is.
+	tmpl *template.Template
+}
+
+// paramList is a list of the '-param' flags.
+type paramList []string
+
+func (pl *paramList) String() string {
+	return strings.Join(*pl, " ")
+}
+
+func (pl *paramList) Set(value string) error {
+	*pl = append(*pl, value)
+	return nil
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdout io.Writer, stderr io.Writer) (exitCode int) {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitCodeOk
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeUsage
+	}
+
+	isCompleted := false
+	for i, mode := range opts.modes {
+		if ctx.Err() != nil {
+			break
+		}
+
+		rep := newBenchmark(opts, mode).run(ctx)
+		isCompleted = isCompleted || (rep.completed > 0)
+
+		if i > 0 {
+			_, _ = fmt.Fprintln(stdout)
+		}
+		err = rep.print(stdout)
+		if err != nil {
+			_, _ = fmt.Fprintln(stderr, err)
+			return ExitCodeFailure
+		}
+	}
+
+	if !isCompleted {
+		_, _ = fmt.Fprintln(stderr, ErrNothingIsCompleted)
+		return ExitCodeFailure
+	}
+
+	return ExitCodeOk
+}
+
+func parseArgs(args []string, stderr io.Writer) (opts *options, err error) {
+	fs := flag.NewFlagSet("fcgi-bench", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	opts = &options{}
+	var modes, stdinPath string
+	var params paramList
+
+	fs.StringVar(&opts.address, "connect", "", "address of the backend: host:port or path to a Unix socket")
+	fs.StringVar(&opts.network, "network", "", "network of the backend: tcp or unix; by default, it is guessed by the address")
+	fs.StringVar(&modes, "mode", ModeKeepAlive, "modes of the client, separated by commas: keep-alive, multiplexed or new-conn")
+	fs.IntVar(&opts.concurrency, "c", ConcurrencyDefault, "number of workers sending requests at a time")
+	fs.IntVar(&opts.conns, "conns", ConnsDefault, "number of connections shared by workers in the multiplexed mode")
+	fs.IntVar(&opts.requests, "n", RequestsDefault, "number of requests of each mode; zero means no limit")
+	fs.DurationVar(&opts.duration, "duration", 0, "time limit of each mode; zero means no limit")
+	fs.Float64Var(&opts.rate, "rate", 0, "requests per second of all the workers; zero means no limit")
+	fs.DurationVar(&opts.timeout, "timeout", TimeoutDefault, "time limit of a request")
+	fs.Var(&params, "param", "parameter of requests in the NAME=VALUE form, the value is a template; may be repeated")
+	fs.StringVar(&stdinPath, "stdin", "", "file with the body of requests")
+
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf(ErrArgumentsAreExcess, fs.Args())
+	}
+
+	if len(opts.address) == 0 {
+		return nil, errors.New(ErrConnectIsNotSet)
+	}
+	if len(opts.network) == 0 {
+		opts.network = cl.GuessNetwork(opts.address)
+	}
+	if !cl.IsNetworkSupported(opts.network) {
+		return nil, fmt.Errorf(cl.ErrNetworkIsNotSupported, opts.network)
+	}
+
+	for _, mode := range strings.Split(modes, ",") {
+		mode = strings.TrimSpace(mode)
+		switch mode {
+		case ModeKeepAlive, ModeMultiplexed, ModeNewConn:
+			opts.modes = append(opts.modes, mode)
+		default:
+			return nil, fmt.Errorf(ErrModeIsUnknown, mode)
+		}
+	}
+
+	switch {
+	case opts.concurrency <= 0:
+		return nil, fmt.Errorf(ErrLimitIsNotPositive, "concurrency")
+	case opts.conns <= 0:
+		return nil, fmt.Errorf(ErrLimitIsNotPositive, "number of connections")
+	case opts.timeout <= 0:
+		return nil, fmt.Errorf(ErrLimitIsNotPositive, "timeout")
+	case (opts.requests < 0) || (opts.duration < 0) || (opts.rate < 0):
+		return nil, fmt.Errorf(ErrLimitIsNegative, "limit of the load")
+	case (opts.requests == 0) && (opts.duration == 0):
+		return nil, errors.New(ErrLoadIsUnbounded)
+	}
+
+	for _, p := range params {
+		var pt *paramTemplate
+		pt, err = parseParam(p)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.params = append(opts.params, pt)
+	}
+
+	if len(stdinPath) > 0 {
+		opts.stdin, err = os.ReadFile(stdinPath)
+		if err != nil {
+			return nil, err
+		}
+
+		if !hasParam(opts.params, dm.Parameter_ContentLength) {
+			opts.params = append(opts.params, &paramTemplate{name: dm.Parameter_ContentLength, value: strconv.Itoa(len(opts.stdin))})
+		}
+	}
+
+	return opts, nil
+}
+
+func parseParam(s string) (pt *paramTemplate, err error) {
+	name, value, ok := strings.Cut(s, "=")
+	if !ok || (len(name) == 0) {
+		return nil, fmt.Errorf(ErrParamSyntax, s)
+	}
+
+	pt = &paramTemplate{name: name, value: value}
+	if !strings.Contains(value, "{{") {
+		return pt, nil
+	}
+
+	// Fields are checked by a trial execution.
+	pt.tmpl, err = template.New(name).Parse(value)
+	if err == nil {
+		err = pt.tmpl.Execute(io.Discard, templateData{N: 1, Worker: 1})
+	}
+	if err != nil {
+		return nil, fmt.Errorf(ErrParamTemplate, name, err)
+	}
+
+	return pt, nil
+}
+
+func hasParam(params []*paramTemplate, name string) bool {
+	for _, p := range params {
+		if p.name == name {
+			return true
+		}
+	}
+
+	return false
+}
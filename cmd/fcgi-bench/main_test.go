@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startBackend starts a backend which rejects every fifth request as
+// overloaded and ends the third request with the application status 3.
+func startBackend(t *testing.T) (srv *fcgitest.Server) {
+	srv, err := fcgitest.NewServer(func(r *fcgitest.Request) *fcgitest.Response {
+		query, _ := r.Param(dm.Parameter_QueryString)
+		switch query {
+		case "n=5", "n=10", "n=15", "n=20":
+			return &fcgitest.Response{ProtocolStatus: dm.FCGI_OVERLOADED}
+		case "n=3":
+			return &fcgitest.Response{Stdout: []byte("Status: 500 Error\r\n\r\n"), AppStatus: 3}
+		default:
+			return &fcgitest.Response{Stdout: []byte("Content-Type: text/plain\r\n\r\nok")}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv
+}
+
+func Test_run(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startBackend(t)
+	stdinPath := filepath.Join(t.TempDir(), "body.txt")
+	aTest.MustBeNoError(os.WriteFile(stdinPath, []byte("name=Alice"), 0o600))
+
+	stdout, stderr := new(bytes.Buffer), new(bytes.Buffer)
+	exitCode := run(context.Background(), []string{
+		"-connect", srv.Address, "-mode", "keep-alive,multiplexed,new-conn", "-n", "20", "-c", "4",
+		"-param", "QUERY_STRING=n={{.N}}", "-param", "SCRIPT_FILENAME=/srv/index.php", "-stdin", stdinPath,
+	}, stdout, stderr)
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+	aTest.MustBeEqual(stderr.String(), "")
+
+	reports := strings.Split(stdout.String(), "\n\n")
+	aTest.MustBeEqual(len(reports), 3)
+	for i, mode := range []string{ModeKeepAlive, ModeMultiplexed, ModeNewConn} {
+		aTest.MustBeEqual(strings.HasPrefix(reports[i], "Mode:                 "+mode+"\n"), true)
+		aTest.MustBeEqual(strings.Contains(reports[i], "\nRequests:             20 in "), true)
+		aTest.MustBeEqual(strings.Contains(reports[i], "\nCompleted:            16\n"), true)
+		aTest.MustBeEqual(strings.Contains(reports[i], "\nLatency:              min "), true)
+		aTest.MustBeEqual(strings.Contains(reports[i], "\nProtocol statuses:    FCGI_REQUEST_COMPLETE 16, FCGI_OVERLOADED 4\n"), true)
+		aTest.MustBeEqual(strings.Contains(reports[i], "\nApplication statuses: 0 15, 3 1\n"), true)
+		aTest.MustBeEqual(strings.HasSuffix(strings.TrimSuffix(reports[i], "\n"), "\nErrors:               0"), true)
+	}
+	aTest.MustBeEqual(strings.Contains(reports[1], "\nMultiplexing:         yes\n"), true)
+
+	requests := srv.Requests()
+	aTest.MustBeEqual(len(requests), 60)
+	queries := make(map[string]int)
+	for _, r := range requests {
+		query, _ := r.Param(dm.Parameter_QueryString)
+		queries[query]++
+
+		contentLength, _ := r.Param(dm.Parameter_ContentLength)
+		aTest.MustBeEqual(contentLength, "10")
+		aTest.MustBeEqual(r.Stdin, []byte("name=Alice"))
+	}
+	aTest.MustBeEqual(len(queries), 20)
+	aTest.MustBeEqual(queries["n=1"], 3)
+	aTest.MustBeEqual(queries["n=20"], 3)
+}
+
+func Test_run_Duration(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startBackend(t)
+	stdout := new(bytes.Buffer)
+	exitCode := run(context.Background(), []string{
+		"-connect", srv.Address, "-n", "0", "-duration", "300ms", "-rate", "10", "-param", "QUERY_STRING=n={{.Worker}}",
+	}, stdout, new(bytes.Buffer))
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+
+	// Three requests are sent in 300 ms at the rate of ten per second.
+	requests := srv.Requests()
+	aTest.MustBeEqual((len(requests) >= 1) && (len(requests) <= 4), true)
+}
+
+func Test_run_Errors(t *testing.T) {
+	aTest := tester.New(t)
+
+	tests := []struct {
+		args     []string
+		exitCode int
+		stderr   string
+	}{
+		{[]string{"-n", "1"}, ExitCodeUsage, ErrConnectIsNotSet},
+		{[]string{"-connect", ":9000", "-network", "udp"}, ExitCodeUsage, "udp"},
+		{[]string{"-connect", ":9000", "-mode", "keep-alive,pipelined"}, ExitCodeUsage, "mode is unknown: pipelined"},
+		{[]string{"-connect", ":9000", "-c", "0"}, ExitCodeUsage, "concurrency must be positive"},
+		{[]string{"-connect", ":9000", "-rate", "-1"}, ExitCodeUsage, "limit of the load must not be negative"},
+		{[]string{"-connect", ":9000", "-n", "0"}, ExitCodeUsage, ErrLoadIsUnbounded},
+		{[]string{"-connect", ":9000", "-param", "=x"}, ExitCodeUsage, "parameter is not in the NAME=VALUE form: =x"},
+		{[]string{"-connect", ":9000", "-param", "X={{.M}}"}, ExitCodeUsage, "template of parameter X is wrong"},
+		{[]string{"-connect", ":9000", "x"}, ExitCodeUsage, "excess arguments: [x]"},
+		{[]string{"-connect", ":9000", "-stdin", filepath.Join(t.TempDir(), "none.txt")}, ExitCodeUsage, "no such file or directory"},
+		{[]string{"-connect", filepath.Join(t.TempDir(), "none.sock"), "-n", "2"}, ExitCodeFailure, ErrNothingIsCompleted},
+	}
+	for _, test := range tests {
+		stderr := new(bytes.Buffer)
+		aTest.MustBeEqual(run(context.Background(), test.args, new(bytes.Buffer), stderr), test.exitCode)
+		aTest.MustBeEqual(strings.Contains(stderr.String(), test.stderr), true)
+	}
+}
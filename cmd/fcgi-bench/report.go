@@ -0,0 +1,163 @@
+package main
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// Percentiles of latency in the report.
+var percentiles = []int{50, 90, 99}
+
+// protocolStatusNames are names of protocol statuses of the FastCGI
+// specification.
+var protocolStatusNames = map[byte]string{
+	dm.FCGI_REQUEST_COMPLETE: "FCGI_REQUEST_COMPLETE",
+	dm.FCGI_CANT_MPX_CONN:    "FCGI_CANT_MPX_CONN",
+	dm.FCGI_OVERLOADED:       "FCGI_OVERLOADED",
+	dm.FCGI_UNKNOWN_ROLE:     "FCGI_UNKNOWN_ROLE",
+}
+
+// report is the summary of a benchmark.
+type report struct {
+	mode          string
+	isMultiplexed bool
+	elapsed       time.Duration
+	requests      int
+
+	// Requests ended with the FCGI_REQUEST_COMPLETE status, and their
+	// latencies in ascending order.
+	completed int
+	latencies []time.Duration
+
+	protocolStatuses map[byte]int
+	appStatuses      map[uint32]int
+	errors           map[string]int
+}
+
+func newReport(mode string, elapsed time.Duration, samples [][]*sample) (rep *report) {
+	rep = &report{
+		mode:             mode,
+		elapsed:          elapsed,
+		protocolStatuses: make(map[byte]int),
+		appStatuses:      make(map[uint32]int),
+		errors:           make(map[string]int),
+	}
+
+	for _, workerSamples := range samples {
+		for _, s := range workerSamples {
+			rep.requests++
+
+			if !s.isEnded {
+				rep.errors[s.err.Error()]++
+				continue
+			}
+
+			rep.protocolStatuses[s.protocolStatus]++
+			if s.protocolStatus != dm.FCGI_REQUEST_COMPLETE {
+				continue
+			}
+
+			rep.completed++
+			rep.appStatuses[s.appStatus]++
+			rep.latencies = append(rep.latencies, s.latency)
+		}
+	}
+
+	slices.Sort(rep.latencies)
+
+	return rep
+}
+
+// percentile returns the latency by the nearest-rank method.
+func (rep *report) percentile(p int) (latency time.Duration) {
+	rank := (p*len(rep.latencies) + 99) / 100
+	return rep.latencies[max(rank-1, 0)]
+}
+
+func (rep *report) mean() (latency time.Duration) {
+	var sum time.Duration
+	for _, l := range rep.latencies {
+		sum += l
+	}
+
+	return sum / time.Duration(len(rep.latencies))
+}
+
+func (rep *report) print(w io.Writer) (err error) {
+	lines := []string{
+		fmt.Sprintf("Mode:                 %v", rep.mode),
+	}
+	if rep.mode == ModeMultiplexed {
+		multiplexing := "yes"
+		if !rep.isMultiplexed {
+			multiplexing = "no, it is not supported by the backend"
+		}
+		lines = append(lines, fmt.Sprintf("Multiplexing:         %v", multiplexing))
+	}
+
+	lines = append(lines,
+		fmt.Sprintf("Requests:             %v in %v", rep.requests, rep.elapsed.Round(time.Millisecond)),
+		fmt.Sprintf("Completed:            %v", rep.completed),
+		fmt.Sprintf("Throughput:           %.1f completed requests per second", float64(rep.completed)/rep.elapsed.Seconds()),
+	)
+
+	if len(rep.latencies) > 0 {
+		parts := []string{"min " + formatLatency(rep.latencies[0]), "mean " + formatLatency(rep.mean())}
+		for _, p := range percentiles {
+			parts = append(parts, fmt.Sprintf("p%v %v", p, formatLatency(rep.percentile(p))))
+		}
+		parts = append(parts, "max "+formatLatency(rep.latencies[len(rep.latencies)-1]))
+
+		lines = append(lines, "Latency:              "+strings.Join(parts, ", "))
+	}
+
+	if len(rep.protocolStatuses) > 0 {
+		var parts []string
+		for _, ps := range slices.Sorted(maps.Keys(rep.protocolStatuses)) {
+			name, ok := protocolStatusNames[ps]
+			if !ok {
+				name = fmt.Sprint(ps)
+			}
+			parts = append(parts, fmt.Sprintf("%v %v", name, rep.protocolStatuses[ps]))
+		}
+
+		lines = append(lines, "Protocol statuses:    "+strings.Join(parts, ", "))
+	}
+
+	if len(rep.appStatuses) > 0 {
+		var parts []string
+		for _, as := range slices.Sorted(maps.Keys(rep.appStatuses)) {
+			parts = append(parts, fmt.Sprintf("%v %v", as, rep.appStatuses[as]))
+		}
+
+		lines = append(lines, "Application statuses: "+strings.Join(parts, ", "))
+	}
+
+	// Errors are listed from the most frequent one.
+	errorsCount := 0
+	for _, n := range rep.errors {
+		errorsCount += n
+	}
+	lines = append(lines, fmt.Sprintf("Errors:               %v", errorsCount))
+
+	texts := slices.SortedFunc(maps.Keys(rep.errors), func(a, b string) int {
+		return cmp.Or(cmp.Compare(rep.errors[b], rep.errors[a]), strings.Compare(a, b))
+	})
+	for _, text := range texts {
+		lines = append(lines, fmt.Sprintf("  %v × %v", rep.errors[text], text))
+	}
+
+	_, err = fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+func formatLatency(d time.Duration) string {
+	return d.Round(time.Microsecond).String()
+}
@@ -0,0 +1,580 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// Directions of records.
+const (
+	DirectionClient = "client"
+	DirectionServer = "server"
+)
+
+// Dump is the decoded capture.
+type Dump struct {
+	Connections []*Connection `json:"connections"`
+
+	// Violations of the capture itself, e.g. a truncated last record.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Connection is the timeline of a single connection, split into sections of
+// requests.
+type Connection struct {
+	Client string     `json:"client,omitempty"`
+	Server string     `json:"server,omitempty"`
+	Start  *time.Time `json:"start,omitempty"`
+
+	// The first section is the section of management records, if any.
+	Sections []*Section `json:"sections"`
+
+	// Violations of the connection which are not related to a request, e.g.
+	// a broken record.
+	Violations []string `json:"violations,omitempty"`
+}
+
+// Section contains the records of a single request.
+type Section struct {
+	RequestId uint16   `json:"requestId"`
+	Role      string   `json:"role,omitempty"`
+	KeepConn  bool     `json:"keepConn,omitempty"`
+	Params    []*Param `json:"params,omitempty"`
+
+	StdinBytes  int `json:"stdinBytes"`
+	DataBytes   int `json:"dataBytes"`
+	StdoutBytes int `json:"stdoutBytes"`
+	StderrBytes int `json:"stderrBytes"`
+
+	AppStatus      *uint32 `json:"appStatus,omitempty"`
+	ProtocolStatus string  `json:"protocolStatus,omitempty"`
+
+	Records    []*RecordInfo `json:"records"`
+	Violations []string      `json:"violations,omitempty"`
+
+	// State of the request.
+	isBegun       bool
+	isEnded       bool
+	params        bytes.Buffer
+	endedStreams  map[dm.RecordType]bool
+	startedStream map[dm.RecordType]bool
+}
+
+// Param is a decoded name-value pair.
+type Param struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// RecordInfo describes a single record.
+type RecordInfo struct {
+	// Time is the number of seconds since the start of the connection. It is
+	// known only for captured packets.
+	Time *float64 `json:"time,omitempty"`
+
+	// Direction is empty when it is not known.
+	Direction string `json:"direction,omitempty"`
+
+	// Offset of the record in the stream of its direction.
+	Offset int64 `json:"offset"`
+
+	Type          string `json:"type"`
+	RequestId     uint16 `json:"requestId"`
+	ContentLength uint16 `json:"contentLength"`
+	PaddingLength byte   `json:"paddingLength"`
+
+	Details    string   `json:"details,omitempty"`
+	Preview    string   `json:"preview,omitempty"`
+	Params     []*Param `json:"params,omitempty"`
+	Violations []string `json:"violations,omitempty"`
+}
+
+// stream is the data of a single direction of a connection.
+type stream struct {
+	direction string
+	data      []byte
+
+	// Times of the pieces of data, when they are known. The data of a piece
+	// lasts until the offset of the next piece.
+	pieces []piece
+
+	// Violation of the capture, e.g. a gap in the data, which ends the
+	// stream.
+	violation string
+}
+
+type piece struct {
+	offset int64
+	time   time.Time
+}
+
+// timeAt returns the time of the byte at the offset.
+func (s *stream) timeAt(offset int64) (t time.Time, ok bool) {
+	for i := len(s.pieces) - 1; i >= 0; i-- {
+		if s.pieces[i].offset <= offset {
+			return s.pieces[i].time, true
+		}
+	}
+
+	return t, false
+}
+
+// decodedRecord is a record with its place in the capture.
+type decodedRecord struct {
+	rec       *dm.Record
+	direction string
+	offset    int64
+	time      time.Time
+	hasTime   bool
+}
+
+// countingReader counts the bytes read from the stream.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (n int, err error) {
+	n, err = cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
+
+// decoder decodes records of connections.
+type decoder struct {
+	previewSize int
+}
+
+// readRecords reads all the records of the stream. A broken record stops
+// reading and is reported as a violation of the connection.
+func (d *decoder) readRecords(s *stream, conn *Connection) (recs []*decodedRecord) {
+	cr := &countingReader{r: bytes.NewReader(s.data)}
+
+	for {
+		offset := cr.n
+
+		rec, err := dm.NewRecordFromStream(cr)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			// Offsets of errors are counted from the start of the record.
+			var re *dm.RecordError
+			if errors.As(err, &re) {
+				conn.Violations = append(conn.Violations, fmt.Sprintf("%v stream: record error at offset %v (%v): %v", directionName(s.direction), offset+re.Offset, re.Part, re.Err))
+			} else {
+				conn.Violations = append(conn.Violations, fmt.Sprintf("%v stream: %v", directionName(s.direction), err))
+			}
+			break
+		}
+
+		dr := &decodedRecord{rec: rec, direction: s.direction, offset: offset}
+		dr.time, dr.hasTime = s.timeAt(offset)
+		recs = append(recs, dr)
+	}
+
+	if len(s.violation) > 0 {
+		conn.Violations = append(conn.Violations, fmt.Sprintf("%v stream: %v", directionName(s.direction), s.violation))
+	}
+
+	return recs
+}
+
+// decodeConnection decodes the streams of a connection. Records of both
+// directions are merged by time into a single timeline.
+func (d *decoder) decodeConnection(conn *Connection, streams ...*stream) {
+	var timeline []*decodedRecord
+	for _, s := range streams {
+		timeline = mergeByTime(timeline, d.readRecords(s, conn))
+	}
+
+	// Checks of a side are done only when the side is captured.
+	var hasClient, hasServer bool
+	for _, dr := range timeline {
+		switch recordDirection(dr) {
+		case DirectionClient:
+			hasClient = true
+		case DirectionServer:
+			hasServer = true
+		}
+	}
+
+	var management *Section
+	active := make(map[uint16]*Section)
+	for _, dr := range timeline {
+		if (conn.Start == nil) && dr.hasTime {
+			start := dr.time
+			conn.Start = &start
+		}
+
+		ri := d.describeRecord(dr, conn.Start)
+
+		if dr.rec.RequestId == dm.FCGI_NULL_REQUEST_ID {
+			if management == nil {
+				management = &Section{}
+				conn.Sections = append([]*Section{management}, conn.Sections...)
+			}
+			management.Records = append(management.Records, ri)
+			continue
+		}
+
+		section := active[dr.rec.RequestId]
+		if dr.rec.Type == dm.FCGI_BEGIN_REQUEST {
+			if (section != nil) && !section.isEnded {
+				ri.Violations = append(ri.Violations, "request ID is already active")
+			}
+
+			section = newSection(dr.rec.RequestId)
+			section.isBegun = true
+			active[dr.rec.RequestId] = section
+			conn.Sections = append(conn.Sections, section)
+		} else if (section == nil) || section.isEnded {
+			if hasClient {
+				ri.Violations = append(ri.Violations, "record of an inactive request")
+			}
+
+			if section == nil {
+				section = newSection(dr.rec.RequestId)
+				active[dr.rec.RequestId] = section
+				conn.Sections = append(conn.Sections, section)
+			}
+		}
+
+		section.Records = append(section.Records, ri)
+		d.applyRecord(section, dr, ri)
+	}
+
+	// Records of a request which has not begun are already flagged when the
+	// requests are seen.
+	if hasServer {
+		for _, section := range conn.Sections {
+			if (section != management) && !section.isEnded && (section.isBegun || !hasClient) {
+				section.Violations = append(section.Violations, "request has not ended")
+			}
+		}
+	}
+}
+
+func newSection(requestId uint16) (section *Section) {
+	return &Section{
+		RequestId:     requestId,
+		endedStreams:  make(map[dm.RecordType]bool),
+		startedStream: make(map[dm.RecordType]bool),
+	}
+}
+
+// describeRecord describes the record and checks it alone.
+func (d *decoder) describeRecord(dr *decodedRecord, start *time.Time) (ri *RecordInfo) {
+	rec := dr.rec
+
+	ri = &RecordInfo{
+		Direction:     dr.direction,
+		Offset:        dr.offset,
+		Type:          recordTypeName(rec.Type),
+		RequestId:     rec.RequestId,
+		ContentLength: rec.ContentLength,
+		PaddingLength: rec.PaddingLength,
+	}
+
+	if dr.hasTime && (start != nil) {
+		t := dr.time.Sub(*start).Seconds()
+		ri.Time = &t
+	}
+
+	if (rec.Type == 0) || (rec.Type > dm.FCGI_MAXTYPE) {
+		// A management record of an unknown type is legal, the server must
+		// answer it with the FCGI_UNKNOWN_TYPE record.
+		if rec.RequestId != dm.FCGI_NULL_REQUEST_ID {
+			ri.Violations = append(ri.Violations, "unknown record type of an application record")
+		}
+		return ri
+	}
+
+	if dm.IsManagementRecordType(rec.Type) != (rec.RequestId == dm.FCGI_NULL_REQUEST_ID) {
+		ri.Violations = append(ri.Violations, fmt.Sprintf("unexpected request ID %v", rec.RequestId))
+	}
+
+	if expected, ok := fixedContentLength(rec.Type); ok && (int(rec.ContentLength) != expected) {
+		ri.Violations = append(ri.Violations, fmt.Sprintf("content length must be %v", expected))
+		return ri
+	}
+
+	if (len(dr.direction) > 0) && (typeDirection(rec.Type) != dr.direction) {
+		ri.Violations = append(ri.Violations, fmt.Sprintf("record of the %v is sent by the %v", typeDirection(rec.Type), dr.direction))
+	}
+
+	switch rec.Type {
+	case dm.FCGI_BEGIN_REQUEST:
+		brb, err := dm.NewBeginRequestBodyFromBytes(rec.ContentData)
+		if err != nil {
+			ri.Violations = append(ri.Violations, err.Error())
+			break
+		}
+		ri.Details = fmt.Sprintf("role=%v flags=%v", roleName(brb.Role), brb.Flags)
+
+	case dm.FCGI_END_REQUEST:
+		erb, err := rec.ParseContentAsEndRequestBody()
+		if err != nil {
+			ri.Violations = append(ri.Violations, err.Error())
+			break
+		}
+		ri.Details = fmt.Sprintf("appStatus=%v protocolStatus=%v", erb.AppStatus, protocolStatusName(erb.ProtocolStatus))
+
+	case dm.FCGI_UNKNOWN_TYPE:
+		utrb, err := dm.NewUnknownTypeRequestBodyFromBytes(rec.ContentData)
+		if err != nil {
+			ri.Violations = append(ri.Violations, err.Error())
+			break
+		}
+		ri.Details = fmt.Sprintf("type=%v", utrb.Type)
+
+	case dm.FCGI_GET_VALUES, dm.FCGI_GET_VALUES_RESULT:
+		nvps, err := rec.ParseContentAsNVPs()
+		if err != nil {
+			ri.Violations = append(ri.Violations, fmt.Sprintf("name-value pairs are broken: %v", err))
+			break
+		}
+		ri.Params = newParams(nvps)
+
+	case dm.FCGI_STDIN, dm.FCGI_DATA, dm.FCGI_STDOUT, dm.FCGI_STDERR:
+		if rec.ContentLength == 0 {
+			ri.Details = "end of stream"
+			break
+		}
+		ri.Preview = d.preview(rec.ContentData)
+
+	case dm.FCGI_PARAMS:
+		if rec.ContentLength == 0 {
+			ri.Details = "end of stream"
+		}
+	}
+
+	return ri
+}
+
+// applyRecord changes the state of the request by the record and checks the
+// order of records.
+func (d *decoder) applyRecord(section *Section, dr *decodedRecord, ri *RecordInfo) {
+	rec := dr.rec
+
+	switch rec.Type {
+	case dm.FCGI_BEGIN_REQUEST:
+		brb, err := dm.NewBeginRequestBodyFromBytes(rec.ContentData)
+		if err == nil {
+			section.Role = roleName(brb.Role)
+			section.KeepConn = brb.Flags&dm.FCGI_KEEP_CONN != 0
+		}
+
+	case dm.FCGI_PARAMS, dm.FCGI_STDIN, dm.FCGI_DATA, dm.FCGI_STDOUT, dm.FCGI_STDERR:
+		if section.endedStreams[rec.Type] {
+			ri.Violations = append(ri.Violations, "stream has already ended")
+			return
+		}
+		section.startedStream[rec.Type] = true
+
+		if rec.ContentLength == 0 {
+			section.endedStreams[rec.Type] = true
+		}
+
+		switch rec.Type {
+		case dm.FCGI_PARAMS:
+			section.params.Write(rec.ContentData)
+			if rec.ContentLength == 0 {
+				nvps, err := parseParams(section.params.Bytes())
+				if err != nil {
+					ri.Violations = append(ri.Violations, fmt.Sprintf("parameters are broken: %v", err))
+				}
+				section.Params = newParams(nvps)
+				ri.Params = section.Params
+			}
+		case dm.FCGI_STDIN:
+			section.StdinBytes += len(rec.ContentData)
+		case dm.FCGI_DATA:
+			section.DataBytes += len(rec.ContentData)
+		case dm.FCGI_STDOUT:
+			section.StdoutBytes += len(rec.ContentData)
+		case dm.FCGI_STDERR:
+			section.StderrBytes += len(rec.ContentData)
+		}
+
+	case dm.FCGI_END_REQUEST:
+		section.isEnded = true
+
+		erb, err := rec.ParseContentAsEndRequestBody()
+		if err == nil {
+			section.AppStatus = &erb.AppStatus
+			section.ProtocolStatus = protocolStatusName(erb.ProtocolStatus)
+		}
+
+		// Output streams are closed with empty records before the end of
+		// the request. Stdout may be missing only in a rejected request.
+		if !section.endedStreams[dm.FCGI_STDOUT] && ((err != nil) || (erb.ProtocolStatus == dm.FCGI_REQUEST_COMPLETE)) {
+			ri.Violations = append(ri.Violations, "stdout stream has not ended")
+		}
+		if section.startedStream[dm.FCGI_STDERR] && !section.endedStreams[dm.FCGI_STDERR] {
+			ri.Violations = append(ri.Violations, "stderr stream has not ended")
+		}
+	}
+}
+
+// preview returns the beginning of the data.
+func (d *decoder) preview(ba []byte) (s string) {
+	if len(ba) > d.previewSize {
+		return string(ba[:d.previewSize]) + "..."
+	}
+
+	return string(ba)
+}
+
+// parseParams parses the content of the FCGI_PARAMS stream. A pair may be
+// split between records, so the stream is parsed as a whole.
+func parseParams(ba []byte) (nvps []*nvpair.NameValuePair, err error) {
+	rdr := bytes.NewReader(ba)
+
+	var nvp *nvpair.NameValuePair
+	for rdr.Len() > 0 {
+		nvp, err = nvpair.NewNameValuePairFromStream(rdr)
+		if err != nil {
+			return nvps, err
+		}
+
+		nvps = append(nvps, nvp)
+	}
+
+	return nvps, nil
+}
+
+func newParams(nvps []*nvpair.NameValuePair) (params []*Param) {
+	for _, nvp := range nvps {
+		params = append(params, &Param{Name: string(nvp.Name), Value: string(nvp.Value)})
+	}
+
+	return params
+}
+
+// mergeByTime merges two timelines. Records without time keep their order.
+func mergeByTime(a []*decodedRecord, b []*decodedRecord) (timeline []*decodedRecord) {
+	timeline = make([]*decodedRecord, 0, len(a)+len(b))
+
+	for (len(a) > 0) && (len(b) > 0) {
+		if b[0].time.Before(a[0].time) {
+			timeline = append(timeline, b[0])
+			b = b[1:]
+		} else {
+			timeline = append(timeline, a[0])
+			a = a[1:]
+		}
+	}
+
+	timeline = append(timeline, a...)
+	return append(timeline, b...)
+}
+
+// recordDirection returns the direction of the record. When it is not known,
+// it is guessed by the record type.
+func recordDirection(dr *decodedRecord) (direction string) {
+	if len(dr.direction) > 0 {
+		return dr.direction
+	}
+
+	return typeDirection(dr.rec.Type)
+}
+
+// typeDirection returns the side which sends records of the type.
+func typeDirection(recordType dm.RecordType) (direction string) {
+	switch recordType {
+	case dm.FCGI_BEGIN_REQUEST, dm.FCGI_ABORT_REQUEST, dm.FCGI_PARAMS, dm.FCGI_STDIN, dm.FCGI_DATA, dm.FCGI_GET_VALUES:
+		return DirectionClient
+	case dm.FCGI_STDOUT, dm.FCGI_STDERR, dm.FCGI_END_REQUEST, dm.FCGI_GET_VALUES_RESULT, dm.FCGI_UNKNOWN_TYPE:
+		return DirectionServer
+	default:
+		return ""
+	}
+}
+
+func directionName(direction string) (name string) {
+	if len(direction) == 0 {
+		return "raw"
+	}
+
+	return direction
+}
+
+func fixedContentLength(recordType dm.RecordType) (length int, ok bool) {
+	switch recordType {
+	case dm.FCGI_BEGIN_REQUEST:
+		return dm.BeginRequestBodyLength, true
+	case dm.FCGI_END_REQUEST:
+		return dm.EndRequestBodyLength, true
+	case dm.FCGI_UNKNOWN_TYPE:
+		return dm.UnknownTypeRequestBodyLength, true
+	case dm.FCGI_ABORT_REQUEST:
+		return 0, true
+	default:
+		return 0, false
+	}
+}
+
+func recordTypeName(recordType dm.RecordType) (name string) {
+	switch recordType {
+	case dm.FCGI_BEGIN_REQUEST:
+		return "FCGI_BEGIN_REQUEST"
+	case dm.FCGI_ABORT_REQUEST:
+		return "FCGI_ABORT_REQUEST"
+	case dm.FCGI_END_REQUEST:
+		return "FCGI_END_REQUEST"
+	case dm.FCGI_PARAMS:
+		return "FCGI_PARAMS"
+	case dm.FCGI_STDIN:
+		return "FCGI_STDIN"
+	case dm.FCGI_STDOUT:
+		return "FCGI_STDOUT"
+	case dm.FCGI_STDERR:
+		return "FCGI_STDERR"
+	case dm.FCGI_DATA:
+		return "FCGI_DATA"
+	case dm.FCGI_GET_VALUES:
+		return "FCGI_GET_VALUES"
+	case dm.FCGI_GET_VALUES_RESULT:
+		return "FCGI_GET_VALUES_RESULT"
+	case dm.FCGI_UNKNOWN_TYPE:
+		return "FCGI_UNKNOWN_TYPE"
+	default:
+		return "TYPE_" + strconv.Itoa(int(recordType))
+	}
+}
+
+func roleName(role dm.Role) (name string) {
+	switch role {
+	case dm.FCGI_RESPONDER:
+		return "FCGI_RESPONDER"
+	case dm.FCGI_AUTHORIZER:
+		return "FCGI_AUTHORIZER"
+	case dm.FCGI_FILTER:
+		return "FCGI_FILTER"
+	default:
+		return "ROLE_" + strconv.Itoa(int(role))
+	}
+}
+
+func protocolStatusName(protocolStatus byte) (name string) {
+	switch protocolStatus {
+	case dm.FCGI_REQUEST_COMPLETE:
+		return "FCGI_REQUEST_COMPLETE"
+	case dm.FCGI_CANT_MPX_CONN:
+		return "FCGI_CANT_MPX_CONN"
+	case dm.FCGI_OVERLOADED:
+		return "FCGI_OVERLOADED"
+	case dm.FCGI_UNKNOWN_ROLE:
+		return "FCGI_UNKNOWN_ROLE"
+	default:
+		return "STATUS_" + strconv.Itoa(int(protocolStatus))
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func record(recordType dm.RecordType, requestId uint16, content []byte) []byte {
+	ba, _ := (&dm.Record{
+		Version:       dm.FCGI_VERSION_1,
+		Type:          recordType,
+		RequestId:     requestId,
+		ContentLength: uint16(len(content)),
+		ContentData:   content,
+	}).ToBytes()
+
+	return ba
+}
+
+// clientRecords returns records of a request having a parameter which is
+// split between two records.
+func clientRecords(requestId uint16) []byte {
+	nvp, _ := nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, "/srv/index.php").ToBytes()
+
+	buf := new(bytes.Buffer)
+	buf.Write(rm.NewBeginRequest(requestId, dm.FCGI_RESPONDER, dm.FCGI_KEEP_CONN).ToBytes())
+	buf.Write(record(dm.FCGI_PARAMS, requestId, nvp[:5]))
+	buf.Write(record(dm.FCGI_PARAMS, requestId, nvp[5:]))
+	buf.Write(record(dm.FCGI_PARAMS, requestId, nil))
+	buf.Write(record(dm.FCGI_STDIN, requestId, []byte("a=b")))
+	buf.Write(record(dm.FCGI_STDIN, requestId, nil))
+
+	return buf.Bytes()
+}
+
+func serverRecords(requestId uint16) []byte {
+	buf := new(bytes.Buffer)
+	buf.Write(record(dm.FCGI_STDOUT, requestId, []byte("Content-Type: text/plain\r\n\r\nHello, World!")))
+	buf.Write(record(dm.FCGI_STDERR, requestId, []byte("warning")))
+	buf.Write(record(dm.FCGI_STDERR, requestId, nil))
+	buf.Write(record(dm.FCGI_STDOUT, requestId, nil))
+	buf.Write(rm.NewEndRequest(requestId, 0, dm.FCGI_REQUEST_COMPLETE).ToBytes())
+
+	return buf.Bytes()
+}
+
+func decodeRaw(t *testing.T, input []byte) (conn *Connection) {
+	dump, err := decode(input, &options{previewSize: 16})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dump.Connections) != 1 {
+		t.Fatal(len(dump.Connections))
+	}
+
+	return dump.Connections[0]
+}
+
+func Test_decode_Raw(t *testing.T) {
+	aTest := tester.New(t)
+
+	getValues, _ := rm.NewGetValuesRequest([]*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("FCGI_MAX_CONNS", "")})
+	getValuesBytes, _ := getValues.ToBytes()
+
+	input := append(getValuesBytes, clientRecords(1)...)
+	input = append(input, serverRecords(1)...)
+
+	conn := decodeRaw(t, input)
+	aTest.MustBeEqual(len(conn.Violations), 0)
+	aTest.MustBeEqual(len(conn.Sections), 2)
+
+	management := conn.Sections[0]
+	aTest.MustBeEqual(management.RequestId, uint16(0))
+	aTest.MustBeEqual(management.Records[0].Type, "FCGI_GET_VALUES")
+	aTest.MustBeEqual(management.Records[0].Params, []*Param{{Name: "FCGI_MAX_CONNS", Value: ""}})
+
+	section := conn.Sections[1]
+	aTest.MustBeEqual(section.RequestId, uint16(1))
+	aTest.MustBeEqual(section.Role, "FCGI_RESPONDER")
+	aTest.MustBeEqual(section.KeepConn, true)
+	aTest.MustBeEqual(section.Params, []*Param{{Name: dm.Parameter_ScriptFilename, Value: "/srv/index.php"}})
+	aTest.MustBeEqual(section.StdinBytes, 3)
+	aTest.MustBeEqual(section.StdoutBytes, 41)
+	aTest.MustBeEqual(section.StderrBytes, 7)
+	aTest.MustBeEqual(*section.AppStatus, uint32(0))
+	aTest.MustBeEqual(section.ProtocolStatus, "FCGI_REQUEST_COMPLETE")
+	aTest.MustBeEqual(len(section.Records), 11)
+	aTest.MustBeEqual(len(section.Violations), 0)
+
+	stdout := section.Records[6]
+	aTest.MustBeEqual(stdout.Type, "FCGI_STDOUT")
+	aTest.MustBeEqual(stdout.Preview, "Content-Type: te...")
+	aTest.MustBeEqual(stdout.Direction, "")
+	aTest.MustBeEqual(stdout.Time == nil, true)
+
+	for _, ri := range section.Records {
+		aTest.MustBeEqual(len(ri.Violations), 0)
+	}
+
+	// Text output.
+	buf := new(bytes.Buffer)
+	aTest.MustBeNoError(printText(buf, &Dump{Connections: []*Connection{conn}}))
+	text := buf.String()
+	aTest.MustBeEqual(strings.HasPrefix(text, "Stream\n\nManagement records\n  @0       FCGI_GET_VALUES        len=16 id=0\n      FCGI_MAX_CONNS=\n"), true)
+	aTest.MustBeEqual(strings.Contains(text, "\nRequest 1 (FCGI_RESPONDER, keep connection)\n"), true)
+	aTest.MustBeEqual(strings.Contains(text, "      SCRIPT_FILENAME=/srv/index.php\n"), true)
+	aTest.MustBeEqual(strings.Contains(text, ` "Content-Type: te..."`), true)
+	aTest.MustBeEqual(strings.Contains(text, "  Summary: stdin 3 B, data 0 B, stdout 41 B, stderr 7 B, app status 0, FCGI_REQUEST_COMPLETE\n"), true)
+}
+
+func Test_decode_Violations(t *testing.T) {
+	aTest := tester.New(t)
+
+	input := clientRecords(1)
+	input = append(input, rm.NewBeginRequest(1, dm.FCGI_RESPONDER, 0).ToBytes()...)
+	input = append(input, record(dm.FCGI_STDIN, 1, nil)...)
+	input = append(input, record(dm.FCGI_STDIN, 1, []byte("x"))...)
+	input = append(input, record(dm.FCGI_ABORT_REQUEST, 1, []byte("x"))...)
+	input = append(input, record(dm.FCGI_STDOUT, 1, []byte("x"))...)
+	input = append(input, rm.NewEndRequest(1, 0, dm.FCGI_REQUEST_COMPLETE).ToBytes()...)
+	input = append(input, record(dm.FCGI_STDOUT, 2, []byte("x"))...)
+	input = append(input, record(dm.FCGI_BEGIN_REQUEST, 0, make([]byte, 8))...)
+	input = append(input, rm.NewBeginRequest(3, dm.FCGI_RESPONDER, 0).ToBytes()...)
+	input = append(input, record(dm.FCGI_PARAMS, 3, []byte{0x80})...)
+	input = append(input, record(dm.FCGI_PARAMS, 3, nil)...)
+	input = append(input, rm.NewEndRequest(3, 0, dm.FCGI_UNKNOWN_ROLE).ToBytes()...)
+	input = append(input, []byte{dm.FCGI_VERSION_1, dm.FCGI_STDOUT, 0, 3, 0, 10, 0, 0, 'x'}...)
+
+	conn := decodeRaw(t, input)
+	aTest.MustBeEqual(len(conn.Violations), 1)
+	aTest.MustBeEqual(conn.Violations[0], fmt.Sprintf("raw stream: record error at offset %v (content data): truncated record", len(input)))
+
+	violations := make(map[string][]string)
+	for _, section := range conn.Sections {
+		for _, ri := range section.Records {
+			violations[ri.Type] = append(violations[ri.Type], ri.Violations...)
+		}
+		for _, v := range section.Violations {
+			violations["section"] = append(violations["section"], v)
+		}
+	}
+
+	aTest.MustBeEqual(violations["FCGI_BEGIN_REQUEST"], []string{"unexpected request ID 0", "request ID is already active"})
+	aTest.MustBeEqual(violations["FCGI_STDIN"], []string{"stream has already ended"})
+	aTest.MustBeEqual(violations["FCGI_ABORT_REQUEST"], []string{"content length must be 0"})
+	aTest.MustBeEqual(violations["FCGI_STDOUT"], []string{"record of an inactive request"})
+	aTest.MustBeEqual(violations["FCGI_END_REQUEST"], []string{"stdout stream has not ended"})
+	aTest.MustBeEqual(len(violations["FCGI_PARAMS"]), 1)
+	aTest.MustBeEqual(strings.HasPrefix(violations["FCGI_PARAMS"][0], "parameters are broken: "), true)
+	aTest.MustBeEqual(violations["section"], []string{"request has not ended"})
+}
+
+func Test_decode_OneSide(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Responses alone do not break the protocol.
+	conn := decodeRaw(t, serverRecords(1))
+	aTest.MustBeEqual(len(conn.Sections), 1)
+	for _, ri := range conn.Sections[0].Records {
+		aTest.MustBeEqual(len(ri.Violations), 0)
+	}
+
+	// Requests alone are not expected to end.
+	conn = decodeRaw(t, clientRecords(1))
+	aTest.MustBeEqual(len(conn.Sections), 1)
+	aTest.MustBeEqual(len(conn.Sections[0].Violations), 0)
+
+	// A request without the end.
+	conn = decodeRaw(t, append(clientRecords(1), record(dm.FCGI_STDOUT, 1, []byte("x"))...))
+	aTest.MustBeEqual(conn.Sections[0].Violations, []string{"request has not ended"})
+}
@@ -0,0 +1,332 @@
+// Fcgi-dump decodes captured FastCGI traffic into a readable timeline of
+// records.
+//
+// The input is either a raw byte stream, e.g. written by 'strace -e
+// write=...' or copied from a Unix socket, or a capture file of the pcap
+// format written by 'tcpdump -w'. In a capture, both directions of every TCP
+// connection are decoded and merged by time.
+//
+// Usage examples:
+//
+//	fcgi-dump stream.bin
+//	tcpdump -i lo -w fpm.pcap port 9000
+//	fcgi-dump -port 9000 -preview 120 fpm.pcap
+//	fcgi-dump -output json fpm.pcap | jq '.connections[].sections[].violations'
+//
+// Records are grouped into sections, one section per request. Parameters are
+// decoded, stream data is shown by a short preview, and records breaking the
+// protocol are flagged. The tool exits with code 1 when the input can not be
+// read and with code 2 when the arguments are wrong.
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	ExitCodeOk      = 0
+	ExitCodeFailure = 1
+	ExitCodeUsage   = 2
+)
+
+// Output modes.
+const (
+	OutputText = "text"
+	OutputJson = "json"
+)
+
+const (
+	// StdinFileName is the file name which means the standard input.
+	StdinFileName = "-"
+
+	PreviewSizeDefault = 64
+)
+
+const (
+	ErrFileIsNotSet    = "file is not set"
+	ErrOutputIsUnknown = "output mode is unknown: %v"
+	ErrPortIsWrong     = "port is wrong: %v"
+)
+
+type options struct {
+	filePath    string
+	port        uint16
+	previewSize int
+	output      string
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (exitCode int) {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitCodeOk
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeUsage
+	}
+
+	var input []byte
+	if opts.filePath == StdinFileName {
+		input, err = io.ReadAll(stdin)
+	} else {
+		input, err = os.ReadFile(opts.filePath)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeFailure
+	}
+
+	var dump *Dump
+	dump, err = decode(input, opts)
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeFailure
+	}
+
+	if opts.output == OutputJson {
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "\t")
+		err = enc.Encode(dump)
+	} else {
+		err = printText(stdout, dump)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeFailure
+	}
+
+	return ExitCodeOk
+}
+
+func parseArgs(args []string, stderr io.Writer) (opts *options, err error) {
+	fs := flag.NewFlagSet("fcgi-dump", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		_, _ = fmt.Fprintln(stderr, "Usage: fcgi-dump [flags] file\n\nThe file is a raw byte stream or a pcap capture; '-' means the standard input.")
+		fs.PrintDefaults()
+	}
+
+	opts = &options{}
+	var port uint
+
+	fs.UintVar(&port, "port", 0, "port of the FastCGI server in a capture; zero means all the TCP connections")
+	fs.IntVar(&opts.previewSize, "preview", PreviewSizeDefault, "maximum size of previews of stream data")
+	fs.StringVar(&opts.output, "output", OutputText, "output mode: text or json")
+
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+
+	if fs.NArg() != 1 {
+		return nil, errors.New(ErrFileIsNotSet)
+	}
+	opts.filePath = fs.Arg(0)
+
+	if port > 0xffff {
+		return nil, fmt.Errorf(ErrPortIsWrong, port)
+	}
+	opts.port = uint16(port)
+
+	if opts.previewSize < 0 {
+		opts.previewSize = 0
+	}
+
+	switch opts.output {
+	case OutputText, OutputJson:
+	default:
+		return nil, fmt.Errorf(ErrOutputIsUnknown, opts.output)
+	}
+
+	return opts, nil
+}
+
+// decode decodes a capture file or a raw stream.
+func decode(input []byte, opts *options) (dump *Dump, err error) {
+	d := &decoder{previewSize: opts.previewSize}
+	dump = &Dump{Connections: []*Connection{}}
+
+	if !IsPcap(input) {
+		conn := &Connection{Sections: []*Section{}}
+		d.decodeConnection(conn, &stream{data: input})
+		dump.Connections = append(dump.Connections, conn)
+		return dump, nil
+	}
+
+	var flows []*tcpFlow
+	var violation string
+	flows, violation, err = readPcap(bytes.NewReader(input), opts.port)
+	if err != nil {
+		return nil, err
+	}
+	if len(violation) > 0 {
+		dump.Violations = append(dump.Violations, violation)
+	}
+
+	for _, flow := range flows {
+		client, server := flow.sides[0], flow.sides[1]
+
+		conn := &Connection{Sections: []*Section{}}
+		if client.source.IsValid() {
+			conn.Client = client.source.String()
+		}
+		if server.source.IsValid() {
+			conn.Server = server.source.String()
+		}
+
+		d.decodeConnection(conn, client.reassemble(DirectionClient), server.reassemble(DirectionServer))
+		dump.Connections = append(dump.Connections, conn)
+	}
+
+	return dump, nil
+}
+
+func printText(w io.Writer, dump *Dump) (err error) {
+	p := &textPrinter{w: w}
+
+	for _, v := range dump.Violations {
+		p.printf("! %v\n", v)
+	}
+
+	for i, conn := range dump.Connections {
+		if (i > 0) || (len(dump.Violations) > 0) {
+			p.printf("\n")
+		}
+
+		switch {
+		case (len(conn.Client) > 0) || (len(conn.Server) > 0):
+			p.printf("Connection %v -> %v", orUnknown(conn.Client), orUnknown(conn.Server))
+		default:
+			p.printf("Stream")
+		}
+		if conn.Start != nil {
+			p.printf(", started at %v", conn.Start.Format(time.RFC3339Nano))
+		}
+		p.printf("\n")
+
+		for _, v := range conn.Violations {
+			p.printf("  ! %v\n", v)
+		}
+
+		for _, section := range conn.Sections {
+			p.printSection(section)
+		}
+	}
+
+	return p.err
+}
+
+// textPrinter remembers the first error of writing.
+type textPrinter struct {
+	w   io.Writer
+	err error
+}
+
+func (p *textPrinter) printf(format string, a ...any) {
+	if p.err != nil {
+		return
+	}
+
+	_, p.err = fmt.Fprintf(p.w, format, a...)
+}
+
+func (p *textPrinter) printSection(section *Section) {
+	p.printf("\n")
+	if section.RequestId == 0 {
+		p.printf("Management records\n")
+	} else {
+		p.printf("Request %v", section.RequestId)
+		if len(section.Role) > 0 {
+			p.printf(" (%v", section.Role)
+			if section.KeepConn {
+				p.printf(", keep connection")
+			}
+			p.printf(")")
+		}
+		p.printf("\n")
+	}
+
+	for _, ri := range section.Records {
+		p.printRecord(ri)
+	}
+
+	if section.RequestId != 0 {
+		p.printf("  Summary: stdin %v B, data %v B, stdout %v B, stderr %v B",
+			section.StdinBytes, section.DataBytes, section.StdoutBytes, section.StderrBytes)
+		if section.AppStatus != nil {
+			p.printf(", app status %v, %v", *section.AppStatus, section.ProtocolStatus)
+		}
+		p.printf("\n")
+	}
+
+	for _, v := range section.Violations {
+		p.printf("  ! %v\n", v)
+	}
+}
+
+func (p *textPrinter) printRecord(ri *RecordInfo) {
+	p.printf("  ")
+	if ri.Time != nil {
+		p.printf("%10.6f ", *ri.Time)
+	}
+
+	switch ri.Direction {
+	case DirectionClient:
+		p.printf("> ")
+	case DirectionServer:
+		p.printf("< ")
+	}
+
+	p.printf("@%-7v %-22v len=%v", ri.Offset, ri.Type, ri.ContentLength)
+	if ri.RequestId == 0 {
+		p.printf(" id=0")
+	}
+	if ri.PaddingLength > 0 {
+		p.printf(" pad=%v", ri.PaddingLength)
+	}
+	if len(ri.Details) > 0 {
+		p.printf(" %v", ri.Details)
+	}
+	if len(ri.Preview) > 0 {
+		p.printf(" %v", strconv.Quote(ri.Preview))
+	}
+	p.printf("\n")
+
+	for _, param := range ri.Params {
+		p.printf("      %v=%v\n", param.Name, quoteIfNeeded(param.Value))
+	}
+
+	for _, v := range ri.Violations {
+		p.printf("      ! %v\n", v)
+	}
+}
+
+// quoteIfNeeded quotes the value when it has special characters.
+func quoteIfNeeded(s string) string {
+	q := strconv.Quote(s)
+	if q[1:len(q)-1] == s {
+		return s
+	}
+
+	return q
+}
+
+func orUnknown(s string) string {
+	if len(s) == 0 {
+		return "?"
+	}
+
+	return s
+}
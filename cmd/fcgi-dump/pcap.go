@@ -0,0 +1,451 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"time"
+)
+
+// Magic numbers of capture files.
+const (
+	PcapMagicMicroseconds = 0xa1b2c3d4
+	PcapMagicNanoseconds  = 0xa1b23c4d
+	PcapngMagic           = 0x0a0d0d0a
+)
+
+// Link types of the pcap format.
+const (
+	LinkTypeNull     = 0
+	LinkTypeEthernet = 1
+	LinkTypeRaw      = 101
+	LinkTypeRawAlt   = 12
+	LinkTypeLinuxSll = 113
+	LinkTypeIpv4     = 228
+	LinkTypeIpv6     = 229
+	LinkTypeLoop     = 108
+	LinkTypeSll2     = 276
+)
+
+const (
+	pcapHeaderLength       = 24
+	pcapRecordHeaderLength = 16
+
+	etherTypeIpv4 = 0x0800
+	etherTypeIpv6 = 0x86dd
+	etherTypeVlan = 0x8100
+
+	ipProtocolTcp = 6
+
+	tcpFlagFin = 0x01
+	tcpFlagSyn = 0x02
+	tcpFlagRst = 0x04
+	tcpFlagAck = 0x10
+)
+
+const (
+	ErrPcapngIsNotSupported = "pcapng format is not supported, convert the file with 'editcap -F pcap'"
+	ErrPcapMagic            = "file is not a pcap file"
+	ErrLinkTypeIsUnknown    = "link type is not supported: %v"
+	ErrPcapRecordIsTooLong  = "pcap record is longer than the snapshot length: %v > %v"
+)
+
+// IsPcap tells whether the data starts with a magic number of a capture file.
+func IsPcap(header []byte) bool {
+	if len(header) < 4 {
+		return false
+	}
+
+	for _, order := range []binary.ByteOrder{binary.LittleEndian, binary.BigEndian} {
+		switch order.Uint32(header) {
+		case PcapMagicMicroseconds, PcapMagicNanoseconds, PcapngMagic:
+			return true
+		}
+	}
+
+	return false
+}
+
+// segment is a TCP segment of a direction.
+type segment struct {
+	seq     uint32
+	payload []byte
+	time    time.Time
+}
+
+// halfFlow is a single direction of a TCP connection.
+type halfFlow struct {
+	source      netip.AddrPort
+	isSynSeen   bool
+	isn         uint32
+	segments    []*segment
+	isTruncated bool
+}
+
+// tcpFlow is a TCP connection. After reading, the first side is the client.
+type tcpFlow struct {
+	sides    [2]*halfFlow
+	isClosed bool
+
+	// The side which has sent SYN without ACK.
+	client *halfFlow
+}
+
+func (f *tcpFlow) side(source netip.AddrPort) (hf *halfFlow) {
+	for _, hf = range f.sides {
+		if (hf != nil) && (hf.source == source) {
+			return hf
+		}
+	}
+
+	hf = &halfFlow{source: source}
+	if f.sides[0] == nil {
+		f.sides[0] = hf
+	} else {
+		f.sides[1] = hf
+	}
+
+	return hf
+}
+
+// packet is a decoded TCP packet.
+type packet struct {
+	time        time.Time
+	source      netip.AddrPort
+	destination netip.AddrPort
+	seq         uint32
+	flags       byte
+	payload     []byte
+	isTruncated bool
+}
+
+// readPcap reads TCP connections from the capture. When the port is not zero,
+// only connections having the port are read. A capture whose last record is
+// truncated, e.g. because the capture has been interrupted, is read up to that
+// record, and the truncation is returned as a violation.
+func readPcap(r io.Reader, port uint16) (flows []*tcpFlow, violation string, err error) {
+	header := make([]byte, pcapHeaderLength)
+	_, err = io.ReadFull(r, header)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var order binary.ByteOrder
+	var isNano bool
+	switch {
+	case binary.LittleEndian.Uint32(header) == PcapngMagic:
+		return nil, "", errors.New(ErrPcapngIsNotSupported)
+	case binary.LittleEndian.Uint32(header) == PcapMagicMicroseconds:
+		order = binary.LittleEndian
+	case binary.LittleEndian.Uint32(header) == PcapMagicNanoseconds:
+		order, isNano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header) == PcapMagicMicroseconds:
+		order = binary.BigEndian
+	case binary.BigEndian.Uint32(header) == PcapMagicNanoseconds:
+		order, isNano = binary.BigEndian, true
+	default:
+		return nil, "", errors.New(ErrPcapMagic)
+	}
+
+	// Some writers set the snapshot length to zero, it is not checked then.
+	snapLen := order.Uint32(header[16:])
+	linkType := order.Uint32(header[20:]) & 0x0fffffff
+
+	active := make(map[[2]netip.AddrPort]*tcpFlow)
+	recHeader := make([]byte, pcapRecordHeaderLength)
+	for {
+		var n int
+		n, err = io.ReadFull(r, recHeader)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			violation = fmt.Sprintf("capture is truncated: %v of %v bytes of the last record header are read", n, pcapRecordHeaderLength)
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+
+		sec := int64(order.Uint32(recHeader))
+		frac := int64(order.Uint32(recHeader[4:]))
+		inclLen := order.Uint32(recHeader[8:])
+		origLen := order.Uint32(recHeader[12:])
+
+		if !isNano {
+			frac *= int64(time.Microsecond)
+		}
+
+		if (snapLen > 0) && (inclLen > snapLen) {
+			return nil, "", fmt.Errorf(ErrPcapRecordIsTooLong, inclLen, snapLen)
+		}
+
+		// The length is not trusted, so the buffer grows with the data read.
+		var data []byte
+		data, err = io.ReadAll(io.LimitReader(r, int64(inclLen)))
+		if err != nil {
+			return nil, "", err
+		}
+		if len(data) < int(inclLen) {
+			violation = fmt.Sprintf("capture is truncated: %v of %v bytes of the last record are read", len(data), inclLen)
+			break
+		}
+
+		var p *packet
+		p, err = decodeLink(linkType, data)
+		if err != nil {
+			return nil, "", err
+		}
+		if p == nil {
+			continue
+		}
+		if (port != 0) && (p.source.Port() != port) && (p.destination.Port() != port) {
+			continue
+		}
+
+		p.time = time.Unix(sec, frac).UTC()
+		p.isTruncated = p.isTruncated || (inclLen < origLen)
+
+		key := flowKey(p.source, p.destination)
+		flow := active[key]
+		isNewSyn := (p.flags&tcpFlagSyn != 0) && (p.flags&tcpFlagAck == 0)
+		if (flow == nil) || (flow.isClosed && isNewSyn) {
+			flow = &tcpFlow{}
+			active[key] = flow
+			flows = append(flows, flow)
+		}
+
+		hf := flow.side(p.source)
+		if p.flags&tcpFlagSyn != 0 {
+			hf.isSynSeen = true
+			hf.isn = p.seq + 1
+			if isNewSyn {
+				flow.client = hf
+			}
+		}
+		if p.flags&(tcpFlagFin|tcpFlagRst) != 0 {
+			flow.isClosed = true
+		}
+
+		hf.isTruncated = hf.isTruncated || p.isTruncated
+		if len(p.payload) > 0 {
+			seq := p.seq
+			if p.flags&tcpFlagSyn != 0 {
+				seq++
+			}
+			hf.segments = append(hf.segments, &segment{seq: seq, payload: p.payload, time: p.time})
+		}
+	}
+
+	for _, flow := range flows {
+		flow.orderSides(port)
+	}
+
+	return flows, violation, nil
+}
+
+// orderSides puts the client first. The client is the side which has sent
+// SYN. Otherwise, the server is the side using the port, or the side having
+// the lower port.
+func (f *tcpFlow) orderSides(port uint16) {
+	if f.sides[1] == nil {
+		f.sides[1] = &halfFlow{}
+	}
+
+	var isSwapped bool
+	switch {
+	case f.client != nil:
+		isSwapped = f.client == f.sides[1]
+	case port != 0:
+		isSwapped = f.sides[0].source.Port() == port
+	case f.sides[1].source.IsValid():
+		isSwapped = f.sides[0].source.Port() < f.sides[1].source.Port()
+	}
+
+	if isSwapped {
+		f.sides[0], f.sides[1] = f.sides[1], f.sides[0]
+	}
+}
+
+// reassemble builds the byte stream of the direction. A gap in the data ends
+// the stream.
+func (hf *halfFlow) reassemble(direction string) (s *stream) {
+	s = &stream{direction: direction}
+	if len(hf.segments) == 0 {
+		return s
+	}
+
+	// Sequence numbers are compared relatively to the base, which allows
+	// them to wrap around.
+	base := hf.isn
+	if !hf.isSynSeen {
+		base = hf.segments[0].seq
+		for _, seg := range hf.segments {
+			if int32(seg.seq-base) < 0 {
+				base = seg.seq
+			}
+		}
+	}
+
+	segments := make([]*segment, len(hf.segments))
+	copy(segments, hf.segments)
+	sort.SliceStable(segments, func(i, j int) bool {
+		return int32(segments[i].seq-base) < int32(segments[j].seq-base)
+	})
+
+	var cursor int64
+	for _, seg := range segments {
+		start := int64(int32(seg.seq - base))
+		end := start + int64(len(seg.payload))
+
+		// Retransmission.
+		if end <= cursor {
+			continue
+		}
+
+		if start > cursor {
+			s.violation = fmt.Sprintf("%v bytes are missing in the capture at offset %v", start-cursor, cursor)
+			break
+		}
+
+		s.pieces = append(s.pieces, piece{offset: cursor, time: seg.time})
+		s.data = append(s.data, seg.payload[cursor-start:]...)
+		cursor = end
+	}
+
+	if hf.isTruncated && (len(s.violation) == 0) {
+		s.violation = "packets are truncated by the capture"
+	}
+
+	return s
+}
+
+func flowKey(a netip.AddrPort, b netip.AddrPort) (key [2]netip.AddrPort) {
+	if a.Compare(b) < 0 {
+		return [2]netip.AddrPort{a, b}
+	}
+
+	return [2]netip.AddrPort{b, a}
+}
+
+// decodeLink decodes a TCP packet of the link layer. Other packets are
+// skipped with the nil result.
+func decodeLink(linkType uint32, data []byte) (p *packet, err error) {
+	switch linkType {
+	case LinkTypeEthernet:
+		if len(data) < 14 {
+			return nil, nil
+		}
+		etherType := binary.BigEndian.Uint16(data[12:])
+		data = data[14:]
+		for (etherType == etherTypeVlan) && (len(data) >= 4) {
+			etherType = binary.BigEndian.Uint16(data[2:])
+			data = data[4:]
+		}
+		return decodeIp(etherType, data), nil
+
+	case LinkTypeLinuxSll:
+		if len(data) < 16 {
+			return nil, nil
+		}
+		return decodeIp(binary.BigEndian.Uint16(data[14:]), data[16:]), nil
+
+	case LinkTypeSll2:
+		if len(data) < 20 {
+			return nil, nil
+		}
+		return decodeIp(binary.BigEndian.Uint16(data), data[20:]), nil
+
+	case LinkTypeNull, LinkTypeLoop:
+		if len(data) < 4 {
+			return nil, nil
+		}
+		// Address family is written in the byte order of the host, or in
+		// the network order for the loop type. IPv6 has several values.
+		family := binary.LittleEndian.Uint32(data)
+		if (linkType == LinkTypeLoop) || (family > 0xffff) {
+			family = binary.BigEndian.Uint32(data)
+		}
+		if family == 2 {
+			return decodeIp(etherTypeIpv4, data[4:]), nil
+		}
+		return decodeIp(etherTypeIpv6, data[4:]), nil
+
+	case LinkTypeRaw, LinkTypeRawAlt, LinkTypeIpv4, LinkTypeIpv6:
+		if len(data) == 0 {
+			return nil, nil
+		}
+		if data[0]>>4 == 4 {
+			return decodeIp(etherTypeIpv4, data), nil
+		}
+		return decodeIp(etherTypeIpv6, data), nil
+
+	default:
+		return nil, fmt.Errorf(ErrLinkTypeIsUnknown, linkType)
+	}
+}
+
+func decodeIp(etherType uint16, data []byte) (p *packet) {
+	var src, dst netip.Addr
+	var payload []byte
+	isTruncated := false
+
+	switch etherType {
+	case etherTypeIpv4:
+		if (len(data) < 20) || (data[0]>>4 != 4) {
+			return nil
+		}
+		headerLength := int(data[0]&0x0f) * 4
+		totalLength := int(binary.BigEndian.Uint16(data[2:]))
+		fragment := binary.BigEndian.Uint16(data[6:])
+		if (data[9] != ipProtocolTcp) || (fragment&0x3fff != 0) || (headerLength < 20) {
+			return nil
+		}
+		if totalLength > len(data) {
+			isTruncated = true
+			totalLength = len(data)
+		}
+		if headerLength > totalLength {
+			return nil
+		}
+		src = netip.AddrFrom4([4]byte(data[12:16]))
+		dst = netip.AddrFrom4([4]byte(data[16:20]))
+		payload = data[headerLength:totalLength]
+
+	case etherTypeIpv6:
+		if (len(data) < 40) || (data[0]>>4 != 6) || (data[6] != ipProtocolTcp) {
+			return nil
+		}
+		payloadLength := int(binary.BigEndian.Uint16(data[4:]))
+		if 40+payloadLength > len(data) {
+			isTruncated = true
+			payloadLength = len(data) - 40
+		}
+		src = netip.AddrFrom16([16]byte(data[8:24]))
+		dst = netip.AddrFrom16([16]byte(data[24:40]))
+		payload = data[40 : 40+payloadLength]
+
+	default:
+		return nil
+	}
+
+	if len(payload) < 20 {
+		return nil
+	}
+	dataOffset := int(payload[12]>>4) * 4
+	if (dataOffset < 20) || (dataOffset > len(payload)) {
+		return nil
+	}
+
+	return &packet{
+		source:      netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload)),
+		destination: netip.AddrPortFrom(dst, binary.BigEndian.Uint16(payload[2:])),
+		seq:         binary.BigEndian.Uint32(payload[4:]),
+		flags:       payload[13],
+		payload:     payload[dataOffset:],
+		isTruncated: isTruncated,
+	}
+}
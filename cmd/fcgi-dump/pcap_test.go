@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// capture writes a pcap file of Ethernet frames.
+type capture struct {
+	buf  bytes.Buffer
+	usec uint32
+}
+
+func newCapture() (c *capture) {
+	c = &capture{}
+	header := make([]byte, pcapHeaderLength)
+	binary.LittleEndian.PutUint32(header, PcapMagicMicroseconds)
+	binary.LittleEndian.PutUint16(header[4:], 2)
+	binary.LittleEndian.PutUint16(header[6:], 4)
+	binary.LittleEndian.PutUint32(header[16:], 65535)
+	binary.LittleEndian.PutUint32(header[20:], LinkTypeEthernet)
+	c.buf.Write(header)
+	return c
+}
+
+// packet writes a TCP packet, each packet is a millisecond later than the
+// previous one.
+func (c *capture) packet(src netip.AddrPort, dst netip.AddrPort, seq uint32, flags byte, payload []byte) {
+	tcp := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(tcp, src.Port())
+	binary.BigEndian.PutUint16(tcp[2:], dst.Port())
+	binary.BigEndian.PutUint32(tcp[4:], seq)
+	tcp[12] = 5 << 4
+	tcp[13] = flags
+	tcp = append(tcp, payload...)
+
+	ip := make([]byte, 20, 20+len(tcp))
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:], uint16(20+len(tcp)))
+	ip[8] = 64
+	ip[9] = ipProtocolTcp
+	copy(ip[12:], src.Addr().AsSlice())
+	copy(ip[16:], dst.Addr().AsSlice())
+	ip = append(ip, tcp...)
+
+	frame := make([]byte, 14, 14+len(ip))
+	binary.BigEndian.PutUint16(frame[12:], etherTypeIpv4)
+	frame = append(frame, ip...)
+
+	c.usec += 1000
+	recHeader := make([]byte, pcapRecordHeaderLength)
+	binary.LittleEndian.PutUint32(recHeader, 1_700_000_000)
+	binary.LittleEndian.PutUint32(recHeader[4:], c.usec)
+	binary.LittleEndian.PutUint32(recHeader[8:], uint32(len(frame)))
+	binary.LittleEndian.PutUint32(recHeader[12:], uint32(len(frame)))
+	c.buf.Write(recHeader)
+	c.buf.Write(frame)
+}
+
+var (
+	clientAddr = netip.MustParseAddrPort("10.0.0.1:40000")
+	serverAddr = netip.MustParseAddrPort("10.0.0.2:9000")
+)
+
+func Test_decode_Pcap(t *testing.T) {
+	aTest := tester.New(t)
+
+	request := clientRecords(1)
+	response := serverRecords(1)
+	var clientIsn, serverIsn uint32 = 0xfffffff0, 1000
+
+	c := newCapture()
+	c.packet(clientAddr, serverAddr, clientIsn, tcpFlagSyn, nil)
+	c.packet(serverAddr, clientAddr, serverIsn, tcpFlagSyn|tcpFlagAck, nil)
+	// The request is split, reordered and retransmitted. Sequence numbers
+	// wrap around.
+	c.packet(clientAddr, serverAddr, clientIsn+1+20, tcpFlagAck, request[20:])
+	c.packet(clientAddr, serverAddr, clientIsn+1, tcpFlagAck, request[:20])
+	c.packet(clientAddr, serverAddr, clientIsn+1, tcpFlagAck, request[:30])
+	c.packet(serverAddr, clientAddr, serverIsn+1, tcpFlagAck, response)
+	c.packet(serverAddr, clientAddr, serverIsn+1+uint32(len(response)), tcpFlagFin|tcpFlagAck, nil)
+
+	// Another connection is filtered out by the port.
+	c.packet(netip.MustParseAddrPort("10.0.0.1:40001"), netip.MustParseAddrPort("10.0.0.3:80"), 1, tcpFlagSyn, nil)
+
+	dump, err := decode(c.buf.Bytes(), &options{port: 9000})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(len(dump.Connections), 1)
+
+	conn := dump.Connections[0]
+	aTest.MustBeEqual(conn.Client, "10.0.0.1:40000")
+	aTest.MustBeEqual(conn.Server, "10.0.0.2:9000")
+	aTest.MustBeEqual(conn.Start.UnixMicro(), int64(1_700_000_000_004_000))
+	aTest.MustBeEqual(len(conn.Violations), 0)
+	aTest.MustBeEqual(len(conn.Sections), 1)
+
+	section := conn.Sections[0]
+	aTest.MustBeEqual(section.Params, []*Param{{Name: "SCRIPT_FILENAME", Value: "/srv/index.php"}})
+	aTest.MustBeEqual(section.ProtocolStatus, "FCGI_REQUEST_COMPLETE")
+	aTest.MustBeEqual(len(section.Violations), 0)
+	aTest.MustBeEqual(len(section.Records), 11)
+
+	// Requests go first, as they have been sent earlier.
+	var directions string
+	for _, ri := range section.Records {
+		aTest.MustBeEqual(len(ri.Violations), 0)
+		if ri.Direction == DirectionClient {
+			directions += ">"
+		} else {
+			directions += "<"
+		}
+	}
+	aTest.MustBeEqual(directions, ">>>>>><<<<<")
+
+	// Times are counted from the first record.
+	aTest.MustBeEqual(*section.Records[0].Time, 0.0)
+	aTest.MustBeEqual(*section.Records[6].Time, 0.002)
+}
+
+func Test_decode_PcapGap(t *testing.T) {
+	aTest := tester.New(t)
+
+	request := clientRecords(1)
+
+	// No handshake, the server side is not seen.
+	c := newCapture()
+	c.packet(clientAddr, serverAddr, 500, tcpFlagAck, request[:16])
+	c.packet(clientAddr, serverAddr, 500+24, tcpFlagAck, request[24:])
+
+	dump, err := decode(c.buf.Bytes(), &options{})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(len(dump.Connections), 1)
+
+	conn := dump.Connections[0]
+	aTest.MustBeEqual(conn.Client, "10.0.0.1:40000")
+	aTest.MustBeEqual(conn.Server, "")
+	aTest.MustBeEqual(conn.Violations, []string{"client stream: 8 bytes are missing in the capture at offset 16"})
+	aTest.MustBeEqual(len(conn.Sections), 1)
+	aTest.MustBeEqual(len(conn.Sections[0].Records), 1)
+}
+
+func Test_readPcap_Errors(t *testing.T) {
+	aTest := tester.New(t)
+
+	header := make([]byte, pcapHeaderLength)
+	binary.LittleEndian.PutUint32(header, PcapngMagic)
+	aTest.MustBeEqual(IsPcap(header), true)
+	_, _, err := readPcap(bytes.NewReader(header), 0)
+	aTest.MustBeEqual(err.Error(), ErrPcapngIsNotSupported)
+
+	binary.LittleEndian.PutUint32(header, PcapMagicNanoseconds)
+	binary.LittleEndian.PutUint32(header[20:], 147)
+	_, _, err = readPcap(bytes.NewReader(append(header, make([]byte, pcapRecordHeaderLength)...)), 0)
+	aTest.MustBeEqual(err.Error(), "link type is not supported: 147")
+
+	c := newCapture()
+	c.packet(clientAddr, serverAddr, 1, tcpFlagSyn, nil)
+	capture := c.buf.Bytes()
+	binary.LittleEndian.PutUint32(capture[pcapHeaderLength+8:], 0xffffffff)
+	_, _, err = readPcap(bytes.NewReader(capture), 0)
+	aTest.MustBeEqual(err.Error(), "pcap record is longer than the snapshot length: 4294967295 > 65535")
+
+	aTest.MustBeEqual(IsPcap([]byte{1, 1, 0, 1}), false)
+}
+
+func Test_decode_PcapTruncated(t *testing.T) {
+	aTest := tester.New(t)
+
+	request := clientRecords(1)
+
+	c := newCapture()
+	c.packet(clientAddr, serverAddr, 1, tcpFlagSyn, nil)
+	c.packet(clientAddr, serverAddr, 2, tcpFlagAck, request)
+	c.packet(serverAddr, clientAddr, 1000, tcpFlagSyn|tcpFlagAck, nil)
+	capture := c.buf.Bytes()
+
+	// The capture is interrupted in the data of the last record.
+	flows, violation, err := readPcap(bytes.NewReader(capture[:len(capture)-10]), 0)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(len(flows), 1)
+	aTest.MustBeEqual(violation, "capture is truncated: 44 of 54 bytes of the last record are read")
+
+	dump, err := decode(capture[:len(capture)-10], &options{})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(dump.Violations, []string{"capture is truncated: 44 of 54 bytes of the last record are read"})
+	aTest.MustBeEqual(len(dump.Connections), 1)
+	aTest.MustBeEqual(dump.Connections[0].Client, "10.0.0.1:40000")
+	aTest.MustBeEqual(len(dump.Connections[0].Sections), 1)
+	aTest.MustBeEqual(len(dump.Connections[0].Sections[0].Records), 6)
+
+	// The capture is interrupted in the header of the last record.
+	dump, err = decode(capture[:len(capture)-54-10], &options{})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(dump.Violations, []string{"capture is truncated: 6 of 16 bytes of the last record header are read"})
+	aTest.MustBeEqual(len(dump.Connections), 1)
+
+	var buf bytes.Buffer
+	aTest.MustBeNoError(printText(&buf, dump))
+	aTest.MustBeEqual(strings.HasPrefix(buf.String(), "! capture is truncated: 6 of 16 bytes of the last record header are read\n\nConnection 10.0.0.1:40000 -> "), true)
+}
@@ -0,0 +1,256 @@
+// Fcgi-record records FastCGI traffic between a web server and a backend and
+// plays it back.
+//
+// Usage examples:
+//
+//	fcgi-record -listen 127.0.0.1:9001 -connect 127.0.0.1:9000 -session site.jsonl
+//	fcgi-record -replay -listen 127.0.0.1:9001 -session site.jsonl
+//	fcgi-record -play -connect /run/php/php-fpm.sock -compare -session site.jsonl
+//
+// In the recording mode, the tool is a transparent proxy which writes every
+// record of both directions to the session file, until it is interrupted.
+// The web server is pointed to the listening address instead of the backend.
+//
+// In the replay mode, the tool is a fake backend which plays the recorded
+// responses back to a web server. In the play mode, the tool is a fake web
+// server which sends the recorded requests to a backend and compares the
+// responses with the recorded ones. Mismatches are printed to the standard
+// error.
+//
+// The tool exits with code 1 when it has failed or has found mismatches and
+// with code 2 when the arguments are wrong.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Recorder"
+)
+
+const (
+	ExitCodeOk      = 0
+	ExitCodeFailure = 1
+	ExitCodeUsage   = 2
+)
+
+// Modes of the tool.
+const (
+	ModeRecord = "record"
+	ModeReplay = "replay"
+	ModePlay   = "play"
+)
+
+const (
+	ErrSessionIsNotSet    = "session file is not set"
+	ErrListenIsNotSet     = "listening address is not set"
+	ErrConnectIsNotSet    = "address of the backend is not set"
+	ErrModesAreExclusive  = "replay and play modes are exclusive"
+	ErrArgumentsAreExcess = "excess arguments: %v"
+	ErrMismatches         = "mismatches are found: %v"
+)
+
+type options struct {
+	mode           string
+	sessionPath    string
+	listenNetwork  string
+	listenAddress  string
+	connectNetwork string
+	connectAddress string
+	replaySettings *rc.ReplaySettings
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	os.Exit(run(ctx, os.Args[1:], os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stderr io.Writer) (exitCode int) {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitCodeOk
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeUsage
+	}
+
+	switch opts.mode {
+	case ModeRecord:
+		err = doRecord(ctx, opts)
+	case ModeReplay:
+		err = doReplay(ctx, opts, stderr)
+	case ModePlay:
+		err = doPlay(ctx, opts, stderr)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeFailure
+	}
+
+	return ExitCodeOk
+}
+
+func parseArgs(args []string, stderr io.Writer) (opts *options, err error) {
+	fs := flag.NewFlagSet("fcgi-record", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	opts = &options{replaySettings: &rc.ReplaySettings{}}
+	var isReplay, isPlay bool
+
+	fs.StringVar(&opts.sessionPath, "session", "", "session file")
+	fs.StringVar(&opts.listenAddress, "listen", "", "address to listen on: host:port or path to a Unix socket")
+	fs.StringVar(&opts.connectAddress, "connect", "", "address of the backend: host:port or path to a Unix socket")
+	fs.StringVar(&opts.connectNetwork, "network", "", "network of the backend: tcp or unix; by default, it is guessed by the address")
+	fs.BoolVar(&isReplay, "replay", false, "play the session back as a fake backend")
+	fs.BoolVar(&isPlay, "play", false, "play the session to the backend as a fake web server")
+	fs.BoolVar(&opts.replaySettings.IsTimingKept, "timing", false, "keep the recorded pauses between records")
+	fs.BoolVar(&opts.replaySettings.IsContentCompared, "compare", false, "compare contents of records, not only their types and request IDs")
+
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf(ErrArgumentsAreExcess, fs.Args())
+	}
+
+	switch {
+	case isReplay && isPlay:
+		return nil, errors.New(ErrModesAreExclusive)
+	case isReplay:
+		opts.mode = ModeReplay
+	case isPlay:
+		opts.mode = ModePlay
+	default:
+		opts.mode = ModeRecord
+	}
+
+	if len(opts.sessionPath) == 0 {
+		return nil, errors.New(ErrSessionIsNotSet)
+	}
+	if (opts.mode != ModePlay) && (len(opts.listenAddress) == 0) {
+		return nil, errors.New(ErrListenIsNotSet)
+	}
+	if (opts.mode != ModeReplay) && (len(opts.connectAddress) == 0) {
+		return nil, errors.New(ErrConnectIsNotSet)
+	}
+
+	opts.listenNetwork = cl.GuessNetwork(opts.listenAddress)
+	if len(opts.connectNetwork) == 0 {
+		opts.connectNetwork = cl.GuessNetwork(opts.connectAddress)
+	}
+	if !cl.IsNetworkSupported(opts.connectNetwork) {
+		return nil, fmt.Errorf(cl.ErrNetworkIsNotSupported, opts.connectNetwork)
+	}
+
+	return opts, nil
+}
+
+// doRecord records the traffic until the context is done.
+func doRecord(ctx context.Context, opts *options) (err error) {
+	var f *os.File
+	f, err = os.Create(opts.sessionPath)
+	if err != nil {
+		return err
+	}
+
+	var r *rc.Recorder
+	r, err = rc.NewRecorder(&rc.RecorderSettings{
+		Network: opts.connectNetwork,
+		Address: opts.connectAddress,
+	}, f)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	err = serveUntilDone(ctx, func() error {
+		return r.ListenAndServe(opts.listenNetwork, opts.listenAddress)
+	}, r.Close, rc.ErrRecorderIsClosed)
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+
+	return f.Close()
+}
+
+// doReplay plays the session back until the context is done.
+func doReplay(ctx context.Context, opts *options, stderr io.Writer) (err error) {
+	var session *rc.Session
+	session, err = rc.LoadSession(opts.sessionPath)
+	if err != nil {
+		return err
+	}
+
+	b := rc.NewBackend(session, opts.replaySettings)
+	err = serveUntilDone(ctx, func() error {
+		return b.ListenAndServe(opts.listenNetwork, opts.listenAddress)
+	}, b.Close, rc.ErrBackendIsClosed)
+	if err != nil {
+		return err
+	}
+
+	return printMismatches(b.Mismatches(), stderr)
+}
+
+func doPlay(ctx context.Context, opts *options, stderr io.Writer) (err error) {
+	var session *rc.Session
+	session, err = rc.LoadSession(opts.sessionPath)
+	if err != nil {
+		return err
+	}
+
+	var mismatches []string
+	mismatches, err = rc.Play(ctx, opts.connectNetwork, opts.connectAddress, session, opts.replaySettings)
+	if err != nil {
+		return err
+	}
+
+	return printMismatches(mismatches, stderr)
+}
+
+// serveUntilDone serves until the context is done or serving fails.
+func serveUntilDone(ctx context.Context, serve func() error, closeFn func() error, errClosed error) (err error) {
+	served := make(chan error, 1)
+	go func() { served <- serve() }()
+
+	select {
+	case err = <-served:
+		_ = closeFn()
+		return err
+
+	case <-ctx.Done():
+		err = closeFn()
+		serveErr := <-served
+		if (serveErr != nil) && !errors.Is(serveErr, errClosed) {
+			return serveErr
+		}
+		return err
+	}
+}
+
+func printMismatches(mismatches []string, stderr io.Writer) (err error) {
+	if len(mismatches) == 0 {
+		return nil
+	}
+
+	for _, m := range mismatches {
+		_, err = fmt.Fprintln(stderr, m)
+		if err != nil {
+			return err
+		}
+	}
+
+	return fmt.Errorf(ErrMismatches, len(mismatches))
+}
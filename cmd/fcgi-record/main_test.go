@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startAppServer starts a responder which writes the greeting.
+func startAppServer(t *testing.T, greeting string) (address string) {
+	srv, err := fcgitest.NewServer(fcgitest.Reply(&fcgitest.Response{
+		Stdout: []byte("Content-Type: text/plain\r\n\r\n" + greeting),
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv.Address
+}
+
+// request sends a request to the Unix socket, which may be not ready yet.
+func request(t *testing.T, socketPath string) (stdout string) {
+	var c *cl.Client
+	var err error
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		c, err = cl.New(cl.NetworkUnix, socketPath)
+		if err == nil {
+			break
+		}
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	rsp, err := c.Do(context.Background(), &cl.Request{
+		Role:   dm.FCGI_RESPONDER,
+		Params: []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, "/srv/index.php")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = rsp.Close() }()
+
+	ba, err := io.ReadAll(rsp.Stdout)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return string(ba)
+}
+
+// runInBackground runs the tool until the request is done.
+func runInBackground(t *testing.T, args []string, socketPath string) (stdout string, exitCode int) {
+	ctx, cancel := context.WithCancel(context.Background())
+	exitCodes := make(chan int, 1)
+	go func() { exitCodes <- run(ctx, args, io.Discard) }()
+
+	stdout = request(t, socketPath)
+	cancel()
+
+	return stdout, <-exitCodes
+}
+
+func Test_run(t *testing.T) {
+	aTest := tester.New(t)
+
+	dir := t.TempDir()
+	sessionPath := filepath.Join(dir, "session.jsonl")
+	address := startAppServer(t, "Hello")
+
+	// Record.
+	socketPath := filepath.Join(dir, "record.sock")
+	stdout, exitCode := runInBackground(t, []string{"-listen", socketPath, "-connect", address, "-session", sessionPath}, socketPath)
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+	aTest.MustBeEqual(stdout, "Content-Type: text/plain\r\n\r\nHello")
+
+	session, err := os.ReadFile(sessionPath)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(strings.HasPrefix(string(session), `{"conn":1,`), true)
+	aTest.MustBeEqual(strings.Contains(string(session), `"text":"Content-Type: text/plain\r\n\r\nHello"`), true)
+
+	// Replay without the application.
+	socketPath = filepath.Join(dir, "replay.sock")
+	stdout, exitCode = runInBackground(t, []string{"-replay", "-listen", socketPath, "-session", sessionPath}, socketPath)
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+	aTest.MustBeEqual(stdout, "Content-Type: text/plain\r\n\r\nHello")
+
+	// Play to the same application and to another one.
+	stderr := new(bytes.Buffer)
+	aTest.MustBeEqual(run(context.Background(), []string{"-play", "-compare", "-network", cl.NetworkTcp, "-connect", address, "-session", sessionPath}, stderr), ExitCodeOk)
+	aTest.MustBeEqual(stderr.String(), "")
+
+	address = startAppServer(t, "Bye")
+	aTest.MustBeEqual(run(context.Background(), []string{"-play", "-compare", "-connect", address, "-session", sessionPath}, stderr), ExitCodeFailure)
+	aTest.MustBeEqual(strings.HasSuffix(stderr.String(), "\nmismatches are found: 1\n"), true)
+}
+
+func Test_run_Errors(t *testing.T) {
+	aTest := tester.New(t)
+
+	tests := []struct {
+		args     []string
+		exitCode int
+		stderr   string
+	}{
+		{[]string{"-listen", ":9001", "-connect", ":9000"}, ExitCodeUsage, ErrSessionIsNotSet},
+		{[]string{"-session", "s.jsonl", "-connect", ":9000"}, ExitCodeUsage, ErrListenIsNotSet},
+		{[]string{"-session", "s.jsonl", "-listen", ":9001"}, ExitCodeUsage, ErrConnectIsNotSet},
+		{[]string{"-session", "s.jsonl", "-replay", "-play"}, ExitCodeUsage, ErrModesAreExclusive},
+		{[]string{"-session", "s.jsonl", "-play", "-network", "udp", "-connect", ":9000"}, ExitCodeUsage, "network is not supported"},
+		{[]string{"-session", "s.jsonl", "-play", "-connect", ":9000", "x"}, ExitCodeUsage, "excess arguments: [x]"},
+		{[]string{"-session", filepath.Join(t.TempDir(), "none.jsonl"), "-play", "-connect", ":9000"}, ExitCodeFailure, "no such file or directory"},
+	}
+	for _, test := range tests {
+		stderr := new(bytes.Buffer)
+		aTest.MustBeEqual(run(context.Background(), test.args, stderr), test.exitCode)
+		aTest.MustBeEqual(strings.Contains(stderr.String(), test.stderr), true)
+	}
+}
@@ -0,0 +1,284 @@
+// Fcgi-request sends a single FastCGI request to a backend and prints its
+// result, like the 'cgi-fcgi' tool does.
+//
+// Usage examples:
+//
+//	fcgi-request -connect 127.0.0.1:9000 -param SCRIPT_FILENAME=/srv/info.php
+//	fcgi-request -connect /run/php/php-fpm.sock -env-file request.env -stdin - -output http
+//	fcgi-request -connect 127.0.0.1:9000 -role authorizer -output json -timing
+//
+// Parameters of the env file are overridden by the '-param' flags. When the
+// request has a body, the CONTENT_LENGTH parameter is set unless it is given.
+//
+// In the raw mode, stdout of the application is copied to the standard output
+// as it arrives, while stderr, statuses and timing go to the standard error.
+// The 'http' mode splits stdout into the HTTP status, headers and body. The
+// 'json' mode prints the whole result as a JSON object.
+//
+// The tool exits with the zero code when the request is complete, with code 1
+// when the request has failed or has been rejected and with code 2 when the
+// arguments are wrong.
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	ExitCodeOk      = 0
+	ExitCodeFailure = 1
+	ExitCodeUsage   = 2
+)
+
+// Output modes.
+const (
+	OutputRaw  = "raw"
+	OutputHttp = "http"
+	OutputJson = "json"
+)
+
+// Role names.
+const (
+	RoleResponder  = "responder"
+	RoleAuthorizer = "authorizer"
+	RoleFilter     = "filter"
+)
+
+const (
+	// StdinFileName is the file name which means the standard input.
+	StdinFileName = "-"
+
+	TimeoutDefault = 30 * time.Second
+)
+
+const (
+	ErrConnectIsNotSet    = "address of the backend is not set"
+	ErrRoleIsUnknown      = "role is unknown: %v"
+	ErrOutputIsUnknown    = "output mode is unknown: %v"
+	ErrParamSyntax        = "parameter is not in the NAME=VALUE form: %v"
+	ErrEnvFileLineSyntax  = "line %v of the env file is not in the NAME=VALUE form"
+	ErrArgumentsAreExcess = "excess arguments: %v"
+	ErrStdinIsUsedTwice   = "standard input can not be both stdin and data"
+)
+
+type options struct {
+	network   string
+	address   string
+	role      dm.Role
+	params    []*nvpair.NameValuePair
+	stdinPath string
+	dataPath  string
+	output    string
+	isTiming  bool
+	timeout   time.Duration
+}
+
+// paramList is a list of the '-param' flags.
+type paramList []string
+
+func (pl *paramList) String() string {
+	return strings.Join(*pl, " ")
+}
+
+func (pl *paramList) Set(value string) error {
+	*pl = append(*pl, value)
+	return nil
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(args []string, stdin io.Reader, stdout io.Writer, stderr io.Writer) (exitCode int) {
+	opts, err := parseArgs(args, stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitCodeOk
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeUsage
+	}
+
+	res := doRequest(opts, stdin, stdout)
+
+	switch opts.output {
+	case OutputRaw:
+		err = printRaw(res, stderr, opts.isTiming)
+	case OutputHttp:
+		err = printHttp(res, stdout, stderr, opts.isTiming)
+	case OutputJson:
+		err = printJson(res, stdout, opts.isTiming)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(stderr, err)
+		return ExitCodeFailure
+	}
+
+	if res.err != nil {
+		return ExitCodeFailure
+	}
+
+	return ExitCodeOk
+}
+
+func parseArgs(args []string, stderr io.Writer) (opts *options, err error) {
+	fs := flag.NewFlagSet("fcgi-request", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+
+	opts = &options{}
+	var role, envFile string
+	var params paramList
+
+	fs.StringVar(&opts.address, "connect", "", "address of the backend: host:port or path to a Unix socket")
+	fs.StringVar(&opts.network, "network", "", "network of the backend: tcp or unix; by default, it is guessed by the address")
+	fs.StringVar(&role, "role", RoleResponder, "role of the request: responder, authorizer or filter")
+	fs.Var(&params, "param", "parameter of the request in the NAME=VALUE form; may be repeated")
+	fs.StringVar(&envFile, "env-file", "", "file with parameters of the request, one NAME=VALUE pair per line")
+	fs.StringVar(&opts.stdinPath, "stdin", "", "file with the body of the request; '-' means the standard input")
+	fs.StringVar(&opts.dataPath, "data", "", "file with the data of the filter role; '-' means the standard input")
+	fs.StringVar(&opts.output, "output", OutputRaw, "output mode: raw, http or json")
+	fs.BoolVar(&opts.isTiming, "timing", false, "print the timing summary")
+	fs.DurationVar(&opts.timeout, "timeout", TimeoutDefault, "time limit of the request")
+
+	err = fs.Parse(args)
+	if err != nil {
+		return nil, err
+	}
+	if fs.NArg() > 0 {
+		return nil, fmt.Errorf(ErrArgumentsAreExcess, fs.Args())
+	}
+
+	if (opts.stdinPath == StdinFileName) && (opts.dataPath == StdinFileName) {
+		return nil, errors.New(ErrStdinIsUsedTwice)
+	}
+
+	if len(opts.address) == 0 {
+		return nil, errors.New(ErrConnectIsNotSet)
+	}
+	if len(opts.network) == 0 {
+		opts.network = cl.GuessNetwork(opts.address)
+	}
+	if !cl.IsNetworkSupported(opts.network) {
+		return nil, fmt.Errorf(cl.ErrNetworkIsNotSupported, opts.network)
+	}
+
+	opts.role, err = parseRole(role)
+	if err != nil {
+		return nil, err
+	}
+
+	switch opts.output {
+	case OutputRaw, OutputHttp, OutputJson:
+	default:
+		return nil, fmt.Errorf(ErrOutputIsUnknown, opts.output)
+	}
+
+	if len(envFile) > 0 {
+		opts.params, err = readEnvFile(envFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	for _, p := range params {
+		name, value, ok := strings.Cut(p, "=")
+		if !ok || (len(name) == 0) {
+			return nil, fmt.Errorf(ErrParamSyntax, p)
+		}
+
+		opts.params = setParam(opts.params, name, value)
+	}
+
+	return opts, nil
+}
+
+func parseRole(s string) (role dm.Role, err error) {
+	switch strings.ToLower(s) {
+	case RoleResponder, strconv.Itoa(dm.FCGI_RESPONDER):
+		return dm.FCGI_RESPONDER, nil
+	case RoleAuthorizer, strconv.Itoa(dm.FCGI_AUTHORIZER):
+		return dm.FCGI_AUTHORIZER, nil
+	case RoleFilter, strconv.Itoa(dm.FCGI_FILTER):
+		return dm.FCGI_FILTER, nil
+	default:
+		return 0, fmt.Errorf(ErrRoleIsUnknown, s)
+	}
+}
+
+// readEnvFile reads parameters from the file. Empty lines and lines starting
+// with the '#' symbol are skipped. Values may be put into quotes.
+func readEnvFile(filePath string) (params []*nvpair.NameValuePair, err error) {
+	var f *os.File
+	f, err = os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if (len(line) == 0) || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, "=")
+		name = strings.TrimSpace(name)
+		if !ok || (len(name) == 0) {
+			return nil, fmt.Errorf(ErrEnvFileLineSyntax, lineNumber)
+		}
+
+		params = setParam(params, name, unquote(strings.TrimSpace(value)))
+	}
+
+	err = scanner.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	return params, nil
+}
+
+func unquote(s string) string {
+	if (len(s) >= 2) && ((s[0] == '"') || (s[0] == '\'')) && (s[len(s)-1] == s[0]) {
+		return s[1 : len(s)-1]
+	}
+
+	return s
+}
+
+// setParam sets the value of the parameter, replacing the previous value.
+func setParam(params []*nvpair.NameValuePair, name string, value string) []*nvpair.NameValuePair {
+	p := nvpair.NewNameValuePairWithTextValueU(name, value)
+
+	for i, x := range params {
+		if string(x.Name) == name {
+			params[i] = p
+			return params
+		}
+	}
+
+	return append(params, p)
+}
+
+func hasParam(params []*nvpair.NameValuePair, name string) bool {
+	for _, p := range params {
+		if string(p.Name) == name {
+			return true
+		}
+	}
+
+	return false
+}
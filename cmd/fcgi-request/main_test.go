@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startAppServer starts a responder which lists the parameters in the body,
+// followed by stdin. The '/fail' script ends with the application status 7.
+func startAppServer(t *testing.T, newServer func(fcgitest.Handler) (*fcgitest.Server, error)) (address string) {
+	srv, err := newServer(func(r *fcgitest.Request) *fcgitest.Response {
+		if r.Role != dm.FCGI_RESPONDER {
+			return &fcgitest.Response{ProtocolStatus: dm.FCGI_UNKNOWN_ROLE}
+		}
+
+		var stdout bytes.Buffer
+		stdout.WriteString("Status: 201 Created\r\nX-Test: yes\r\n\r\n")
+		for _, p := range r.Params {
+			_, _ = fmt.Fprintf(&stdout, "%s=%s\n", p.Name, p.Value)
+		}
+		stdout.Write(r.Stdin)
+
+		rsp := &fcgitest.Response{Stdout: stdout.Bytes(), Stderr: []byte("warning\n")}
+		if script, _ := r.Param(dm.Parameter_ScriptName); script == "/fail" {
+			rsp.AppStatus = 7
+		}
+
+		return rsp
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv.Address
+}
+
+func runTool(args []string, stdin string) (exitCode int, stdout string, stderr string) {
+	outBuf, errBuf := new(bytes.Buffer), new(bytes.Buffer)
+	exitCode = run(args, strings.NewReader(stdin), outBuf, errBuf)
+
+	return exitCode, outBuf.String(), errBuf.String()
+}
+
+func Test_run_Raw(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startAppServer(t, fcgitest.NewServer)
+	exitCode, stdout, stderr := runTool([]string{
+		"-connect", address, "-param", "SCRIPT_NAME=/a", "-stdin", "-", "-timing",
+	}, "body")
+
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+	aTest.MustBeEqual(stdout, "Status: 201 Created\r\nX-Test: yes\r\n\r\nSCRIPT_NAME=/a\nCONTENT_LENGTH=4\nbody")
+	aTest.MustBeEqual(strings.HasPrefix(stderr, "warning\nApp status: 0\nProtocol status: 0 (FCGI_REQUEST_COMPLETE)\nConnect: "), true)
+	aTest.MustBeEqual(strings.Contains(stderr, "Stdout: 72 bytes\nStderr: 8 bytes\n"), true)
+}
+
+func Test_run_Http(t *testing.T) {
+	aTest := tester.New(t)
+
+	dir := t.TempDir()
+	address := startAppServer(t, fcgitest.NewUnixServer)
+
+	envFile := filepath.Join(dir, "request.env")
+	aTest.MustBeNoError(os.WriteFile(envFile, []byte("# Request.\nSCRIPT_NAME=/a\n\nREQUEST_METHOD = \"GET\"\n"), 0600))
+
+	exitCode, stdout, stderr := runTool([]string{
+		"-connect", address, "-env-file", envFile, "-param", "SCRIPT_NAME=/fail", "-output", "http",
+	}, "")
+
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+	aTest.MustBeEqual(stdout, "Status: 201 Created\nX-Test: yes\n\nSCRIPT_NAME=/fail\nREQUEST_METHOD=GET\n")
+	aTest.MustBeEqual(stderr, "warning\nApp status: 7\nProtocol status: 0 (FCGI_REQUEST_COMPLETE)\n")
+}
+
+func Test_run_Json(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startAppServer(t, fcgitest.NewServer)
+	exitCode, stdout, stderr := runTool([]string{
+		"-connect", address, "-output", "json", "-timing",
+	}, "")
+
+	aTest.MustBeEqual(exitCode, ExitCodeOk)
+	aTest.MustBeEqual(stderr, "")
+
+	var jr jsonResult
+	aTest.MustBeNoError(json.Unmarshal([]byte(stdout), &jr))
+	aTest.MustBeEqual(jr.Stdout, "Status: 201 Created\r\nX-Test: yes\r\n\r\n")
+	aTest.MustBeEqual(jr.Stderr, "warning\n")
+	aTest.MustBeEqual(*jr.AppStatus, uint32(0))
+	aTest.MustBeEqual(jr.ProtocolStatusName, "FCGI_REQUEST_COMPLETE")
+	aTest.MustBeEqual(jr.Timing.StdoutBytes, int64(len(jr.Stdout)))
+	aTest.MustBeEqual(jr.Timing.Total >= jr.Timing.Connect, true)
+}
+
+func Test_run_Errors(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startAppServer(t, fcgitest.NewServer)
+
+	// Wrong arguments.
+	for _, args := range [][]string{
+		{},
+		{"-connect", address, "-role", "guard"},
+		{"-connect", address, "-output", "xml"},
+		{"-connect", address, "-param", "=x"},
+		{"-connect", address, "-network", "udp"},
+		{"-connect", address, "extra"},
+		{"-connect", address, "-role", "filter", "-stdin", "-", "-data", "-"},
+	} {
+		exitCode, _, _ := runTool(args, "")
+		aTest.MustBeEqual(exitCode, ExitCodeUsage)
+	}
+
+	// Rejected request.
+	exitCode, _, stderr := runTool([]string{"-connect", address, "-role", "filter"}, "")
+	aTest.MustBeEqual(exitCode, ExitCodeFailure)
+	aTest.MustBeEqual(strings.HasPrefix(stderr, "App status: 0\nProtocol status: 3 (FCGI_UNKNOWN_ROLE)\nError: "), true)
+
+	// Nobody listens.
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	address = listener.Addr().String()
+	aTest.MustBeNoError(listener.Close())
+
+	exitCode, stdout, _ := runTool([]string{"-connect", address, "-output", "json"}, "")
+	aTest.MustBeEqual(exitCode, ExitCodeFailure)
+
+	var jr jsonResult
+	aTest.MustBeNoError(json.Unmarshal([]byte(stdout), &jr))
+	aTest.MustBeEqual(jr.AppStatus == nil, true)
+	aTest.MustBeEqual(len(jr.Error) > 0, true)
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+)
+
+// jsonResult is the result of the 'json' output mode. Statuses are set only
+// when the request is ended.
+type jsonResult struct {
+	Stdout             string      `json:"stdout"`
+	Stderr             string      `json:"stderr"`
+	AppStatus          *uint32     `json:"appStatus,omitempty"`
+	ProtocolStatus     *byte       `json:"protocolStatus,omitempty"`
+	ProtocolStatusName string      `json:"protocolStatusName,omitempty"`
+	Error              string      `json:"error,omitempty"`
+	Timing             *jsonTiming `json:"timing,omitempty"`
+}
+
+// jsonTiming is the timing summary in seconds.
+type jsonTiming struct {
+	Connect     float64 `json:"connect"`
+	FirstByte   float64 `json:"firstByte"`
+	Total       float64 `json:"total"`
+	StdoutBytes int64   `json:"stdoutBytes"`
+	StderrBytes int     `json:"stderrBytes"`
+}
+
+func protocolStatusName(protocolStatus byte) (name string) {
+	switch protocolStatus {
+	case dm.FCGI_REQUEST_COMPLETE:
+		return "FCGI_REQUEST_COMPLETE"
+	case dm.FCGI_CANT_MPX_CONN:
+		return "FCGI_CANT_MPX_CONN"
+	case dm.FCGI_OVERLOADED:
+		return "FCGI_OVERLOADED"
+	case dm.FCGI_UNKNOWN_ROLE:
+		return "FCGI_UNKNOWN_ROLE"
+	default:
+		return "UNKNOWN"
+	}
+}
+
+// printRaw prints everything except stdout, which is already copied.
+func printRaw(res *result, stderr io.Writer, isTiming bool) (err error) {
+	_, err = stderr.Write(res.stderr)
+	if err != nil {
+		return err
+	}
+
+	return printSummary(res, stderr, isTiming)
+}
+
+// printHttp prints stdout as an HTTP response.
+func printHttp(res *result, stdout io.Writer, stderr io.Writer, isTiming bool) (err error) {
+	if res.isEnded && (res.err == nil) {
+		var httpData *pm.Data
+		httpData, err = pm.SplitHeadersFromStdout(res.stdout)
+		if err != nil {
+			return err
+		}
+
+		statusCode := httpData.StatusCode
+		statusText := httpData.StatusText
+		if statusCode == 0 {
+			statusCode = http.StatusOK
+		}
+		if len(statusText) == 0 {
+			statusText = http.StatusText(int(statusCode))
+		}
+
+		_, err = fmt.Fprintf(stdout, "Status: %d %s\n", statusCode, statusText)
+		if err != nil {
+			return err
+		}
+
+		for _, hdr := range httpData.Headers {
+			_, err = fmt.Fprintf(stdout, "%s: %s\n", hdr.Name, hdr.Value)
+			if err != nil {
+				return err
+			}
+		}
+
+		_, err = fmt.Fprintf(stdout, "\n%s", httpData.Body)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err = stderr.Write(res.stderr)
+	if err != nil {
+		return err
+	}
+
+	return printSummary(res, stderr, isTiming)
+}
+
+// printSummary prints the statuses, the error and the timing summary.
+func printSummary(res *result, w io.Writer, isTiming bool) (err error) {
+	if res.isEnded {
+		_, err = fmt.Fprintf(w, "App status: %d\nProtocol status: %d (%s)\n",
+			res.appStatus, res.protocolStatus, protocolStatusName(res.protocolStatus))
+		if err != nil {
+			return err
+		}
+	}
+
+	if res.err != nil {
+		_, err = fmt.Fprintf(w, "Error: %v\n", res.err)
+		if err != nil {
+			return err
+		}
+	}
+
+	if isTiming {
+		_, err = fmt.Fprintf(w, "Connect: %v\nFirst byte: %v\nTotal: %v\nStdout: %d bytes\nStderr: %d bytes\n",
+			res.connectTime, res.firstByteTime, res.totalTime, res.stdoutBytes, len(res.stderr))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func printJson(res *result, stdout io.Writer, isTiming bool) (err error) {
+	jr := &jsonResult{
+		Stdout: string(res.stdout),
+		Stderr: string(res.stderr),
+	}
+
+	if res.isEnded {
+		jr.AppStatus = &res.appStatus
+		jr.ProtocolStatus = &res.protocolStatus
+		jr.ProtocolStatusName = protocolStatusName(res.protocolStatus)
+	}
+
+	if res.err != nil {
+		jr.Error = res.err.Error()
+	}
+
+	if isTiming {
+		jr.Timing = &jsonTiming{
+			Connect:     res.connectTime.Seconds(),
+			FirstByte:   res.firstByteTime.Seconds(),
+			Total:       res.totalTime.Seconds(),
+			StdoutBytes: res.stdoutBytes,
+			StderrBytes: len(res.stderr),
+		}
+	}
+
+	enc := json.NewEncoder(stdout)
+	enc.SetIndent("", "\t")
+
+	return enc.Encode(jr)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// result is the result of a request.
+type result struct {
+	// Stdout is collected unless it is copied to the sink.
+	stdout      []byte
+	stdoutBytes int64
+	stderr      []byte
+
+	// Statuses are known when the request is ended, even when it is
+	// rejected.
+	isEnded        bool
+	appStatus      uint32
+	protocolStatus byte
+
+	// The error which has stopped the request.
+	err error
+
+	connectTime   time.Duration
+	firstByteTime time.Duration
+	totalTime     time.Duration
+}
+
+// firstByteWriter counts the bytes of stdout and remembers the time of the
+// first byte.
+type firstByteWriter struct {
+	w         io.Writer
+	startedAt time.Time
+	n         int64
+	firstByte time.Duration
+}
+
+func (fbw *firstByteWriter) Write(p []byte) (n int, err error) {
+	if (fbw.n == 0) && (len(p) > 0) {
+		fbw.firstByte = time.Since(fbw.startedAt)
+	}
+
+	n, err = fbw.w.Write(p)
+	fbw.n += int64(n)
+
+	return n, err
+}
+
+// doRequest sends the request and reads its response. In the raw mode, stdout
+// is copied to the sink.
+func doRequest(opts *options, stdin io.Reader, sink io.Writer) (res *result) {
+	res = &result{}
+
+	params := opts.params
+	var body, data []byte
+	if len(opts.stdinPath) > 0 {
+		body, res.err = readInput(opts.stdinPath, stdin)
+		if res.err != nil {
+			return res
+		}
+
+		if !hasParam(params, dm.Parameter_ContentLength) {
+			params = setParam(params, dm.Parameter_ContentLength, strconv.Itoa(len(body)))
+		}
+	}
+	if len(opts.dataPath) > 0 {
+		data, res.err = readInput(opts.dataPath, stdin)
+		if res.err != nil {
+			return res
+		}
+
+		if !hasParam(params, dm.Parameter_FcgiDataLength) {
+			params = setParam(params, dm.Parameter_FcgiDataLength, strconv.Itoa(len(data)))
+		}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.timeout)
+	defer cancel()
+
+	startedAt := time.Now()
+	defer func() {
+		res.totalTime = time.Since(startedAt)
+	}()
+
+	var c *cl.Client
+	c, res.err = cl.New(opts.network, opts.address)
+	if res.err != nil {
+		return res
+	}
+	defer c.Close()
+	res.connectTime = time.Since(startedAt)
+
+	req := &cl.Request{
+		Role:   opts.role,
+		Params: params,
+	}
+	if body != nil {
+		req.Stdin = bytes.NewReader(body)
+	}
+	if data != nil {
+		req.Data = bytes.NewReader(data)
+	}
+
+	var rsp *cl.Response
+	rsp, res.err = c.Do(ctx, req)
+	if res.err != nil {
+		return res
+	}
+	defer rsp.Close()
+
+	var stdoutBuf *bytes.Buffer
+	if opts.output != OutputRaw {
+		stdoutBuf = new(bytes.Buffer)
+		sink = stdoutBuf
+	}
+
+	fbw := &firstByteWriter{w: sink, startedAt: startedAt}
+	_, res.err = io.Copy(fbw, rsp.Stdout)
+	res.stdoutBytes = fbw.n
+	res.firstByteTime = fbw.firstByte
+	if stdoutBuf != nil {
+		res.stdout = stdoutBuf.Bytes()
+	}
+	res.stderr = rsp.Stderr()
+
+	_, err := rsp.EndRequest()
+	if err == nil {
+		res.isEnded = true
+		res.appStatus = rsp.AppStatus()
+		res.protocolStatus = rsp.ProtocolStatus()
+	}
+
+	return res
+}
+
+func readInput(filePath string, stdin io.Reader) (ba []byte, err error) {
+	if filePath == StdinFileName {
+		return io.ReadAll(stdin)
+	}
+
+	return os.ReadFile(filePath)
+}
@@ -53,7 +53,8 @@ func showOutro() {
 
 func runSimplePhpScript(scriptFilePath string) (err error) {
 	var stdOut, stdErr []byte
-	stdOut, stdErr, err = pm.RunOnceSimplePhpScript(TestServerNetwork, TestServerAddress, scriptFilePath)
+	var appStatus uint32
+	stdOut, stdErr, appStatus, err = pm.RunOnceSimplePhpScriptWithAppStatus(TestServerNetwork, TestServerAddress, scriptFilePath)
 	if err != nil {
 		return err
 	}
@@ -72,6 +73,8 @@ func runSimplePhpScript(scriptFilePath string) (err error) {
 		}
 	}
 
+	fmt.Println(fmt.Sprintf("Exit code: %v.", appStatus))
+
 	return nil
 }
 
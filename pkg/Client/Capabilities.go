@@ -0,0 +1,311 @@
+package cl
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	// CapabilitiesCacheTtl is the time during which capabilities of a server
+	// are taken from the cache.
+	CapabilitiesCacheTtl = 5 * time.Minute
+)
+
+const (
+	ErrValuesAreNotAnswered = "connection is closed without an answer to FCGI_GET_VALUES"
+)
+
+const (
+	// FcgiMpxsConnsEnabled is the value of the FCGI_MPXS_CONNS variable of a
+	// server which multiplexes connections.
+	FcgiMpxsConnsEnabled = "1"
+)
+
+// Capabilities are the values which a server reports in the
+// FCGI_GET_VALUES_RESULT record.
+type Capabilities struct {
+	// IsSupported is false when the server does not support the
+	// FCGI_GET_VALUES record, i.e. it answers with the FCGI_UNKNOWN_TYPE
+	// record or closes the connection. In this case all the other fields are
+	// empty.
+	IsSupported bool
+
+	// FCGI_MAX_CONNS. Zero means that the server has not reported it.
+	MaxConns int
+
+	// FCGI_MAX_REQS. Zero means that the server has not reported it.
+	MaxReqs int
+
+	// FCGI_MPXS_CONNS.
+	MpxsConns bool
+
+	// Values of other variables reported by the server.
+	// Key: variable name; Value: variable value.
+	Others map[string]string
+}
+
+// NewCapabilitiesFromRecord parses the FCGI_GET_VALUES_RESULT record.
+// Malformed numbers are kept as other values.
+func NewCapabilitiesFromRecord(rec *dm.Record) (caps *Capabilities, err error) {
+	var nvps []*nvpair.NameValuePair
+	nvps, err = rec.ParseContentAsNVPs()
+	if err != nil {
+		return nil, err
+	}
+
+	caps = &Capabilities{
+		IsSupported: true,
+		Others:      make(map[string]string),
+	}
+
+	var name, value string
+	var x int
+	for _, nvp := range nvps {
+		name, value = string(nvp.Name), string(nvp.Value)
+
+		switch name {
+		case cm.FCGI_MAX_CONNS, cm.FCGI_MAX_REQS:
+			x, err = strconv.Atoi(value)
+			if (err != nil) || (x < 0) {
+				caps.Others[name] = value
+				continue
+			}
+
+			if name == cm.FCGI_MAX_CONNS {
+				caps.MaxConns = x
+			} else {
+				caps.MaxReqs = x
+			}
+
+		case cm.FCGI_MPXS_CONNS:
+			caps.MpxsConns = value == FcgiMpxsConnsEnabled
+
+		default:
+			caps.Others[name] = value
+		}
+	}
+
+	return caps, nil
+}
+
+// clone returns a deep copy of the capabilities.
+func (caps *Capabilities) clone() (c *Capabilities) {
+	c = &Capabilities{
+		IsSupported: caps.IsSupported,
+		MaxConns:    caps.MaxConns,
+		MaxReqs:     caps.MaxReqs,
+		MpxsConns:   caps.MpxsConns,
+	}
+
+	if caps.Others != nil {
+		c.Others = make(map[string]string, len(caps.Others))
+		for name, value := range caps.Others {
+			c.Others[name] = value
+		}
+	}
+
+	return c
+}
+
+// GetValues asks the server for its capabilities using the FCGI_GET_VALUES
+// record. Capabilities are cached for each server, so the server is asked only
+// when the cache is empty or outdated. The context limits the time of waiting
+// for an answer, while some servers ignore this record silently. Each call
+// returns its own copy of the capabilities, which the caller may change.
+//
+// After this method, records of the connection are read by the multiplexer.
+func (c *Client) GetValues(ctx context.Context) (caps *Capabilities, err error) {
+	caps = capabilitiesCache.get(c.network, c.address)
+	if caps != nil {
+		return caps, nil
+	}
+
+	c.valuesLock.Lock()
+	defer c.valuesLock.Unlock()
+
+	var isClosed bool
+	caps, isClosed, err = c.queryValues(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Server has closed the connection instead of answering.
+	if isClosed {
+		caps = &Capabilities{}
+	}
+
+	capabilitiesCache.set(c.network, c.address, caps)
+
+	return caps, nil
+}
+
+// ProbeValues asks the server for its capabilities using the FCGI_GET_VALUES
+// record, bypassing the cache. This is suitable for health checks, so a server
+// which closes the connection instead of answering fails the probe. The answer
+// is stored in the cache.
+func (c *Client) ProbeValues(ctx context.Context) (caps *Capabilities, err error) {
+	c.valuesLock.Lock()
+	defer c.valuesLock.Unlock()
+
+	var isClosed bool
+	caps, isClosed, err = c.queryValues(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if isClosed {
+		return nil, errors.New(ErrValuesAreNotAnswered)
+	}
+
+	capabilitiesCache.set(c.network, c.address, caps)
+
+	return caps, nil
+}
+
+// ForgetCapabilities removes the capabilities of the server from the cache.
+func ForgetCapabilities(network string, address string) {
+	capabilitiesCache.delete(network, address)
+}
+
+// queryValues asks the server for its capabilities. The flag is set when the
+// server has closed the connection cleanly instead of answering.
+func (c *Client) queryValues(ctx context.Context) (caps *Capabilities, isClosed bool, err error) {
+	params := []*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_CONNS, ""),
+		nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_REQS, ""),
+		nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MPXS_CONNS, ""),
+	}
+
+	var ba []byte
+	ba, err = c.CreateGetValuesRequest(params)
+	if err != nil {
+		return nil, false, err
+	}
+
+	c.muxLock.Lock()
+	c.startMux()
+	c.muxLock.Unlock()
+
+	// Answers to previous questions are not needed.
+	c.dropManagementRecords()
+
+	// A broken client can not tell anything about the server.
+	err = c.muxError()
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = c.SendRequest(ba)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var rec *dm.Record
+	for {
+		select {
+		case rec = <-c.managementRecs:
+		case <-c.muxStopped:
+			// Server has closed the connection instead of answering. Any
+			// other failure of the connection is not an answer.
+			if c.isClosedByServer() {
+				return nil, true, nil
+			}
+			return nil, false, c.muxError()
+		case <-ctx.Done():
+			return nil, false, ctx.Err()
+		}
+
+		switch rec.Type {
+		case dm.FCGI_GET_VALUES_RESULT:
+			caps, err = NewCapabilitiesFromRecord(rec)
+			return caps, false, err
+
+		case dm.FCGI_UNKNOWN_TYPE:
+			if (len(rec.ContentData) > 0) && (rec.ContentData[0] == dm.FCGI_GET_VALUES) {
+				return &Capabilities{}, false, nil
+			}
+		}
+	}
+}
+
+// isClosedByServer tells whether the multiplexer has stopped at a clean end
+// of the connection.
+func (c *Client) isClosedByServer() bool {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	return c.isMuxEof
+}
+
+func (c *Client) dropManagementRecords() {
+	for {
+		select {
+		case <-c.managementRecs:
+		default:
+			return
+		}
+	}
+}
+
+// capabilitiesCache keeps capabilities of servers.
+var capabilitiesCache = &capabilitiesCacheT{
+	lock:    new(sync.Mutex),
+	entries: make(map[string]*capabilitiesCacheEntry),
+}
+
+type capabilitiesCacheT struct {
+	lock *sync.Mutex
+
+	// Key: network and address of a server.
+	entries map[string]*capabilitiesCacheEntry
+}
+
+type capabilitiesCacheEntry struct {
+	caps      *Capabilities
+	expiresAt time.Time
+}
+
+func capabilitiesCacheKey(network string, address string) string {
+	return network + "://" + address
+}
+
+func (cc *capabilitiesCacheT) get(network string, address string) (caps *Capabilities) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	key := capabilitiesCacheKey(network, address)
+	entry, ok := cc.entries[key]
+	if !ok {
+		return nil
+	}
+
+	if time.Now().After(entry.expiresAt) {
+		delete(cc.entries, key)
+		return nil
+	}
+
+	return entry.caps.clone()
+}
+
+func (cc *capabilitiesCacheT) set(network string, address string, caps *Capabilities) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	cc.entries[capabilitiesCacheKey(network, address)] = &capabilitiesCacheEntry{
+		caps:      caps.clone(),
+		expiresAt: time.Now().Add(CapabilitiesCacheTtl),
+	}
+}
+
+func (cc *capabilitiesCacheT) delete(network string, address string) {
+	cc.lock.Lock()
+	defer cc.lock.Unlock()
+
+	delete(cc.entries, capabilitiesCacheKey(network, address))
+}
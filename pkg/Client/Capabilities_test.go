@@ -0,0 +1,207 @@
+package cl
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startUnknownTypeServer starts a server which answers the FCGI_GET_VALUES
+// record with the FCGI_UNKNOWN_TYPE record or, if 'isClosing' is set, closes
+// the connection.
+func startUnknownTypeServer(t *testing.T, isClosing bool) (address string) {
+	srv := startServer(t, nil)
+	srv.SetValuesAnswer(&fcgitest.ValuesAnswer{
+		IsUnknownType: !isClosing,
+		IsConnClosed:  isClosing,
+	})
+
+	return srv.Address
+}
+
+func Test_Client_GetValues(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startServer(t, nil)
+	srv.SetValuesAnswer(&fcgitest.ValuesAnswer{
+		Values: []*nvpair.NameValuePair{
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_CONNS, "3"),
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_REQS, "many"),
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MPXS_CONNS, "1"),
+			nvpair.NewNameValuePairWithTextValueU("X_VENDOR", "test"),
+		},
+	})
+	address := srv.Address
+	defer ForgetCapabilities(NetworkTcp, address)
+
+	c, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// The multiplexer is running already.
+	ex, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	defer ex.Close()
+
+	caps, err := c.GetValues(context.Background())
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps, &Capabilities{
+		IsSupported: true,
+		MaxConns:    3,
+		MaxReqs:     0,
+		MpxsConns:   true,
+		Others: map[string]string{
+			cm.FCGI_MAX_REQS: "many",
+			"X_VENDOR":       "test",
+		},
+	})
+
+	// Capabilities are taken from the cache when the server is gone.
+	_ = c.Close()
+	c2, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c2.Close()
+	}()
+	aTest.MustBeNoError(c2.Close())
+
+	caps2, err := c2.GetValues(context.Background())
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps2, caps)
+
+	// Cached capabilities are not changed through the returned ones.
+	aTest.MustBeEqual(caps2 == caps, false)
+	caps2.MaxConns = 1
+	caps2.Others["X_VENDOR"] = "changed"
+	caps3, err := c2.GetValues(context.Background())
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps3, caps)
+}
+
+func Test_Client_GetValues_Unsupported(t *testing.T) {
+	aTest := tester.New(t)
+
+	for _, isClosing := range []bool{false, true} {
+		address := startUnknownTypeServer(t, isClosing)
+
+		c, err := New(NetworkTcp, address)
+		aTest.MustBeNoError(err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		caps, err := c.GetValues(ctx)
+		cancel()
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(caps.IsSupported, false)
+		aTest.MustBeEqual(caps.MpxsConns, false)
+
+		_ = c.Close()
+		ForgetCapabilities(NetworkTcp, address)
+	}
+}
+
+func Test_Client_ProbeValues_Closed(t *testing.T) {
+	aTest := tester.New(t)
+
+	// A server which does not answer fails the probe.
+	address := startUnknownTypeServer(t, true)
+	c, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = c.ProbeValues(ctx)
+	aTest.MustBeEqual(err.Error(), ErrValuesAreNotAnswered)
+	aTest.MustBeEqual(capabilitiesCache.get(NetworkTcp, address) == nil, true)
+
+	// A server which answers with the FCGI_UNKNOWN_TYPE record passes it.
+	address = startUnknownTypeServer(t, false)
+	c2, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c2.Close()
+	}()
+
+	caps, err := c2.ProbeValues(ctx)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps.IsSupported, false)
+	ForgetCapabilities(NetworkTcp, address)
+}
+
+func Test_Client_GetValues_BrokenConnection(t *testing.T) {
+	aTest := tester.New(t)
+
+	// This server answers with a part of a record.
+	listener, err := net.Listen(NetworkTcp, "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		_, err = dm.NewRecordFromStream(conn)
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write([]byte{dm.FCGI_VERSION_1, dm.FCGI_GET_VALUES_RESULT, 0})
+	}()
+	address := listener.Addr().String()
+
+	c, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	_, err = c.GetValues(ctx)
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(c.IsBroken(), true)
+
+	// The broken client is not asked again, and failures are not cached.
+	_, err = c.ProbeValues(ctx)
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(capabilitiesCache.get(NetworkTcp, address) == nil, true)
+}
+
+func Test_Client_GetValues_Timeout(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Nobody accepts connections of this listener, so nothing is answered.
+	listener, err := net.Listen(NetworkTcp, "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = listener.Close() })
+	address := listener.Addr().String()
+
+	c, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+
+	_, err = c.GetValues(ctx)
+	aTest.MustBeEqual(err, context.DeadlineExceeded)
+
+	// Failures are not cached.
+	aTest.MustBeEqual(capabilitiesCache.get(NetworkTcp, address) == nil, true)
+}
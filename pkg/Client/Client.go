@@ -1,38 +1,149 @@
 package cl
 
 import (
+	"errors"
+	"fmt"
 	"net"
+	"strings"
+	"sync"
 
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
 )
 
+// Networks supported by the client.
+const (
+	NetworkTcp  = "tcp"
+	NetworkTcp4 = "tcp4"
+	NetworkTcp6 = "tcp6"
+
+	// NetworkUnix is a network of Unix domain sockets. Address of such a
+	// socket is a path to the socket file, e.g. '/run/php/php-fpm.sock'. On
+	// Linux, an address starting with the '@' symbol is a name of a socket in
+	// the abstract namespace, e.g. '@php-fpm'.
+	NetworkUnix = "unix"
+)
+
+const (
+	ErrNetworkIsNotSupported = "network is not supported: %v"
+	ErrRecordsAreMultiplexed = "records are read by the multiplexer"
+)
+
 type Client struct {
-	serverAddress *net.TCPAddr
-	conn          *net.TCPConn
+	network string
+	address string
+	conn    net.Conn
+
+	// Records of the connection are read by a single buffered reader, so
+	// that offsets in errors are counted from the start of the connection.
+	reader *dm.RecordReader
+
+	// Writer of records. It is used under the write lock.
+	writer *dm.RecordWriter
+
+	// Writes of different requests must not be mixed.
+	writeLock *sync.Mutex
+
+	// Multiplexer. It is started by the first exchange and then it reads
+	// all the records of the connection, routing them to exchanges.
+	muxLock        *sync.Mutex
+	isMuxStarted   bool
+	exchanges      map[uint16]*Exchange
+	lastRequestId  uint16
+	muxErr         error
+	managementRecs chan *dm.Record
+
+	// This flag is set when the multiplexer has stopped because the server
+	// has closed the connection cleanly, between records.
+	isMuxEof bool
+
+	// This channel is closed when the multiplexer stops.
+	muxStopped chan struct{}
+
+	// Only one FCGI_GET_VALUES question may be asked at a time, while
+	// answers have no request ID to tell them apart.
+	valuesLock *sync.Mutex
+
+	// This flag is set when the client is returned to a pool, i.e. when the
+	// connection has already served at least one request.
+	isReused bool
+
+	// Number of requests taken from a pool and not yet returned.
+	poolActive int
 }
 
+// New connects to the FastCGI server. Network is either a TCP network, where
+// address is a host and a port, or a Unix network, where address is a path to
+// the socket.
 func New(network string, address string) (c *Client, err error) {
-	c = &Client{}
+	if !IsNetworkSupported(network) {
+		return nil, fmt.Errorf(ErrNetworkIsNotSupported, network)
+	}
 
-	c.serverAddress, err = net.ResolveTCPAddr(network, address)
-	if err != nil {
-		return nil, err
+	c = &Client{
+		network:        network,
+		address:        address,
+		writeLock:      new(sync.Mutex),
+		muxLock:        new(sync.Mutex),
+		exchanges:      make(map[uint16]*Exchange),
+		managementRecs: make(chan *dm.Record, ManagementRecordsBufferSize),
+		muxStopped:     make(chan struct{}),
+		valuesLock:     new(sync.Mutex),
 	}
 
-	c.conn, err = net.DialTCP(network, nil, c.serverAddress)
+	c.conn, err = net.Dial(network, address)
 	if err != nil {
 		return nil, err
 	}
 
+	c.reader = dm.NewBufferedRecordReader(c.conn, false, 0)
+	c.writer = dm.NewRecordWriter(c.conn)
+
 	return c, nil
 }
 
+// IsNetworkSupported checks whether the network can be used by the client.
+func IsNetworkSupported(network string) bool {
+	switch network {
+	case NetworkTcp, NetworkTcp4, NetworkTcp6, NetworkUnix:
+		return true
+	default:
+		return false
+	}
+}
+
+// GuessNetwork tells the network by the address. Paths and names of the
+// abstract namespace are Unix sockets.
+func GuessNetwork(address string) (network string) {
+	if strings.HasPrefix(address, "/") || strings.HasPrefix(address, "@") ||
+		strings.HasPrefix(address, ".") || strings.HasSuffix(address, ".sock") {
+		return NetworkUnix
+	}
+
+	return NetworkTcp
+}
+
+// Network returns the network of the server.
+func (c *Client) Network() (network string) {
+	return c.network
+}
+
+// Address returns the address of the server.
+func (c *Client) Address() (address string) {
+	return c.address
+}
+
 func (c *Client) Close() (err error) {
 	return c.conn.Close()
 }
 
+// IsReused tells whether the connection has already served a request. A
+// reused connection may be closed by the server while it was idle.
+func (c *Client) IsReused() (isReused bool) {
+	return c.isReused
+}
+
 // 4.1.1. FCGI_GET_VALUES.
 func (c *Client) CreateGetValuesRequest(params []*nvpair.NameValuePair) (ba []byte, err error) {
 	var r *rm.ValuesRequest
@@ -130,7 +241,12 @@ func (c *Client) CreateEndRequest(requestId uint16, appStatus uint32, protocolSt
 	return rm.NewEndRequest(requestId, appStatus, protocolStatus).ToBytes()
 }
 
+// SendRequest writes the data into the connection. Data written by a single
+// call is never mixed with data of other calls.
 func (c *Client) SendRequest(data []byte) (err error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
 	_, err = c.conn.Write(data)
 	if err != nil {
 		return err
@@ -139,16 +255,41 @@ func (c *Client) SendRequest(data []byte) (err error) {
 	return nil
 }
 
+// SendRecord sends a record having the specified content. Header, content and
+// padding are written without copying them into a single buffer.
+func (c *Client) SendRecord(recordType dm.RecordType, requestId uint16, content []byte) (err error) {
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	return c.writer.WriteRecord(recordType, requestId, content)
+}
+
+// ReadRawRecord reads a single record from the connection. This method can
+// not be used after an exchange is opened, while all the records are read by
+// the multiplexer.
 func (c *Client) ReadRawRecord() (r *dm.Record, err error) {
-	return dm.NewRecordFromStream(c.conn)
+	if c.IsMultiplexed() {
+		return nil, errors.New(ErrRecordsAreMultiplexed)
+	}
+
+	return c.reader.ReadRecord()
 }
 
+// ReadResponseUntilEnd reads records until the first FCGI_END_REQUEST
+// record. This method does not separate records of different requests, so it
+// is suitable only for a connection serving a single request. This method can
+// not be used after an exchange is opened, while all the records are read by
+// the multiplexer.
 func (c *Client) ReadResponseUntilEnd() (recs []*dm.Record, err error) {
+	if c.IsMultiplexed() {
+		return nil, errors.New(ErrRecordsAreMultiplexed)
+	}
+
 	recs = make([]*dm.Record, 0)
 	var rec *dm.Record
 
 	for {
-		rec, err = dm.NewRecordFromStream(c.conn)
+		rec, err = c.reader.ReadRecord()
 		if err != nil {
 			return nil, err
 		}
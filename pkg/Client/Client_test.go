@@ -0,0 +1,17 @@
+package cl
+
+import (
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func Test_GuessNetwork(t *testing.T) {
+	aTest := tester.New(t)
+
+	aTest.MustBeEqual(GuessNetwork("127.0.0.1:9000"), NetworkTcp)
+	aTest.MustBeEqual(GuessNetwork("[::1]:9000"), NetworkTcp)
+	aTest.MustBeEqual(GuessNetwork("/run/php/php-fpm.sock"), NetworkUnix)
+	aTest.MustBeEqual(GuessNetwork("@php-fpm"), NetworkUnix)
+	aTest.MustBeEqual(GuessNetwork("php.sock"), NetworkUnix)
+}
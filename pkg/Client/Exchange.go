@@ -0,0 +1,307 @@
+package cl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	// AbortTimeoutDefault is the time during which a server should end an
+	// aborted request.
+	AbortTimeoutDefault = 5 * time.Second
+)
+
+const (
+	ErrAbortTimeout = "server has not ended the aborted request in time"
+)
+
+// Exchange is a single request and its response inside a connection. Many
+// exchanges may share a single connection when the server supports
+// multiplexing. Records of the response are routed to the exchange by the
+// multiplexer of the client.
+type Exchange struct {
+	client    *Client
+	requestId uint16
+
+	// Records of the response. The multiplexer never waits for the exchange,
+	// so that a slow reader does not hold back other exchanges of the
+	// connection, and records which are not read yet are queued. The queue
+	// is closed after the FCGI_END_REQUEST record or when the connection
+	// breaks. The channel is signalled when the queue changes.
+	queueLock     *sync.Mutex
+	queue         []*dm.Record
+	isQueueClosed bool
+	queueChanged  chan struct{}
+
+	// This channel is closed when the exchange is abandoned.
+	abandoned chan struct{}
+	closeOnce *sync.Once
+
+	isEnded bool
+}
+
+// OpenExchange registers a new exchange in the client. If the request ID is
+// zero, i.e. FCGI_NULL_REQUEST_ID, a free request ID is allocated. After the
+// first exchange is opened, all the records of the connection are read by the
+// multiplexer.
+func (c *Client) OpenExchange(requestId uint16) (ex *Exchange, err error) {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	if c.muxErr != nil {
+		return nil, c.muxErr
+	}
+
+	if requestId == dm.FCGI_NULL_REQUEST_ID {
+		requestId, err = c.allocateRequestId()
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		_, isBusy := c.exchanges[requestId]
+		if isBusy {
+			return nil, fmt.Errorf(ErrRequestIdIsBusy, requestId)
+		}
+	}
+
+	ex = &Exchange{
+		client:       c,
+		requestId:    requestId,
+		queueLock:    new(sync.Mutex),
+		queueChanged: make(chan struct{}, 1),
+		abandoned:    make(chan struct{}),
+		closeOnce:    new(sync.Once),
+	}
+
+	c.exchanges[requestId] = ex
+	c.startMux()
+
+	return ex, nil
+}
+
+// RequestId returns the request ID of the exchange.
+func (ex *Exchange) RequestId() (requestId uint16) {
+	return ex.requestId
+}
+
+// Client returns the client of the exchange.
+func (ex *Exchange) Client() (c *Client) {
+	return ex.client
+}
+
+// Send writes the data of the request into the connection.
+func (ex *Exchange) Send(data []byte) (err error) {
+	return ex.client.SendRequest(data)
+}
+
+// Write implements the io.Writer interface. Data of a single call is never
+// mixed with data of other exchanges, so it must contain whole records.
+func (ex *Exchange) Write(p []byte) (n int, err error) {
+	err = ex.client.SendRequest(p)
+	if err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// WriteRecord implements the 'i.IRecordWriter' interface. Request ID must be
+// the ID of the exchange.
+func (ex *Exchange) WriteRecord(recordType dm.RecordType, requestId uint16, content []byte) (err error) {
+	return ex.client.SendRecord(recordType, requestId, content)
+}
+
+// ReadRecord returns the next record of the response. After the
+// FCGI_END_REQUEST record, io.EOF is returned.
+func (ex *Exchange) ReadRecord() (rec *dm.Record, err error) {
+	return ex.ReadRecordContext(context.Background())
+}
+
+// ReadRecordContext returns the next record of the response. After the
+// FCGI_END_REQUEST record, io.EOF is returned. If the context is done before a
+// record arrives, the error of the context is returned. The request is not
+// aborted here, see the Abort method.
+func (ex *Exchange) ReadRecordContext(ctx context.Context) (rec *dm.Record, err error) {
+	if ex.isEnded {
+		return nil, io.EOF
+	}
+
+	var ok bool
+	for {
+		rec, ok = ex.popRecord()
+		if (rec != nil) || !ok {
+			break
+		}
+
+		select {
+		case <-ex.queueChanged:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if !ok {
+		return nil, ex.client.muxError()
+	}
+
+	if rec.Type == dm.FCGI_END_REQUEST {
+		ex.isEnded = true
+	}
+
+	return rec, nil
+}
+
+// ReadResponseUntilEnd reads all the records of the response including the
+// FCGI_END_REQUEST record.
+func (ex *Exchange) ReadResponseUntilEnd() (recs []*dm.Record, err error) {
+	return ex.ReadResponseUntilEndContext(context.Background())
+}
+
+// ReadResponseUntilEndContext reads all the records of the response including
+// the FCGI_END_REQUEST record. If the context is done before the end, the
+// request is aborted and the error of the context is returned.
+func (ex *Exchange) ReadResponseUntilEndContext(ctx context.Context) (recs []*dm.Record, err error) {
+	recs = make([]*dm.Record, 0)
+	var rec *dm.Record
+
+	for {
+		rec, err = ex.ReadRecordContext(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				_ = ex.Abort(AbortTimeoutDefault)
+				return nil, ctx.Err()
+			}
+
+			return nil, err
+		}
+
+		recs = append(recs, rec)
+
+		if rec.Type == dm.FCGI_END_REQUEST {
+			return recs, nil
+		}
+	}
+}
+
+// Abort sends the FCGI_ABORT_REQUEST record and waits for the server to end
+// the request during the specified time. Records arriving meanwhile are
+// dropped. If the server does not end the request in time, the connection is
+// closed, while its state is unknown.
+func (ex *Exchange) Abort(timeout time.Duration) (err error) {
+	if ex.isEnded {
+		return nil
+	}
+
+	err = ex.Send(ex.client.CreateAbortRequest(ex.requestId))
+	if err != nil {
+		ex.client.breakConn(err)
+		return err
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	var rec *dm.Record
+	var ok bool
+	for {
+		rec, ok = ex.popRecord()
+		if !ok {
+			return ex.client.muxError()
+		}
+		if rec != nil {
+			if rec.Type == dm.FCGI_END_REQUEST {
+				ex.isEnded = true
+				return nil
+			}
+			continue
+		}
+
+		select {
+		case <-ex.queueChanged:
+		case <-timer.C:
+			err = errors.New(ErrAbortTimeout)
+			ex.client.breakConn(err)
+			return err
+		}
+	}
+}
+
+// IsEnded tells whether the FCGI_END_REQUEST record has been read.
+func (ex *Exchange) IsEnded() bool {
+	return ex.isEnded
+}
+
+// Close abandons the exchange. Queued records and records which arrive later
+// are dropped. The request ID stays busy until the server ends the request.
+func (ex *Exchange) Close() {
+	ex.closeOnce.Do(func() {
+		close(ex.abandoned)
+
+		ex.queueLock.Lock()
+		ex.queue = nil
+		ex.queueLock.Unlock()
+	})
+}
+
+// deliver queues the record for the exchange without waiting. This method is
+// used only by the multiplexer.
+func (ex *Exchange) deliver(rec *dm.Record) {
+	ex.queueLock.Lock()
+	select {
+	case <-ex.abandoned:
+	default:
+		ex.queue = append(ex.queue, rec)
+	}
+	if rec.Type == dm.FCGI_END_REQUEST {
+		ex.isQueueClosed = true
+	}
+	ex.queueLock.Unlock()
+
+	ex.signalQueue()
+}
+
+// closeQueue ends the records of the exchange when the connection breaks.
+func (ex *Exchange) closeQueue() {
+	ex.queueLock.Lock()
+	ex.isQueueClosed = true
+	ex.queueLock.Unlock()
+
+	ex.signalQueue()
+}
+
+func (ex *Exchange) signalQueue() {
+	select {
+	case ex.queueChanged <- struct{}{}:
+	default:
+	}
+}
+
+// popRecord takes the next queued record. Nil record with the true flag means
+// that the queue is empty, while the false flag means that it is closed.
+func (ex *Exchange) popRecord() (rec *dm.Record, ok bool) {
+	ex.queueLock.Lock()
+	defer ex.queueLock.Unlock()
+
+	if len(ex.queue) == 0 {
+		return nil, !ex.isQueueClosed
+	}
+
+	rec = ex.queue[0]
+	ex.queue[0] = nil
+	ex.queue = ex.queue[1:]
+
+	return rec, true
+}
+
+// muxError returns the error which has stopped the multiplexer.
+func (c *Client) muxError() (err error) {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	return c.muxErr
+}
@@ -0,0 +1,277 @@
+package cl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/interfaces"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startInterleavingServer starts a server which answers requests in the
+// reverse order of their IDs. Output of each request is its request ID.
+func startInterleavingServer(t *testing.T) (srv *fcgitest.Server) {
+	return startServer(t, func(r *fcgitest.Request) *fcgitest.Response {
+		return &fcgitest.Response{
+			Stdout: []byte(fmt.Sprintf("%v", r.Id)),
+			Delay:  time.Duration(4-int(r.Id)) * 50 * time.Millisecond,
+		}
+	})
+}
+
+func sendEmptyRequest(ex *Exchange) (err error) {
+	c := ex.Client()
+
+	err = ex.Send(c.CreateBeginRequest(ex.RequestId(), dm.FCGI_RESPONDER, dm.FCGI_KEEP_CONN))
+	if err != nil {
+		return err
+	}
+
+	var ba []byte
+	ba, err = c.CreateParamsRequest(ex.RequestId(), nil)
+	if err != nil {
+		return err
+	}
+	err = ex.Send(ba)
+	if err != nil {
+		return err
+	}
+
+	ba, err = c.CreateStdInRequest(ex.RequestId(), nil)
+	if err != nil {
+		return err
+	}
+
+	return ex.Send(ba)
+}
+
+func Test_Exchange(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startInterleavingServer(t)
+	c, err := New(NetworkTcp, srv.Address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	exchanges := make([]*Exchange, 0, 3)
+	for i := 0; i < 3; i++ {
+		ex, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(ex.RequestId(), uint16(i+1))
+		exchanges = append(exchanges, ex)
+	}
+
+	_, err = c.OpenExchange(2)
+	aTest.MustBeAnError(err)
+
+	// This exchange sends nothing and waits for the connection to be closed.
+	exIdle, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(exIdle.RequestId(), uint16(4))
+
+	_, err = c.ReadRawRecord()
+	aTest.MustBeAnError(err)
+
+	for _, ex := range exchanges {
+		aTest.MustBeNoError(sendEmptyRequest(ex))
+	}
+
+	for _, ex := range exchanges {
+		recs, err := ex.ReadResponseUntilEnd()
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(len(recs), 3)
+		aTest.MustBeEqual(string(dm.GetStdOutFromRecords(recs)), fmt.Sprintf("%v", ex.RequestId()))
+		aTest.MustBeEqual(ex.IsEnded(), true)
+
+		_, err = ex.ReadRecord()
+		aTest.MustBeEqual(err, io.EOF)
+		ex.Close()
+	}
+
+	// Server closes the connection after the third request.
+	aTest.MustBeNoError(srv.Close())
+	_, err = exIdle.ReadRecord()
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(c.IsBroken(), true)
+	aTest.MustBeEqual(c.ActiveExchangesCount(), 0)
+}
+
+func Test_Pool_Multiplexing(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startServer(t, nil)
+	srv.SetValuesAnswer(&fcgitest.ValuesAnswer{
+		Values: []*nvpair.NameValuePair{
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_CONNS, "2"),
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_REQS, "3"),
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MPXS_CONNS, "1"),
+		},
+	})
+	address := srv.Address
+
+	p := NewMultiplexingPool(NetworkTcp, address, 4, 2)
+	defer func() {
+		aTest.MustBeNoError(p.Close())
+	}()
+
+	c1, err := p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(p.IsMultiplexed(), true)
+	aTest.MustBeEqual(p.MaxConns(), 2)
+	aTest.MustBeEqual(p.MaxReqs(), 3)
+
+	// The second request shares the connection with the first one, the third
+	// request needs a new connection.
+	c2, err := p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(c2 == c1, true)
+
+	c3, err := p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(c3 == c1, false)
+
+	p.Put(c1)
+	p.Put(c2)
+	p.Put(c3)
+}
+
+func Test_Exchange_Stalled(t *testing.T) {
+	aTest := tester.New(t)
+
+	// The first request gets more records than an exchange used to buffer,
+	// and they come before the output of the second request.
+	big := bytes.Repeat([]byte("x"), 8*1024*1024)
+	srv := startServer(t, func(r *fcgitest.Request) *fcgitest.Response {
+		if r.Id == 1 {
+			return &fcgitest.Response{Stdout: big}
+		}
+		return &fcgitest.Response{
+			Stdout: []byte("small"),
+			Delay:  50 * time.Millisecond,
+		}
+	})
+
+	c, err := New(NetworkTcp, srv.Address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	exStalled, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	defer exStalled.Close()
+	ex, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	defer ex.Close()
+
+	aTest.MustBeNoError(sendEmptyRequest(exStalled))
+	aTest.MustBeNoError(sendEmptyRequest(ex))
+
+	// The second request completes while nobody reads the first one.
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	recs, err := ex.ReadResponseUntilEndContext(ctx)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(string(dm.GetStdOutFromRecords(recs)), "small")
+
+	recs, err = exStalled.ReadResponseUntilEndContext(ctx)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(bytes.Equal(dm.GetStdOutFromRecords(recs), big), true)
+	aTest.MustBeEqual(c.IsBroken(), false)
+}
+
+// startAbortableServer starts a server which never answers requests on its
+// own. When an abort arrives, it ends the request if 'isAbortHonoured' is set.
+func startAbortableServer(t *testing.T, isAbortHonoured bool) (srv *fcgitest.Server) {
+	done := make(chan struct{})
+	srv = startServer(t, func(r *fcgitest.Request) *fcgitest.Response {
+		select {
+		case <-r.Aborted():
+		case <-done:
+			return nil
+		}
+
+		if !isAbortHonoured {
+			<-done
+		}
+
+		return &fcgitest.Response{AppStatus: 1}
+	})
+
+	// Handlers are released before the server is closed.
+	t.Cleanup(func() { close(done) })
+
+	return srv
+}
+
+// waitForAbort waits for a request of the server to be aborted and returns
+// its ID.
+func waitForAbort(srv *fcgitest.Server) (requestId uint16) {
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		for _, r := range srv.Requests() {
+			if r.IsAborted() {
+				return r.Id
+			}
+		}
+	}
+
+	return dm.FCGI_NULL_REQUEST_ID
+}
+
+func Test_Exchange_Abort(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Server ends the aborted request.
+	srv := startAbortableServer(t, true)
+	c, err := New(NetworkTcp, srv.Address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	ex, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(sendEmptyRequest(ex))
+
+	ctx, cancelFn := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelFn()
+
+	_, err = ex.ReadResponseUntilEndContext(ctx)
+	aTest.MustBeEqual(errors.Is(err, context.DeadlineExceeded), true)
+	aTest.MustBeEqual(waitForAbort(srv), ex.RequestId())
+	aTest.MustBeEqual(ex.IsEnded(), true)
+	aTest.MustBeEqual(c.IsBroken(), false)
+	ex.Close()
+
+	// Server ignores the abort.
+	srv = startAbortableServer(t, false)
+	c2, err := New(NetworkTcp, srv.Address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c2.Close()
+	}()
+
+	ex, err = c2.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(sendEmptyRequest(ex))
+
+	err = ex.Abort(50 * time.Millisecond)
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(waitForAbort(srv), ex.RequestId())
+	aTest.MustBeEqual(c2.IsBroken(), true)
+	ex.Close()
+}
+
+var _ i.IRecordWriter = (*Exchange)(nil)
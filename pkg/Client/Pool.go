@@ -0,0 +1,458 @@
+package cl
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+const (
+	PoolMaxConnsDefault       = 16
+	PoolMaxReqsPerConnDefault = 16
+
+	// PoolDiscoveryTimeoutDefault is the default time given to the server to
+	// answer the FCGI_GET_VALUES record. Requests wait for the answer, so the
+	// timeout is short.
+	PoolDiscoveryTimeoutDefault = 500 * time.Millisecond
+)
+
+const (
+	ErrPoolIsClosed = "pool is closed"
+)
+
+// Pool is a pool of connections to a single FastCGI server.
+//
+// Connections are dialled lazily and are kept open between requests with the
+// help of the FCGI_KEEP_CONN flag. Number of open connections is limited by
+// the 'maxConns' setting and, when the server tells them, by FCGI_MAX_CONNS
+// and FCGI_MAX_REQS values of the server.
+//
+// When the server reports FCGI_MPXS_CONNS=1, a connection is shared by up to
+// 'maxReqsPerConn' in-flight requests, each of them being an exchange with its
+// own request ID. Otherwise, each connection serves a single request at a
+// time.
+type Pool struct {
+	network        string
+	address        string
+	maxConns       int
+	maxReqsPerConn int
+	maxReqs        int
+
+	// Semaphore limiting the number of in-flight requests. A token is put
+	// into the channel when a connection is taken from the pool.
+	slots chan struct{}
+
+	// Discovery of server's limits is done once. The limits are guarded by
+	// the pool's lock, so that they can be read while the discovery waits for
+	// the server.
+	discoveryLock    *sync.Mutex
+	discoveryTimeout time.Duration
+	isDiscoveryDone  bool
+	isMultiplexed    bool
+
+	lock *sync.Mutex
+
+	// This condition is signalled when a connection is dialled or returned.
+	cond *sync.Cond
+
+	// Open connections, both idle and busy.
+	conns []*Client
+
+	// Number of connections being dialled at the moment.
+	dialsCount int
+
+	isClosed bool
+}
+
+// NewPool creates a pool of connections to the specified server. No
+// connection is dialled here. If 'maxConns' is not positive, the default limit
+// is used. Connections are multiplexed by the default number of requests when
+// the server supports multiplexing.
+func NewPool(network string, address string, maxConns int) (p *Pool) {
+	return NewMultiplexingPool(network, address, maxConns, PoolMaxReqsPerConnDefault)
+}
+
+// NewMultiplexingPool creates a pool of connections to the specified server.
+// When the server supports multiplexing, each connection is shared by up to
+// 'maxReqsPerConn' requests. If a limit is not positive, the default limit is
+// used.
+func NewMultiplexingPool(network string, address string, maxConns int, maxReqsPerConn int) (p *Pool) {
+	if maxConns <= 0 {
+		maxConns = PoolMaxConnsDefault
+	}
+	if maxReqsPerConn <= 0 {
+		maxReqsPerConn = PoolMaxReqsPerConnDefault
+	}
+
+	p = &Pool{
+		network:          network,
+		address:          address,
+		maxConns:         maxConns,
+		maxReqsPerConn:   maxReqsPerConn,
+		maxReqs:          maxConns,
+		slots:            make(chan struct{}, maxConns*maxReqsPerConn),
+		discoveryLock:    new(sync.Mutex),
+		discoveryTimeout: PoolDiscoveryTimeoutDefault,
+		lock:             new(sync.Mutex),
+		conns:            make([]*Client, 0, maxConns),
+	}
+	p.cond = sync.NewCond(p.lock)
+
+	return p
+}
+
+// SetDiscoveryTimeout sets the time given to the server to report its limits
+// before the first connection is taken. When the server does not answer in
+// time, the configured limits are used without multiplexing. Non-positive
+// timeout means the default one.
+func (p *Pool) SetDiscoveryTimeout(timeout time.Duration) {
+	if timeout <= 0 {
+		timeout = PoolDiscoveryTimeoutDefault
+	}
+
+	p.discoveryLock.Lock()
+	defer p.discoveryLock.Unlock()
+
+	p.discoveryTimeout = timeout
+}
+
+// MaxConns returns the current limit of connections. It may become lower
+// after the first connection when the server reports its own limits.
+func (p *Pool) MaxConns() (maxConns int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.maxConns
+}
+
+// MaxReqs returns the current limit of in-flight requests.
+func (p *Pool) MaxReqs() (maxReqs int) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.maxReqs
+}
+
+// IsMultiplexed tells whether connections of the pool are shared by several
+// requests. This is known only after the first connection.
+func (p *Pool) IsMultiplexed() bool {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	return p.isMultiplexed
+}
+
+// Get takes a connection having a free slot for a request or dials a new one.
+// When the limit of requests is reached, Get waits for a request to be
+// finished. Every connection taken from the pool must be either returned with
+// the Put method or thrown away with the Discard method.
+//
+// When the pool is not multiplexed, the connection is used only by the
+// caller. Otherwise, the caller must use an exchange to talk to the server.
+func (p *Pool) Get() (c *Client, err error) {
+	return p.GetContext(context.Background())
+}
+
+// GetContext is the Get method which stops waiting for a free slot when the
+// context is done.
+func (p *Pool) GetContext(ctx context.Context) (c *Client, err error) {
+	err = p.discoverLimits()
+	if err != nil {
+		return nil, err
+	}
+
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	c, err = p.takeConn()
+	if err != nil {
+		<-p.slots
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Do sends the request using a connection of the pool. The connection is
+// returned into the pool when the response is closed. A request which does not
+// keep the connection spoils it, so such a connection is thrown away. When a
+// reused connection turns out to be closed by the server, the request is sent
+// once more using another connection.
+//
+// A request which fails while the connection is healthy, e.g. because its
+// request ID is busy, returns the connection into the pool, so that other
+// requests sharing the connection are not affected.
+func (p *Pool) Do(ctx context.Context, req *Request) (rsp *Response, err error) {
+	var c *Client
+	for {
+		c, err = p.GetContext(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		rsp, err = c.Do(ctx, req)
+		if err == nil {
+			break
+		}
+
+		if !c.IsBroken() {
+			p.Put(c)
+			return nil, err
+		}
+
+		p.Discard(c)
+
+		if !c.IsReused() {
+			return nil, err
+		}
+	}
+
+	rsp.release = func(isEnded bool) {
+		if isEnded && req.KeepConn {
+			p.Put(c)
+		} else {
+			p.Discard(c)
+		}
+	}
+
+	return rsp, nil
+}
+
+// Put returns a connection into the pool after the request is finished.
+// Broken connections are closed.
+func (p *Pool) Put(c *Client) {
+	defer func() {
+		<-p.slots
+	}()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c.poolActive--
+	c.isReused = true
+
+	if c.IsBroken() || (p.isClosed && (c.poolActive == 0)) {
+		p.removeConn(c)
+		_ = c.Close()
+	}
+
+	p.cond.Broadcast()
+}
+
+// Discard closes a broken connection taken from the pool. Other requests
+// sharing the connection fail.
+func (p *Pool) Discard(c *Client) {
+	defer func() {
+		<-p.slots
+	}()
+
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	c.poolActive--
+	p.removeConn(c)
+	_ = c.Close()
+
+	p.cond.Broadcast()
+}
+
+// Close closes all idle connections. Connections which are in use are closed
+// when they are returned to the pool.
+func (p *Pool) Close() (err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	if p.isClosed {
+		return nil
+	}
+	p.isClosed = true
+
+	conns := make([]*Client, 0, len(p.conns))
+	for _, c := range p.conns {
+		if c.poolActive > 0 {
+			conns = append(conns, c)
+			continue
+		}
+
+		err = ae.Combine(err, c.Close())
+	}
+	p.conns = conns
+
+	p.cond.Broadcast()
+
+	return err
+}
+
+// takeConn finds the least busy connection having a free slot or dials a new
+// connection.
+func (p *Pool) takeConn() (c *Client, err error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	for {
+		if p.isClosed {
+			return nil, errors.New(ErrPoolIsClosed)
+		}
+
+		c = p.findFreeConn()
+		if c != nil {
+			c.poolActive++
+			return c, nil
+		}
+
+		if len(p.conns)+p.dialsCount < p.maxConns {
+			return p.dialConn()
+		}
+
+		// Another request is dialling a connection which will have a free
+		// slot for us.
+		p.cond.Wait()
+	}
+}
+
+// dialConn dials a new connection. This method must be called under the
+// pool's lock, which is released while the connection is being dialled.
+func (p *Pool) dialConn() (c *Client, err error) {
+	p.dialsCount++
+	p.lock.Unlock()
+
+	c, err = New(p.network, p.address)
+
+	p.lock.Lock()
+	p.dialsCount--
+	p.cond.Broadcast()
+
+	if err != nil {
+		return nil, err
+	}
+
+	c.poolActive++
+	p.conns = append(p.conns, c)
+
+	return c, nil
+}
+
+// findFreeConn returns the least busy healthy connection having a free slot.
+// Broken idle connections are closed on the way.
+func (p *Pool) findFreeConn() (c *Client) {
+	limit := 1
+	if p.isMultiplexed {
+		limit = p.maxReqsPerConn
+	}
+
+	for i := 0; i < len(p.conns); i++ {
+		x := p.conns[i]
+
+		if x.IsBroken() {
+			if x.poolActive == 0 {
+				p.removeConn(x)
+				_ = x.Close()
+				i--
+			}
+			continue
+		}
+
+		if x.poolActive >= limit {
+			continue
+		}
+
+		if (c == nil) || (x.poolActive < c.poolActive) {
+			c = x
+		}
+	}
+
+	return c
+}
+
+func (p *Pool) removeConn(c *Client) {
+	for i, x := range p.conns {
+		if x == c {
+			p.conns = append(p.conns[:i], p.conns[i+1:]...)
+			return
+		}
+	}
+}
+
+// discoverLimits asks the server for its limits once. If the server does not
+// support the FCGI_GET_VALUES record, the configured limit of connections is
+// used without multiplexing. Only the failure to connect is reported as an
+// error.
+func (p *Pool) discoverLimits() (err error) {
+	p.discoveryLock.Lock()
+	defer p.discoveryLock.Unlock()
+
+	if p.isDiscoveryDone {
+		return nil
+	}
+
+	var c *Client
+	c, err = New(p.network, p.address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	p.isDiscoveryDone = true
+
+	ctx, cancel := context.WithTimeout(context.Background(), p.discoveryTimeout)
+	defer cancel()
+
+	var caps *Capabilities
+	caps, err = c.GetValues(ctx)
+	if err != nil {
+		caps = &Capabilities{}
+	}
+
+	p.applyLimits(caps)
+
+	return nil
+}
+
+// applyLimits sets the limits using the capabilities of the server. This
+// method must be called before the first connection is taken from the pool.
+func (p *Pool) applyLimits(caps *Capabilities) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+
+	p.isMultiplexed = caps.MpxsConns
+	p.maxConns = lowerLimit(p.maxConns, caps.MaxConns)
+
+	if p.isMultiplexed {
+		p.maxReqs = p.maxConns * p.maxReqsPerConn
+	} else {
+		p.maxReqs = p.maxConns
+	}
+	p.maxReqs = lowerLimit(p.maxReqs, caps.MaxReqs)
+
+	// Without multiplexing, each connection carries a single request.
+	if !p.isMultiplexed {
+		p.maxConns = p.maxReqs
+	}
+
+	// Extra slots of the semaphore are reserved forever.
+	for i := cap(p.slots) - p.maxReqs; i > 0; i-- {
+		p.slots <- struct{}{}
+	}
+}
+
+// lowerLimit returns the lesser of the limit and the value reported by the
+// server. Zero value means that the server has not reported it.
+func lowerLimit(limit int, x int) int {
+	if x <= 0 {
+		return limit
+	}
+
+	if x < limit {
+		return x
+	}
+
+	return limit
+}
@@ -0,0 +1,143 @@
+package cl
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startServer starts a scripted server which is closed at the end of the
+// test.
+func startServer(t *testing.T, handler fcgitest.Handler) (srv *fcgitest.Server) {
+	srv, err := fcgitest.NewServer(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv
+}
+
+func Test_Pool(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startServer(t, nil)
+	srv.SetValuesAnswer(&fcgitest.ValuesAnswer{
+		Values: []*nvpair.NameValuePair{
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_CONNS, "2"),
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_REQS, "5"),
+		},
+	})
+	address := srv.Address
+
+	p := NewPool("tcp", address, 10)
+	defer func() {
+		aTest.MustBeNoError(p.Close())
+	}()
+	aTest.MustBeEqual(p.MaxConns(), 10)
+
+	c1, err := p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(p.MaxConns(), 2)
+	aTest.MustBeEqual(c1.IsReused(), false)
+
+	c2, err := p.Get()
+	aTest.MustBeNoError(err)
+
+	// The third request must get the connection returned to the pool.
+	got := make(chan *Client)
+	go func() {
+		c, err := p.Get()
+		if err != nil {
+			close(got)
+			return
+		}
+		got <- c
+	}()
+
+	p.Put(c1)
+	c3 := <-got
+	aTest.MustBeEqual(c3, c1)
+	aTest.MustBeEqual(c3.IsReused(), true)
+
+	p.Discard(c2)
+	p.Put(c3)
+}
+
+func Test_Pool_Unix(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv, err := fcgitest.NewUnixServer(nil)
+	aTest.MustBeNoError(err)
+	defer func() {
+		aTest.MustBeNoError(srv.Close())
+	}()
+	srv.SetValuesAnswer(&fcgitest.ValuesAnswer{
+		Values: []*nvpair.NameValuePair{
+			nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_CONNS, "1"),
+		},
+	})
+	address := srv.Address
+
+	p := NewPool(NetworkUnix, address, 0)
+	defer func() {
+		aTest.MustBeNoError(p.Close())
+	}()
+
+	c, err := p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(p.MaxConns(), 1)
+	aTest.MustBeEqual(c.Network(), NetworkUnix)
+	aTest.MustBeEqual(c.Address(), address)
+	p.Put(c)
+}
+
+func Test_Pool_DiscoveryTimeout(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Nobody accepts connections of this listener, so the limits are never
+	// reported.
+	listener, err := net.Listen(NetworkTcp, "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = listener.Close() })
+
+	p := NewPool(NetworkTcp, listener.Addr().String(), 3)
+	defer func() {
+		aTest.MustBeNoError(p.Close())
+	}()
+	p.SetDiscoveryTimeout(300 * time.Millisecond)
+
+	type result struct {
+		c        *Client
+		err      error
+		duration time.Duration
+	}
+	got := make(chan result, 1)
+	go func() {
+		start := time.Now()
+		c, err := p.Get()
+		got <- result{c: c, err: err, duration: time.Since(start)}
+	}()
+
+	// The limits are read while the discovery waits for the server.
+	time.Sleep(50 * time.Millisecond)
+	start := time.Now()
+	aTest.MustBeEqual(p.MaxConns(), 3)
+	aTest.MustBeEqual(p.MaxReqs(), 3)
+	aTest.MustBeEqual(p.IsMultiplexed(), false)
+	aTest.MustBeEqual(time.Since(start) < 100*time.Millisecond, true)
+
+	// The configured limits are used when the time is out.
+	r := <-got
+	aTest.MustBeNoError(r.err)
+	aTest.MustBeEqual(r.duration >= 300*time.Millisecond, true)
+	aTest.MustBeEqual(r.duration < time.Second, true)
+	aTest.MustBeEqual(p.MaxConns(), 3)
+	aTest.MustBeEqual(p.IsMultiplexed(), false)
+	p.Put(r.c)
+}
@@ -0,0 +1,110 @@
+package cl
+
+import (
+	"bytes"
+	"context"
+	"io"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
+)
+
+// Request is a FastCGI request of any role.
+type Request struct {
+	// Role of the application. Zero role means FCGI_RESPONDER.
+	Role dm.Role
+
+	// RequestId is the ID of the request inside the connection. Zero ID
+	// means that a free ID is allocated by the client.
+	RequestId uint16
+
+	// KeepConn asks the server to keep the connection open after the
+	// request, i.e. it sets the FCGI_KEEP_CONN flag.
+	KeepConn bool
+
+	// Params are the CGI variables of the request.
+	Params []*nvpair.NameValuePair
+
+	// Stdin is the body of the request. Nil means an empty stream.
+	Stdin io.Reader
+
+	// Data is the file data for the FCGI_FILTER role. Nil means an empty
+	// stream. The stream is sent only for the FCGI_FILTER role or when it is
+	// set.
+	Data io.Reader
+
+	// Stderr is the sink of the FCGI_STDERR stream. If it is nil, the stream
+	// is collected by the response, see the 'Response.Stderr' method.
+	Stderr io.Writer
+}
+
+// Doer sends FastCGI requests. It is implemented by the Client and the Pool.
+type Doer interface {
+	Do(ctx context.Context, req *Request) (rsp *Response, err error)
+}
+
+// Do sends the request and returns its response as soon as the request is
+// begun. Parameters and input streams are written while the response is being
+// read. The response must be closed.
+//
+// When the context is done, the request is aborted and reading of the
+// response fails with the error of the context.
+func (c *Client) Do(ctx context.Context, req *Request) (rsp *Response, err error) {
+	var ex *Exchange
+	ex, err = c.OpenExchange(req.RequestId)
+	if err != nil {
+		return nil, err
+	}
+
+	role := req.Role
+	if role == 0 {
+		role = dm.FCGI_RESPONDER
+	}
+
+	var flags byte
+	if req.KeepConn {
+		flags = dm.FCGI_KEEP_CONN
+	}
+
+	requestId := ex.RequestId()
+
+	// A record which is not written completely spoils the connection.
+	err = ex.Send(rm.NewBeginRequest(requestId, role, flags).ToBytes())
+	if err != nil {
+		c.breakConn(err)
+		ex.Close()
+		return nil, err
+	}
+
+	rw, readCtx := ex.StartRequestWriter(ctx, func(w io.Writer) (err error) {
+		err = rm.WriteParams(w, requestId, req.Params)
+		if err != nil {
+			return err
+		}
+
+		err = rm.WriteStream(w, dm.FCGI_STDIN, requestId, req.Stdin)
+		if err != nil {
+			return err
+		}
+
+		if (role == dm.FCGI_FILTER) || (req.Data != nil) {
+			return rm.WriteStream(w, dm.FCGI_DATA, requestId, req.Data)
+		}
+
+		return nil
+	})
+
+	stderr := req.Stderr
+	var stderrBuf *bytes.Buffer
+	if stderr == nil {
+		stderrBuf = new(bytes.Buffer)
+		stderr = stderrBuf
+	}
+
+	rsp = ex.NewResponse(readCtx, stderr)
+	rsp.requestWriter = rw
+	rsp.stderrBuf = stderrBuf
+
+	return rsp, nil
+}
@@ -0,0 +1,127 @@
+package cl
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	ErrRequestWriterIsStopped = "request writer is stopped"
+	ErrRequestWriterTimeout   = "request writer has not stopped in time"
+)
+
+// RequestWriter writes a request in a separate goroutine while its response
+// is being read. A server may answer before it has consumed the whole request,
+// so writing all the request before reading the response may lead to a
+// deadlock when buffers of both sides are full.
+//
+// When writing fails, the context of reading is cancelled, so the reader
+// aborts the request and stops. When reading is over, writing is stopped
+// before the next record.
+type RequestWriter struct {
+	exchange *Exchange
+	cancel   context.CancelCauseFunc
+
+	stop     chan struct{}
+	stopOnce *sync.Once
+
+	// This channel is closed when the writing function returns.
+	done chan struct{}
+	err  error
+
+	// This flag is set when writing fails before it is stopped.
+	isFailed bool
+}
+
+// StartRequestWriter starts writing the request by the specified function in
+// a separate goroutine. The function gets the request writer, which passes
+// whole records to the exchange. The returned context must be used to read
+// the response, and then the Finish method must be called.
+func (ex *Exchange) StartRequestWriter(ctx context.Context, write func(w io.Writer) error) (rw *RequestWriter, readCtx context.Context) {
+	readCtx, cancel := context.WithCancelCause(ctx)
+
+	rw = &RequestWriter{
+		exchange: ex,
+		cancel:   cancel,
+		stop:     make(chan struct{}),
+		stopOnce: new(sync.Once),
+		done:     make(chan struct{}),
+	}
+
+	go func() {
+		defer close(rw.done)
+
+		rw.err = write(rw)
+		if (rw.err != nil) && !rw.isStopped() {
+			rw.isFailed = true
+			rw.cancel(rw.err)
+		}
+	}()
+
+	return rw, readCtx
+}
+
+// Write implements the io.Writer interface. Data of a single call must contain
+// whole records.
+func (rw *RequestWriter) Write(p []byte) (n int, err error) {
+	if rw.isStopped() {
+		return 0, errors.New(ErrRequestWriterIsStopped)
+	}
+
+	return rw.exchange.Write(p)
+}
+
+// WriteRecord implements the 'i.IRecordWriter' interface.
+func (rw *RequestWriter) WriteRecord(recordType dm.RecordType, requestId uint16, content []byte) (err error) {
+	if rw.isStopped() {
+		return errors.New(ErrRequestWriterIsStopped)
+	}
+
+	return rw.exchange.WriteRecord(recordType, requestId, content)
+}
+
+// Finish stops writing and waits for the writer. 'readErr' is the result of
+// reading the response. The error of writing is returned when it has caused
+// the failure of reading. Writing which has been stopped because the response
+// is over is not an error.
+//
+// If the writer is stuck in the middle of a record for too long, the
+// connection is broken.
+func (rw *RequestWriter) Finish(readErr error) (err error) {
+	rw.stopOnce.Do(func() { close(rw.stop) })
+	defer rw.cancel(nil)
+
+	timer := time.NewTimer(AbortTimeoutDefault)
+	defer timer.Stop()
+
+	select {
+	case <-rw.done:
+	case <-timer.C:
+		rw.exchange.client.breakConn(errors.New(ErrRequestWriterTimeout))
+		<-rw.done
+	}
+
+	if readErr == nil {
+		return nil
+	}
+
+	if rw.isFailed {
+		return rw.err
+	}
+
+	return readErr
+}
+
+func (rw *RequestWriter) isStopped() bool {
+	select {
+	case <-rw.stop:
+		return true
+	default:
+		return false
+	}
+}
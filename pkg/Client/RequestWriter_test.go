@@ -0,0 +1,150 @@
+package cl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startEchoServer starts a server which copies stdin of a request to its
+// stdout record by record as soon as it arrives. The server does not read
+// the next record until the copy is written, like a script which streams its
+// input. Aborted requests are ended. The scripted server of the fcgitest
+// package answers only complete requests, so it can not be used here.
+func startEchoServer(t *testing.T) (address string) {
+	listener, err := net.Listen(NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		rr := dm.NewBufferedRecordReader(conn, true, 0)
+		for {
+			rec, err := rr.ReadRecord()
+			if err != nil {
+				return
+			}
+
+			switch rec.Type {
+			case dm.FCGI_STDIN:
+				err = dm.WriteRecord(conn, dm.FCGI_STDOUT, rec.RequestId, rec.ContentData)
+				if (err == nil) && (rec.ContentLength == 0) {
+					_, err = conn.Write(rm.NewEndRequest(rec.RequestId, 0, dm.FCGI_REQUEST_COMPLETE).ToBytes())
+				}
+
+			case dm.FCGI_ABORT_REQUEST:
+				_, err = conn.Write(rm.NewEndRequest(rec.RequestId, 1, dm.FCGI_REQUEST_COMPLETE).ToBytes())
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// echo sends the stdin to the echo server using the request writer and
+// returns the stdout.
+func echo(c *Client, write func(w io.Writer, requestId uint16) error) (stdout []byte, err error) {
+	var ex *Exchange
+	ex, err = c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	if err != nil {
+		return nil, err
+	}
+	defer ex.Close()
+
+	err = ex.Send(c.CreateBeginRequest(ex.RequestId(), dm.FCGI_RESPONDER, dm.FCGI_KEEP_CONN))
+	if err != nil {
+		return nil, err
+	}
+
+	rw, readCtx := ex.StartRequestWriter(context.Background(), func(w io.Writer) error {
+		return write(w, ex.RequestId())
+	})
+
+	rsp := ex.NewResponse(readCtx, nil)
+	stdout, err = io.ReadAll(rsp.Stdout)
+
+	return stdout, rw.Finish(err)
+}
+
+func Test_RequestWriter_Echo(t *testing.T) {
+	aTest := tester.New(t)
+
+	c, err := New(NetworkTcp, startEchoServer(t))
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// Much more than socket buffers and the buffer of the exchange can hold.
+	stdin := make([]byte, 32*1024*1024)
+	for i := range stdin {
+		stdin[i] = byte(i % 251)
+	}
+
+	type Result struct {
+		stdout []byte
+		err    error
+	}
+	result := make(chan Result, 1)
+	go func() {
+		stdout, err := echo(c, func(w io.Writer, requestId uint16) error {
+			return rm.WriteStream(w, dm.FCGI_STDIN, requestId, bytes.NewReader(stdin))
+		})
+		result <- Result{stdout: stdout, err: err}
+	}()
+
+	select {
+	case r := <-result:
+		aTest.MustBeNoError(r.err)
+		aTest.MustBeEqual(bytes.Equal(r.stdout, stdin), true)
+	case <-time.After(30 * time.Second):
+		t.Fatal("deadlock")
+	}
+}
+
+func Test_RequestWriter_Error(t *testing.T) {
+	aTest := tester.New(t)
+
+	c, err := New(NetworkTcp, startEchoServer(t))
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	errStdin := errors.New("stdin has failed")
+	_, err = echo(c, func(w io.Writer, requestId uint16) error {
+		_, err := rm.NewStdInWriter(w, requestId).Write([]byte("partial"))
+		if err != nil {
+			return err
+		}
+
+		return errStdin
+	})
+	aTest.MustBeEqual(err, errStdin)
+
+	// The request is aborted and the connection is still usable.
+	aTest.MustBeEqual(c.IsBroken(), false)
+	stdout, err := echo(c, func(w io.Writer, requestId uint16) error {
+		return rm.WriteStream(w, dm.FCGI_STDIN, requestId, bytes.NewReader([]byte("again")))
+	})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(string(stdout), "again")
+}
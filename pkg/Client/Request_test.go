@@ -0,0 +1,174 @@
+package cl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startRoleServer starts a server which writes the role, flags and
+// parameters of a request into stderr, and copies stdin and data streams into
+// stdout. The request ends with the length of stdout as the application
+// status. FCGI_GET_VALUES is not supported.
+func startRoleServer(t *testing.T) (address string) {
+	srv := startServer(t, func(r *fcgitest.Request) *fcgitest.Response {
+		var flags byte
+		if r.KeepConn {
+			flags = dm.FCGI_KEEP_CONN
+		}
+
+		stdout := append(append([]byte{}, r.Stdin...), r.Data...)
+		return &fcgitest.Response{
+			Stdout:    stdout,
+			Stderr:    []byte(fmt.Sprintf("role=%v flags=%v params=%v", r.Role, flags, len(r.Params))),
+			AppStatus: uint32(len(stdout)),
+		}
+	})
+	srv.SetValuesAnswer(&fcgitest.ValuesAnswer{IsUnknownType: true})
+
+	return srv.Address
+}
+
+func Test_Client_Do(t *testing.T) {
+	aTest := tester.New(t)
+
+	c, err := New(NetworkTcp, startRoleServer(t))
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	type TestData struct {
+		Request        *Request
+		ExpectedStdout string
+		ExpectedStderr string
+	}
+
+	tests := []TestData{
+		{
+			Request: &Request{
+				KeepConn: true,
+				Params: []*nvpair.NameValuePair{
+					nvpair.NewNameValuePairWithTextValueU("A", "1"),
+					nvpair.NewNameValuePairWithTextValueU("B", "2"),
+				},
+				Stdin: strings.NewReader("input"),
+			},
+			ExpectedStdout: "input",
+			ExpectedStderr: "role=1 flags=1 params=2",
+		},
+		{
+			Request: &Request{
+				Role:     dm.FCGI_AUTHORIZER,
+				KeepConn: true,
+			},
+			ExpectedStdout: "",
+			ExpectedStderr: "role=2 flags=1 params=0",
+		},
+		{
+			Request: &Request{
+				Role:     dm.FCGI_FILTER,
+				KeepConn: true,
+				Stdin:    strings.NewReader("input;"),
+				Data:     strings.NewReader("file"),
+			},
+			ExpectedStdout: "input;file",
+			ExpectedStderr: "role=3 flags=1 params=0",
+		},
+	}
+
+	for i, test := range tests {
+		fmt.Printf("[%v]", i+1)
+
+		rsp, err := c.Do(context.Background(), test.Request)
+		aTest.MustBeNoError(err)
+
+		stdout, err := io.ReadAll(rsp.Stdout)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(string(stdout), test.ExpectedStdout)
+		aTest.MustBeEqual(string(rsp.Stderr()), test.ExpectedStderr)
+		aTest.MustBeEqual(rsp.AppStatus(), uint32(len(test.ExpectedStdout)))
+		aTest.MustBeEqual(rsp.ProtocolStatus(), byte(dm.FCGI_REQUEST_COMPLETE))
+		aTest.MustBeNoError(rsp.Close())
+	}
+	fmt.Println()
+
+	// Stderr sink.
+	var stderr bytes.Buffer
+	rsp, err := c.Do(context.Background(), &Request{KeepConn: true, Stderr: &stderr})
+	aTest.MustBeNoError(err)
+	_, err = io.Copy(io.Discard, rsp.Stdout)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(stderr.String(), "role=1 flags=1 params=0")
+	aTest.MustBeEqual(rsp.Stderr() == nil, true)
+	aTest.MustBeNoError(rsp.Close())
+}
+
+func Test_Pool_Do(t *testing.T) {
+	aTest := tester.New(t)
+
+	p := NewPool(NetworkTcp, startRoleServer(t), 2)
+	defer func() {
+		aTest.MustBeNoError(p.Close())
+	}()
+
+	rsp, err := p.Do(context.Background(), &Request{KeepConn: true, Stdin: strings.NewReader("a")})
+	aTest.MustBeNoError(err)
+	stdout, err := io.ReadAll(rsp.Stdout)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(string(stdout), "a")
+	aTest.MustBeNoError(rsp.Close())
+
+	// The connection is returned and reused.
+	c, err := p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(c.IsReused(), true)
+	p.Put(c)
+
+	// A request without FCGI_KEEP_CONN spoils the connection.
+	rsp, err = p.Do(context.Background(), &Request{Stdin: strings.NewReader("b")})
+	aTest.MustBeNoError(err)
+	stdout, err = io.ReadAll(rsp.Stdout)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(string(stdout), "b")
+	aTest.MustBeNoError(rsp.Close())
+
+	c, err = p.Get()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(c.IsReused(), false)
+	p.Put(c)
+}
+
+func Test_Pool_Do_SharedConnection(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startAbortableServer(t, true)
+	p := NewMultiplexingPool(NetworkTcp, srv.Address, 1, 2)
+	defer func() {
+		aTest.MustBeNoError(p.Close())
+	}()
+	p.isDiscoveryDone = true
+	p.applyLimits(&Capabilities{IsSupported: true, MpxsConns: true})
+
+	rsp, err := p.Do(context.Background(), &Request{RequestId: 7, KeepConn: true})
+	aTest.MustBeNoError(err)
+
+	// The failure of another request does not close the shared connection.
+	_, err = p.Do(context.Background(), &Request{RequestId: 7, KeepConn: true})
+	aTest.MustBeEqual(err.Error(), fmt.Sprintf(ErrRequestIdIsBusy, 7))
+	aTest.MustBeEqual(len(p.conns), 1)
+	aTest.MustBeEqual(p.conns[0].IsBroken(), false)
+
+	aTest.MustBeNoError(rsp.Close())
+	aTest.MustBeEqual(waitForAbort(srv), uint16(7))
+	aTest.MustBeEqual(len(p.conns), 1)
+	aTest.MustBeEqual(p.conns[0].IsBroken(), false)
+}
@@ -0,0 +1,251 @@
+package cl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	ErrResponseIsNotDrained = "response is not drained"
+)
+
+// Response is a response of a FastCGI server which is read while it arrives.
+//
+// Stdout is fed as FCGI_STDOUT records arrive, so the output is kept in memory
+// only while it is not read. FCGI_STDERR records met on the way are written
+// into the stderr sink. When Stdout is drained, i.e. it has returned io.EOF, the
+// FCGI_END_REQUEST record is available.
+type Response struct {
+	// Stdout is the FCGI_STDOUT stream of the response.
+	Stdout io.Reader
+
+	ctx       context.Context
+	exchange  *Exchange
+	stderr    io.Writer
+	endRecord *dm.Record
+	endBody   dm.EndRequestBody
+
+	// Unread part of the last FCGI_STDOUT record.
+	chunk []byte
+
+	// The first error of reading stops the response.
+	err error
+
+	// Writer of the request which is running while the response is read.
+	requestWriter *RequestWriter
+
+	// Collected stderr, when the request has no sink.
+	stderrBuf *bytes.Buffer
+
+	// This function is called when the response is closed. The flag tells
+	// whether the request has ended properly.
+	release  func(isEnded bool)
+	isClosed bool
+
+	// Functions called after the response is closed.
+	closeHooks []func(err error)
+}
+
+// NewResponse creates a response which reads the records of the exchange.
+// If the stderr sink is nil, stderr is dropped. When the context is done while
+// the response is being read, the request is aborted and the error of the
+// context is returned by Stdout.
+func (ex *Exchange) NewResponse(ctx context.Context, stderr io.Writer) (rsp *Response) {
+	if stderr == nil {
+		stderr = io.Discard
+	}
+
+	rsp = &Response{
+		ctx:      ctx,
+		exchange: ex,
+		stderr:   stderr,
+	}
+	rsp.Stdout = &stdoutReader{rsp: rsp}
+
+	return rsp
+}
+
+// RequestId returns the request ID of the response.
+func (rsp *Response) RequestId() (requestId uint16) {
+	return rsp.exchange.RequestId()
+}
+
+// EndRequest returns the FCGI_END_REQUEST record. It is available only after
+// Stdout is drained.
+func (rsp *Response) EndRequest() (rec *dm.Record, err error) {
+	if rsp.endRecord == nil {
+		if (rsp.err != nil) && (rsp.err != io.EOF) {
+			return nil, rsp.err
+		}
+
+		return nil, errors.New(ErrResponseIsNotDrained)
+	}
+
+	return rsp.endRecord, nil
+}
+
+// AppStatus returns the application-level status code of the request, which
+// is an exit code of a CGI script. It is available only after Stdout is
+// drained.
+func (rsp *Response) AppStatus() (appStatus uint32) {
+	return rsp.endBody.AppStatus
+}
+
+// ProtocolStatus returns the protocol-level status code of the request. It is
+// available only after Stdout is drained.
+func (rsp *Response) ProtocolStatus() (protocolStatus byte) {
+	return rsp.endBody.ProtocolStatus
+}
+
+// Stderr returns the FCGI_STDERR stream collected by a response of the
+// 'Client.Do' method when the request has no stderr sink. The stream is
+// complete only after Stdout is drained.
+func (rsp *Response) Stderr() (stderr []byte) {
+	if rsp.stderrBuf == nil {
+		return nil
+	}
+
+	return rsp.stderrBuf.Bytes()
+}
+
+// OnClose adds a function which is called after the response is closed. The
+// function receives the error which has stopped reading the response, e.g. an
+// error of the protocol status, or nil when the response has been drained.
+func (rsp *Response) OnClose(hook func(err error)) {
+	rsp.closeHooks = append(rsp.closeHooks, hook)
+}
+
+// Close releases the exchange. If the response is not drained, the request
+// is aborted.
+func (rsp *Response) Close() (err error) {
+	if rsp.isClosed {
+		return nil
+	}
+	rsp.isClosed = true
+
+	defer func() {
+		rsp.exchange.Close()
+
+		if rsp.release != nil {
+			rsp.release(err == nil)
+		}
+
+		readErr := rsp.err
+		if readErr == io.EOF {
+			readErr = nil
+		}
+		for _, hook := range rsp.closeHooks {
+			hook(readErr)
+		}
+	}()
+
+	if !rsp.exchange.IsEnded() && (rsp.err == nil) {
+		rsp.err = errors.New(ErrResponseIsNotDrained)
+		err = rsp.exchange.Abort(AbortTimeoutDefault)
+	}
+
+	rsp.finishWriting()
+
+	return err
+}
+
+// read fills the buffer with the data of FCGI_STDOUT records.
+func (rsp *Response) read(p []byte) (n int, err error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	for len(rsp.chunk) == 0 {
+		if rsp.err != nil {
+			return 0, rsp.err
+		}
+
+		rsp.err = rsp.readRecord()
+		if rsp.err != nil {
+			rsp.finishWriting()
+		}
+	}
+
+	n = copy(p, rsp.chunk)
+	rsp.chunk = rsp.chunk[n:]
+
+	return n, nil
+}
+
+// readRecord reads the next record of the response. FCGI_STDERR records are
+// passed to the stderr sink, the FCGI_END_REQUEST record ends the response
+// with io.EOF or with the error of the protocol status.
+func (rsp *Response) readRecord() (err error) {
+	var rec *dm.Record
+	rec, err = rsp.exchange.ReadRecordContext(rsp.ctx)
+	if err != nil {
+		if rsp.ctx.Err() != nil {
+			_ = rsp.exchange.Abort(AbortTimeoutDefault)
+			return rsp.ctx.Err()
+		}
+
+		return err
+	}
+
+	switch rec.Type {
+	case dm.FCGI_STDOUT:
+		rsp.chunk = rec.ContentData
+
+	case dm.FCGI_STDERR:
+		_, err = rsp.stderr.Write(rec.ContentData)
+		if err != nil {
+			return err
+		}
+
+	case dm.FCGI_END_REQUEST:
+		rsp.endBody, err = rec.ParseContentAsEndRequestBody()
+		if err != nil {
+			return err
+		}
+
+		rsp.endRecord = rec
+
+		err = rsp.endBody.Err()
+		if err != nil {
+			return err
+		}
+
+		return io.EOF
+	}
+
+	return nil
+}
+
+// finishWriting stops the writer of the request, if any, and waits for it.
+// The error of writing replaces the error of reading when it is the reason.
+func (rsp *Response) finishWriting() {
+	if rsp.requestWriter == nil {
+		return
+	}
+
+	rw := rsp.requestWriter
+	rsp.requestWriter = nil
+
+	readErr := rsp.err
+	if readErr == io.EOF {
+		readErr = nil
+	}
+
+	err := rw.Finish(readErr)
+	if err != nil {
+		rsp.err = err
+	}
+}
+
+// stdoutReader is the Stdout of a response.
+type stdoutReader struct {
+	rsp *Response
+}
+
+func (sr *stdoutReader) Read(p []byte) (n int, err error) {
+	return sr.rsp.read(p)
+}
@@ -0,0 +1,92 @@
+package cl
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func Test_Response(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, fcgitest.Reply(&fcgitest.Response{
+		Stdout:    []byte("Hello, World!"),
+		Stderr:    []byte("Warning"),
+		AppStatus: 3,
+	})).Address
+
+	c, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	ex, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(sendEmptyRequest(ex))
+
+	var stderr bytes.Buffer
+	rsp := ex.NewResponse(context.Background(), &stderr)
+	aTest.MustBeEqual(rsp.RequestId(), ex.RequestId())
+
+	_, err = rsp.EndRequest()
+	aTest.MustBeAnError(err)
+
+	// Read the stream with a tiny buffer to check that a record is read in
+	// parts.
+	buf := make([]byte, 3)
+	var stdout bytes.Buffer
+	_, err = io.CopyBuffer(&stdout, struct{ io.Reader }{rsp.Stdout}, buf)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(stdout.String(), "Hello, World!")
+	aTest.MustBeEqual(stderr.String(), "Warning")
+
+	rec, err := rsp.EndRequest()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(rec.Type, byte(dm.FCGI_END_REQUEST))
+	aTest.MustBeEqual(rec.RequestId, ex.RequestId())
+	aTest.MustBeEqual(rsp.AppStatus(), uint32(3))
+	aTest.MustBeEqual(rsp.ProtocolStatus(), byte(dm.FCGI_REQUEST_COMPLETE))
+
+	n, err := rsp.Stdout.Read(buf)
+	aTest.MustBeEqual(n, 0)
+	aTest.MustBeEqual(err, io.EOF)
+
+	aTest.MustBeNoError(rsp.Close())
+}
+
+func Test_Response_Overloaded(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, fcgitest.Reply(&fcgitest.Response{
+		ProtocolStatus: dm.FCGI_OVERLOADED,
+	})).Address
+
+	c, err := New(NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	ex, err := c.OpenExchange(dm.FCGI_NULL_REQUEST_ID)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(sendEmptyRequest(ex))
+
+	rsp := ex.NewResponse(context.Background(), nil)
+	_, err = io.ReadAll(rsp.Stdout)
+	aTest.MustBeEqual(errors.Is(err, dm.ErrOverloaded), true)
+	aTest.MustBeEqual(rsp.ProtocolStatus(), byte(dm.FCGI_OVERLOADED))
+
+	_, err = rsp.EndRequest()
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(rsp.Close())
+
+	// The connection is still usable.
+	aTest.MustBeEqual(c.IsBroken(), false)
+}
@@ -0,0 +1,156 @@
+package cl
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	// ManagementRecordsBufferSize is the number of management records kept
+	// by the multiplexer. Extra records are dropped.
+	ManagementRecordsBufferSize = 4
+)
+
+const (
+	ErrNoFreeRequestId    = "no free request ID"
+	ErrRequestIdIsBusy    = "request ID is busy: %v"
+	ErrConnectionIsClosed = "connection is closed"
+)
+
+// IsMultiplexed tells whether records of the connection are read by the
+// multiplexer.
+func (c *Client) IsMultiplexed() bool {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	return c.isMuxStarted
+}
+
+// IsBroken tells whether the multiplexer has stopped reading the connection
+// due to an error. A broken client can not be used any more.
+func (c *Client) IsBroken() bool {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	return c.muxErr != nil
+}
+
+// ActiveExchangesCount returns the number of exchanges which have not
+// received their FCGI_END_REQUEST records yet.
+func (c *Client) ActiveExchangesCount() (n int) {
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	return len(c.exchanges)
+}
+
+// startMux starts the multiplexer if it is not started yet. This method must
+// be called under the multiplexer's lock.
+func (c *Client) startMux() {
+	if c.isMuxStarted {
+		return
+	}
+
+	c.isMuxStarted = true
+	go c.runMux()
+}
+
+// runMux reads records of the connection and routes them to the exchanges
+// by their request IDs. Records of unknown requests are dropped. The
+// multiplexer never waits for an exchange to read its records.
+func (c *Client) runMux() {
+	var rec *dm.Record
+	var err error
+	var ex *Exchange
+
+	for {
+		rec, err = c.reader.ReadRecord()
+		if err != nil {
+			c.stopMux(err)
+			return
+		}
+
+		if rec.RequestId == dm.FCGI_NULL_REQUEST_ID {
+			select {
+			case c.managementRecs <- rec:
+			default:
+			}
+			continue
+		}
+
+		c.muxLock.Lock()
+		ex = c.exchanges[rec.RequestId]
+		if (ex != nil) && (rec.Type == dm.FCGI_END_REQUEST) {
+			// Request ID may be reused as soon as the request is complete.
+			delete(c.exchanges, rec.RequestId)
+		}
+		c.muxLock.Unlock()
+
+		if ex == nil {
+			continue
+		}
+
+		ex.deliver(rec)
+	}
+}
+
+// stopMux fails all the active exchanges.
+func (c *Client) stopMux(err error) {
+	defer close(c.muxStopped)
+
+	isEof := errors.Is(err, io.EOF)
+	if isEof {
+		err = errors.New(ErrConnectionIsClosed)
+	}
+
+	c.muxLock.Lock()
+	defer c.muxLock.Unlock()
+
+	// The first error is the reason, others are its consequences.
+	if c.muxErr == nil {
+		c.muxErr = err
+		c.isMuxEof = isEof
+	}
+	for id, ex := range c.exchanges {
+		ex.closeQueue()
+		delete(c.exchanges, id)
+	}
+}
+
+// breakConn marks the client as broken and closes the connection. It is used
+// when the state of the connection is unknown, so it can not be used by other
+// requests.
+func (c *Client) breakConn(err error) {
+	c.muxLock.Lock()
+	if c.muxErr == nil {
+		c.muxErr = err
+	}
+	c.muxLock.Unlock()
+
+	_ = c.conn.Close()
+}
+
+// allocateRequestId finds a free request ID. This method must be called under
+// the multiplexer's lock.
+func (c *Client) allocateRequestId() (requestId uint16, err error) {
+	if len(c.exchanges) >= math.MaxUint16 {
+		return 0, errors.New(ErrNoFreeRequestId)
+	}
+
+	requestId = c.lastRequestId
+	for {
+		requestId++
+		if requestId == dm.FCGI_NULL_REQUEST_ID {
+			continue
+		}
+
+		_, isBusy := c.exchanges[requestId]
+		if !isBusy {
+			c.lastRequestId = requestId
+			return requestId, nil
+		}
+	}
+}
@@ -0,0 +1,218 @@
+package px
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Transport"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/http"
+	"github.com/vault-thirteen/auxie/header"
+)
+
+// Hop-by-hop headers are not passed from scripts to clients.
+var hopByHopHeaders = []string{
+	header.HttpHeaderConnection,
+	header.HttpHeaderKeepAlive,
+	header.HttpHeaderProxyAuthenticate,
+	header.HttpHeaderProxyAuthorization,
+	header.HttpHeaderTE,
+	header.HttpHeaderTrailer,
+	header.HttpHeaderTransferEncoding,
+	header.HttpHeaderUpgrade,
+}
+
+// Settings of the proxy.
+type Settings struct {
+	// Document root folder of the FastCGI application.
+	DocumentRoot string
+
+	// Script file extensions, e.g. '.php'. The URL path is split after the
+	// first segment having one of the extensions, and the rest of the path
+	// is the PATH_INFO parameter. When no extensions are set, the whole path
+	// is the script name.
+	ScriptExtensions []string
+
+	// Script resolver, which overrides the document root and extensions.
+	Script tp.ScriptResolver
+
+	// Prefix of the path where the proxy is mounted, e.g. '/app'. The prefix
+	// is removed from the URL path before the script is resolved, and it is
+	// added to the SCRIPT_NAME parameter. Requests out of the prefix are not
+	// found.
+	Prefix string
+
+	// Name of the server software, the SERVER_SOFTWARE parameter.
+	ServerSoftware string
+
+	// Parameters added to every request.
+	Params []*nvpair.NameValuePair
+
+	// Parameters added to a request, after the 'Params'.
+	ParamsFunc func(req *http.Request) (params []*nvpair.NameValuePair)
+
+	// Output of scripts into stderr is written here. By default, it is
+	// dropped.
+	Stderr io.Writer
+
+	// ErrorHandler responds when the FastCGI request fails. By default, the
+	// error is logged and the client gets the 502 or 503 status.
+	ErrorHandler func(rw http.ResponseWriter, req *http.Request, err error)
+}
+
+// Proxy is an HTTP handler which passes requests to a FastCGI responder, such
+// as php-fpm, fcgiwrap or a Python flup application.
+type Proxy struct {
+	transport    *tp.Transport
+	prefix       string
+	errorHandler func(rw http.ResponseWriter, req *http.Request, err error)
+}
+
+func New(doer tp.Doer, settings *Settings) (p *Proxy) {
+	if settings == nil {
+		settings = &Settings{}
+	}
+
+	p = &Proxy{
+		prefix:       strings.TrimSuffix(settings.Prefix, "/"),
+		errorHandler: settings.ErrorHandler,
+	}
+
+	script := settings.Script
+	if script == nil {
+		script = tp.DocumentRootScript(settings.DocumentRoot, settings.ScriptExtensions...)
+	}
+	if len(p.prefix) > 0 {
+		script = withPrefix(script, p.prefix)
+	}
+
+	p.transport = tp.New(doer, &tp.Settings{
+		DocumentRoot:   settings.DocumentRoot,
+		Script:         script,
+		ServerSoftware: settings.ServerSoftware,
+		Params:         settings.Params,
+		ParamsFunc:     settings.ParamsFunc,
+		Stderr:         settings.Stderr,
+	})
+
+	if p.errorHandler == nil {
+		p.errorHandler = DefaultErrorHandler
+	}
+
+	return p
+}
+
+// ServeHTTP implements the 'http.Handler' interface.
+func (p *Proxy) ServeHTTP(rw http.ResponseWriter, req *http.Request) {
+	if !hasPathPrefix(req.URL.Path, p.prefix) {
+		http.NotFound(rw, req)
+		return
+	}
+
+	resp, err := p.transport.RoundTrip(req)
+	if err != nil {
+		p.errorHandler(rw, req, err)
+		return
+	}
+	defer func() {
+		_ = resp.Body.Close()
+	}()
+
+	for name, values := range resp.Header {
+		rw.Header()[name] = values
+	}
+	for _, name := range hopByHopHeaders {
+		rw.Header().Del(name)
+	}
+	rw.WriteHeader(resp.StatusCode)
+
+	err = copyFlushing(rw, resp.Body)
+	if err != nil {
+		// The status is sent already.
+		log.Println(err)
+	}
+}
+
+// DefaultErrorHandler responds with the 503 status when the FastCGI server is
+// overloaded or no backend of a group is available, and with the 502 status
+// on other errors. Nothing is sent when the client has gone away.
+func DefaultErrorHandler(rw http.ResponseWriter, req *http.Request, err error) {
+	if errors.Is(err, context.Canceled) {
+		return
+	}
+
+	log.Println(err)
+
+	if errors.Is(err, dm.ErrOverloaded) || errors.Is(err, us.ErrNoAvailableBackend) {
+		rw.Header().Set(header.HttpHeaderRetryAfter, strconv.Itoa(hm.RetryAfterOverloadedSec))
+		rw.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+
+	rw.WriteHeader(http.StatusBadGateway)
+}
+
+// copyFlushing copies the body flushing every chunk of it, so that output of
+// long-running scripts is seen by clients at once.
+func copyFlushing(rw http.ResponseWriter, body io.Reader) (err error) {
+	rc := http.NewResponseController(rw)
+	buf := make([]byte, 32*1024)
+
+	var n int
+	var readErr error
+	for {
+		n, readErr = body.Read(buf)
+		if n > 0 {
+			_, err = rw.Write(buf[:n])
+			if err != nil {
+				return err
+			}
+
+			err = rc.Flush()
+			if (err != nil) && !errors.Is(err, http.ErrNotSupported) {
+				return err
+			}
+		}
+
+		if readErr == io.EOF {
+			return nil
+		}
+		if readErr != nil {
+			return readErr
+		}
+	}
+}
+
+// withPrefix resolves the script by the path without the prefix, and adds the
+// prefix to the script name.
+func withPrefix(resolver tp.ScriptResolver, prefix string) tp.ScriptResolver {
+	return func(req *http.Request) (script *tp.Script, err error) {
+		r2 := *req
+		u2 := *req.URL
+		u2.Path = strings.TrimPrefix(u2.Path, prefix)
+		r2.URL = &u2
+
+		script, err = resolver(&r2)
+		if err != nil {
+			return nil, err
+		}
+
+		script.Name = prefix + script.Name
+		return script, nil
+	}
+}
+
+func hasPathPrefix(urlPath string, prefix string) bool {
+	if len(prefix) == 0 {
+		return true
+	}
+
+	return (urlPath == prefix) || strings.HasPrefix(urlPath, prefix+"/")
+}
@@ -0,0 +1,177 @@
+package px
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// appHandler is a FastCGI responder which lists the parameters in the
+// 'X-Param' headers and writes stdin into the body.
+func appHandler(r *fcgitest.Request) *fcgitest.Response {
+	var stdout bytes.Buffer
+	stdout.WriteString("Status: 202 Accepted\r\nConnection: close\r\n")
+	for _, p := range r.Params {
+		_, _ = fmt.Fprintf(&stdout, "X-Param: %s=%s\r\n", p.Name, p.Value)
+	}
+	stdout.WriteString("\r\n")
+	stdout.Write(r.Stdin)
+
+	return &fcgitest.Response{Stdout: stdout.Bytes()}
+}
+
+// startAppServer starts a scripted FastCGI server which is closed at the end
+// of the test.
+func startAppServer(t *testing.T, handler fcgitest.Handler) (address string) {
+	srv, err := fcgitest.NewServer(handler)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address = srv.Address
+	t.Cleanup(func() {
+		_ = srv.Close()
+		cl.ForgetCapabilities(cl.NetworkTcp, address)
+	})
+
+	return address
+}
+
+func newPool(t *testing.T, address string) (pool *cl.Pool) {
+	pool = cl.NewPool(cl.NetworkTcp, address, 4)
+	t.Cleanup(func() { _ = pool.Close() })
+
+	return pool
+}
+
+func params(resp *http.Response) (params map[string]string) {
+	params = make(map[string]string)
+	for _, p := range resp.Header.Values("X-Param") {
+		name, value, _ := strings.Cut(p, "=")
+		params[name] = value
+	}
+
+	return params
+}
+
+func Test_Proxy_Mounted(t *testing.T) {
+	aTest := tester.New(t)
+
+	pool := newPool(t, startAppServer(t, appHandler))
+	proxy := New(pool, &Settings{
+		DocumentRoot:     "/srv/app",
+		ScriptExtensions: []string{".py"},
+		Prefix:           "/app/",
+		ServerSoftware:   "proxy",
+		Params:           []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("APP_ENV", "test")},
+		ParamsFunc: func(req *http.Request) []*nvpair.NameValuePair {
+			return []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("APP_METHOD", req.Method)}
+		},
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("/app/", proxy)
+	front := httptest.NewServer(mux)
+	defer front.Close()
+
+	resp, err := http.Post(front.URL+"/app/main.py/users/1?x=y", "text/plain", strings.NewReader("body"))
+	aTest.MustBeNoError(err)
+	body, err := io.ReadAll(resp.Body)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(resp.Body.Close())
+
+	aTest.MustBeEqual(resp.StatusCode, http.StatusAccepted)
+	aTest.MustBeEqual(string(body), "body")
+	aTest.MustBeEqual(resp.Close, false)
+
+	p := params(resp)
+	aTest.MustBeEqual(p[dm.Parameter_DocumentRoot], "/srv/app")
+	aTest.MustBeEqual(p[dm.Parameter_ScriptFilename], "/srv/app/main.py")
+	aTest.MustBeEqual(p[dm.Parameter_ScriptName], "/app/main.py")
+	aTest.MustBeEqual(p[dm.Parameter_PathInfo], "/users/1")
+	aTest.MustBeEqual(p[dm.Parameter_RequestUri], "/app/main.py/users/1?x=y")
+	aTest.MustBeEqual(p[dm.Parameter_ServerSoftware], "proxy")
+	aTest.MustBeEqual(p["APP_ENV"], "test")
+	aTest.MustBeEqual(p["APP_METHOD"], http.MethodPost)
+}
+
+func Test_Proxy_OutOfPrefix(t *testing.T) {
+	aTest := tester.New(t)
+
+	pool := newPool(t, startAppServer(t, appHandler))
+	proxy := New(pool, &Settings{Prefix: "/app"})
+
+	for _, path := range []string{"/application", "/other"} {
+		rec := httptest.NewRecorder()
+		proxy.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, path, nil))
+		aTest.MustBeEqual(rec.Code, http.StatusNotFound)
+	}
+}
+
+func Test_Proxy_Errors(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Overloaded server.
+	address := startAppServer(t, fcgitest.Reply(&fcgitest.Response{ProtocolStatus: dm.FCGI_OVERLOADED}))
+
+	rec := httptest.NewRecorder()
+	New(newPool(t, address), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/b", nil))
+	aTest.MustBeEqual(rec.Code, http.StatusServiceUnavailable)
+	aTest.MustBeEqual(rec.Header().Get("Retry-After"), "1")
+
+	// Unknown role.
+	pool := newPool(t, startAppServer(t, fcgitest.Reply(&fcgitest.Response{ProtocolStatus: dm.FCGI_UNKNOWN_ROLE})))
+	rec = httptest.NewRecorder()
+	New(pool, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	aTest.MustBeEqual(rec.Code, http.StatusBadGateway)
+
+	// Nobody listens.
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	address = listener.Addr().String()
+	aTest.MustBeNoError(listener.Close())
+
+	rec = httptest.NewRecorder()
+	New(newPool(t, address), nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	aTest.MustBeEqual(rec.Code, http.StatusBadGateway)
+
+	// No available backend of a group.
+	group, err := us.New(&us.Settings{
+		Backends:    []us.BackendSettings{{Network: cl.NetworkTcp, Address: address}},
+		HealthCheck: &us.HealthCheckSettings{FailsToEject: 1},
+	})
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = group.Close()
+	}()
+	group.CheckHealth()
+
+	rec = httptest.NewRecorder()
+	New(group, nil).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	aTest.MustBeEqual(rec.Code, http.StatusServiceUnavailable)
+	aTest.MustBeEqual(rec.Header().Get("Retry-After"), "1")
+
+	// Custom handler.
+	var handledErr error
+	rec = httptest.NewRecorder()
+	New(newPool(t, address), &Settings{
+		ErrorHandler: func(rw http.ResponseWriter, req *http.Request, err error) {
+			handledErr = err
+			rw.WriteHeader(http.StatusTeapot)
+		},
+	}).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/", nil))
+	aTest.MustBeEqual(rec.Code, http.StatusTeapot)
+	aTest.MustBeEqual(handledErr != nil, true)
+}
@@ -0,0 +1,196 @@
+package rc
+
+import (
+	"errors"
+	"net"
+	"sync"
+
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+const (
+	ErrConnIsNotRecorded = "connection is not recorded"
+)
+
+// ErrBackendIsClosed is returned by the Serve method after the backend is
+// closed.
+var ErrBackendIsClosed = errors.New("backend is closed")
+
+// Backend is a fake FastCGI application which plays a recorded session back
+// to a web server. Each accepted connection plays the next recorded
+// connection: the recorded responses are sent after the recorded requests
+// are received.
+type Backend struct {
+	conns    [][]*Entry
+	settings *ReplaySettings
+
+	lock       *sync.Mutex
+	next       int
+	mismatches []string
+	listeners  map[net.Listener]struct{}
+	netConns   map[net.Conn]struct{}
+	isClosed   bool
+	closed     chan struct{}
+	wg         *sync.WaitGroup
+}
+
+// NewBackend creates a backend playing the session. Nil settings mean the
+// zero settings.
+func NewBackend(session *Session, settings *ReplaySettings) (b *Backend) {
+	if settings == nil {
+		settings = &ReplaySettings{}
+	}
+
+	return &Backend{
+		conns:     session.Connections(),
+		settings:  settings,
+		lock:      new(sync.Mutex),
+		listeners: make(map[net.Listener]struct{}),
+		netConns:  make(map[net.Conn]struct{}),
+		closed:    make(chan struct{}),
+		wg:        new(sync.WaitGroup),
+	}
+}
+
+// ListenAndServe listens on the address and serves the accepted connections.
+func (b *Backend) ListenAndServe(network string, address string) (err error) {
+	var listener net.Listener
+	listener, err = net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	return b.Serve(listener)
+}
+
+// Serve accepts connections of the listener until the backend is closed. The
+// listener is closed by the backend.
+func (b *Backend) Serve(listener net.Listener) (err error) {
+	if !b.addListener(listener) {
+		_ = listener.Close()
+		return ErrBackendIsClosed
+	}
+
+	var netConn net.Conn
+	for {
+		netConn, err = listener.Accept()
+		if err != nil {
+			if b.IsClosed() {
+				return ErrBackendIsClosed
+			}
+
+			return err
+		}
+
+		go b.ServeConn(netConn)
+	}
+}
+
+// ServeConn plays the next recorded connection. A connection which is not
+// recorded is closed at once.
+func (b *Backend) ServeConn(netConn net.Conn) {
+	entries, connNumber, ok := b.addConn(netConn)
+	if !ok {
+		_ = netConn.Close()
+		return
+	}
+	defer b.removeConn(netConn)
+
+	rp := newReplayer(b.settings, SideServer, netConn, connNumber, b.closed)
+	if entries == nil {
+		rp.mismatch(ErrConnIsNotRecorded)
+	} else {
+		_ = rp.play(entries)
+	}
+	_ = netConn.Close()
+
+	b.lock.Lock()
+	b.mismatches = append(b.mismatches, rp.mismatches...)
+	b.lock.Unlock()
+}
+
+// Mismatches returns differences between the received records and the
+// recorded ones. An empty list means that the web server has behaved as it
+// has been recorded.
+func (b *Backend) Mismatches() (mismatches []string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return append([]string{}, b.mismatches...)
+}
+
+// Close closes all the listeners and connections of the backend and waits
+// for the connections to stop.
+func (b *Backend) Close() (err error) {
+	b.lock.Lock()
+
+	if b.isClosed {
+		b.lock.Unlock()
+		return nil
+	}
+
+	b.isClosed = true
+	close(b.closed)
+
+	for listener := range b.listeners {
+		err = ae.Combine(err, listener.Close())
+	}
+
+	for netConn := range b.netConns {
+		_ = netConn.Close()
+	}
+
+	b.lock.Unlock()
+
+	b.wg.Wait()
+
+	return err
+}
+
+func (b *Backend) IsClosed() (isClosed bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.isClosed
+}
+
+func (b *Backend) addListener(listener net.Listener) (ok bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.isClosed {
+		return false
+	}
+
+	b.listeners[listener] = struct{}{}
+	return true
+}
+
+// addConn registers the connection and takes the next recorded connection.
+func (b *Backend) addConn(netConn net.Conn) (entries []*Entry, connNumber int, ok bool) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if b.isClosed {
+		return nil, 0, false
+	}
+
+	b.netConns[netConn] = struct{}{}
+	b.wg.Add(1)
+
+	b.next++
+	connNumber = b.next
+	if connNumber <= len(b.conns) {
+		entries = b.conns[connNumber-1]
+	}
+
+	return entries, connNumber, true
+}
+
+func (b *Backend) removeConn(netConn net.Conn) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	delete(b.netConns, netConn)
+	b.wg.Done()
+}
@@ -0,0 +1,44 @@
+package rc
+
+import (
+	"context"
+	"net"
+)
+
+// Play is a fake web server which plays the recorded requests of a session
+// back to a FastCGI application. The recorded connections are played one by
+// one: the recorded requests are sent and the responses are compared with
+// the recorded ones. Differences are returned as mismatches, while an error
+// is returned when a connection can not be made or the context is done. Nil
+// settings mean the zero settings.
+func Play(ctx context.Context, network string, address string, session *Session, settings *ReplaySettings) (mismatches []string, err error) {
+	if settings == nil {
+		settings = &ReplaySettings{}
+	}
+
+	var d net.Dialer
+	for i, entries := range session.Connections() {
+		var netConn net.Conn
+		netConn, err = d.DialContext(ctx, network, address)
+		if err != nil {
+			return mismatches, err
+		}
+
+		stop := context.AfterFunc(ctx, func() {
+			_ = netConn.Close()
+		})
+
+		rp := newReplayer(settings, SideClient, netConn, i+1, ctx.Done())
+		_ = rp.play(entries)
+		_ = netConn.Close()
+		stop()
+
+		mismatches = append(mismatches, rp.mismatches...)
+
+		if ctx.Err() != nil {
+			return mismatches, ctx.Err()
+		}
+	}
+
+	return mismatches, nil
+}
@@ -0,0 +1,282 @@
+package rc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+const (
+	DialTimeoutDefault = 10 * time.Second
+)
+
+const (
+	ErrAddressIsNotSet = "address of the backend is not set"
+)
+
+// ErrRecorderIsClosed is returned by the Serve method after the recorder is
+// closed.
+var ErrRecorderIsClosed = errors.New("recorder is closed")
+
+// RecorderSettings are settings of the recorder.
+type RecorderSettings struct {
+	// Backend, e.g. php-fpm.
+	Network string
+	Address string
+
+	// Zero timeout is replaced with the default value.
+	DialTimeout time.Duration
+}
+
+// Recorder is a transparent proxy which records every record of both
+// directions of its connections. A connection accepted by the recorder is
+// forwarded to a new connection to the backend.
+type Recorder struct {
+	network     string
+	address     string
+	dialTimeout time.Duration
+	writer      *SessionWriter
+	start       time.Time
+
+	lock      *sync.Mutex
+	lastConn  int
+	listeners map[net.Listener]struct{}
+	conns     map[net.Conn]struct{}
+	isClosed  bool
+	wg        *sync.WaitGroup
+}
+
+// NewRecorder creates a recorder writing the session to the writer. The
+// session starts now.
+func NewRecorder(settings *RecorderSettings, w io.Writer) (r *Recorder, err error) {
+	if !cl.IsNetworkSupported(settings.Network) {
+		return nil, fmt.Errorf(cl.ErrNetworkIsNotSupported, settings.Network)
+	}
+	if len(settings.Address) == 0 {
+		return nil, errors.New(ErrAddressIsNotSet)
+	}
+
+	r = &Recorder{
+		network:     settings.Network,
+		address:     settings.Address,
+		dialTimeout: settings.DialTimeout,
+		writer:      NewSessionWriter(w),
+		start:       time.Now(),
+		lock:        new(sync.Mutex),
+		listeners:   make(map[net.Listener]struct{}),
+		conns:       make(map[net.Conn]struct{}),
+		wg:          new(sync.WaitGroup),
+	}
+
+	if r.dialTimeout <= 0 {
+		r.dialTimeout = DialTimeoutDefault
+	}
+
+	return r, nil
+}
+
+// ListenAndServe listens on the address and serves the accepted connections.
+func (r *Recorder) ListenAndServe(network string, address string) (err error) {
+	var listener net.Listener
+	listener, err = net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	return r.Serve(listener)
+}
+
+// Serve accepts connections of the listener until the recorder is closed.
+// The listener is closed by the recorder.
+func (r *Recorder) Serve(listener net.Listener) (err error) {
+	if !r.addListener(listener) {
+		_ = listener.Close()
+		return ErrRecorderIsClosed
+	}
+
+	var netConn net.Conn
+	for {
+		netConn, err = listener.Accept()
+		if err != nil {
+			if r.IsClosed() {
+				return ErrRecorderIsClosed
+			}
+
+			return err
+		}
+
+		go r.ServeConn(netConn)
+	}
+}
+
+// ServeConn forwards the connection to the backend until one of the sides
+// closes its connection.
+func (r *Recorder) ServeConn(clientConn net.Conn) {
+	if !r.addConn(clientConn) {
+		_ = clientConn.Close()
+		return
+	}
+	defer r.removeConn(clientConn)
+
+	connNumber := r.nextConn()
+	r.write(&Entry{Conn: connNumber, Time: r.now(), Event: EventOpen})
+
+	serverConn, err := net.DialTimeout(r.network, r.address, r.dialTimeout)
+	if err != nil {
+		_ = clientConn.Close()
+		r.write(&Entry{Conn: connNumber, Time: r.now(), Event: EventClose, From: SideServer, Error: err.Error()})
+		return
+	}
+	if !r.addConn(serverConn) {
+		_ = serverConn.Close()
+		_ = clientConn.Close()
+		return
+	}
+	defer r.removeConn(serverConn)
+
+	type pipeEnd struct {
+		from string
+		err  error
+	}
+	ends := make(chan pipeEnd, 2)
+	go func() { ends <- pipeEnd{from: SideClient, err: r.pipe(connNumber, SideClient, clientConn, serverConn)} }()
+	go func() { ends <- pipeEnd{from: SideServer, err: r.pipe(connNumber, SideServer, serverConn, clientConn)} }()
+
+	// The side which has ended first has closed the connection. The other
+	// side is stopped by closing its connection.
+	end := <-ends
+	_ = clientConn.Close()
+	_ = serverConn.Close()
+	<-ends
+
+	// A connection closed by the recorder is closed by none of the sides.
+	e := &Entry{Conn: connNumber, Time: r.now(), Event: EventClose}
+	if !r.IsClosed() {
+		e.From = end.from
+		if !errors.Is(end.err, io.EOF) {
+			e.Error = end.err.Error()
+		}
+	}
+	r.write(e)
+}
+
+// pipe records and forwards records of the source until it fails. A record
+// is recorded before it is forwarded, so that a response is never recorded
+// before its request.
+func (r *Recorder) pipe(connNumber int, from string, src net.Conn, dst net.Conn) (err error) {
+	br := bufio.NewReader(src)
+
+	var rec *dm.Record
+	var ba []byte
+	for {
+		rec, err = dm.NewRecordFromStream(br)
+		if err != nil {
+			return err
+		}
+
+		r.write(NewRecordEntry(connNumber, r.now(), from, rec))
+
+		ba, err = rec.ToBytes()
+		if err != nil {
+			return err
+		}
+
+		_, err = dst.Write(ba)
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// write writes the entry. Errors of writing are not fatal for the traffic,
+// so they are ignored.
+func (r *Recorder) write(e *Entry) {
+	_ = r.writer.Write(e)
+}
+
+func (r *Recorder) now() (t time.Duration) {
+	return time.Since(r.start)
+}
+
+// Close closes all the listeners and connections of the recorder and waits
+// for the connections to be recorded.
+func (r *Recorder) Close() (err error) {
+	r.lock.Lock()
+
+	if r.isClosed {
+		r.lock.Unlock()
+		return nil
+	}
+
+	r.isClosed = true
+
+	for listener := range r.listeners {
+		err = ae.Combine(err, listener.Close())
+	}
+
+	for netConn := range r.conns {
+		_ = netConn.Close()
+	}
+
+	r.lock.Unlock()
+
+	r.wg.Wait()
+
+	return err
+}
+
+func (r *Recorder) IsClosed() (isClosed bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return r.isClosed
+}
+
+func (r *Recorder) nextConn() (connNumber int) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	r.lastConn++
+	return r.lastConn
+}
+
+func (r *Recorder) addListener(listener net.Listener) (ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.isClosed {
+		return false
+	}
+
+	r.listeners[listener] = struct{}{}
+	return true
+}
+
+func (r *Recorder) addConn(netConn net.Conn) (ok bool) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	if r.isClosed {
+		return false
+	}
+
+	r.conns[netConn] = struct{}{}
+	r.wg.Add(1)
+	return true
+}
+
+func (r *Recorder) removeConn(netConn net.Conn) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	delete(r.conns, netConn)
+	r.wg.Done()
+}
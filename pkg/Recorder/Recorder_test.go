@@ -0,0 +1,265 @@
+package rc
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func listen(t *testing.T) (listener net.Listener) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return listener
+}
+
+// startAppServer starts a FastCGI responder which greets the NAME parameter.
+func startAppServer(t *testing.T, greeting string) (address string) {
+	srv, err := fcgitest.NewServer(func(r *fcgitest.Request) *fcgitest.Response {
+		name, _ := r.Param("NAME")
+		return &fcgitest.Response{
+			Stdout:    []byte(fmt.Sprintf("Status: 404 Not Found\r\nContent-Type: text/html\r\n\r\n<p>%v, %v!</p>", greeting, name)),
+			Stderr:    []byte("notice"),
+			AppStatus: 3,
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv.Address
+}
+
+func result(greeting string, name string) string {
+	return fmt.Sprintf("Status: 404 Not Found\r\nContent-Type: text/html\r\n\r\n<p>%v, %v!</p>|notice|3", greeting, name)
+}
+
+// doRequests sends two requests over a kept connection and one request over
+// a connection closed by the server.
+func doRequests(t *testing.T, address string) (stdouts []string) {
+	c, err := cl.New(cl.NetworkTcp, address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = c.Close() }()
+
+	for _, name := range []string{"Alice", "Bob", "Carol"} {
+		if name == "Carol" {
+			_ = c.Close()
+			c, err = cl.New(cl.NetworkTcp, address)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		var rsp *cl.Response
+		rsp, err = c.Do(context.Background(), &cl.Request{
+			Role:     dm.FCGI_RESPONDER,
+			KeepConn: name != "Carol",
+			Params:   []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("NAME", name)},
+			Stdin:    strings.NewReader("a=b"),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var stdout []byte
+		stdout, err = io.ReadAll(rsp.Stdout)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_ = rsp.Close()
+
+		stdouts = append(stdouts, fmt.Sprintf("%s|%s|%v", stdout, rsp.Stderr(), rsp.AppStatus()))
+	}
+
+	return stdouts
+}
+
+func record(t *testing.T) (s *Session) {
+	address := startAppServer(t, "Hello")
+
+	buf := new(bytes.Buffer)
+	r, err := NewRecorder(&RecorderSettings{Network: cl.NetworkTcp, Address: address}, buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	listener := listen(t)
+	go func() { _ = r.Serve(listener) }()
+
+	stdouts := doRequests(t, listener.Addr().String())
+	if stdouts[0] != result("Hello", "Alice") {
+		t.Fatal(stdouts)
+	}
+
+	err = r.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = ReadSession(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func Test_Recorder(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := record(t)
+	conns := s.Connections()
+	aTest.MustBeEqual(len(conns), 2)
+
+	// Connections are opened, closed and have records of both sides.
+	for i, entries := range conns {
+		aTest.MustBeEqual(entries[0].Event, EventOpen)
+		aTest.MustBeEqual(entries[0].Conn, i+1)
+
+		last := entries[len(entries)-1]
+		aTest.MustBeEqual(last.Event, EventClose)
+		if i == 0 {
+			aTest.MustBeEqual(last.From, SideClient)
+		} else {
+			aTest.MustBeEqual(last.From, SideServer)
+		}
+		aTest.MustBeEqual(last.Error, "")
+
+		for j := 1; j < len(entries); j++ {
+			aTest.MustBeEqual(entries[j].Time >= entries[j-1].Time, true)
+		}
+	}
+
+	exchanges := s.Exchanges()
+	aTest.MustBeEqual(len(exchanges), 3)
+	for i, name := range []string{"Alice", "Bob", "Carol"} {
+		x := exchanges[i]
+		aTest.MustBeEqual(x.Request[0].Type, byte(dm.FCGI_BEGIN_REQUEST))
+		aTest.MustBeEqual(x.Response[len(x.Response)-1].Type, byte(dm.FCGI_END_REQUEST))
+		aTest.MustBeEqual(string(dm.GetStdOutFromRecords(x.Response)), "Status: 404 Not Found\r\nContent-Type: text/html\r\n\r\n<p>Hello, "+name+"!</p>")
+		aTest.MustBeEqual(string(dm.GetStdErrFromRecords(x.Response)), "notice")
+	}
+	aTest.MustBeEqual(exchanges[2].Conn, 2)
+
+	// Stdout is readable in the file, parameters are not a text.
+	buf := new(bytes.Buffer)
+	sw := NewSessionWriter(buf)
+	for _, e := range s.Entries {
+		aTest.MustBeNoError(sw.Write(e))
+	}
+	aTest.MustBeEqual(strings.Contains(buf.String(), `"text":"Status: 404 Not Found\r\nContent-Type: text/html\r\n\r\n<p>Hello, Alice!</p>"`), true)
+
+	s2, err := ReadSession(buf)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(s2, s)
+}
+
+func Test_Backend(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := record(t)
+
+	b := NewBackend(s, nil)
+	listener := listen(t)
+	go func() { _ = b.Serve(listener) }()
+
+	// The web server gets the recorded responses without the application.
+	stdouts := doRequests(t, listener.Addr().String())
+	aTest.MustBeEqual(stdouts, []string{result("Hello", "Alice"), result("Hello", "Bob"), result("Hello", "Carol")})
+
+	aTest.MustBeNoError(b.Close())
+	aTest.MustBeEqual(b.Mismatches(), []string{})
+}
+
+func Test_Backend_Mismatches(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := record(t)
+
+	b := NewBackend(s, &ReplaySettings{IsContentCompared: true})
+	listener := listen(t)
+	go func() { _ = b.Serve(listener) }()
+
+	c, err := cl.New(cl.NetworkTcp, listener.Addr().String())
+	aTest.MustBeNoError(err)
+	defer func() { _ = c.Close() }()
+
+	// Parameters differ.
+	rsp, err := c.Do(context.Background(), &cl.Request{
+		Role:     dm.FCGI_RESPONDER,
+		KeepConn: true,
+		Params:   []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("NAME", "Dave")},
+		Stdin:    strings.NewReader("a=b"),
+	})
+	aTest.MustBeNoError(err)
+	_, err = io.ReadAll(rsp.Stdout)
+	aTest.MustBeNoError(err)
+	_ = rsp.Close()
+
+	// Another record instead of the second request, then the connection is
+	// closed too early.
+	err = c.SendRecord(dm.FCGI_ABORT_REQUEST, 2, nil)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(c.Close())
+
+	var mismatches []string
+	for start := time.Now(); (len(mismatches) < 3) && (time.Since(start) < 5*time.Second); time.Sleep(10 * time.Millisecond) {
+		mismatches = b.Mismatches()
+	}
+	aTest.MustBeNoError(b.Close())
+
+	aTest.MustBeEqual(mismatches, []string{
+		`connection 1, entry 2: content of record of type 4 of request 1 differs: "\x04\x05NAMEAlice" is expected, "\x04\x04NAMEDave" is received`,
+		"connection 1, entry 11: record of type 1 of request 2 is expected, record of type 2 of request 2 is received",
+		"connection 1, entry 12: record of type 4 of request 2 is expected, reading has failed: EOF",
+	})
+}
+
+func Test_Play(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := record(t)
+
+	// The same application.
+	mismatches, err := Play(context.Background(), cl.NetworkTcp, startAppServer(t, "Hello"), s, &ReplaySettings{IsContentCompared: true})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(len(mismatches), 0)
+
+	// Another application.
+	mismatches, err = Play(context.Background(), cl.NetworkTcp, startAppServer(t, "Bye"), s, &ReplaySettings{IsContentCompared: true})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(len(mismatches), 3)
+	aTest.MustBeEqual(strings.HasPrefix(mismatches[0], "connection 1, entry 6: content of record of type 6 of request 1 differs: "), true)
+
+	// A connection which can not be made.
+	listener := listen(t)
+	address := listener.Addr().String()
+	_ = listener.Close()
+	_, err = Play(context.Background(), cl.NetworkTcp, address, s, nil)
+	aTest.MustBeAnError(err)
+}
+
+func Test_NewRecorder(t *testing.T) {
+	aTest := tester.New(t)
+
+	_, err := NewRecorder(&RecorderSettings{Network: "udp", Address: "127.0.0.1:9000"}, io.Discard)
+	aTest.MustBeAnError(err)
+
+	_, err = NewRecorder(&RecorderSettings{Network: cl.NetworkTcp}, io.Discard)
+	aTest.MustBeEqual(err.Error(), ErrAddressIsNotSet)
+}
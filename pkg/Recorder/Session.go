@@ -0,0 +1,225 @@
+package rc
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+// Events of a session.
+const (
+	EventOpen   = "open"
+	EventRecord = "record"
+	EventClose  = "close"
+)
+
+// Sides of a connection. The client is a web server, the server is a FastCGI
+// application.
+const (
+	SideClient = "client"
+	SideServer = "server"
+)
+
+// Entry is an event of a recorded session. A session file has an entry per
+// line in the JSON format.
+type Entry struct {
+	// Number of the connection, starting from 1.
+	Conn int `json:"conn"`
+
+	// Time passed since the start of the session.
+	Time time.Duration `json:"time"`
+
+	Event string `json:"event"`
+
+	// Side which has sent the record or has closed the connection. A
+	// connection closed by the recorder has no side.
+	From string `json:"from,omitempty"`
+
+	// Record. Content which is a valid UTF-8 text is stored as a text to be
+	// readable, other content is stored in the Base64 encoding.
+	Type      dm.RecordType `json:"type,omitempty"`
+	RequestId uint16        `json:"requestId,omitempty"`
+	Text      string        `json:"text,omitempty"`
+	Content   []byte        `json:"content,omitempty"`
+	Padding   []byte        `json:"padding,omitempty"`
+	Reserved  byte          `json:"reserved,omitempty"`
+
+	// Error which has closed the connection.
+	Error string `json:"error,omitempty"`
+}
+
+// NewRecordEntry creates an entry of a record.
+func NewRecordEntry(conn int, t time.Duration, from string, rec *dm.Record) (e *Entry) {
+	e = &Entry{
+		Conn:      conn,
+		Time:      t,
+		Event:     EventRecord,
+		From:      from,
+		Type:      rec.Type,
+		RequestId: rec.RequestId,
+		Padding:   rec.PaddingData,
+		Reserved:  rec.Reserved,
+	}
+
+	if utf8.Valid(rec.ContentData) {
+		e.Text = string(rec.ContentData)
+	} else {
+		e.Content = rec.ContentData
+	}
+
+	return e
+}
+
+// Record returns the record of the entry.
+func (e *Entry) Record() (rec *dm.Record) {
+	rec = &dm.Record{
+		Version:     dm.FCGI_VERSION_1,
+		Type:        e.Type,
+		RequestId:   e.RequestId,
+		Reserved:    e.Reserved,
+		ContentData: e.Content,
+		PaddingData: e.Padding,
+	}
+
+	if len(e.Text) > 0 {
+		rec.ContentData = []byte(e.Text)
+	}
+
+	rec.ContentLength = uint16(len(rec.ContentData))
+	rec.PaddingLength = byte(len(rec.PaddingData))
+
+	return rec
+}
+
+// Session is a recorded session.
+type Session struct {
+	Entries []*Entry
+}
+
+// ReadSession reads a session written by the SessionWriter.
+func ReadSession(r io.Reader) (s *Session, err error) {
+	s = &Session{Entries: []*Entry{}}
+	dec := json.NewDecoder(r)
+
+	for {
+		e := &Entry{}
+		err = dec.Decode(e)
+		if errors.Is(err, io.EOF) {
+			return s, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		s.Entries = append(s.Entries, e)
+	}
+}
+
+// LoadSession reads a session file.
+func LoadSession(filePath string) (s *Session, err error) {
+	var file *os.File
+	file, err = os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer func() {
+		derr := file.Close()
+		if derr != nil {
+			err = ae.Combine(err, derr)
+		}
+	}()
+
+	return ReadSession(file)
+}
+
+// Connections returns entries of each connection in the order in which the
+// connections have been opened.
+func (s *Session) Connections() (conns [][]*Entry) {
+	indices := make(map[int]int)
+
+	for _, e := range s.Entries {
+		i, ok := indices[e.Conn]
+		if !ok {
+			i = len(conns)
+			indices[e.Conn] = i
+			conns = append(conns, nil)
+		}
+
+		conns[i] = append(conns[i], e)
+	}
+
+	return conns
+}
+
+// Exchange is an application request and its response.
+type Exchange struct {
+	Conn      int
+	RequestId uint16
+	Request   []*dm.Record
+	Response  []*dm.Record
+}
+
+// Exchanges returns the requests of the session in the order in which they
+// have begun, e.g. to collect stdout of recorded scripts. Management records
+// are skipped.
+func (s *Session) Exchanges() (exchanges []*Exchange) {
+	type key struct {
+		conn      int
+		requestId uint16
+	}
+	active := make(map[key]*Exchange)
+
+	for _, e := range s.Entries {
+		if (e.Event != EventRecord) || (e.RequestId == dm.FCGI_NULL_REQUEST_ID) {
+			continue
+		}
+
+		k := key{conn: e.Conn, requestId: e.RequestId}
+		x := active[k]
+		if (x == nil) || ((e.Type == dm.FCGI_BEGIN_REQUEST) && (e.From == SideClient)) {
+			x = &Exchange{Conn: e.Conn, RequestId: e.RequestId}
+			active[k] = x
+			exchanges = append(exchanges, x)
+		}
+
+		if e.From == SideClient {
+			x.Request = append(x.Request, e.Record())
+		} else {
+			x.Response = append(x.Response, e.Record())
+		}
+	}
+
+	return exchanges
+}
+
+// SessionWriter writes entries of a session. It is safe for concurrent use.
+type SessionWriter struct {
+	lock *sync.Mutex
+	enc  *json.Encoder
+}
+
+func NewSessionWriter(w io.Writer) (sw *SessionWriter) {
+	sw = &SessionWriter{
+		lock: new(sync.Mutex),
+		enc:  json.NewEncoder(w),
+	}
+
+	// Stdout of scripts is HTML, mostly.
+	sw.enc.SetEscapeHTML(false)
+
+	return sw
+}
+
+func (sw *SessionWriter) Write(e *Entry) (err error) {
+	sw.lock.Lock()
+	defer sw.lock.Unlock()
+
+	return sw.enc.Encode(e)
+}
@@ -0,0 +1,156 @@
+package rc
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// ReplaySettings are settings of replaying a session.
+type ReplaySettings struct {
+	// When it is set, pauses before the records sent by the player are kept
+	// as they have been recorded. Otherwise, records are sent at once.
+	IsTimingKept bool
+
+	// When it is set, contents of the received records are compared with the
+	// recorded ones. Otherwise, only types and request IDs are compared,
+	// which suits parameters having a remote port, a time and so on.
+	IsContentCompared bool
+}
+
+// replayer plays the recorded connection from the side. Records of the side
+// are sent, records of the other side are received and compared with the
+// recorded ones.
+type replayer struct {
+	settings   *ReplaySettings
+	side       string
+	netConn    net.Conn
+	br         *bufio.Reader
+	connNumber int
+	mismatches []string
+
+	// Pauses are interrupted when the channel is closed.
+	stop <-chan struct{}
+}
+
+func newReplayer(settings *ReplaySettings, side string, netConn net.Conn, connNumber int, stop <-chan struct{}) (rp *replayer) {
+	return &replayer{
+		settings:   settings,
+		side:       side,
+		netConn:    netConn,
+		br:         bufio.NewReader(netConn),
+		connNumber: connNumber,
+		stop:       stop,
+	}
+}
+
+// play plays the entries of a connection. When the session has no closing
+// entry, the server waits for the client to close the connection, while the
+// client closes it at once. A connection closed by the recorder is closed at
+// once by both sides. An error is returned when the connection fails.
+func (rp *replayer) play(entries []*Entry) (err error) {
+	var prev time.Duration
+	if len(entries) > 0 {
+		prev = entries[0].Time
+	}
+
+	for i, e := range entries {
+		switch e.Event {
+		case EventRecord:
+			if e.From == rp.side {
+				err = rp.send(e, e.Time-prev)
+			} else {
+				err = rp.receive(i, e)
+			}
+			if err != nil {
+				return err
+			}
+
+		case EventClose:
+			// The connection is closed by the other side, by this side or
+			// by the recorder.
+			if (len(e.From) > 0) && (e.From != rp.side) {
+				return rp.waitForClose()
+			}
+			return nil
+		}
+
+		prev = e.Time
+	}
+
+	if rp.side == SideServer {
+		return rp.waitForClose()
+	}
+
+	return nil
+}
+
+func (rp *replayer) send(e *Entry, pause time.Duration) (err error) {
+	if rp.settings.IsTimingKept && (pause > 0) {
+		timer := time.NewTimer(pause)
+		select {
+		case <-timer.C:
+		case <-rp.stop:
+			timer.Stop()
+			return net.ErrClosed
+		}
+	}
+
+	var ba []byte
+	ba, err = e.Record().ToBytes()
+	if err != nil {
+		return err
+	}
+
+	_, err = rp.netConn.Write(ba)
+	return err
+}
+
+func (rp *replayer) receive(i int, e *Entry) (err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(rp.br)
+	if err != nil {
+		rp.mismatch("entry %v: record of type %v of request %v is expected, reading has failed: %v", i, e.Type, e.RequestId, err)
+		return err
+	}
+
+	expected := e.Record()
+	switch {
+	case (rec.Type != expected.Type) || (rec.RequestId != expected.RequestId):
+		rp.mismatch("entry %v: record of type %v of request %v is expected, record of type %v of request %v is received",
+			i, expected.Type, expected.RequestId, rec.Type, rec.RequestId)
+
+	case rp.settings.IsContentCompared && !bytes.Equal(rec.ContentData, expected.ContentData):
+		rp.mismatch("entry %v: content of record of type %v of request %v differs: %q is expected, %q is received",
+			i, expected.Type, expected.RequestId, expected.ContentData, rec.ContentData)
+	}
+
+	return nil
+}
+
+// waitForClose reads the connection until the other side closes it. Records
+// received meanwhile are not expected.
+func (rp *replayer) waitForClose() (err error) {
+	var rec *dm.Record
+	for {
+		rec, err = dm.NewRecordFromStream(rp.br)
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		rp.mismatch("unexpected record of type %v of request %v", rec.Type, rec.RequestId)
+	}
+}
+
+func (rp *replayer) mismatch(format string, a ...any) {
+	rp.mismatches = append(rp.mismatches, fmt.Sprintf("connection %v, ", rp.connNumber)+fmt.Sprintf(format, a...))
+}
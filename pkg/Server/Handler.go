@@ -0,0 +1,19 @@
+package sv
+
+// Handler serves FastCGI requests. The returned application status is sent to
+// the client in the FCGI_END_REQUEST record. For the FCGI_RESPONDER role, it is
+// an exit code of a CGI script.
+//
+// Handlers are run concurrently. Output written into the response writer is
+// sent to the client when the buffer is full, when the writer is flushed and
+// when the handler returns.
+type Handler interface {
+	ServeFastCGI(w *ResponseWriter, r *Request) (appStatus uint32)
+}
+
+// HandlerFunc is an ordinary function used as a handler.
+type HandlerFunc func(w *ResponseWriter, r *Request) (appStatus uint32)
+
+func (f HandlerFunc) ServeFastCGI(w *ResponseWriter, r *Request) (appStatus uint32) {
+	return f(w, r)
+}
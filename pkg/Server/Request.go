@@ -0,0 +1,114 @@
+package sv
+
+import (
+	"bufio"
+	"context"
+	"io"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
+)
+
+const (
+	// StdoutBufferSize is the size of the buffer of the FCGI_STDOUT stream.
+	StdoutBufferSize = 32 * 1024
+
+	// StderrBufferSize is the size of the buffer of the FCGI_STDERR stream.
+	StderrBufferSize = 4 * 1024
+)
+
+// Request is a FastCGI request received by the server.
+type Request struct {
+	RequestId uint16
+	Role      dm.Role
+	KeepConn  bool
+	Params    []*nvpair.NameValuePair
+
+	// Stdin is the FCGI_STDIN stream. It is read while the records arrive.
+	Stdin io.Reader
+
+	// Data is the FCGI_DATA stream of the FCGI_FILTER role. For other roles
+	// the stream is empty.
+	Data io.Reader
+
+	ctx context.Context
+}
+
+// Context returns the context of the request. The context is cancelled when
+// the request is aborted by the client or when the connection is closed.
+func (r *Request) Context() (ctx context.Context) {
+	return r.ctx
+}
+
+// Param returns the value of the first parameter having the name.
+func (r *Request) Param(name string) (value string, ok bool) {
+	for _, p := range r.Params {
+		if string(p.Name) == name {
+			return string(p.Value), true
+		}
+	}
+
+	return "", false
+}
+
+// ResponseWriter writes the FCGI_STDOUT and FCGI_STDERR streams of a request.
+// Writing into the ResponseWriter itself is writing into stdout.
+type ResponseWriter struct {
+	stdout       *bufio.Writer
+	stderr       *bufio.Writer
+	stdoutStream *rm.StreamWriter
+	stderrStream *rm.StreamWriter
+}
+
+func newResponseWriter(w io.Writer, requestId uint16) (rw *ResponseWriter) {
+	rw = &ResponseWriter{
+		stdoutStream: rm.NewStdOutWriter(w, requestId),
+		stderrStream: rm.NewStdErrWriter(w, requestId),
+	}
+
+	rw.stdout = bufio.NewWriterSize(rw.stdoutStream, StdoutBufferSize)
+	rw.stderr = bufio.NewWriterSize(rw.stderrStream, StderrBufferSize)
+
+	return rw
+}
+
+// Write implements the io.Writer interface.
+func (rw *ResponseWriter) Write(p []byte) (n int, err error) {
+	return rw.stdout.Write(p)
+}
+
+// Stdout returns the writer of the FCGI_STDOUT stream.
+func (rw *ResponseWriter) Stdout() (w io.Writer) {
+	return rw.stdout
+}
+
+// Stderr returns the writer of the FCGI_STDERR stream.
+func (rw *ResponseWriter) Stderr() (w io.Writer) {
+	return rw.stderr
+}
+
+// Flush sends the buffered output to the client.
+func (rw *ResponseWriter) Flush() (err error) {
+	err = rw.stderr.Flush()
+	if err != nil {
+		return err
+	}
+
+	return rw.stdout.Flush()
+}
+
+// close flushes the output and ends both streams.
+func (rw *ResponseWriter) close() (err error) {
+	err = rw.Flush()
+	if err != nil {
+		return err
+	}
+
+	err = rw.stderrStream.Close()
+	if err != nil {
+		return err
+	}
+
+	return rw.stdoutStream.Close()
+}
@@ -0,0 +1,293 @@
+package sv
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+// Default limits of the server.
+const (
+	MaxConnsDefault = 64
+	MaxReqsDefault  = 1024
+)
+
+const (
+	FcgiMpxsConnsEnabled  = "1"
+	FcgiMpxsConnsDisabled = "0"
+)
+
+// ErrServerIsClosed is returned by the Serve method after the server is
+// closed.
+var ErrServerIsClosed = errors.New("server is closed")
+
+// Settings of the server. Zero limits are replaced with default values.
+type Settings struct {
+	// Maximum number of connections served at a time by all the listeners.
+	// More connections wait to be served.
+	MaxConns int
+
+	// Maximum number of requests served at a time by all the connections.
+	// More requests are rejected with the FCGI_OVERLOADED status.
+	MaxReqs int
+
+	// When multiplexing is disabled, a second concurrent request of a
+	// connection is rejected with the FCGI_CANT_MPX_CONN status.
+	IsMultiplexingDisabled bool
+
+	// Size of the buffer in memory of an input stream of a request. When the
+	// handler reads a stream slower than it comes, the connection waits for
+	// the handler, or, when multiplexing is enabled, the rest of the stream
+	// is kept in a temporary file.
+	StreamBufferSize int
+
+	// Roles served by the handler. Empty list means all the three roles.
+	// Requests of other roles are rejected with the FCGI_UNKNOWN_ROLE status.
+	Roles []dm.Role
+}
+
+// Server is a FastCGI application server. It decodes requests of accepted
+// connections and serves them by the handler. Requests of a connection are
+// served concurrently.
+type Server struct {
+	handler          Handler
+	maxConns         int
+	maxReqs          int
+	isMultiplexing   bool
+	streamBufferSize int
+	roles            map[dm.Role]bool
+
+	// Slots of connections being served, shared by all the listeners.
+	connSlots chan struct{}
+
+	lock       *sync.Mutex
+	activeReqs int
+	listeners  map[net.Listener]struct{}
+	conns      map[*conn]struct{}
+	isClosed   bool
+	closed     chan struct{}
+}
+
+func New(handler Handler, settings *Settings) (srv *Server) {
+	if settings == nil {
+		settings = &Settings{}
+	}
+
+	srv = &Server{
+		handler:          handler,
+		maxConns:         settings.MaxConns,
+		maxReqs:          settings.MaxReqs,
+		isMultiplexing:   !settings.IsMultiplexingDisabled,
+		streamBufferSize: settings.StreamBufferSize,
+		roles:            make(map[dm.Role]bool),
+		lock:             new(sync.Mutex),
+		listeners:        make(map[net.Listener]struct{}),
+		conns:            make(map[*conn]struct{}),
+		closed:           make(chan struct{}),
+	}
+
+	if srv.maxConns <= 0 {
+		srv.maxConns = MaxConnsDefault
+	}
+	if srv.maxReqs <= 0 {
+		srv.maxReqs = MaxReqsDefault
+	}
+	if srv.streamBufferSize <= 0 {
+		srv.streamBufferSize = StreamBufferSizeDefault
+	}
+	srv.connSlots = make(chan struct{}, srv.maxConns)
+
+	roles := settings.Roles
+	if len(roles) == 0 {
+		roles = []dm.Role{dm.FCGI_RESPONDER, dm.FCGI_AUTHORIZER, dm.FCGI_FILTER}
+	}
+	for _, role := range roles {
+		srv.roles[role] = true
+	}
+
+	return srv
+}
+
+// ListenAndServe listens on the address and serves the accepted connections.
+func (srv *Server) ListenAndServe(network string, address string) (err error) {
+	var listener net.Listener
+	listener, err = net.Listen(network, address)
+	if err != nil {
+		return err
+	}
+
+	return srv.Serve(listener)
+}
+
+// Serve accepts connections of the listener until the server is closed. The
+// listener is closed by the server.
+func (srv *Server) Serve(listener net.Listener) (err error) {
+	if !srv.addListener(listener) {
+		_ = listener.Close()
+		return ErrServerIsClosed
+	}
+	defer srv.removeListener(listener)
+
+	var netConn net.Conn
+	for {
+		netConn, err = listener.Accept()
+		if err != nil {
+			if srv.IsClosed() {
+				return ErrServerIsClosed
+			}
+
+			return err
+		}
+
+		// An accepted connection waits for a free slot, while a listener
+		// waiting for a connection holds no slot.
+		select {
+		case srv.connSlots <- struct{}{}:
+		case <-srv.closed:
+			_ = netConn.Close()
+			return ErrServerIsClosed
+		}
+
+		go func(netConn net.Conn) {
+			defer func() { <-srv.connSlots }()
+			srv.ServeConn(netConn)
+		}(netConn)
+	}
+}
+
+// ServeConn serves the connection until it is closed.
+func (srv *Server) ServeConn(netConn net.Conn) {
+	c := newConn(srv, netConn)
+	if !srv.addConn(c) {
+		_ = netConn.Close()
+		return
+	}
+	defer srv.removeConn(c)
+
+	c.serve()
+}
+
+// Close closes all the listeners and connections of the server. Requests
+// being served see the closed input streams and the cancelled context.
+func (srv *Server) Close() (err error) {
+	srv.lock.Lock()
+
+	if srv.isClosed {
+		srv.lock.Unlock()
+		return nil
+	}
+
+	srv.isClosed = true
+	close(srv.closed)
+
+	for listener := range srv.listeners {
+		err = ae.Combine(err, listener.Close())
+	}
+
+	conns := make([]*conn, 0, len(srv.conns))
+	for c := range srv.conns {
+		conns = append(conns, c)
+	}
+	srv.lock.Unlock()
+
+	// The reader of a connection may wait for a handler, so the connection
+	// is closed here rather than by its reader. Connections release requests
+	// under the lock of the server.
+	for _, c := range conns {
+		c.close()
+	}
+
+	return err
+}
+
+func (srv *Server) IsClosed() (isClosed bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	return srv.isClosed
+}
+
+func (srv *Server) addListener(listener net.Listener) (ok bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.isClosed {
+		return false
+	}
+
+	srv.listeners[listener] = struct{}{}
+	return true
+}
+
+func (srv *Server) removeListener(listener net.Listener) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	delete(srv.listeners, listener)
+	_ = listener.Close()
+}
+
+func (srv *Server) addConn(c *conn) (ok bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.isClosed {
+		return false
+	}
+
+	srv.conns[c] = struct{}{}
+	return true
+}
+
+func (srv *Server) removeConn(c *conn) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	delete(srv.conns, c)
+}
+
+func (srv *Server) isRoleSupported(role dm.Role) bool {
+	return srv.roles[role]
+}
+
+// acquireRequest takes a place for a request unless the server is overloaded.
+func (srv *Server) acquireRequest() (ok bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.activeReqs >= srv.maxReqs {
+		return false
+	}
+
+	srv.activeReqs++
+	return true
+}
+
+func (srv *Server) releaseRequest() {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.activeReqs--
+}
+
+// value returns a value of the FCGI_GET_VALUES variable.
+func (srv *Server) value(name string) (value string, ok bool) {
+	switch name {
+	case cm.FCGI_MAX_CONNS:
+		return strconv.Itoa(srv.maxConns), true
+	case cm.FCGI_MAX_REQS:
+		return strconv.Itoa(srv.maxReqs), true
+	case cm.FCGI_MPXS_CONNS:
+		if srv.isMultiplexing {
+			return FcgiMpxsConnsEnabled, true
+		}
+		return FcgiMpxsConnsDisabled, true
+	default:
+		return "", false
+	}
+}
@@ -0,0 +1,467 @@
+package sv
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startServer starts the server on a random TCP port.
+func startServer(t *testing.T, handler Handler, settings *Settings) (address string) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := New(handler, settings)
+	go func() { _ = srv.Serve(listener) }()
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return listener.Addr().String()
+}
+
+// echoHandler writes the role and parameters into stderr, and copies stdin
+// and data into stdout. The application status is the length of stdout.
+var echoHandler = HandlerFunc(func(w *ResponseWriter, r *Request) (appStatus uint32) {
+	name, _ := r.Param("NAME")
+	_, _ = fmt.Fprintf(w.Stderr(), "role=%v name=%v", r.Role, name)
+
+	n1, _ := io.Copy(w, r.Stdin)
+	n2, _ := io.Copy(w, r.Data)
+
+	return uint32(n1 + n2)
+})
+
+func do(c *cl.Client, req *cl.Request) (stdout []byte, rsp *cl.Response, err error) {
+	rsp, err = c.Do(context.Background(), req)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer rsp.Close()
+
+	stdout, err = io.ReadAll(rsp.Stdout)
+	return stdout, rsp, err
+}
+
+func Test_Server_Roles(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, echoHandler, nil)
+	c, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	params := []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("NAME", "x")}
+	stdin := strings.Repeat("i", 100_000)
+
+	for _, role := range []dm.Role{dm.FCGI_RESPONDER, dm.FCGI_AUTHORIZER, dm.FCGI_FILTER} {
+		var data io.Reader
+		if role == dm.FCGI_FILTER {
+			data = strings.NewReader("data")
+		}
+
+		stdout, rsp, err := do(c, &cl.Request{
+			Role:     role,
+			KeepConn: true,
+			Params:   params,
+			Stdin:    strings.NewReader(stdin),
+			Data:     data,
+		})
+		aTest.MustBeNoError(err)
+
+		expected := stdin
+		if role == dm.FCGI_FILTER {
+			expected += "data"
+		}
+		aTest.MustBeEqual(string(stdout), expected)
+		aTest.MustBeEqual(rsp.AppStatus(), uint32(len(expected)))
+		aTest.MustBeEqual(string(rsp.Stderr()), fmt.Sprintf("role=%v name=x", role))
+	}
+}
+
+func Test_Server_GetValues(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, echoHandler, &Settings{MaxConns: 3, MaxReqs: 7})
+	defer cl.ForgetCapabilities(cl.NetworkTcp, address)
+
+	c, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	caps, err := c.GetValues(context.Background())
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps, &cl.Capabilities{
+		IsSupported: true,
+		MaxConns:    3,
+		MaxReqs:     7,
+		MpxsConns:   true,
+		Others:      map[string]string{},
+	})
+}
+
+func Test_Server_UnknownType(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, echoHandler, nil)
+	conn, err := net.Dial(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = conn.Close()
+	}()
+
+	aTest.MustBeNoError(dm.WriteRecord(conn, 100, dm.FCGI_NULL_REQUEST_ID, []byte{1, 2, 3}))
+
+	rec, err := dm.NewRecordFromStream(conn)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(rec.Type, byte(dm.FCGI_UNKNOWN_TYPE))
+
+	body, err := dm.NewUnknownTypeRequestBodyFromBytes(rec.ContentData)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(body.Type, byte(100))
+}
+
+func Test_Server_UnknownRole(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, echoHandler, &Settings{Roles: []dm.Role{dm.FCGI_RESPONDER}})
+	c, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	for _, role := range []dm.Role{dm.FCGI_FILTER, 9} {
+		_, rsp, err := do(c, &cl.Request{Role: role, KeepConn: true})
+		aTest.MustBeEqual(errors.Is(err, dm.ErrUnknownRole), true)
+		aTest.MustBeEqual(rsp.ProtocolStatus(), byte(dm.FCGI_UNKNOWN_ROLE))
+	}
+
+	// The connection is still usable.
+	stdout, _, err := do(c, &cl.Request{KeepConn: true, Stdin: strings.NewReader("ok")})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(string(stdout), "ok")
+}
+
+func Test_Server_Multiplexing(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Each handler waits until all the requests are being served.
+	const n = 20
+	var arrived sync.WaitGroup
+	arrived.Add(n)
+	handler := HandlerFunc(func(w *ResponseWriter, r *Request) (appStatus uint32) {
+		arrived.Done()
+		arrived.Wait()
+
+		_, _ = io.Copy(w, r.Stdin)
+		return 0
+	})
+
+	address := startServer(t, handler, nil)
+	defer cl.ForgetCapabilities(cl.NetworkTcp, address)
+
+	pool := cl.NewMultiplexingPool(cl.NetworkTcp, address, 1, n)
+	defer func() {
+		_ = pool.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	errs := make(chan error, n)
+	for j := 0; j < n; j++ {
+		go func() {
+			expected := fmt.Sprintf("request %d", j)
+
+			rsp, err := pool.Do(ctx, &cl.Request{KeepConn: true, Stdin: strings.NewReader(expected)})
+			if err != nil {
+				errs <- err
+				return
+			}
+			defer rsp.Close()
+
+			stdout, err := io.ReadAll(rsp.Stdout)
+			if (err == nil) && (string(stdout) != expected) {
+				err = fmt.Errorf("unexpected stdout: %q", stdout)
+			}
+			errs <- err
+		}()
+	}
+
+	for j := 0; j < n; j++ {
+		aTest.MustBeNoError(<-errs)
+	}
+}
+
+// startBlockedServer starts a server whose handler waits until the channel is
+// closed or the request is aborted. The handler reports the reason.
+func startBlockedServer(t *testing.T, settings *Settings) (address string, started chan struct{}, release chan struct{}, reasons chan error) {
+	started = make(chan struct{}, 16)
+	release = make(chan struct{})
+	reasons = make(chan error, 16)
+
+	handler := HandlerFunc(func(w *ResponseWriter, r *Request) (appStatus uint32) {
+		started <- struct{}{}
+
+		select {
+		case <-release:
+			reasons <- nil
+		case <-r.Context().Done():
+			reasons <- r.Context().Err()
+		}
+
+		return 0
+	})
+
+	return startServer(t, handler, settings), started, release, reasons
+}
+
+func Test_Server_CantMpxConn(t *testing.T) {
+	aTest := tester.New(t)
+
+	address, started, release, _ := startBlockedServer(t, &Settings{IsMultiplexingDisabled: true})
+	c, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	rsp1, err := c.Do(context.Background(), &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+	<-started
+
+	_, _, err = do(c, &cl.Request{KeepConn: true})
+	aTest.MustBeEqual(errors.Is(err, dm.ErrCantMpxConn), true)
+
+	close(release)
+	_, err = io.ReadAll(rsp1.Stdout)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(rsp1.Close())
+}
+
+func Test_Server_Overloaded(t *testing.T) {
+	aTest := tester.New(t)
+
+	address, started, release, _ := startBlockedServer(t, &Settings{MaxReqs: 1})
+
+	c1, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c1.Close()
+	}()
+	c2, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c2.Close()
+	}()
+
+	rsp1, err := c1.Do(context.Background(), &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+	<-started
+
+	_, _, err = do(c2, &cl.Request{KeepConn: true})
+	aTest.MustBeEqual(errors.Is(err, dm.ErrOverloaded), true)
+
+	close(release)
+	_, err = io.ReadAll(rsp1.Stdout)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(rsp1.Close())
+
+	// The place is free again.
+	_, _, err = do(c2, &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+}
+
+func Test_Server_Abort(t *testing.T) {
+	aTest := tester.New(t)
+
+	address, started, _, reasons := startBlockedServer(t, nil)
+	c, err := cl.New(cl.NetworkTcp, address)
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c.Close()
+	}()
+
+	// The connection is still usable after an abort.
+	for j := 0; j < 2; j++ {
+		rsp, err := c.Do(context.Background(), &cl.Request{KeepConn: true})
+		aTest.MustBeNoError(err)
+		<-started
+
+		aTest.MustBeNoError(rsp.Close())
+		aTest.MustBeEqual(<-reasons, context.Canceled)
+	}
+}
+
+func Test_Server_KeepConn(t *testing.T) {
+	aTest := tester.New(t)
+
+	address := startServer(t, echoHandler, nil)
+
+	for _, keepConn := range []bool{true, false} {
+		conn, err := net.Dial(cl.NetworkTcp, address)
+		aTest.MustBeNoError(err)
+
+		var flags byte
+		if keepConn {
+			flags = dm.FCGI_KEEP_CONN
+		}
+
+		var buf bytes.Buffer
+		aTest.MustBeNoError(dm.WriteRecord(&buf, dm.FCGI_BEGIN_REQUEST, 1, dm.NewBeginRequestBody(dm.FCGI_RESPONDER, flags).ToBytes()))
+		aTest.MustBeNoError(dm.WriteRecord(&buf, dm.FCGI_PARAMS, 1, nil))
+		aTest.MustBeNoError(dm.WriteRecord(&buf, dm.FCGI_STDIN, 1, nil))
+		_, err = conn.Write(buf.Bytes())
+		aTest.MustBeNoError(err)
+
+		rr := dm.NewRecordReader(conn, true)
+		var rec *dm.Record
+		for {
+			rec, err = rr.ReadRecord()
+			aTest.MustBeNoError(err)
+			if rec.Type == dm.FCGI_END_REQUEST {
+				break
+			}
+		}
+
+		aTest.MustBeNoError(conn.SetReadDeadline(time.Now().Add(200 * time.Millisecond)))
+		_, err = rr.ReadRecord()
+		if keepConn {
+			var netErr net.Error
+			aTest.MustBeEqual(errors.As(err, &netErr) && netErr.Timeout(), true)
+		} else {
+			aTest.MustBeEqual(err, io.EOF)
+		}
+
+		_ = conn.Close()
+	}
+}
+
+func Test_Server_SlowHandler(t *testing.T) {
+	aTest := tester.New(t)
+
+	// The handler of the slow request starts reading stdin when the whole
+	// request is sent, and reports the temporary files of the streams.
+	const size = 4 * 1024 * 1024
+	payload := make([]byte, size)
+	_, _ = rand.Read(payload)
+	tmpDir := t.TempDir()
+	t.Setenv("TMPDIR", tmpDir)
+	handler := HandlerFunc(func(w *ResponseWriter, r *Request) (appStatus uint32) {
+		name, _ := r.Param("NAME")
+		if name != "slow" {
+			_, _ = io.Copy(w, r.Stdin)
+			return 0
+		}
+
+		time.Sleep(300 * time.Millisecond)
+		files, _ := os.ReadDir(tmpDir)
+		_, _ = fmt.Fprintf(w, "files=%v", len(files))
+
+		stdin, err := io.ReadAll(r.Stdin)
+		if err != nil {
+			_, _ = fmt.Fprintf(w.Stderr(), "%v", err)
+		} else if !bytes.Equal(stdin, payload) {
+			_, _ = fmt.Fprint(w.Stderr(), "stdin is corrupted")
+		}
+
+		return uint32(len(stdin))
+	})
+
+	for _, isMultiplexingDisabled := range []bool{true, false} {
+		address := startServer(t, handler, &Settings{
+			IsMultiplexingDisabled: isMultiplexingDisabled,
+			StreamBufferSize:       64 * 1024,
+		})
+		c, err := cl.New(cl.NetworkTcp, address)
+		aTest.MustBeNoError(err)
+
+		rsp, err := c.Do(context.Background(), &cl.Request{
+			KeepConn: true,
+			Params:   []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU("NAME", "slow")},
+			Stdin:    bytes.NewReader(payload),
+		})
+		aTest.MustBeNoError(err)
+
+		// Other requests of a multiplexed connection are served meanwhile.
+		expectedFiles := "files=0"
+		if !isMultiplexingDisabled {
+			stdout, _, err := do(c, &cl.Request{KeepConn: true, Stdin: strings.NewReader("fast")})
+			aTest.MustBeNoError(err)
+			aTest.MustBeEqual(string(stdout), "fast")
+			expectedFiles = "files=1"
+		}
+
+		stdout, err := io.ReadAll(rsp.Stdout)
+		aTest.MustBeNoError(err)
+		aTest.MustBeNoError(rsp.Close())
+		aTest.MustBeEqual(string(stdout), expectedFiles)
+		aTest.MustBeEqual(string(rsp.Stderr()), "")
+		aTest.MustBeEqual(rsp.AppStatus(), uint32(size))
+
+		files, err := os.ReadDir(tmpDir)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(len(files), 0)
+
+		_ = c.Close()
+	}
+}
+
+func Test_Server_MaxConns(t *testing.T) {
+	aTest := tester.New(t)
+
+	// The limit is shared by the listeners.
+	srv := New(echoHandler, &Settings{MaxConns: 1})
+	t.Cleanup(func() { _ = srv.Close() })
+
+	var addresses []string
+	for j := 0; j < 2; j++ {
+		listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+		aTest.MustBeNoError(err)
+		go func() { _ = srv.Serve(listener) }()
+		addresses = append(addresses, listener.Addr().String())
+	}
+
+	c1, err := cl.New(cl.NetworkTcp, addresses[0])
+	aTest.MustBeNoError(err)
+	_, _, err = do(c1, &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+
+	c2, err := cl.New(cl.NetworkTcp, addresses[1])
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = c2.Close()
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	_, err = c2.ProbeValues(ctx)
+	cancel()
+	aTest.MustBeEqual(err, context.DeadlineExceeded)
+
+	aTest.MustBeNoError(c1.Close())
+
+	ctx, cancel = context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	_, err = c2.ProbeValues(ctx)
+	aTest.MustBeNoError(err)
+	cl.ForgetCapabilities(cl.NetworkTcp, addresses[1])
+}
@@ -0,0 +1,380 @@
+package sv
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net"
+	"sync"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// Errors of input streams seen by handlers.
+var (
+	ErrRequestIsAborted   = errors.New("request is aborted")
+	ErrConnectionIsClosed = errors.New("connection is closed")
+)
+
+// conn is a connection accepted by the server.
+type conn struct {
+	srv     *Server
+	netConn net.Conn
+	reader  *dm.RecordReader
+	writer  *connWriter
+
+	// Requests being served, by request ID. Requests are added by the reader
+	// of the connection and are removed when they end.
+	lock     *sync.Mutex
+	requests map[uint16]*request
+
+	// This flag is set when a request without the FCGI_KEEP_CONN flag ends.
+	// The connection is closed when no requests are left.
+	isClosing bool
+}
+
+// request is a state of a request being received.
+type request struct {
+	id       uint16
+	role     dm.Role
+	keepConn bool
+
+	// Content of the FCGI_PARAMS stream. The handler is started when the
+	// stream ends.
+	params    bytes.Buffer
+	isStarted bool
+
+	stdin  *streamBuffer
+	data   *streamBuffer
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// connWriter writes whole records into the connection. Records of different
+// requests are never mixed.
+type connWriter struct {
+	lock   *sync.Mutex
+	conn   net.Conn
+	writer *dm.RecordWriter
+}
+
+func newConn(srv *Server, netConn net.Conn) (c *conn) {
+	return &conn{
+		srv:     srv,
+		netConn: netConn,
+		reader:  dm.NewBufferedRecordReader(netConn, false, 0),
+		writer: &connWriter{
+			lock:   new(sync.Mutex),
+			conn:   netConn,
+			writer: dm.NewRecordWriter(netConn),
+		},
+		lock:     new(sync.Mutex),
+		requests: make(map[uint16]*request),
+	}
+}
+
+// WriteRecord implements the 'i.IRecordWriter' interface.
+func (cw *connWriter) WriteRecord(recordType dm.RecordType, requestId uint16, content []byte) (err error) {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	return cw.writer.WriteRecord(recordType, requestId, content)
+}
+
+// Write writes the data into the connection by a single call. It is used by
+// stream writers only when they can not write records themselves.
+func (cw *connWriter) Write(p []byte) (n int, err error) {
+	cw.lock.Lock()
+	defer cw.lock.Unlock()
+
+	return cw.conn.Write(p)
+}
+
+// serve reads records of the connection until it is closed.
+func (c *conn) serve() {
+	defer c.close()
+
+	var rec dm.Record
+	var err error
+	for {
+		err = c.reader.ReadRecordInto(&rec)
+		if err != nil {
+			return
+		}
+
+		err = c.handleRecord(&rec)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// close closes the connection. Requests being served see the closed input
+// streams and the cancelled context.
+func (c *conn) close() {
+	_ = c.netConn.Close()
+
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	for id, req := range c.requests {
+		req.cancel()
+		req.stdin.CloseWithError(ErrConnectionIsClosed)
+		req.data.CloseWithError(ErrConnectionIsClosed)
+
+		if !req.isStarted {
+			req.stdin.CloseRead()
+			req.data.CloseRead()
+			delete(c.requests, id)
+			c.srv.releaseRequest()
+		}
+	}
+}
+
+func (c *conn) handleRecord(rec *dm.Record) (err error) {
+	if rec.RequestId == dm.FCGI_NULL_REQUEST_ID {
+		return c.handleManagementRecord(rec)
+	}
+
+	switch rec.Type {
+	case dm.FCGI_BEGIN_REQUEST:
+		return c.beginRequest(rec)
+	case dm.FCGI_ABORT_REQUEST:
+		return c.abortRequest(rec.RequestId)
+	case dm.FCGI_PARAMS:
+		return c.addParams(rec)
+	case dm.FCGI_STDIN:
+		return c.addStreamData(rec, func(req *request) *streamBuffer { return req.stdin })
+	case dm.FCGI_DATA:
+		return c.addStreamData(rec, func(req *request) *streamBuffer { return req.data })
+	default:
+		// Records of other types are not sent by clients.
+		return nil
+	}
+}
+
+// handleManagementRecord answers the FCGI_GET_VALUES record. Management
+// records of other types are answered with the FCGI_UNKNOWN_TYPE record.
+func (c *conn) handleManagementRecord(rec *dm.Record) (err error) {
+	if rec.Type != dm.FCGI_GET_VALUES {
+		body := dm.NewUnknownTypeRequestBody(rec.Type)
+		return c.writer.WriteRecord(dm.FCGI_UNKNOWN_TYPE, dm.FCGI_NULL_REQUEST_ID, body.ToBytes())
+	}
+
+	var names []*nvpair.NameValuePair
+	names, err = rec.ParseContentAsNVPs()
+	if err != nil {
+		return err
+	}
+
+	values := make([]*nvpair.NameValuePair, 0, len(names))
+	var value string
+	var ok bool
+	for _, name := range names {
+		value, ok = c.srv.value(string(name.Name))
+		if !ok {
+			continue
+		}
+
+		values = append(values, nvpair.NewNameValuePairWithTextValueU(string(name.Name), value))
+	}
+
+	var buf bytes.Buffer
+	err = dm.WriteParametersToBytesBuffer(&buf, values)
+	if err != nil {
+		return err
+	}
+
+	return c.writer.WriteRecord(dm.FCGI_GET_VALUES_RESULT, dm.FCGI_NULL_REQUEST_ID, buf.Bytes())
+}
+
+func (c *conn) beginRequest(rec *dm.Record) (err error) {
+	var brb dm.BeginRequestBody
+	brb, err = dm.NewBeginRequestBodyFromBytes(rec.ContentData)
+	if err != nil {
+		return err
+	}
+
+	id := rec.RequestId
+	keepConn := brb.Flags&dm.FCGI_KEEP_CONN != 0
+
+	c.lock.Lock()
+	_, isActive := c.requests[id]
+	activeCount := len(c.requests)
+	c.lock.Unlock()
+
+	// The specification tells to ignore a request having the ID of an active
+	// request.
+	if isActive {
+		return nil
+	}
+
+	if !c.srv.isRoleSupported(brb.Role) {
+		return c.endRequest(id, 0, dm.FCGI_UNKNOWN_ROLE, keepConn)
+	}
+
+	if (activeCount > 0) && !c.srv.isMultiplexing {
+		return c.endRequest(id, 0, dm.FCGI_CANT_MPX_CONN, keepConn)
+	}
+
+	if !c.srv.acquireRequest() {
+		return c.endRequest(id, 0, dm.FCGI_OVERLOADED, keepConn)
+	}
+
+	req := &request{
+		id:       id,
+		role:     brb.Role,
+		keepConn: keepConn,
+		stdin:    newStreamBuffer(c.srv.streamBufferSize, c.srv.isMultiplexing),
+		data:     newStreamBuffer(c.srv.streamBufferSize, c.srv.isMultiplexing),
+	}
+	req.ctx, req.cancel = context.WithCancel(context.Background())
+
+	// Only a filter receives data.
+	if req.role != dm.FCGI_FILTER {
+		req.data.CloseWithError(nil)
+	}
+
+	c.lock.Lock()
+	c.requests[id] = req
+	c.lock.Unlock()
+
+	return nil
+}
+
+func (c *conn) abortRequest(id uint16) (err error) {
+	req := c.getRequest(id)
+	if req == nil {
+		return nil
+	}
+
+	if !req.isStarted {
+		req.stdin.CloseRead()
+		req.data.CloseRead()
+		c.srv.releaseRequest()
+		return c.endRequest(id, 0, dm.FCGI_REQUEST_COMPLETE, req.keepConn)
+	}
+
+	req.cancel()
+	req.stdin.CloseWithError(ErrRequestIsAborted)
+	req.data.CloseWithError(ErrRequestIsAborted)
+
+	return nil
+}
+
+// addParams collects the FCGI_PARAMS stream. A name-value pair may be split
+// between records, so the pairs are parsed when the stream ends.
+func (c *conn) addParams(rec *dm.Record) (err error) {
+	req := c.getRequest(rec.RequestId)
+	if (req == nil) || req.isStarted {
+		return nil
+	}
+
+	if len(rec.ContentData) > 0 {
+		req.params.Write(rec.ContentData)
+		return nil
+	}
+
+	var params []*nvpair.NameValuePair
+	params, err = parseParams(req.params.Bytes())
+	if err != nil {
+		return err
+	}
+
+	c.lock.Lock()
+	req.isStarted = true
+	c.lock.Unlock()
+
+	go c.runRequest(req, params)
+
+	return nil
+}
+
+func (c *conn) addStreamData(rec *dm.Record, stream func(req *request) *streamBuffer) (err error) {
+	req := c.getRequest(rec.RequestId)
+	if req == nil {
+		return nil
+	}
+
+	if len(rec.ContentData) == 0 {
+		stream(req).CloseWithError(nil)
+		return nil
+	}
+
+	_, err = stream(req).Write(rec.ContentData)
+	return err
+}
+
+// runRequest runs the handler and ends the request.
+func (c *conn) runRequest(req *request, params []*nvpair.NameValuePair) {
+	rw := newResponseWriter(c.writer, req.id)
+
+	appStatus := c.srv.handler.ServeFastCGI(rw, &Request{
+		RequestId: req.id,
+		Role:      req.role,
+		KeepConn:  req.keepConn,
+		Params:    params,
+		Stdin:     req.stdin,
+		Data:      req.data,
+		ctx:       req.ctx,
+	})
+
+	req.stdin.CloseRead()
+	req.data.CloseRead()
+	req.cancel()
+	c.srv.releaseRequest()
+
+	err := rw.close()
+	if err != nil {
+		_ = c.netConn.Close()
+	}
+
+	_ = c.endRequest(req.id, appStatus, dm.FCGI_REQUEST_COMPLETE, req.keepConn)
+}
+
+// endRequest sends the FCGI_END_REQUEST record. The request ID is released
+// before the record is sent, so that the client may reuse it at once.
+func (c *conn) endRequest(id uint16, appStatus uint32, protocolStatus byte, keepConn bool) (err error) {
+	c.lock.Lock()
+	delete(c.requests, id)
+	if !keepConn {
+		c.isClosing = true
+	}
+	isClosingNow := c.isClosing && (len(c.requests) == 0)
+	c.lock.Unlock()
+
+	body := dm.NewEndRequestBody(appStatus, protocolStatus)
+	err = c.writer.WriteRecord(dm.FCGI_END_REQUEST, id, body.ToBytes())
+
+	if isClosingNow {
+		_ = c.netConn.Close()
+	}
+
+	return err
+}
+
+func (c *conn) getRequest(id uint16) (req *request) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+
+	return c.requests[id]
+}
+
+// parseParams parses name-value pairs of the whole FCGI_PARAMS stream.
+func parseParams(ba []byte) (params []*nvpair.NameValuePair, err error) {
+	params = make([]*nvpair.NameValuePair, 0)
+	rdr := bytes.NewReader(ba)
+
+	var nvp *nvpair.NameValuePair
+	for rdr.Len() > 0 {
+		nvp, err = nvpair.NewNameValuePairFromStream(rdr)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, nvp)
+	}
+
+	return params, nil
+}
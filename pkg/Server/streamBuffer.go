@@ -0,0 +1,183 @@
+package sv
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"sync"
+)
+
+const (
+	// StreamBufferSizeDefault is the default size of the buffer in memory of
+	// an input stream.
+	StreamBufferSizeDefault = 1024 * 1024
+
+	// StreamSpillFilePattern is the name pattern of temporary files of input
+	// streams.
+	StreamSpillFilePattern = "fcgi-stream-*"
+)
+
+// streamBuffer is a pipe of an input stream, such as FCGI_STDIN, with a
+// buffer. Records are written into the buffer by the reader of the
+// connection, and the handler reads the stream.
+//
+// When the buffer in memory is full and the connection has a single request,
+// the writer waits for the handler, so that the client waits as well. A
+// multiplexed connection is never held back by a single request, so the data
+// which does not fit into memory is written into a temporary file.
+type streamBuffer struct {
+	lock    *sync.Mutex
+	cond    *sync.Cond
+	buf     bytes.Buffer
+	size    int
+	isSpill bool
+
+	// Temporary file with the data written after the data in memory, and
+	// offsets of writing and reading in it.
+	file      *os.File
+	fileWrite int64
+	fileRead  int64
+
+	// Error of the stream after the buffered data, io.EOF at the end.
+	err error
+
+	// When the handler has returned, nobody reads the stream, so the
+	// incoming data is dropped.
+	isReaderClosed bool
+}
+
+func newStreamBuffer(size int, isSpill bool) (sb *streamBuffer) {
+	sb = &streamBuffer{
+		lock:    new(sync.Mutex),
+		size:    size,
+		isSpill: isSpill,
+	}
+	sb.cond = sync.NewCond(sb.lock)
+
+	return sb
+}
+
+// Write puts the data into the buffer. When the buffer in memory is full, it
+// either waits for the handler or writes the data into the temporary file.
+// When the file can not be written, the stream fails after the buffered data.
+func (sb *streamBuffer) Write(p []byte) (n int, err error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	for !sb.isSpill && !sb.isReaderClosed && (sb.err == nil) &&
+		(sb.buf.Len() > 0) && (sb.buf.Len()+len(p) > sb.size) {
+		sb.cond.Wait()
+	}
+
+	if sb.isReaderClosed || (sb.err != nil) {
+		return len(p), nil
+	}
+
+	// Once the data goes into the file, it goes there until the file is read
+	// to the end, so that the order of the data is kept.
+	if !sb.isSpill || ((sb.file == nil) && (sb.buf.Len()+len(p) <= sb.size)) {
+		sb.buf.Write(p)
+		sb.cond.Broadcast()
+		return len(p), nil
+	}
+
+	err = sb.spill(p)
+	if err != nil {
+		sb.err = err
+		sb.removeFile()
+	}
+	sb.cond.Broadcast()
+
+	return len(p), nil
+}
+
+func (sb *streamBuffer) spill(p []byte) (err error) {
+	if sb.file == nil {
+		sb.file, err = os.CreateTemp("", StreamSpillFilePattern)
+		if err != nil {
+			return err
+		}
+	}
+
+	var n int
+	n, err = sb.file.WriteAt(p, sb.fileWrite)
+	sb.fileWrite += int64(n)
+
+	return err
+}
+
+// Read implements the io.Reader interface.
+func (sb *streamBuffer) Read(p []byte) (n int, err error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	for (sb.buf.Len() == 0) && (sb.file == nil) && (sb.err == nil) {
+		sb.cond.Wait()
+	}
+
+	if sb.buf.Len() > 0 {
+		n, _ = sb.buf.Read(p)
+		sb.cond.Broadcast()
+		return n, nil
+	}
+
+	if sb.file == nil {
+		return 0, sb.err
+	}
+
+	if int64(len(p)) > sb.fileWrite-sb.fileRead {
+		p = p[:sb.fileWrite-sb.fileRead]
+	}
+	n, err = sb.file.ReadAt(p, sb.fileRead)
+	sb.fileRead += int64(n)
+	if err != nil {
+		sb.err = err
+		sb.removeFile()
+		return n, nil
+	}
+
+	// The file is read to the end, new data goes into memory again.
+	if sb.fileRead == sb.fileWrite {
+		sb.removeFile()
+	}
+
+	return n, nil
+}
+
+// CloseWithError ends the stream. Nil error is the normal end of the stream.
+func (sb *streamBuffer) CloseWithError(err error) {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	if sb.err != nil {
+		return
+	}
+
+	if err == nil {
+		err = io.EOF
+	}
+
+	sb.err = err
+	sb.cond.Broadcast()
+}
+
+// CloseRead drops the buffered data and all the data written later.
+func (sb *streamBuffer) CloseRead() {
+	sb.lock.Lock()
+	defer sb.lock.Unlock()
+
+	sb.isReaderClosed = true
+	sb.buf.Reset()
+	sb.removeFile()
+	sb.cond.Broadcast()
+}
+
+func (sb *streamBuffer) removeFile() {
+	if sb.file == nil {
+		return
+	}
+
+	_ = sb.file.Close()
+	_ = os.Remove(sb.file.Name())
+	sb.file, sb.fileWrite, sb.fileRead = nil, 0, 0
+}
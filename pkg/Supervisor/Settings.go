@@ -0,0 +1,89 @@
+//go:build linux
+
+package spv
+
+import (
+	"io"
+	"log"
+	"time"
+)
+
+// Default settings.
+const (
+	WorkersDefault         = 1
+	RestartDelayDefault    = 100 * time.Millisecond
+	RestartDelayMaxDefault = 10 * time.Second
+	MinUptimeDefault       = time.Second
+	StopTimeoutDefault     = 10 * time.Second
+)
+
+// Environment variables of php-cgi.
+const (
+	// EnvPhpFcgiChildren is the number of children forked by php-cgi itself.
+	// The supervisor sets it to zero, so that each worker is a single
+	// process.
+	EnvPhpFcgiChildren = "PHP_FCGI_CHILDREN"
+
+	// EnvPhpFcgiMaxRequests is the number of requests after which php-cgi
+	// exits.
+	EnvPhpFcgiMaxRequests = "PHP_FCGI_MAX_REQUESTS"
+)
+
+// Settings of the supervisor.
+//
+// Workers do not bind sockets themselves. The supervisor listens on the
+// sockets and passes the listening socket to a worker as its standard input,
+// i.e. as the FCGI_LISTENSOCK_FILENO descriptor. This is what php-cgi expects
+// when it is started without the '-b' argument. The sockets stay open while
+// workers are restarted, so that connections wait in the backlog instead of
+// being refused.
+type Settings struct {
+	// Path to the executable of the worker, e.g. 'php-cgi', and its
+	// arguments.
+	Command string
+	Args    []string
+
+	// Additional environment variables in the 'NAME=value' form. Workers
+	// inherit the environment of the supervisor.
+	Env []string
+
+	// Working directory of workers. Empty directory means the current
+	// directory of the supervisor.
+	Dir string
+
+	// Network of the sockets. Empty network means TCP.
+	Network string
+
+	// Address of the shared socket. Connections of the shared socket are
+	// accepted by 'Workers' workers. Zero number of workers means one worker.
+	Address string
+	Workers int
+
+	// Addresses of individual sockets. When they are set, a single worker is
+	// spawned for each socket and the shared socket is not used.
+	WorkerAddresses []string
+
+	// Number of requests after which a worker exits to be replaced with a new
+	// one, i.e. PHP_FCGI_MAX_REQUESTS. Zero number means the default value of
+	// php-cgi, which is 500.
+	MaxRequests int
+
+	// Delay before the restart of a crashed worker. It is doubled after each
+	// crash in a row up to the maximum. A worker which has exited with the
+	// zero status is restarted at once, unless it has worked less than the
+	// minimal uptime, in which case it is delayed like a crashed one.
+	RestartDelay    time.Duration
+	RestartDelayMax time.Duration
+	MinUptime       time.Duration
+
+	// Time given to workers to exit after the SIGTERM signal. When the time
+	// is out, workers are killed.
+	StopTimeout time.Duration
+
+	// Sink of the standard output and error streams of workers. Nil sink
+	// discards them.
+	Output io.Writer
+
+	// Logger of starts and exits of workers. Nil logger disables the log.
+	Logger *log.Logger
+}
@@ -0,0 +1,349 @@
+//go:build linux
+
+package spv
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+const (
+	ErrCommandIsNotSet   = "command is not set"
+	ErrAddressIsNotSet   = "address is not set"
+	ErrListenerHasNoFile = "listener has no file descriptor: %v"
+)
+
+// Time given to a process to close its output streams after it exits.
+const outputWaitDelay = time.Second
+
+// Supervisor spawns FastCGI workers and keeps them running. A worker which
+// exits is replaced with a new process: at once when it has exited with the
+// zero status after working for a while, e.g. after PHP_FCGI_MAX_REQUESTS
+// requests, or after a delay when it has crashed or exited too early.
+type Supervisor struct {
+	settings Settings
+	env      []string
+
+	sockets []*socket
+	workers []*Worker
+
+	lock     *sync.Mutex
+	isClosed bool
+	stop     chan struct{}
+	wg       *sync.WaitGroup
+}
+
+// New listens on the sockets and starts the workers.
+func New(settings *Settings) (s *Supervisor, err error) {
+	s = &Supervisor{
+		settings: *settings,
+		lock:     new(sync.Mutex),
+		stop:     make(chan struct{}),
+		wg:       new(sync.WaitGroup),
+	}
+
+	st := &s.settings
+	if len(st.Command) == 0 {
+		return nil, errors.New(ErrCommandIsNotSet)
+	}
+	st.Command, err = exec.LookPath(st.Command)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(st.Network) == 0 {
+		st.Network = cl.NetworkTcp
+	}
+	if !cl.IsNetworkSupported(st.Network) {
+		return nil, fmt.Errorf(cl.ErrNetworkIsNotSupported, st.Network)
+	}
+	if (len(st.WorkerAddresses) == 0) && (len(st.Address) == 0) {
+		return nil, errors.New(ErrAddressIsNotSet)
+	}
+	if st.Workers <= 0 {
+		st.Workers = WorkersDefault
+	}
+	if st.RestartDelay <= 0 {
+		st.RestartDelay = RestartDelayDefault
+	}
+	if st.RestartDelayMax < st.RestartDelay {
+		st.RestartDelayMax = max(RestartDelayMaxDefault, st.RestartDelay)
+	}
+	if st.MinUptime <= 0 {
+		st.MinUptime = MinUptimeDefault
+	}
+	if st.StopTimeout <= 0 {
+		st.StopTimeout = StopTimeoutDefault
+	}
+
+	s.env = append(os.Environ(), st.Env...)
+	s.env = append(s.env, EnvPhpFcgiChildren+"=0")
+	if st.MaxRequests > 0 {
+		s.env = append(s.env, EnvPhpFcgiMaxRequests+"="+strconv.Itoa(st.MaxRequests))
+	}
+
+	err = s.listen()
+	if err != nil {
+		_ = s.closeSockets()
+		return nil, err
+	}
+
+	for _, w := range s.workers {
+		s.wg.Add(1)
+		go s.run(w)
+	}
+
+	return s, nil
+}
+
+// Workers returns the workers of the supervisor.
+func (s *Supervisor) Workers() (workers []*Worker) {
+	return s.workers
+}
+
+// Addresses returns the addresses of the sockets.
+func (s *Supervisor) Addresses() (addresses []string) {
+	addresses = make([]string, 0, len(s.sockets))
+	for _, sock := range s.sockets {
+		addresses = append(addresses, sock.listener.Addr().String())
+	}
+
+	return addresses
+}
+
+// Backends returns settings of the sockets for an upstream group. A worker
+// serves a single connection at a time, so the limit of connections to a
+// socket is the number of its workers.
+func (s *Supervisor) Backends() (backends []us.BackendSettings) {
+	backends = make([]us.BackendSettings, 0, len(s.sockets))
+	for _, sock := range s.sockets {
+		backends = append(backends, us.BackendSettings{
+			Network:  s.settings.Network,
+			Address:  sock.listener.Addr().String(),
+			MaxConns: sock.workers,
+		})
+	}
+
+	return backends
+}
+
+// Close asks the workers to exit with the SIGTERM signal, kills those which
+// are still running after the stop timeout and closes the sockets.
+func (s *Supervisor) Close() (err error) {
+	s.lock.Lock()
+	if s.isClosed {
+		s.lock.Unlock()
+		return nil
+	}
+	s.isClosed = true
+	s.lock.Unlock()
+
+	close(s.stop)
+	s.signal(syscall.SIGTERM)
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	timer := time.NewTimer(s.settings.StopTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-done:
+	case <-timer.C:
+		s.signal(syscall.SIGKILL)
+		<-done
+	}
+
+	return s.closeSockets()
+}
+
+// listen opens the sockets and creates a worker for each slot.
+func (s *Supervisor) listen() (err error) {
+	if len(s.settings.WorkerAddresses) == 0 {
+		var sock *socket
+		sock, err = newSocket(s.settings.Network, s.settings.Address, s.settings.Workers)
+		if err != nil {
+			return err
+		}
+		s.sockets = append(s.sockets, sock)
+
+		for i := 0; i < s.settings.Workers; i++ {
+			s.workers = append(s.workers, newWorker(i, sock))
+		}
+
+		return nil
+	}
+
+	for i, address := range s.settings.WorkerAddresses {
+		var sock *socket
+		sock, err = newSocket(s.settings.Network, address, 1)
+		if err != nil {
+			return err
+		}
+		s.sockets = append(s.sockets, sock)
+		s.workers = append(s.workers, newWorker(i, sock))
+	}
+
+	return nil
+}
+
+func newSocket(network string, address string, workers int) (sock *socket, err error) {
+	sock = &socket{workers: workers}
+
+	sock.listener, err = net.Listen(network, address)
+	if err != nil {
+		return nil, err
+	}
+
+	filer, ok := sock.listener.(interface{ File() (*os.File, error) })
+	if !ok {
+		_ = sock.listener.Close()
+		return nil, fmt.Errorf(ErrListenerHasNoFile, network)
+	}
+
+	sock.file, err = filer.File()
+	if err != nil {
+		_ = sock.listener.Close()
+		return nil, err
+	}
+
+	return sock, nil
+}
+
+func (s *Supervisor) closeSockets() (err error) {
+	for _, sock := range s.sockets {
+		err = ae.Combine(err, sock.file.Close())
+		err = ae.Combine(err, sock.listener.Close())
+	}
+
+	return err
+}
+
+func (s *Supervisor) signal(sig syscall.Signal) {
+	for _, w := range s.workers {
+		w.stop(sig)
+	}
+}
+
+// run keeps a process of the worker running until the supervisor is closed.
+func (s *Supervisor) run(w *Worker) {
+	defer s.wg.Done()
+
+	var delay time.Duration
+	for {
+		startedAt := time.Now()
+		state, err := s.runProcess(w)
+		if w.isStoppedNow() {
+			return
+		}
+
+		uptime := time.Since(startedAt)
+		isSuccess := (err == nil) && state.Success()
+
+		// A process which exits at once, e.g. because of a wrong
+		// configuration, is restarted after a delay even when it succeeds,
+		// so that it is not restarted in a tight loop.
+		isEarly := uptime < s.settings.MinUptime
+
+		switch {
+		case isSuccess && !isEarly:
+			s.logf("worker %d: process %d has exited", w.id, state.Pid())
+		case isSuccess:
+			s.logf("worker %d: process %d has exited too early", w.id, state.Pid())
+		case state != nil:
+			s.logf("worker %d: process %d has crashed: %v", w.id, state.Pid(), err)
+		default:
+			s.logf("worker %d: process has not started: %v", w.id, err)
+		}
+
+		if !isSuccess {
+			w.lock.Lock()
+			w.crashes++
+			w.lock.Unlock()
+		}
+
+		// A process which has worked long enough resets the delay.
+		switch {
+		case isSuccess && !isEarly:
+			delay = 0
+		case (delay == 0) || (uptime >= s.settings.RestartDelayMax):
+			delay = s.settings.RestartDelay
+		default:
+			delay = min(delay*2, s.settings.RestartDelayMax)
+		}
+
+		if delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-s.stop:
+				timer.Stop()
+				return
+			}
+		}
+	}
+}
+
+// runProcess starts a process of the worker and waits for it to exit. Nothing
+// is started when the worker is stopped.
+func (s *Supervisor) runProcess(w *Worker) (state *os.ProcessState, err error) {
+	cmd := exec.Command(s.settings.Command, s.settings.Args...)
+	cmd.Dir = s.settings.Dir
+	cmd.Env = s.env
+	cmd.Stdin = w.socket.file
+	cmd.Stdout = s.settings.Output
+	cmd.Stderr = s.settings.Output
+	cmd.WaitDelay = outputWaitDelay
+
+	// The process has its own group, so that its children are signalled
+	// together with it. It is killed when the supervisor dies.
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setpgid:   true,
+		Pdeathsig: syscall.SIGKILL,
+	}
+
+	w.lock.Lock()
+	if w.isStopped {
+		w.lock.Unlock()
+		return nil, nil
+	}
+	err = cmd.Start()
+	if err == nil {
+		w.process = cmd.Process
+		w.starts++
+	}
+	w.lock.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+	s.logf("worker %d: process %d has started", w.id, cmd.Process.Pid)
+
+	err = cmd.Wait()
+
+	w.lock.Lock()
+	w.process = nil
+	w.lock.Unlock()
+
+	return cmd.ProcessState, err
+}
+
+func (s *Supervisor) logf(format string, v ...any) {
+	if s.settings.Logger != nil {
+		s.settings.Logger.Printf(format, v...)
+	}
+}
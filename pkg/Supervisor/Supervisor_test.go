@@ -0,0 +1,266 @@
+//go:build linux
+
+package spv
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// Path to the stand-in worker built from the 'testdata/worker' folder.
+var workerPath string
+
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "spv")
+	if err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+
+	workerPath = filepath.Join(dir, "worker")
+	out, err := exec.Command("go", "build", "-o", workerPath, "./testdata/worker").CombinedOutput()
+	if err != nil {
+		fmt.Println(string(out), err)
+		_ = os.RemoveAll(dir)
+		os.Exit(1)
+	}
+
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func newSupervisor(t *testing.T, settings *Settings) (s *Supervisor) {
+	settings.Command = workerPath
+	settings.RestartDelay = 10 * time.Millisecond
+
+	s, err := New(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = s.Close() })
+
+	// Wait for the processes.
+	for _, w := range s.Workers() {
+		for i := 0; w.Pid() == 0; i++ {
+			if i == 500 {
+				t.Fatal("worker has not started")
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	return s
+}
+
+// request runs the script using a new connection and returns the ID of the
+// process which has served it.
+func request(address string, script string) (pid int, err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	var c *cl.Client
+	c, err = cl.New(cl.NetworkTcp, address)
+	if err != nil {
+		return 0, err
+	}
+	defer c.Close()
+
+	var rsp *cl.Response
+	rsp, err = c.Do(ctx, &cl.Request{
+		Params: []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptName, script)},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer rsp.Close()
+
+	var body []byte
+	body, err = io.ReadAll(rsp.Stdout)
+	if err != nil {
+		return 0, err
+	}
+
+	return strconv.Atoi(string(body))
+}
+
+func isProcessAlive(pid int) bool {
+	return !errors.Is(syscall.Kill(pid, 0), syscall.ESRCH)
+}
+
+func Test_New(t *testing.T) {
+	aTest := tester.New(t)
+
+	_, err := New(&Settings{Address: "127.0.0.1:0"})
+	aTest.MustBeAnError(err)
+
+	_, err = New(&Settings{Command: workerPath})
+	aTest.MustBeAnError(err)
+
+	_, err = New(&Settings{Command: workerPath, Network: "udp", Address: "127.0.0.1:0"})
+	aTest.MustBeAnError(err)
+
+	_, err = New(&Settings{Command: filepath.Join(t.TempDir(), "none"), Address: "127.0.0.1:0"})
+	aTest.MustBeAnError(err)
+}
+
+func Test_Supervisor_SharedSocket(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := newSupervisor(t, &Settings{Address: "127.0.0.1:0", Workers: 3})
+
+	addresses := s.Addresses()
+	aTest.MustBeEqual(len(addresses), 1)
+	aTest.MustBeEqual(s.Backends(), []us.BackendSettings{{Network: cl.NetworkTcp, Address: addresses[0], MaxConns: 3}})
+
+	pids := make(map[int]bool)
+	for _, w := range s.Workers() {
+		aTest.MustBeEqual(w.Address(), addresses[0])
+		pids[w.Pid()] = true
+	}
+	aTest.MustBeEqual(len(pids), 3)
+
+	for i := 0; i < 10; i++ {
+		pid, err := request(addresses[0], "/")
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(pids[pid], true)
+	}
+}
+
+func Test_Supervisor_Recycle(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := newSupervisor(t, &Settings{Address: "127.0.0.1:0", MaxRequests: 2})
+	w := s.Workers()[0]
+
+	pids := make([]int, 0, 6)
+	for i := 0; i < 6; i++ {
+		pid, err := request(w.Address(), "/")
+		aTest.MustBeNoError(err)
+		pids = append(pids, pid)
+	}
+
+	for i := 0; i < len(pids); i += 2 {
+		aTest.MustBeEqual(pids[i], pids[i+1])
+		if i > 0 {
+			aTest.MustBeDifferent(pids[i], pids[i-1])
+		}
+	}
+	aTest.MustBeEqual(w.Starts() >= 3, true)
+	aTest.MustBeEqual(w.Crashes(), 0)
+}
+
+func Test_Supervisor_Crash(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := newSupervisor(t, &Settings{WorkerAddresses: []string{"127.0.0.1:0"}})
+	w := s.Workers()[0]
+	oldPid := w.Pid()
+
+	_, err := request(w.Address(), "/crash")
+	aTest.MustBeAnError(err)
+
+	pid, err := request(w.Address(), "/")
+	aTest.MustBeNoError(err)
+	aTest.MustBeDifferent(pid, oldPid)
+	aTest.MustBeEqual(w.Pid(), pid)
+	aTest.MustBeEqual(w.Crashes(), 1)
+	aTest.MustBeEqual(w.Starts(), 2)
+}
+
+func Test_Supervisor_EarlyExit(t *testing.T) {
+	aTest := tester.New(t)
+
+	s, err := New(&Settings{
+		Command:         workerPath,
+		Env:             []string{"WORKER_EXIT_AT_ONCE=1"},
+		Address:         "127.0.0.1:0",
+		RestartDelay:    50 * time.Millisecond,
+		RestartDelayMax: time.Second,
+	})
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = s.Close() })
+
+	// Delays of 50, 100, 200 and 400 ms fit into the time.
+	time.Sleep(500 * time.Millisecond)
+	w := s.Workers()[0]
+	aTest.MustBeEqual((w.Starts() >= 2) && (w.Starts() <= 5), true)
+	aTest.MustBeEqual(w.Crashes(), 0)
+}
+
+func Test_Supervisor_WorkerAddresses(t *testing.T) {
+	aTest := tester.New(t)
+
+	s := newSupervisor(t, &Settings{WorkerAddresses: []string{"127.0.0.1:0", "127.0.0.1:0"}})
+
+	addresses := s.Addresses()
+	aTest.MustBeEqual(len(addresses), 2)
+	aTest.MustBeDifferent(addresses[0], addresses[1])
+
+	for i, w := range s.Workers() {
+		aTest.MustBeEqual(w.Id(), i)
+		aTest.MustBeEqual(w.Address(), addresses[i])
+		aTest.MustBeEqual(s.Backends()[i].MaxConns, 1)
+
+		pid, err := request(addresses[i], "/")
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(pid, w.Pid())
+	}
+}
+
+func Test_Supervisor_Close(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Workers exit after the SIGTERM signal.
+	s := newSupervisor(t, &Settings{Address: "127.0.0.1:0", Workers: 2})
+	pids := []int{s.Workers()[0].Pid(), s.Workers()[1].Pid()}
+
+	startedAt := time.Now()
+	aTest.MustBeNoError(s.Close())
+	aTest.MustBeEqual(time.Since(startedAt) < StopTimeoutDefault, true)
+	for _, pid := range pids {
+		aTest.MustBeEqual(isProcessAlive(pid), false)
+	}
+	aTest.MustBeEqual(s.Workers()[0].Pid(), 0)
+	aTest.MustBeNoError(s.Close())
+
+	_, err := request(s.Addresses()[0], "/")
+	aTest.MustBeAnError(err)
+
+	// Workers ignoring the SIGTERM signal are killed.
+	s = newSupervisor(t, &Settings{
+		WorkerAddresses: []string{"127.0.0.1:0", "127.0.0.1:0"},
+		Env:             []string{"WORKER_IGNORE_SIGTERM=1"},
+		StopTimeout:     200 * time.Millisecond,
+	})
+
+	pids = pids[:0]
+	for _, w := range s.Workers() {
+		// The signal is ignored when the worker serves a request.
+		pid, err := request(w.Address(), "/")
+		aTest.MustBeNoError(err)
+		pids = append(pids, pid)
+	}
+
+	startedAt = time.Now()
+	aTest.MustBeNoError(s.Close())
+	aTest.MustBeEqual(time.Since(startedAt) >= 200*time.Millisecond, true)
+	for _, pid := range pids {
+		aTest.MustBeEqual(isProcessAlive(pid), false)
+	}
+}
@@ -0,0 +1,102 @@
+//go:build linux
+
+package spv
+
+import (
+	"net"
+	"os"
+	"sync"
+	"syscall"
+)
+
+// socket is a listening socket of workers.
+type socket struct {
+	listener net.Listener
+
+	// Duplicate of the listener's descriptor, which is passed to workers.
+	file *os.File
+
+	// Number of workers accepting connections of the socket.
+	workers int
+}
+
+// Worker is a slot of the supervisor. It holds a single process at a time,
+// which is replaced with a new one when it exits.
+type Worker struct {
+	id     int
+	socket *socket
+
+	lock      *sync.Mutex
+	process   *os.Process
+	starts    int
+	crashes   int
+	isStopped bool
+}
+
+func newWorker(id int, s *socket) (w *Worker) {
+	return &Worker{
+		id:     id,
+		socket: s,
+		lock:   new(sync.Mutex),
+	}
+}
+
+// Id returns the number of the worker, starting from zero.
+func (w *Worker) Id() (id int) {
+	return w.id
+}
+
+// Address returns the address of the socket served by the worker.
+func (w *Worker) Address() (address string) {
+	return w.socket.listener.Addr().String()
+}
+
+// Pid returns the ID of the current process. Zero ID means that the process is
+// not running.
+func (w *Worker) Pid() (pid int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	if w.process == nil {
+		return 0
+	}
+
+	return w.process.Pid
+}
+
+// Starts returns the number of processes started by the worker.
+func (w *Worker) Starts() (n int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.starts
+}
+
+// Crashes returns the number of processes which have exited with a non-zero
+// status or by a signal.
+func (w *Worker) Crashes() (n int) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.crashes
+}
+
+// stop marks the worker as stopped and sends the signal to the process group
+// of its process.
+func (w *Worker) stop(sig syscall.Signal) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	w.isStopped = true
+
+	if w.process != nil {
+		_ = syscall.Kill(-w.process.Pid, sig)
+	}
+}
+
+func (w *Worker) isStoppedNow() bool {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+
+	return w.isStopped
+}
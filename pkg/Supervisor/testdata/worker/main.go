@@ -0,0 +1,75 @@
+// Worker is a stand-in of php-cgi for tests of the supervisor.
+//
+// Like php-cgi, it accepts connections on the listening socket passed as its
+// standard input, serves them one by one and exits with the zero status after
+// PHP_FCGI_MAX_REQUESTS requests. The response is the ID of the process. A
+// request of the '/crash' script makes the worker exit with a non-zero status.
+// When the WORKER_IGNORE_SIGTERM variable is set, the SIGTERM signal is
+// ignored. When the WORKER_EXIT_AT_ONCE variable is set, the worker exits with
+// the zero status at once.
+package main
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"strconv"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Server"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	MaxRequestsDefault = 500
+	ScriptCrash        = "/crash"
+	ExitCodeCrash      = 3
+)
+
+func main() {
+	if len(os.Getenv("WORKER_EXIT_AT_ONCE")) > 0 {
+		return
+	}
+
+	if len(os.Getenv("WORKER_IGNORE_SIGTERM")) > 0 {
+		signal.Ignore(syscall.SIGTERM)
+	}
+
+	maxRequests := MaxRequestsDefault
+	if s := os.Getenv("PHP_FCGI_MAX_REQUESTS"); len(s) > 0 {
+		var err error
+		maxRequests, err = strconv.Atoi(s)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	listener, err := net.FileListener(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	var requests atomic.Int64
+	srv := sv.New(sv.HandlerFunc(func(w *sv.ResponseWriter, r *sv.Request) (appStatus uint32) {
+		if script, _ := r.Param(dm.Parameter_ScriptName); script == ScriptCrash {
+			os.Exit(ExitCodeCrash)
+		}
+
+		requests.Add(1)
+		_, _ = fmt.Fprintf(w, "%d", os.Getpid())
+		return 0
+	}), &sv.Settings{MaxConns: 1})
+
+	for requests.Load() < int64(maxRequests) {
+		var conn net.Conn
+		conn, err = listener.Accept()
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		srv.ServeConn(conn)
+	}
+}
@@ -0,0 +1,81 @@
+package tp
+
+import (
+	"net/http"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Script is a script which serves a request.
+type Script struct {
+	// Path to the script file, the SCRIPT_FILENAME parameter.
+	Filename string
+
+	// Virtual path to the script, the SCRIPT_NAME parameter.
+	Name string
+
+	// Part of the URL path after the script name, the PATH_INFO parameter.
+	PathInfo string
+}
+
+// ScriptResolver finds the script which serves the request.
+type ScriptResolver func(req *http.Request) (script *Script, err error)
+
+// FixedScript serves all the requests by a single script, e.g. by a front
+// controller of a PHP framework. The whole URL path is the path info.
+func FixedScript(filename string) ScriptResolver {
+	return func(req *http.Request) (script *Script, err error) {
+		return &Script{
+			Filename: filename,
+			Name:     "/" + filepath.Base(filename),
+			PathInfo: cleanUrlPath(req.URL.Path),
+		}, nil
+	}
+}
+
+// DocumentRootScript looks for scripts inside the document root folder. If
+// script file extensions are set, e.g. '.php', the URL path is split after
+// the first segment having one of the extensions, and the rest of the path is
+// the path info. Otherwise, the whole URL path is the script name.
+func DocumentRootScript(documentRoot string, exts ...string) ScriptResolver {
+	return func(req *http.Request) (script *Script, err error) {
+		script = &Script{Name: cleanUrlPath(req.URL.Path)}
+
+		if len(exts) > 0 {
+			script.Name, script.PathInfo = splitScriptPath(script.Name, exts)
+		}
+
+		script.Filename = filepath.Join(documentRoot, filepath.FromSlash(script.Name))
+		return script, nil
+	}
+}
+
+// cleanUrlPath makes an absolute URL path without '..' segments.
+func cleanUrlPath(urlPath string) (cleanPath string) {
+	return path.Clean("/" + urlPath)
+}
+
+// splitScriptPath splits the URL path after the first segment having one of
+// the extensions.
+func splitScriptPath(urlPath string, exts []string) (scriptName string, pathInfo string) {
+	end := 0
+	for {
+		next := strings.Index(urlPath[end+1:], "/")
+		if next < 0 {
+			end = len(urlPath)
+		} else {
+			end += 1 + next
+		}
+
+		for _, ext := range exts {
+			if strings.HasSuffix(urlPath[:end], ext) {
+				return urlPath[:end], urlPath[end:]
+			}
+		}
+
+		if end == len(urlPath) {
+			return urlPath, ""
+		}
+	}
+}
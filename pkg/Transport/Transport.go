@@ -0,0 +1,217 @@
+package tp
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/textproto"
+	"strconv"
+	"strings"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	ae "github.com/vault-thirteen/auxie/errors"
+	"github.com/vault-thirteen/auxie/header"
+)
+
+const (
+	// HeaderStatus is the CGI header setting the HTTP status.
+	HeaderStatus = "Status"
+)
+
+const (
+	ErrStatusSyntax = "syntax error in status header: %v"
+)
+
+// Doer sends FastCGI requests, e.g. 'cl.Client' or 'cl.Pool'.
+type Doer = cl.Doer
+
+// Settings of the transport.
+type Settings struct {
+	// Document root folder, the DOCUMENT_ROOT parameter.
+	DocumentRoot string
+
+	// Script serving a request. By default, scripts are looked for inside
+	// the document root folder.
+	Script ScriptResolver
+
+	// Name of the server software, the SERVER_SOFTWARE parameter.
+	ServerSoftware string
+
+	// Parameters added to every request.
+	Params []*nvpair.NameValuePair
+
+	// Parameters added to a request, after the 'Params'.
+	ParamsFunc func(req *http.Request) (params []*nvpair.NameValuePair)
+
+	// Output of scripts into stderr is written here. By default, it is
+	// dropped.
+	Stderr io.Writer
+}
+
+// Transport is an 'http.RoundTripper' which sends HTTP requests to a FastCGI
+// server as requests of the FCGI_RESPONDER role. The CGI response is returned
+// as an HTTP response, whose body is read while it arrives.
+type Transport struct {
+	doer     Doer
+	settings Settings
+}
+
+func New(doer Doer, settings *Settings) (t *Transport) {
+	t = &Transport{doer: doer}
+
+	if settings != nil {
+		t.settings = *settings
+	}
+
+	if t.settings.Script == nil {
+		t.settings.Script = DocumentRootScript(t.settings.DocumentRoot)
+	}
+
+	if t.settings.Stderr == nil {
+		t.settings.Stderr = io.Discard
+	}
+
+	return t
+}
+
+// RoundTrip implements the 'http.RoundTripper' interface.
+func (t *Transport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	body := req.Body
+	if body == nil {
+		body = http.NoBody
+	}
+	defer func() {
+		if err != nil {
+			_ = body.Close()
+		}
+	}()
+
+	var script *Script
+	script, err = t.settings.Script(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Scripts read as many bytes of stdin as CONTENT_LENGTH tells, so a body
+	// of unknown length is read beforehand.
+	var stdin io.Reader = body
+	contentLength := req.ContentLength
+	if (contentLength < 0) || ((contentLength == 0) && (body != http.NoBody)) {
+		var ba []byte
+		ba, err = io.ReadAll(body)
+		if err != nil {
+			return nil, err
+		}
+
+		stdin = bytes.NewReader(ba)
+		contentLength = int64(len(ba))
+	}
+
+	var rsp *cl.Response
+	rsp, err = t.doer.Do(req.Context(), &cl.Request{
+		Role:     dm.FCGI_RESPONDER,
+		KeepConn: true,
+		Params:   NewParams(req, script, contentLength, &t.settings),
+		Stdin:    stdin,
+		Stderr:   t.settings.Stderr,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err = newResponse(req, rsp, body)
+	if err != nil {
+		_ = rsp.Close()
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// newResponse reads the CGI headers of the response.
+func newResponse(req *http.Request, rsp *cl.Response, reqBody io.Closer) (resp *http.Response, err error) {
+	br := bufio.NewReader(rsp.Stdout)
+
+	var mimeHeader textproto.MIMEHeader
+	mimeHeader, err = textproto.NewReader(br).ReadMIMEHeader()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	resp = &http.Response{
+		StatusCode:    http.StatusOK,
+		Proto:         ProtocolDefault,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        http.Header(mimeHeader),
+		ContentLength: -1,
+		Body:          &responseBody{reader: br, response: rsp, requestBody: reqBody},
+		Request:       req,
+	}
+
+	// A script redirecting the client may omit the status, 6.2.3.
+	if len(resp.Header.Get(header.HttpHeaderLocation)) > 0 {
+		resp.StatusCode = http.StatusFound
+	}
+
+	status := resp.Header.Get(HeaderStatus)
+	if len(status) > 0 {
+		resp.StatusCode, err = parseStatus(status)
+		if err != nil {
+			return nil, err
+		}
+		resp.Header.Del(HeaderStatus)
+	}
+	resp.Status = fmt.Sprintf("%d %s", resp.StatusCode, http.StatusText(resp.StatusCode))
+
+	contentLength := resp.Header.Get(header.HttpHeaderContentLength)
+	if len(contentLength) > 0 {
+		resp.ContentLength, err = strconv.ParseInt(contentLength, 10, 64)
+		if err != nil {
+			resp.ContentLength = -1
+		}
+	}
+
+	if req.Method == http.MethodHead {
+		resp.ContentLength = 0
+	}
+
+	return resp, nil
+}
+
+// parseStatus parses the status header, e.g. '404 Not Found'.
+func parseStatus(value string) (statusCode int, err error) {
+	codeText, _, _ := strings.Cut(strings.TrimSpace(value), " ")
+
+	statusCode, err = strconv.Atoi(codeText)
+	if (err != nil) || (statusCode < 100) || (statusCode > 999) {
+		return 0, fmt.Errorf(ErrStatusSyntax, value)
+	}
+
+	return statusCode, nil
+}
+
+// responseBody is a body of the HTTP response. Closing the body closes the
+// FastCGI response and the body of the request.
+type responseBody struct {
+	reader      io.Reader
+	response    *cl.Response
+	requestBody io.Closer
+}
+
+func (rb *responseBody) Read(p []byte) (n int, err error) {
+	return rb.reader.Read(p)
+}
+
+func (rb *responseBody) Close() (err error) {
+	err = rb.response.Close()
+	return ae.Combine(err, rb.requestBody.Close())
+}
@@ -0,0 +1,234 @@
+package tp
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Server"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startScriptServer starts a FastCGI server acting as a CGI script. Headers of
+// the response are taken from the 'X_HEADERS' parameter, and the parameters
+// are listed in the 'X-Param' headers. The body is stdin.
+func startScriptServer(t *testing.T, settings *sv.Settings) (pool *cl.Pool) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := sv.New(sv.HandlerFunc(func(w *sv.ResponseWriter, r *sv.Request) (appStatus uint32) {
+		headers, _ := r.Param("HTTP_X_HEADERS")
+		for _, h := range strings.Split(headers, ";") {
+			if len(h) > 0 {
+				_, _ = fmt.Fprintf(w, "%s\r\n", h)
+			}
+		}
+
+		for _, p := range r.Params {
+			_, _ = fmt.Fprintf(w, "X-Param: %s=%s\r\n", p.Name, p.Value)
+		}
+		_, _ = fmt.Fprint(w, "\r\n")
+
+		_, _ = io.Copy(w, r.Stdin)
+		_, _ = fmt.Fprint(w.Stderr(), "stderr")
+		return 0
+	}), settings)
+	go func() { _ = srv.Serve(listener) }()
+
+	address := listener.Addr().String()
+	pool = cl.NewPool(cl.NetworkTcp, address, 2)
+	t.Cleanup(func() {
+		_ = pool.Close()
+		_ = srv.Close()
+		cl.ForgetCapabilities(cl.NetworkTcp, address)
+	})
+
+	return pool
+}
+
+func params(resp *http.Response) (params map[string]string) {
+	params = make(map[string]string)
+	for _, p := range resp.Header.Values("X-Param") {
+		name, value, _ := strings.Cut(p, "=")
+		params[name] = value
+	}
+
+	return params
+}
+
+func Test_Transport_RoundTrip(t *testing.T) {
+	aTest := tester.New(t)
+
+	var stderr bytes.Buffer
+	pool := startScriptServer(t, nil)
+	client := &http.Client{Transport: New(pool, &Settings{
+		DocumentRoot:   "/var/www",
+		Script:         DocumentRootScript("/var/www", ".php"),
+		ServerSoftware: "test",
+		Stderr:         &stderr,
+	})}
+
+	req, err := http.NewRequest(http.MethodPost, "http://example.com:8080/app/index.php/a/b?x=1", strings.NewReader("body"))
+	aTest.MustBeNoError(err)
+	req.Header.Set("Content-Type", "text/plain")
+	req.Header.Set("Proxy", "http://evil")
+	req.Header.Set("X-Headers", "Status: 201 Made;Content-Length: 4")
+
+	resp, err := client.Do(req)
+	aTest.MustBeNoError(err)
+	body, err := io.ReadAll(resp.Body)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(resp.Body.Close())
+
+	aTest.MustBeEqual(resp.StatusCode, http.StatusCreated)
+	aTest.MustBeEqual(resp.ContentLength, int64(4))
+	aTest.MustBeEqual(string(body), "body")
+	aTest.MustBeEqual(resp.Header.Get(HeaderStatus), "")
+	aTest.MustBeEqual(stderr.String(), "stderr")
+
+	p := params(resp)
+	aTest.MustBeEqual(p[dm.Parameter_RequestMethod], http.MethodPost)
+	aTest.MustBeEqual(p[dm.Parameter_ContentLength], "4")
+	aTest.MustBeEqual(p[dm.Parameter_ContentType], "text/plain")
+	aTest.MustBeEqual(p[dm.Parameter_ScriptFilename], "/var/www/app/index.php")
+	aTest.MustBeEqual(p[dm.Parameter_ScriptName], "/app/index.php")
+	aTest.MustBeEqual(p[dm.Parameter_PathInfo], "/a/b")
+	aTest.MustBeEqual(p[dm.Parameter_QueryString], "x=1")
+	aTest.MustBeEqual(p[dm.Parameter_RequestUri], "/app/index.php/a/b?x=1")
+	aTest.MustBeEqual(p[dm.Parameter_ServerName], "example.com")
+	aTest.MustBeEqual(p[dm.Parameter_ServerPort], "8080")
+	aTest.MustBeEqual(p[dm.Parameter_ServerSoftware], "test")
+	aTest.MustBeEqual(p["HTTP_HOST"], "example.com:8080")
+	_, hasProxy := p["HTTP_PROXY"]
+	aTest.MustBeEqual(hasProxy, false)
+}
+
+func Test_Transport_UnknownLength(t *testing.T) {
+	aTest := tester.New(t)
+
+	pool := startScriptServer(t, nil)
+	client := &http.Client{Transport: New(pool, &Settings{Script: FixedScript("/srv/index.php")})}
+
+	// A reader of unknown length is sent with the chunked encoding.
+	pr, pw := io.Pipe()
+	go func() {
+		_, _ = pw.Write([]byte("chunked"))
+		_ = pw.Close()
+	}()
+
+	resp, err := client.Post("http://localhost/path", "text/plain", pr)
+	aTest.MustBeNoError(err)
+	body, err := io.ReadAll(resp.Body)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(resp.Body.Close())
+
+	aTest.MustBeEqual(resp.StatusCode, http.StatusOK)
+	aTest.MustBeEqual(string(body), "chunked")
+
+	p := params(resp)
+	aTest.MustBeEqual(p[dm.Parameter_ContentLength], "7")
+	aTest.MustBeEqual(p[dm.Parameter_ScriptFilename], "/srv/index.php")
+	aTest.MustBeEqual(p[dm.Parameter_PathInfo], "/path")
+	aTest.MustBeEqual(p[dm.Parameter_ServerPort], "80")
+}
+
+func Test_Transport_Redirect(t *testing.T) {
+	aTest := tester.New(t)
+
+	pool := startScriptServer(t, nil)
+	client := &http.Client{
+		Transport: New(pool, nil),
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	req, err := http.NewRequest(http.MethodGet, "http://localhost/", nil)
+	aTest.MustBeNoError(err)
+	req.Header.Set("X-Headers", "Location: /next")
+
+	resp, err := client.Do(req)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(resp.Body.Close())
+	aTest.MustBeEqual(resp.StatusCode, http.StatusFound)
+	aTest.MustBeEqual(resp.Header.Get("Location"), "/next")
+}
+
+func Test_Transport_UnknownRole(t *testing.T) {
+	aTest := tester.New(t)
+
+	// No role is served.
+	pool := startScriptServer(t, &sv.Settings{Roles: []dm.Role{dm.FCGI_FILTER}})
+	client := &http.Client{Transport: New(pool, nil)}
+
+	_, err := client.Get("http://localhost/")
+	aTest.MustBeEqual(errors.Is(err, dm.ErrUnknownRole), true)
+}
+
+func Test_Transport_ReverseProxy(t *testing.T) {
+	aTest := tester.New(t)
+
+	pool := startScriptServer(t, nil)
+	target, err := url.Parse("http://backend")
+	aTest.MustBeNoError(err)
+
+	proxy := httputil.NewSingleHostReverseProxy(target)
+	proxy.Transport = New(pool, &Settings{DocumentRoot: "/www"})
+
+	front := httptest.NewServer(proxy)
+	defer front.Close()
+
+	resp, err := http.Post(front.URL+"/x.php?q=2", "text/plain", strings.NewReader("proxied"))
+	aTest.MustBeNoError(err)
+	body, err := io.ReadAll(resp.Body)
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(resp.Body.Close())
+
+	aTest.MustBeEqual(resp.StatusCode, http.StatusOK)
+	aTest.MustBeEqual(string(body), "proxied")
+
+	p := params(resp)
+	aTest.MustBeEqual(p[dm.Parameter_ScriptFilename], "/www/x.php")
+	aTest.MustBeEqual(p[dm.Parameter_RemoteAddr], "127.0.0.1")
+	aTest.MustBeEqual(len(p[dm.Parameter_RemotePort]) > 0, true)
+}
+
+func Test_DocumentRootScript(t *testing.T) {
+	aTest := tester.New(t)
+
+	type testCase struct {
+		urlPath  string
+		expected Script
+	}
+
+	resolver := DocumentRootScript("/root", ".php")
+	tests := []testCase{
+		{urlPath: "/a/b.php", expected: Script{Filename: "/root/a/b.php", Name: "/a/b.php"}},
+		{urlPath: "/a/b.php/c/d", expected: Script{Filename: "/root/a/b.php", Name: "/a/b.php", PathInfo: "/c/d"}},
+		{urlPath: "/a.php.d/b.php/c", expected: Script{Filename: "/root/a.php.d/b.php", Name: "/a.php.d/b.php", PathInfo: "/c"}},
+		{urlPath: "/../../etc/passwd", expected: Script{Filename: "/root/etc/passwd", Name: "/etc/passwd"}},
+		{urlPath: "", expected: Script{Filename: "/root", Name: "/"}},
+	}
+
+	for _, tc := range tests {
+		script, err := resolver(&http.Request{URL: &url.URL{Path: tc.urlPath}})
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(*script, tc.expected)
+	}
+}
+
+var _ http.RoundTripper = (*Transport)(nil)
+var _ Doer = (*cl.Client)(nil)
+var _ Doer = (*cl.Pool)(nil)
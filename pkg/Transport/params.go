@@ -0,0 +1,117 @@
+package tp
+
+import (
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/http"
+	"github.com/vault-thirteen/auxie/header"
+)
+
+const (
+	GatewayInterface = "CGI/1.1"
+	ProtocolDefault  = "HTTP/1.1"
+	SchemeHttp       = "http"
+	SchemeHttps      = "https"
+	HttpsOn          = "on"
+	PortHttp         = "80"
+	PortHttps        = "443"
+)
+
+const (
+	// HeaderProxy is the 'Proxy' HTTP header. It is never passed to scripts,
+	// because the HTTP_PROXY parameter is taken by many of them for the
+	// proxy settings ('httpoxy').
+	HeaderProxy = "Proxy"
+)
+
+// NewParams maps the HTTP request to CGI/1.1 meta-variables. 'contentLength'
+// is the length of the request body.
+func NewParams(req *http.Request, script *Script, contentLength int64, settings *Settings) (params []*nvpair.NameValuePair) {
+	scheme := SchemeHttp
+	if (req.TLS != nil) || (req.URL.Scheme == SchemeHttps) {
+		scheme = SchemeHttps
+	}
+
+	serverName, serverPort := splitHostPort(requestHost(req))
+	if len(serverPort) == 0 {
+		serverPort = PortHttp
+		if scheme == SchemeHttps {
+			serverPort = PortHttps
+		}
+	}
+
+	remoteAddr, remotePort := splitHostPort(req.RemoteAddr)
+
+	proto := req.Proto
+	if len(proto) == 0 {
+		proto = ProtocolDefault
+	}
+
+	authScheme, _, _ := hm.ParseAuthorizationHeader(req.Header.Get(header.HttpHeaderAuthorization))
+
+	params = []*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_AuthType, authScheme),                                      // 4.1.1.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ContentLength, strconv.FormatInt(contentLength, 10)),       // 4.1.2.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ContentType, req.Header.Get(header.HttpHeaderContentType)), // 4.1.3.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_DocumentRoot, settings.DocumentRoot),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_DocumentUri, script.Name+script.PathInfo),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_GatewayInterface, GatewayInterface), // 4.1.4.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_PathInfo, script.PathInfo),          // 4.1.5.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_QueryString, req.URL.RawQuery),      // 4.1.7.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RedirectStatus, strconv.Itoa(http.StatusOK)),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RemoteAddr, remoteAddr), // 4.1.8.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RemotePort, remotePort),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestMethod, req.Method), // 4.1.12.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestScheme, scheme),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestUri, req.URL.RequestURI()),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, script.Filename),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptName, script.Name),                 // 4.1.13.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ServerName, serverName),                  // 4.1.14.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ServerPort, serverPort),                  // 4.1.15.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ServerProtocol, proto),                   // 4.1.16.
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ServerSoftware, settings.ServerSoftware), // 4.1.17.
+	}
+
+	if scheme == SchemeHttps {
+		params = append(params, nvpair.NewNameValuePairWithTextValueU(dm.Parameter_Https, HttpsOn))
+	}
+
+	// Protocol-specific meta-variables, 4.1.18. Host is not a header of a
+	// request in Go.
+	headers := req.Header.Clone()
+	headers.Del(HeaderProxy)
+	if len(requestHost(req)) > 0 {
+		headers.Set(header.HttpHeaderHost, requestHost(req))
+	}
+	hm.AddHttpHeadersToParameters(&params, headers)
+
+	params = append(params, settings.Params...)
+	if settings.ParamsFunc != nil {
+		params = append(params, settings.ParamsFunc(req)...)
+	}
+
+	return params
+}
+
+func requestHost(req *http.Request) (host string) {
+	if len(req.Host) > 0 {
+		return req.Host
+	}
+
+	return req.URL.Host
+}
+
+// splitHostPort splits the address when it has a port.
+func splitHostPort(address string) (host string, port string) {
+	var err error
+	host, port, err = net.SplitHostPort(address)
+	if err != nil {
+		return address, ""
+	}
+
+	return host, port
+}
@@ -0,0 +1,135 @@
+package us
+
+import (
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+)
+
+// Backend is a FastCGI server of the upstream group.
+type Backend struct {
+	network string
+	address string
+	pool    *cl.Pool
+
+	lock *sync.Mutex
+
+	// State of active health checks.
+	isHealthy bool
+	fails     int
+	passes    int
+
+	// The status read by the last health check.
+	fpmStatus *pm.FpmStatus
+
+	// Passive ejection lasts until this time.
+	ejectedUntil time.Time
+
+	// Number of requests in progress.
+	outstanding int
+}
+
+func newBackend(settings BackendSettings) (b *Backend) {
+	maxConns := settings.MaxConns
+	if maxConns <= 0 {
+		maxConns = BackendMaxConnsDefault
+	}
+
+	return &Backend{
+		network:   settings.Network,
+		address:   settings.Address,
+		pool:      cl.NewPool(settings.Network, settings.Address, maxConns),
+		lock:      new(sync.Mutex),
+		isHealthy: true,
+	}
+}
+
+func (b *Backend) Network() (network string) {
+	return b.network
+}
+
+func (b *Backend) Address() (address string) {
+	return b.address
+}
+
+// IsAvailable tells whether the backend is healthy and is not ejected.
+func (b *Backend) IsAvailable() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.isAvailable(time.Now())
+}
+
+// IsHealthy tells whether the backend passes health checks.
+func (b *Backend) IsHealthy() bool {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.isHealthy
+}
+
+// Outstanding returns the number of requests in progress.
+func (b *Backend) Outstanding() (n int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.outstanding
+}
+
+// FpmStatus returns the status of php-fpm read by the last health check. It
+// is nil when the status script is not set or when the check has failed to
+// read the status.
+func (b *Backend) FpmStatus() (status *pm.FpmStatus) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	return b.fpmStatus
+}
+
+func (b *Backend) isAvailable(now time.Time) bool {
+	return b.isHealthy && !now.Before(b.ejectedUntil)
+}
+
+func (b *Backend) eject(duration time.Duration) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.ejectedUntil = time.Now().Add(duration)
+}
+
+func (b *Backend) setFpmStatus(status *pm.FpmStatus) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.fpmStatus = status
+}
+
+func (b *Backend) addOutstanding(delta int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	b.outstanding += delta
+}
+
+// reportCheck counts the result of a health check.
+func (b *Backend) reportCheck(isPassed bool, settings *HealthCheckSettings) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	if isPassed {
+		b.fails = 0
+		b.passes++
+		if !b.isHealthy && (b.passes >= settings.PassesToRestore) {
+			b.isHealthy = true
+		}
+		return
+	}
+
+	b.passes = 0
+	b.fails++
+	if b.isHealthy && (b.fails >= settings.FailsToEject) {
+		b.isHealthy = false
+	}
+}
@@ -0,0 +1,410 @@
+package us
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+	ae "github.com/vault-thirteen/auxie/errors"
+)
+
+const (
+	ErrBackendsAreNotSet = "backends are not set"
+	ErrStrategyIsUnknown = "strategy is unknown: %v"
+	ErrPingAppStatus     = "ping script has ended with status %v"
+	ErrListenQueue       = "listen queue is too long: %v"
+)
+
+// ErrNoAvailableBackend is returned when all the backends are ejected.
+var ErrNoAvailableBackend = errors.New("no available backend")
+
+// Group is a group of FastCGI servers serving the same application. Requests
+// are spread among available backends by the strategy. A request which can
+// not connect to a backend is sent to another one.
+type Group struct {
+	backends []*Backend
+	strategy string
+	ring     *hashRing
+
+	hashParam   string
+	healthCheck *HealthCheckSettings
+	passive     PassiveEjectionSettings
+
+	// Counter of the round-robin strategy.
+	lock    *sync.Mutex
+	counter int
+
+	stop     chan struct{}
+	stopOnce *sync.Once
+	wg       *sync.WaitGroup
+}
+
+func New(settings *Settings) (g *Group, err error) {
+	if len(settings.Backends) == 0 {
+		return nil, errors.New(ErrBackendsAreNotSet)
+	}
+
+	g = &Group{
+		backends:  make([]*Backend, 0, len(settings.Backends)),
+		strategy:  settings.Strategy,
+		hashParam: settings.HashParam,
+		passive:   settings.PassiveEjection,
+		lock:      new(sync.Mutex),
+		stop:      make(chan struct{}),
+		stopOnce:  new(sync.Once),
+		wg:        new(sync.WaitGroup),
+	}
+
+	switch g.strategy {
+	case "":
+		g.strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategyLeastOutstanding, StrategyConsistentHash:
+	default:
+		return nil, fmt.Errorf(ErrStrategyIsUnknown, g.strategy)
+	}
+
+	if len(g.hashParam) == 0 {
+		g.hashParam = HashParamDefault
+	}
+
+	if g.passive.Duration <= 0 {
+		g.passive.Duration = EjectionDurationDefault
+	}
+
+	for _, bs := range settings.Backends {
+		if !cl.IsNetworkSupported(bs.Network) {
+			return nil, fmt.Errorf(cl.ErrNetworkIsNotSupported, bs.Network)
+		}
+
+		g.backends = append(g.backends, newBackend(bs))
+	}
+
+	if g.strategy == StrategyConsistentHash {
+		g.ring = newHashRing(g.backends, HashReplicasDefault)
+	}
+
+	if settings.HealthCheck != nil {
+		hc := *settings.HealthCheck
+		if hc.Timeout <= 0 {
+			hc.Timeout = HealthCheckTimeoutDefault
+		}
+		if hc.FailsToEject <= 0 {
+			hc.FailsToEject = FailsToEjectDefault
+		}
+		if hc.PassesToRestore <= 0 {
+			hc.PassesToRestore = PassesToRestoreDefault
+		}
+		g.healthCheck = &hc
+
+		if hc.Interval > 0 {
+			g.wg.Add(1)
+			go g.runHealthChecks()
+		}
+	}
+
+	return g, nil
+}
+
+// Backends returns the backends of the group.
+func (g *Group) Backends() (backends []*Backend) {
+	return g.backends
+}
+
+// Do sends the request to a backend chosen by the strategy. When a connection
+// to the backend can not be made, the request is sent to another backend.
+func (g *Group) Do(ctx context.Context, req *cl.Request) (rsp *cl.Response, err error) {
+	tried := make([]bool, len(g.backends))
+
+	var b *Backend
+	for {
+		b = g.pick(ctx, req, tried)
+		if b == nil {
+			if err != nil {
+				return nil, err
+			}
+
+			return nil, ErrNoAvailableBackend
+		}
+
+		// Requests waiting for a connection of the backend count as well.
+		b.addOutstanding(1)
+		rsp, err = b.pool.Do(ctx, req)
+		if err == nil {
+			break
+		}
+		b.addOutstanding(-1)
+
+		if !isConnectError(err) {
+			return nil, err
+		}
+
+		if g.passive.OnConnectError {
+			b.eject(g.passive.Duration)
+		}
+	}
+
+	rsp.OnClose(func(err error) {
+		b.addOutstanding(-1)
+
+		if g.passive.OnOverloaded && errors.Is(err, dm.ErrOverloaded) {
+			b.eject(g.passive.Duration)
+		}
+	})
+
+	return rsp, nil
+}
+
+// Close stops the health checks and closes connections to the backends.
+func (g *Group) Close() (err error) {
+	g.stopOnce.Do(func() { close(g.stop) })
+	g.wg.Wait()
+
+	for _, b := range g.backends {
+		err = ae.Combine(err, b.pool.Close())
+	}
+
+	return err
+}
+
+// pick chooses an available backend which has not been tried yet.
+func (g *Group) pick(ctx context.Context, req *cl.Request, tried []bool) (b *Backend) {
+	now := time.Now()
+	isCandidate := func(i int) bool {
+		if tried[i] {
+			return false
+		}
+
+		b := g.backends[i]
+		b.lock.Lock()
+		defer b.lock.Unlock()
+
+		return b.isAvailable(now)
+	}
+
+	chosen := -1
+	switch g.strategy {
+	case StrategyConsistentHash:
+		g.ring.walk(g.hashKey(ctx, req), func(i int) bool {
+			if isCandidate(i) {
+				chosen = i
+				return true
+			}
+			return false
+		})
+
+	case StrategyLeastOutstanding:
+		// Ties are broken by the round-robin order.
+		start := g.nextCounter()
+		least := 0
+		for j := 0; j < len(g.backends); j++ {
+			i := (start + j) % len(g.backends)
+			if !isCandidate(i) {
+				continue
+			}
+
+			n := g.backends[i].Outstanding()
+			if (chosen < 0) || (n < least) {
+				chosen, least = i, n
+			}
+		}
+
+	default:
+		start := g.nextCounter()
+		for j := 0; j < len(g.backends); j++ {
+			i := (start + j) % len(g.backends)
+			if isCandidate(i) {
+				chosen = i
+				break
+			}
+		}
+	}
+
+	if chosen < 0 {
+		return nil
+	}
+
+	tried[chosen] = true
+	return g.backends[chosen]
+}
+
+func (g *Group) nextCounter() (n int) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	n = g.counter
+	g.counter++
+	if g.counter < 0 {
+		g.counter = 0
+	}
+
+	return n
+}
+
+// hashKey returns the key of the consistent hash.
+func (g *Group) hashKey(ctx context.Context, req *cl.Request) (key string) {
+	key, ok := hashKeyFromContext(ctx)
+	if ok {
+		return key
+	}
+
+	for _, p := range req.Params {
+		if string(p.Name) == g.hashParam {
+			return string(p.Value)
+		}
+	}
+
+	return ""
+}
+
+// isConnectError tells whether the connection to the server has not been
+// made, so the request has not been sent.
+func isConnectError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && (opErr.Op == "dial")
+}
+
+func (g *Group) runHealthChecks() {
+	defer g.wg.Done()
+
+	ticker := time.NewTicker(g.healthCheck.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-g.stop:
+			return
+		case <-ticker.C:
+			g.CheckHealth()
+		}
+	}
+}
+
+// CheckHealth checks all the backends at once. Checks are run periodically
+// when the interval is set, and this method runs them out of turn.
+func (g *Group) CheckHealth() {
+	if g.healthCheck == nil {
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, b := range g.backends {
+		wg.Add(1)
+		go func(b *Backend) {
+			defer wg.Done()
+
+			err := g.check(b)
+			b.reportCheck(err == nil, g.healthCheck)
+		}(b)
+	}
+	wg.Wait()
+}
+
+// check makes a single health check of the backend.
+func (g *Group) check(b *Backend) (err error) {
+	ctx, cancel := context.WithTimeout(context.Background(), g.healthCheck.Timeout)
+	defer cancel()
+
+	switch {
+	case len(g.healthCheck.PingScript) > 0:
+		err = g.ping(ctx, b)
+	case len(g.healthCheck.StatusScript) == 0:
+		err = probe(ctx, b)
+	}
+	if (err != nil) || (len(g.healthCheck.StatusScript) == 0) {
+		return err
+	}
+
+	return g.checkStatus(ctx, b)
+}
+
+// probe asks the backend with the FCGI_GET_VALUES record.
+func probe(ctx context.Context, b *Backend) (err error) {
+	var c *cl.Client
+	c, err = cl.New(b.network, b.address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	_, err = c.ProbeValues(ctx)
+	return err
+}
+
+// checkStatus reads the status of php-fpm of the backend and checks its
+// listen queue.
+func (g *Group) checkStatus(ctx context.Context, b *Backend) (err error) {
+	var c *cl.Client
+	c, err = cl.New(b.network, b.address)
+	if err != nil {
+		b.setFpmStatus(nil)
+		return err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	var status *pm.FpmStatus
+	status, err = pm.GetFpmStatusContext(ctx, c, g.healthCheck.StatusScript)
+	b.setFpmStatus(status)
+	if err != nil {
+		return err
+	}
+
+	if (g.healthCheck.MaxListenQueue > 0) && (status.ListenQueue > g.healthCheck.MaxListenQueue) {
+		return fmt.Errorf(ErrListenQueue, status.ListenQueue)
+	}
+
+	return nil
+}
+
+// ping runs the ping script of the backend. The script is run using a new
+// connection, so that a busy pool does not fail the check.
+func (g *Group) ping(ctx context.Context, b *Backend) (err error) {
+	script := g.healthCheck.PingScript
+
+	var c *cl.Client
+	c, err = cl.New(b.network, b.address)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	var rsp *cl.Response
+	rsp, err = c.Do(ctx, &cl.Request{
+		Params: []*nvpair.NameValuePair{
+			nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestMethod, "GET"),
+			nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, script),
+			nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptName, script),
+			nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestUri, script),
+		},
+	})
+	if err != nil {
+		return err
+	}
+	defer func() {
+		_ = rsp.Close()
+	}()
+
+	_, err = io.Copy(io.Discard, rsp.Stdout)
+	if err != nil {
+		return err
+	}
+
+	if rsp.AppStatus() != 0 {
+		return fmt.Errorf(ErrPingAppStatus, rsp.AppStatus())
+	}
+
+	return nil
+}
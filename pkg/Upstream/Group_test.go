@@ -0,0 +1,513 @@
+package us
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/Server"
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startNamedServer starts a FastCGI server which writes its name into stdout.
+// The ping script ends with the status taken from 'pingStatus'.
+func startNamedServer(t *testing.T, name string, pingStatus *atomic.Uint32) (address string, srv *sv.Server) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv = sv.New(sv.HandlerFunc(func(w *sv.ResponseWriter, r *sv.Request) (appStatus uint32) {
+		script, _ := r.Param(dm.Parameter_ScriptName)
+		if (script == "/ping") && (pingStatus != nil) {
+			return pingStatus.Load()
+		}
+
+		_, _ = io.WriteString(w, name)
+		return 0
+	}), nil)
+	go func() { _ = srv.Serve(listener) }()
+
+	address = listener.Addr().String()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		cl.ForgetCapabilities(cl.NetworkTcp, address)
+	})
+
+	return address, srv
+}
+
+// startSerialServer starts a FastCGI server which serves one request of a
+// connection at a time and writes "a" into stdout.
+func startSerialServer(t *testing.T) (address string) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv := sv.New(sv.HandlerFunc(func(w *sv.ResponseWriter, r *sv.Request) (appStatus uint32) {
+		_, _ = io.WriteString(w, "a")
+		return 0
+	}), &sv.Settings{IsMultiplexingDisabled: true})
+	go func() { _ = srv.Serve(listener) }()
+
+	address = listener.Addr().String()
+	t.Cleanup(func() {
+		_ = srv.Close()
+		cl.ForgetCapabilities(cl.NetworkTcp, address)
+	})
+
+	return address
+}
+
+// startOverloadedServer starts a server which rejects all the requests with
+// the FCGI_OVERLOADED status.
+func startOverloadedServer(t *testing.T) (address string) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				rr := dm.NewRecordReader(conn, false)
+				for {
+					rec, err := rr.ReadRecord()
+					if err != nil {
+						return
+					}
+
+					switch rec.Type {
+					case dm.FCGI_GET_VALUES:
+						_, err = conn.Write(rm.NewUnknownTypeRequest(rec.Type).ToBytes())
+					case dm.FCGI_BEGIN_REQUEST:
+						_, err = conn.Write(rm.NewEndRequest(rec.RequestId, 0, dm.FCGI_OVERLOADED).ToBytes())
+					}
+					if err != nil {
+						return
+					}
+				}
+			}()
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+// deadAddress returns an address where nobody listens.
+func deadAddress(t *testing.T) (address string) {
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	address = listener.Addr().String()
+	_ = listener.Close()
+
+	return address
+}
+
+func newGroup(t *testing.T, settings *Settings) (g *Group) {
+	g, err := New(settings)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = g.Close() })
+
+	return g
+}
+
+func backends(addresses ...string) (bs []BackendSettings) {
+	for _, address := range addresses {
+		bs = append(bs, BackendSettings{Network: cl.NetworkTcp, Address: address})
+	}
+
+	return bs
+}
+
+// get sends a request with the key and returns the name of the server.
+func get(ctx context.Context, g *Group, remoteAddr string) (name string, err error) {
+	rsp, err := g.Do(ctx, &cl.Request{
+		KeepConn: true,
+		Params:   []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RemoteAddr, remoteAddr)},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer rsp.Close()
+
+	stdout, err := io.ReadAll(rsp.Stdout)
+	return string(stdout), err
+}
+
+func Test_New(t *testing.T) {
+	aTest := tester.New(t)
+
+	_, err := New(&Settings{})
+	aTest.MustBeAnError(err)
+
+	_, err = New(&Settings{Backends: backends("127.0.0.1:1"), Strategy: "random"})
+	aTest.MustBeAnError(err)
+
+	_, err = New(&Settings{Backends: []BackendSettings{{Network: "udp", Address: "127.0.0.1:1"}}})
+	aTest.MustBeAnError(err)
+
+	// The group may be closed twice.
+	g, err := New(&Settings{
+		Backends:    backends("127.0.0.1:1"),
+		HealthCheck: &HealthCheckSettings{Interval: time.Hour},
+	})
+	aTest.MustBeNoError(err)
+	aTest.MustBeNoError(g.Close())
+	aTest.MustBeNoError(g.Close())
+}
+
+func Test_Group_RoundRobin(t *testing.T) {
+	aTest := tester.New(t)
+
+	a, _ := startNamedServer(t, "a", nil)
+	b, _ := startNamedServer(t, "b", nil)
+	c, _ := startNamedServer(t, "c", nil)
+	g := newGroup(t, &Settings{Backends: backends(a, b, c)})
+
+	counts := make(map[string]int)
+	for j := 0; j < 6; j++ {
+		name, err := get(context.Background(), g, "")
+		aTest.MustBeNoError(err)
+		counts[name]++
+	}
+	aTest.MustBeEqual(counts, map[string]int{"a": 2, "b": 2, "c": 2})
+}
+
+func Test_Group_LeastOutstanding(t *testing.T) {
+	aTest := tester.New(t)
+
+	a, _ := startNamedServer(t, "a", nil)
+	b, _ := startNamedServer(t, "b", nil)
+	g := newGroup(t, &Settings{Backends: backends(a, b), Strategy: StrategyLeastOutstanding})
+
+	// A response which is not closed keeps its backend busy.
+	rsp, err := g.Do(context.Background(), &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+	busy, err := io.ReadAll(rsp.Stdout)
+	aTest.MustBeNoError(err)
+
+	for j := 0; j < 4; j++ {
+		name, err := get(context.Background(), g, "")
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(name != string(busy), true)
+	}
+
+	aTest.MustBeNoError(rsp.Close())
+	for _, backend := range g.Backends() {
+		aTest.MustBeEqual(backend.Outstanding(), 0)
+	}
+}
+
+func Test_Group_LeastOutstanding_Waiting(t *testing.T) {
+	aTest := tester.New(t)
+
+	a := startSerialServer(t)
+	g := newGroup(t, &Settings{
+		Backends: []BackendSettings{{Network: cl.NetworkTcp, Address: a, MaxConns: 1}},
+		Strategy: StrategyLeastOutstanding,
+	})
+	backend := g.Backends()[0]
+
+	rsp, err := g.Do(context.Background(), &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(backend.Outstanding(), 1)
+
+	// A request waiting for the connection is outstanding too.
+	names := make(chan string, 1)
+	go func() {
+		name, _ := get(context.Background(), g, "")
+		names <- name
+	}()
+	for start := time.Now(); (backend.Outstanding() != 2) && (time.Since(start) < 5*time.Second); time.Sleep(10 * time.Millisecond) {
+	}
+	aTest.MustBeEqual(backend.Outstanding(), 2)
+
+	aTest.MustBeNoError(rsp.Close())
+	aTest.MustBeEqual(<-names, "a")
+	aTest.MustBeEqual(backend.Outstanding(), 0)
+
+	// Failed requests are not outstanding.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rsp, err = g.Do(ctx, &cl.Request{KeepConn: true})
+	if err == nil {
+		_ = rsp.Close()
+	}
+	aTest.MustBeEqual(backend.Outstanding(), 0)
+}
+
+func Test_Group_ConsistentHash(t *testing.T) {
+	aTest := tester.New(t)
+
+	a, srvA := startNamedServer(t, "a", nil)
+	b, _ := startNamedServer(t, "b", nil)
+	c, _ := startNamedServer(t, "c", nil)
+	g := newGroup(t, &Settings{
+		Backends:        backends(a, b, c),
+		Strategy:        StrategyConsistentHash,
+		PassiveEjection: PassiveEjectionSettings{OnConnectError: true, Duration: time.Minute},
+	})
+
+	// Each key sticks to its backend.
+	keys := make(map[string]string)
+	for j := 0; j < 30; j++ {
+		key := fmt.Sprintf("10.0.0.%d", j)
+		name, err := get(context.Background(), g, key)
+		aTest.MustBeNoError(err)
+		keys[key] = name
+
+		name, err = get(context.Background(), g, key)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(name, keys[key])
+	}
+	aTest.MustBeEqual(len(keys), 30)
+
+	// The key of the context is preferred.
+	ctxKey := WithHashKey(context.Background(), "10.0.0.1")
+	name, err := get(ctxKey, g, "10.0.0.2")
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(name, keys["10.0.0.1"])
+
+	// Keys of the lost backend move, other keys stay.
+	// Idle connections to the lost backend are dropped by the pool when their
+	// readers see that the server has closed them.
+	aTest.MustBeNoError(srvA.Close())
+	time.Sleep(100 * time.Millisecond)
+	for key, expected := range keys {
+		name, err := get(context.Background(), g, key)
+		aTest.MustBeNoError(err)
+
+		if expected == "a" {
+			aTest.MustBeEqual(name != "a", true)
+		} else {
+			aTest.MustBeEqual(name, expected)
+		}
+	}
+}
+
+func Test_Group_ConnectError(t *testing.T) {
+	aTest := tester.New(t)
+
+	dead := deadAddress(t)
+	a, _ := startNamedServer(t, "a", nil)
+	g := newGroup(t, &Settings{
+		Backends:        backends(dead, a),
+		PassiveEjection: PassiveEjectionSettings{OnConnectError: true, Duration: time.Minute},
+	})
+
+	for j := 0; j < 4; j++ {
+		name, err := get(context.Background(), g, "")
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(name, "a")
+	}
+	aTest.MustBeEqual(g.Backends()[0].IsAvailable(), false)
+	aTest.MustBeEqual(g.Backends()[1].IsAvailable(), true)
+
+	// Without other backends, the error of connection is returned.
+	g2 := newGroup(t, &Settings{Backends: backends(dead)})
+	_, err := get(context.Background(), g2, "")
+	var opErr *net.OpError
+	aTest.MustBeEqual(errors.As(err, &opErr), true)
+}
+
+func Test_Group_Overloaded(t *testing.T) {
+	aTest := tester.New(t)
+
+	overloaded := startOverloadedServer(t)
+	g := newGroup(t, &Settings{
+		Backends:        backends(overloaded),
+		PassiveEjection: PassiveEjectionSettings{OnOverloaded: true, Duration: 200 * time.Millisecond},
+	})
+
+	_, err := get(context.Background(), g, "")
+	aTest.MustBeEqual(errors.Is(err, dm.ErrOverloaded), true)
+
+	_, err = get(context.Background(), g, "")
+	aTest.MustBeEqual(err, ErrNoAvailableBackend)
+
+	// The backend is returned after the ejection.
+	time.Sleep(300 * time.Millisecond)
+	_, err = get(context.Background(), g, "")
+	aTest.MustBeEqual(errors.Is(err, dm.ErrOverloaded), true)
+}
+
+func Test_Group_HealthCheck(t *testing.T) {
+	aTest := tester.New(t)
+
+	a, srvA := startNamedServer(t, "a", nil)
+	b, _ := startNamedServer(t, "b", nil)
+	g := newGroup(t, &Settings{
+		Backends:    backends(a, b),
+		HealthCheck: &HealthCheckSettings{FailsToEject: 2, PassesToRestore: 2},
+	})
+
+	g.CheckHealth()
+	aTest.MustBeEqual(g.Backends()[0].IsHealthy(), true)
+
+	aTest.MustBeNoError(srvA.Close())
+	g.CheckHealth()
+	aTest.MustBeEqual(g.Backends()[0].IsHealthy(), true)
+	g.CheckHealth()
+	aTest.MustBeEqual(g.Backends()[0].IsHealthy(), false)
+	aTest.MustBeEqual(g.Backends()[1].IsHealthy(), true)
+
+	for j := 0; j < 3; j++ {
+		name, err := get(context.Background(), g, "")
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(name, "b")
+	}
+}
+
+func Test_Group_HealthCheck_Closed(t *testing.T) {
+	aTest := tester.New(t)
+
+	// This backend accepts connections and closes them without answering.
+	listener, err := net.Listen(cl.NetworkTcp, "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			_, _ = dm.NewRecordFromStream(conn)
+			_ = conn.Close()
+		}
+	}()
+
+	g := newGroup(t, &Settings{
+		Backends:    backends(listener.Addr().String()),
+		HealthCheck: &HealthCheckSettings{},
+	})
+	g.CheckHealth()
+	aTest.MustBeEqual(g.Backends()[0].IsHealthy(), false)
+}
+
+func Test_Group_PingScript(t *testing.T) {
+	aTest := tester.New(t)
+
+	pingStatus := new(atomic.Uint32)
+	a, _ := startNamedServer(t, "a", pingStatus)
+	g := newGroup(t, &Settings{
+		Backends:    backends(a),
+		HealthCheck: &HealthCheckSettings{Interval: 20 * time.Millisecond, PingScript: "/ping"},
+	})
+
+	waitFor := func(isHealthy bool) {
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if g.Backends()[0].IsHealthy() == isHealthy {
+				return
+			}
+		}
+		t.Fatalf("backend health is not %v", isHealthy)
+	}
+
+	pingStatus.Store(1)
+	waitFor(false)
+
+	_, err := get(context.Background(), g, "")
+	aTest.MustBeEqual(err, ErrNoAvailableBackend)
+
+	pingStatus.Store(0)
+	waitFor(true)
+
+	name, err := get(context.Background(), g, "")
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(name, "a")
+}
+
+func Test_Group_PingScript_BusyPool(t *testing.T) {
+	aTest := tester.New(t)
+
+	a := startSerialServer(t)
+	g := newGroup(t, &Settings{
+		Backends: []BackendSettings{{Network: cl.NetworkTcp, Address: a, MaxConns: 1}},
+		HealthCheck: &HealthCheckSettings{
+			Timeout:      200 * time.Millisecond,
+			FailsToEject: 1,
+			PingScript:   "/ping",
+		},
+	})
+
+	// The only connection of the pool is taken.
+	rsp, err := g.Do(context.Background(), &cl.Request{KeepConn: true})
+	aTest.MustBeNoError(err)
+	defer func() {
+		_ = rsp.Close()
+	}()
+
+	g.CheckHealth()
+	aTest.MustBeEqual(g.Backends()[0].IsHealthy(), true)
+}
+
+var _ cl.Doer = (*Group)(nil)
+
+func Test_Group_StatusScript(t *testing.T) {
+	aTest := tester.New(t)
+
+	listenQueue := new(atomic.Int64)
+	srv, err := fcgitest.NewServer(func(r *fcgitest.Request) *fcgitest.Response {
+		status := fmt.Sprintf(`{"pool":"www","listen queue":%v}`, listenQueue.Load())
+		return &fcgitest.Response{Stdout: []byte("Content-Type: application/json\r\n\r\n" + status)}
+	})
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = srv.Close() })
+
+	g := newGroup(t, &Settings{
+		Backends:    backends(srv.Address),
+		HealthCheck: &HealthCheckSettings{StatusScript: "/status", MaxListenQueue: 2},
+	})
+	backend := g.Backends()[0]
+	aTest.MustBeEqual(backend.FpmStatus(), (*pm.FpmStatus)(nil))
+
+	g.CheckHealth()
+	aTest.MustBeEqual(backend.IsHealthy(), true)
+	aTest.MustBeEqual(backend.FpmStatus(), &pm.FpmStatus{Pool: "www"})
+
+	listenQueue.Store(3)
+	g.CheckHealth()
+	aTest.MustBeEqual(backend.IsHealthy(), false)
+	aTest.MustBeEqual(backend.FpmStatus().ListenQueue, 3)
+
+	listenQueue.Store(2)
+	g.CheckHealth()
+	aTest.MustBeEqual(backend.IsHealthy(), true)
+
+	// Only the status page is requested.
+	requests := srv.Requests()
+	aTest.MustBeEqual(len(requests), 3)
+	query, _ := requests[0].Param(dm.Parameter_QueryString)
+	aTest.MustBeEqual(query, pm.FpmStatusQueryFull)
+
+	aTest.MustBeNoError(srv.Close())
+	g.CheckHealth()
+	aTest.MustBeEqual(backend.IsHealthy(), false)
+	aTest.MustBeEqual(backend.FpmStatus(), (*pm.FpmStatus)(nil))
+}
@@ -0,0 +1,109 @@
+package us
+
+import (
+	"time"
+)
+
+// Strategies of choosing a backend.
+const (
+	// StrategyRoundRobin takes backends one by one.
+	StrategyRoundRobin = "round-robin"
+
+	// StrategyLeastOutstanding takes the backend having the least number of
+	// requests in progress.
+	StrategyLeastOutstanding = "least-outstanding"
+
+	// StrategyConsistentHash takes the backend by a hash of a request key,
+	// so that requests having the same key go to the same backend while it is
+	// available.
+	StrategyConsistentHash = "consistent-hash"
+)
+
+// Default settings.
+const (
+	BackendMaxConnsDefault    = 16
+	HealthCheckTimeoutDefault = 2 * time.Second
+	EjectionDurationDefault   = 10 * time.Second
+	HashReplicasDefault       = 160
+	FailsToEjectDefault       = 1
+	PassesToRestoreDefault    = 1
+	HashParamDefault          = "REMOTE_ADDR"
+)
+
+// BackendSettings are settings of a FastCGI server.
+type BackendSettings struct {
+	Network string
+	Address string
+
+	// Maximum number of connections to the backend. Zero means the default
+	// number.
+	MaxConns int
+}
+
+// HealthCheckSettings are settings of active health checks. A backend is
+// asked with the FCGI_GET_VALUES record, or, when the ping script is set, the
+// script is run. When the status script is set, the status is read as well,
+// and the FCGI_GET_VALUES record is not sent. Checks use new connections
+// rather than the pool, so that a busy backend is not taken for a dead one.
+type HealthCheckSettings struct {
+	// Interval between checks.
+	Interval time.Duration
+
+	// Time limit of a single check.
+	Timeout time.Duration
+
+	// Path to the ping script. The script is run with the FCGI_RESPONDER
+	// role and must end with the zero application status. For php-fpm, it is
+	// the 'ping.path' setting.
+	PingScript string
+
+	// Path to the status page of php-fpm, see the 'pm.status_path' setting.
+	// The status read by the last check is kept by the backend, see the
+	// 'Backend.FpmStatus' method.
+	StatusScript string
+
+	// Maximum number of connections waiting in the listen queue of php-fpm
+	// for a healthy backend. It is checked when the status script is set.
+	// Zero means that the queue is not checked.
+	MaxListenQueue int
+
+	// Number of consecutive failed checks after which the backend is
+	// ejected.
+	FailsToEject int
+
+	// Number of consecutive successful checks after which the ejected
+	// backend is returned.
+	PassesToRestore int
+}
+
+// PassiveEjectionSettings are settings of ejecting backends by results of
+// ordinary requests.
+type PassiveEjectionSettings struct {
+	// Eject the backend when a connection can not be made.
+	OnConnectError bool
+
+	// Eject the backend when it rejects a request with the FCGI_OVERLOADED
+	// status.
+	OnOverloaded bool
+
+	// Time after which the ejected backend is returned.
+	Duration time.Duration
+}
+
+// Settings of the upstream group.
+type Settings struct {
+	Backends []BackendSettings
+
+	// Strategy of choosing a backend. Empty strategy means round-robin.
+	Strategy string
+
+	// Active health checks. Nil settings disable the checks.
+	HealthCheck *HealthCheckSettings
+
+	PassiveEjection PassiveEjectionSettings
+
+	// Name of the request parameter which is the key of the consistent hash,
+	// unless the key is set by the 'WithHashKey' function. Empty name means
+	// the REMOTE_ADDR parameter.
+	HashParam string
+}
@@ -0,0 +1,78 @@
+package us
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strconv"
+)
+
+type hashKeyT struct{}
+
+// WithHashKey sets the key of the consistent hash for requests made with the
+// context, e.g. a session ID.
+func WithHashKey(ctx context.Context, key string) context.Context {
+	return context.WithValue(ctx, hashKeyT{}, key)
+}
+
+func hashKeyFromContext(ctx context.Context) (key string, ok bool) {
+	key, ok = ctx.Value(hashKeyT{}).(string)
+	return key, ok
+}
+
+// hashRing is a ring of consistent hashing. Each backend has many points on
+// the ring, so that keys of an ejected backend are spread among others.
+type hashRing struct {
+	points []hashRingPoint
+}
+
+type hashRingPoint struct {
+	hash    uint32
+	backend int
+}
+
+func newHashRing(backends []*Backend, replicas int) (ring *hashRing) {
+	ring = &hashRing{
+		points: make([]hashRingPoint, 0, len(backends)*replicas),
+	}
+
+	for i, b := range backends {
+		for r := 0; r < replicas; r++ {
+			ring.points = append(ring.points, hashRingPoint{
+				hash:    hash(b.network + "://" + b.address + "#" + strconv.Itoa(r)),
+				backend: i,
+			})
+		}
+	}
+
+	sort.Slice(ring.points, func(i, j int) bool {
+		return ring.points[i].hash < ring.points[j].hash
+	})
+
+	return ring
+}
+
+// walk calls the function for backends of the ring, starting from the point
+// of the key, until the function returns true.
+func (ring *hashRing) walk(key string, f func(backend int) bool) {
+	if len(ring.points) == 0 {
+		return
+	}
+
+	h := hash(key)
+	start := sort.Search(len(ring.points), func(i int) bool {
+		return ring.points[i].hash >= h
+	})
+
+	for i := 0; i < len(ring.points); i++ {
+		if f(ring.points[(start+i)%len(ring.points)].backend) {
+			return
+		}
+	}
+}
+
+func hash(s string) uint32 {
+	h := fnv.New32a()
+	_, _ = h.Write([]byte(s))
+	return h.Sum32()
+}
@@ -0,0 +1,81 @@
+package fcgitest
+
+import (
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// Request is a request received by the server. The handler gets it when the
+// input streams have ended: FCGI_PARAMS, FCGI_STDIN and, for the FCGI_FILTER
+// role, FCGI_DATA.
+type Request struct {
+	Id       uint16
+	Role     dm.Role
+	KeepConn bool
+	Params   []*nvpair.NameValuePair
+	Stdin    []byte
+	Data     []byte
+
+	aborted chan struct{}
+}
+
+// Param returns the value of the parameter.
+func (r *Request) Param(name string) (value string, ok bool) {
+	for _, p := range r.Params {
+		if string(p.Name) == name {
+			return string(p.Value), true
+		}
+	}
+
+	return "", false
+}
+
+// Aborted returns a channel which is closed when the FCGI_ABORT_REQUEST record
+// of the request arrives.
+func (r *Request) Aborted() <-chan struct{} {
+	return r.aborted
+}
+
+// IsAborted tells whether the FCGI_ABORT_REQUEST record of the request has
+// arrived.
+func (r *Request) IsAborted() (isAborted bool) {
+	select {
+	case <-r.aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// Response is a scripted response to a request.
+type Response struct {
+	Stdout    []byte
+	Stderr    []byte
+	AppStatus uint32
+
+	// A status other than FCGI_REQUEST_COMPLETE, e.g. FCGI_OVERLOADED,
+	// rejects the request: the output streams are not sent.
+	ProtocolStatus byte
+
+	// Pause before the response is sent. It is interrupted when the request
+	// is aborted or the server is closed.
+	Delay time.Duration
+
+	// When it is set, the connection is closed abruptly after the output
+	// streams are sent, without their ends and the FCGI_END_REQUEST record.
+	IsConnClosed bool
+}
+
+// Handler scripts responses of the server. A nil response is an empty one.
+// A handler waiting for something should also wait for the abort of the
+// request, as the server is closed after all the handlers have returned.
+type Handler func(r *Request) (rsp *Response)
+
+// Reply returns a handler which gives the same response to every request.
+func Reply(rsp *Response) (h Handler) {
+	return func(r *Request) *Response {
+		return rsp
+	}
+}
@@ -0,0 +1,218 @@
+// Package fcgitest provides a scripted FastCGI application for tests of
+// clients, like the 'httptest' package does for HTTP.
+package fcgitest
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+)
+
+// Values of the FCGI_GET_VALUES variables reported by the server.
+const (
+	FcgiMaxConns  = "64"
+	FcgiMaxReqs   = "1024"
+	FcgiMpxsConns = "1"
+)
+
+const (
+	LoopbackAddress = "127.0.0.1:0"
+	SocketFileName  = "fcgi.sock"
+)
+
+// Networks of the listener. The 'cl' package is not imported, so that its own
+// tests may use this package.
+const (
+	networkTcp  = "tcp"
+	networkUnix = "unix"
+)
+
+// ValuesAnswer scripts the answer of the server to the FCGI_GET_VALUES record.
+type ValuesAnswer struct {
+	// Values reported whatever variables are asked.
+	Values []*nvpair.NameValuePair
+
+	// When it is set, the record is answered with the FCGI_UNKNOWN_TYPE
+	// record, like a server which does not support it.
+	IsUnknownType bool
+
+	// When it is set, the connection is closed instead of an answer.
+	IsConnClosed bool
+}
+
+// Server is a scripted FastCGI application. It collects the received requests
+// and answers them by the handler. Requests of a connection are served
+// concurrently.
+type Server struct {
+	// Network and Address of the listener, suitable for 'cl.New'.
+	Network string
+	Address string
+
+	handler  Handler
+	listener net.Listener
+	tempDir  string
+
+	lock         *sync.Mutex
+	valuesAnswer *ValuesAnswer
+	requests     []*Request
+	netConns     map[net.Conn]struct{}
+	isClosed     bool
+	closed       chan struct{}
+	wg           *sync.WaitGroup
+}
+
+// NewServer starts a server on a loopback TCP port.
+func NewServer(handler Handler) (srv *Server, err error) {
+	var listener net.Listener
+	listener, err = net.Listen(networkTcp, LoopbackAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	return start(handler, listener, ""), nil
+}
+
+// NewUnixServer starts a server on a Unix socket in a temporary directory,
+// which is removed when the server is closed.
+func NewUnixServer(handler Handler) (srv *Server, err error) {
+	var tempDir string
+	tempDir, err = os.MkdirTemp("", "fcgitest")
+	if err != nil {
+		return nil, err
+	}
+
+	var listener net.Listener
+	listener, err = net.Listen(networkUnix, filepath.Join(tempDir, SocketFileName))
+	if err != nil {
+		_ = os.RemoveAll(tempDir)
+		return nil, err
+	}
+
+	return start(handler, listener, tempDir), nil
+}
+
+func start(handler Handler, listener net.Listener, tempDir string) (srv *Server) {
+	if handler == nil {
+		handler = Reply(nil)
+	}
+
+	srv = &Server{
+		Network:  listener.Addr().Network(),
+		Address:  listener.Addr().String(),
+		handler:  handler,
+		listener: listener,
+		tempDir:  tempDir,
+		lock:     new(sync.Mutex),
+		netConns: make(map[net.Conn]struct{}),
+		closed:   make(chan struct{}),
+		wg:       new(sync.WaitGroup),
+	}
+
+	srv.wg.Add(1)
+	go srv.serve()
+
+	return srv
+}
+
+// SetValuesAnswer scripts the answer to the FCGI_GET_VALUES record. Nil answer
+// restores the default one, which reports the asked standard variables.
+func (srv *Server) SetValuesAnswer(answer *ValuesAnswer) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	srv.valuesAnswer = answer
+}
+
+func (srv *Server) getValuesAnswer() (answer *ValuesAnswer) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	return srv.valuesAnswer
+}
+
+// Requests returns copies of the requests received so far, in order of their
+// beginning. Requests being received may have incomplete input streams.
+func (srv *Server) Requests() (requests []*Request) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	requests = make([]*Request, 0, len(srv.requests))
+	for _, r := range srv.requests {
+		copied := *r
+		requests = append(requests, &copied)
+	}
+
+	return requests
+}
+
+// Close closes the listener and the connections and waits for the handlers
+// to return.
+func (srv *Server) Close() (err error) {
+	srv.lock.Lock()
+	if srv.isClosed {
+		srv.lock.Unlock()
+		return nil
+	}
+
+	srv.isClosed = true
+	close(srv.closed)
+
+	err = srv.listener.Close()
+	for netConn := range srv.netConns {
+		_ = netConn.Close()
+	}
+	srv.lock.Unlock()
+
+	srv.wg.Wait()
+
+	if len(srv.tempDir) > 0 {
+		_ = os.RemoveAll(srv.tempDir)
+	}
+
+	return err
+}
+
+func (srv *Server) serve() {
+	defer srv.wg.Done()
+
+	for {
+		netConn, err := srv.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		if !srv.addConn(netConn) {
+			_ = netConn.Close()
+			return
+		}
+
+		srv.wg.Add(1)
+		go func() {
+			defer srv.wg.Done()
+			newConn(srv, netConn).serve()
+			srv.removeConn(netConn)
+		}()
+	}
+}
+
+func (srv *Server) addConn(netConn net.Conn) (ok bool) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	if srv.isClosed {
+		return false
+	}
+
+	srv.netConns[netConn] = struct{}{}
+	return true
+}
+
+func (srv *Server) removeConn(netConn net.Conn) {
+	srv.lock.Lock()
+	defer srv.lock.Unlock()
+
+	delete(srv.netConns, netConn)
+}
@@ -0,0 +1,214 @@
+package fcgitest
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/ScriptRunner"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func do(srv *Server, ctx context.Context, stdin string) (stdout string, stderr string, appStatus uint32, err error) {
+	var c *cl.Client
+	c, err = cl.New(srv.Network, srv.Address)
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer func() { _ = c.Close() }()
+
+	var stderrBuf bytes.Buffer
+	var rsp *cl.Response
+	rsp, err = c.Do(ctx, &cl.Request{
+		Role:   dm.FCGI_RESPONDER,
+		Params: []*nvpair.NameValuePair{nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, "/srv/index.php")},
+		Stdin:  strings.NewReader(stdin),
+		Stderr: &stderrBuf,
+	})
+	if err != nil {
+		return "", "", 0, err
+	}
+	defer func() { _ = rsp.Close() }()
+
+	var ba []byte
+	ba, err = io.ReadAll(rsp.Stdout)
+	if err != nil {
+		return "", "", 0, err
+	}
+
+	return string(ba), stderrBuf.String(), rsp.AppStatus(), nil
+}
+
+func Test_Server(t *testing.T) {
+	aTest := tester.New(t)
+
+	for _, newServer := range []func(Handler) (*Server, error){NewServer, NewUnixServer} {
+		srv, err := newServer(func(r *Request) *Response {
+			return &Response{Stdout: append([]byte("Content-Type: text/plain\r\n\r\n"), r.Stdin...), Stderr: []byte("notice"), AppStatus: 3}
+		})
+		aTest.MustBeNoError(err)
+
+		stdout, stderr, appStatus, err := do(srv, context.Background(), "name=Alice")
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(stdout, "Content-Type: text/plain\r\n\r\nname=Alice")
+		aTest.MustBeEqual(stderr, "notice")
+		aTest.MustBeEqual(appStatus, uint32(3))
+
+		requests := srv.Requests()
+		aTest.MustBeEqual(len(requests), 1)
+		aTest.MustBeEqual(requests[0].Id, uint16(1))
+		aTest.MustBeEqual(requests[0].Role, dm.Role(dm.FCGI_RESPONDER))
+		aTest.MustBeEqual(requests[0].Stdin, []byte("name=Alice"))
+		aTest.MustBeEqual(requests[0].IsAborted(), false)
+
+		value, ok := requests[0].Param(dm.Parameter_ScriptFilename)
+		aTest.MustBeEqual(ok, true)
+		aTest.MustBeEqual(value, "/srv/index.php")
+		_, ok = requests[0].Param("QUERY_STRING")
+		aTest.MustBeEqual(ok, false)
+
+		aTest.MustBeNoError(srv.Close())
+	}
+}
+
+func Test_Server_ScriptRunner(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv, err := NewServer(Reply(&Response{Stdout: []byte("Status: 201 Created\r\nContent-Type: text/plain\r\n\r\nDone")}))
+	aTest.MustBeNoError(err)
+	defer func() { _ = srv.Close() }()
+
+	pool := cl.NewPool(srv.Network, srv.Address, 2)
+	defer func() { _ = pool.Close() }()
+
+	runner := sr.New(pool)
+	for range 3 {
+		data, err := runner.RunScript(context.Background(), nil, nil)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(data.StatusCode, uint(201))
+		aTest.MustBeEqual(data.Body, []byte("Done"))
+	}
+
+	aTest.MustBeEqual(len(srv.Requests()), 3)
+}
+
+func Test_Server_Rejects(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv, err := NewServer(Reply(&Response{Stdout: []byte("ignored"), ProtocolStatus: dm.FCGI_OVERLOADED}))
+	aTest.MustBeNoError(err)
+
+	_, _, _, err = do(srv, context.Background(), "")
+	aTest.MustBeEqual(errors.Is(err, dm.ErrOverloaded), true)
+	aTest.MustBeNoError(srv.Close())
+
+	srv, err = NewServer(Reply(&Response{Stdout: []byte("Content-Type: text/plain\r\n\r\nHal"), IsConnClosed: true}))
+	aTest.MustBeNoError(err)
+
+	_, _, _, err = do(srv, context.Background(), "")
+	aTest.MustBeAnError(err)
+	aTest.MustBeNoError(srv.Close())
+}
+
+func Test_Server_Delay(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv, err := NewServer(Reply(&Response{Delay: 100 * time.Millisecond}))
+	aTest.MustBeNoError(err)
+	defer func() { _ = srv.Close() }()
+
+	start := time.Now()
+	_, _, _, err = do(srv, context.Background(), "")
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(time.Since(start) >= 100*time.Millisecond, true)
+}
+
+func Test_Server_Abort(t *testing.T) {
+	aTest := tester.New(t)
+
+	// The handler waits for the abort.
+	srv, err := NewServer(func(r *Request) *Response {
+		<-r.Aborted()
+		return &Response{AppStatus: 1}
+	})
+	aTest.MustBeNoError(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, _, err = do(srv, ctx, "")
+	aTest.MustBeEqual(errors.Is(err, context.DeadlineExceeded), true)
+
+	requests := srv.Requests()
+	aTest.MustBeEqual(len(requests), 1)
+	aTest.MustBeEqual(requests[0].IsAborted(), true)
+	aTest.MustBeNoError(srv.Close())
+
+	// The delay is interrupted by the abort.
+	srv, err = NewServer(Reply(&Response{Delay: time.Hour}))
+	aTest.MustBeNoError(err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, _, _, err = do(srv, ctx, "")
+	aTest.MustBeEqual(errors.Is(err, context.DeadlineExceeded), true)
+	aTest.MustBeEqual(srv.Requests()[0].IsAborted(), true)
+	aTest.MustBeNoError(srv.Close())
+}
+
+func Test_Server_ValuesAnswer(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv, err := NewServer(nil)
+	aTest.MustBeNoError(err)
+	defer func() { _ = srv.Close() }()
+
+	probe := func() (caps *cl.Capabilities, err error) {
+		defer cl.ForgetCapabilities(srv.Network, srv.Address)
+
+		var c *cl.Client
+		c, err = cl.New(srv.Network, srv.Address)
+		if err != nil {
+			return nil, err
+		}
+		defer func() { _ = c.Close() }()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		return c.ProbeValues(ctx)
+	}
+
+	caps, err := probe()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps, &cl.Capabilities{IsSupported: true, MaxConns: 64, MaxReqs: 1024, MpxsConns: true, Others: map[string]string{}})
+
+	srv.SetValuesAnswer(&ValuesAnswer{Values: []*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU("X_VENDOR", "test"),
+	}})
+	caps, err = probe()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps, &cl.Capabilities{IsSupported: true, Others: map[string]string{"X_VENDOR": "test"}})
+
+	srv.SetValuesAnswer(&ValuesAnswer{IsUnknownType: true})
+	caps, err = probe()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps.IsSupported, false)
+
+	srv.SetValuesAnswer(&ValuesAnswer{IsConnClosed: true})
+	_, err = probe()
+	aTest.MustBeEqual(err.Error(), cl.ErrValuesAreNotAnswered)
+
+	srv.SetValuesAnswer(nil)
+	caps, err = probe()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(caps.MaxConns, 64)
+}
@@ -0,0 +1,341 @@
+package fcgitest
+
+import (
+	"bytes"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/request"
+)
+
+// conn is a connection of the server. Records are read by a single goroutine,
+// while responses are written by goroutines of the requests.
+type conn struct {
+	srv       *Server
+	netConn   net.Conn
+	writeLock *sync.Mutex
+
+	// Requests being received or served. They are guarded by the lock of
+	// the server.
+	requests map[uint16]*request
+}
+
+type request struct {
+	*Request
+
+	params      bytes.Buffer
+	isParamsEnd bool
+	isStdinEnd  bool
+	isDataEnd   bool
+	isStarted   bool
+}
+
+func newConn(srv *Server, netConn net.Conn) (c *conn) {
+	return &conn{
+		srv:       srv,
+		netConn:   netConn,
+		writeLock: new(sync.Mutex),
+		requests:  make(map[uint16]*request),
+	}
+}
+
+// serve reads records until the connection is closed or a record is broken.
+func (c *conn) serve() {
+	defer func() { _ = c.netConn.Close() }()
+
+	reader := dm.NewRecordReader(c.netConn, false)
+
+	var rec dm.Record
+	var err error
+	for {
+		err = reader.ReadRecordInto(&rec)
+		if err != nil {
+			return
+		}
+
+		err = c.handleRecord(&rec)
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (c *conn) handleRecord(rec *dm.Record) (err error) {
+	if rec.RequestId == dm.FCGI_NULL_REQUEST_ID {
+		return c.handleManagementRecord(rec)
+	}
+
+	switch rec.Type {
+	case dm.FCGI_BEGIN_REQUEST:
+		return c.beginRequest(rec)
+	case dm.FCGI_ABORT_REQUEST:
+		return c.abortRequest(rec.RequestId)
+	case dm.FCGI_PARAMS, dm.FCGI_STDIN, dm.FCGI_DATA:
+		return c.addInput(rec)
+	default:
+		return nil
+	}
+}
+
+// handleManagementRecord answers the FCGI_GET_VALUES record, as pools of
+// connections ask for the limits of the server. The answer may be scripted.
+func (c *conn) handleManagementRecord(rec *dm.Record) (err error) {
+	answer := c.srv.getValuesAnswer()
+	if (rec.Type != dm.FCGI_GET_VALUES) || ((answer != nil) && answer.IsUnknownType) {
+		body := dm.NewUnknownTypeRequestBody(rec.Type)
+		return c.writeRecords(func(buf *bytes.Buffer) error {
+			return dm.WriteRecord(buf, dm.FCGI_UNKNOWN_TYPE, dm.FCGI_NULL_REQUEST_ID, body.ToBytes())
+		})
+	}
+
+	if (answer != nil) && answer.IsConnClosed {
+		_ = c.netConn.Close()
+		return nil
+	}
+
+	var values []*nvpair.NameValuePair
+	if answer != nil {
+		values = answer.Values
+	} else {
+		values, err = defaultValues(rec)
+		if err != nil {
+			return err
+		}
+	}
+
+	var content bytes.Buffer
+	err = dm.WriteParametersToBytesBuffer(&content, values)
+	if err != nil {
+		return err
+	}
+
+	return c.writeRecords(func(buf *bytes.Buffer) error {
+		return dm.WriteRecord(buf, dm.FCGI_GET_VALUES_RESULT, dm.FCGI_NULL_REQUEST_ID, content.Bytes())
+	})
+}
+
+// defaultValues returns the values of the standard variables asked by the
+// FCGI_GET_VALUES record.
+func defaultValues(rec *dm.Record) (values []*nvpair.NameValuePair, err error) {
+	var names []*nvpair.NameValuePair
+	names, err = rec.ParseContentAsNVPs()
+	if err != nil {
+		return nil, err
+	}
+
+	values = make([]*nvpair.NameValuePair, 0, len(names))
+	for _, name := range names {
+		switch string(name.Name) {
+		case cm.FCGI_MAX_CONNS:
+			values = append(values, nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_CONNS, FcgiMaxConns))
+		case cm.FCGI_MAX_REQS:
+			values = append(values, nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MAX_REQS, FcgiMaxReqs))
+		case cm.FCGI_MPXS_CONNS:
+			values = append(values, nvpair.NewNameValuePairWithTextValueU(cm.FCGI_MPXS_CONNS, FcgiMpxsConns))
+		}
+	}
+
+	return values, nil
+}
+
+func (c *conn) beginRequest(rec *dm.Record) (err error) {
+	var brb dm.BeginRequestBody
+	brb, err = dm.NewBeginRequestBodyFromBytes(rec.ContentData)
+	if err != nil {
+		return err
+	}
+
+	req := &request{
+		Request: &Request{
+			Id:       rec.RequestId,
+			Role:     brb.Role,
+			KeepConn: brb.Flags&dm.FCGI_KEEP_CONN != 0,
+			aborted:  make(chan struct{}),
+		},
+	}
+
+	c.srv.lock.Lock()
+	defer c.srv.lock.Unlock()
+
+	c.requests[rec.RequestId] = req
+	c.srv.requests = append(c.srv.requests, req.Request)
+
+	return nil
+}
+
+// abortRequest marks the request as aborted. A request which is not started
+// yet is ended at once, a started one is ended by its handler.
+func (c *conn) abortRequest(id uint16) (err error) {
+	c.srv.lock.Lock()
+	req, ok := c.requests[id]
+	if !ok || req.IsAborted() {
+		c.srv.lock.Unlock()
+		return nil
+	}
+
+	close(req.aborted)
+
+	isStarted := req.isStarted
+	if !isStarted {
+		delete(c.requests, id)
+	}
+	c.srv.lock.Unlock()
+
+	if isStarted {
+		return nil
+	}
+
+	return c.writeResponse(req.Request, &Response{})
+}
+
+// addInput collects the input streams and starts the request when they have
+// ended.
+func (c *conn) addInput(rec *dm.Record) (err error) {
+	c.srv.lock.Lock()
+	defer c.srv.lock.Unlock()
+
+	req, ok := c.requests[rec.RequestId]
+	if !ok || req.isStarted {
+		return nil
+	}
+
+	isEnd := len(rec.ContentData) == 0
+	switch rec.Type {
+	case dm.FCGI_PARAMS:
+		req.params.Write(rec.ContentData)
+		if isEnd && !req.isParamsEnd {
+			req.isParamsEnd = true
+			req.Params, err = parseParams(req.params.Bytes())
+			if err != nil {
+				return err
+			}
+		}
+	case dm.FCGI_STDIN:
+		req.Stdin = append(req.Stdin, rec.ContentData...)
+		req.isStdinEnd = req.isStdinEnd || isEnd
+	case dm.FCGI_DATA:
+		req.Data = append(req.Data, rec.ContentData...)
+		req.isDataEnd = req.isDataEnd || isEnd
+	}
+
+	if !req.isParamsEnd || !req.isStdinEnd || ((req.Role == dm.FCGI_FILTER) && !req.isDataEnd) {
+		return nil
+	}
+
+	req.isStarted = true
+
+	c.srv.wg.Add(1)
+	go c.runRequest(req.Request)
+
+	return nil
+}
+
+// runRequest runs the handler and sends its response.
+func (c *conn) runRequest(r *Request) {
+	defer c.srv.wg.Done()
+
+	rsp := c.srv.handler(r)
+	if rsp == nil {
+		rsp = &Response{}
+	}
+
+	if rsp.Delay > 0 {
+		timer := time.NewTimer(rsp.Delay)
+		select {
+		case <-timer.C:
+		case <-r.aborted:
+		case <-c.srv.closed:
+		}
+		timer.Stop()
+	}
+
+	c.srv.lock.Lock()
+	delete(c.requests, r.Id)
+	c.srv.lock.Unlock()
+
+	_ = c.writeResponse(r, rsp)
+}
+
+// writeResponse writes the response and closes the connection when the
+// request or the response asks for it.
+func (c *conn) writeResponse(r *Request, rsp *Response) (err error) {
+	err = c.writeRecords(func(buf *bytes.Buffer) (err error) {
+		if rsp.ProtocolStatus == dm.FCGI_REQUEST_COMPLETE {
+			err = writeStream(buf, dm.FCGI_STDOUT, r.Id, rsp.Stdout, !rsp.IsConnClosed)
+			if err != nil {
+				return err
+			}
+
+			err = writeStream(buf, dm.FCGI_STDERR, r.Id, rsp.Stderr, !rsp.IsConnClosed && (len(rsp.Stderr) > 0))
+			if err != nil {
+				return err
+			}
+		}
+
+		if rsp.IsConnClosed {
+			return nil
+		}
+
+		return dm.WriteRecord(buf, dm.FCGI_END_REQUEST, r.Id, dm.NewEndRequestBody(rsp.AppStatus, rsp.ProtocolStatus).ToBytes())
+	})
+
+	if rsp.IsConnClosed || !r.KeepConn {
+		_ = c.netConn.Close()
+	}
+
+	return err
+}
+
+// writeRecords writes the records at once, so that records of concurrent
+// requests are not mixed.
+func (c *conn) writeRecords(fn func(buf *bytes.Buffer) error) (err error) {
+	var buf bytes.Buffer
+	err = fn(&buf)
+	if err != nil {
+		return err
+	}
+
+	c.writeLock.Lock()
+	defer c.writeLock.Unlock()
+
+	_, err = c.netConn.Write(buf.Bytes())
+	return err
+}
+
+// writeStream writes the data as records of the stream, ending the stream
+// when it is asked to.
+func writeStream(buf *bytes.Buffer, recordType dm.RecordType, requestId uint16, data []byte, isEnded bool) (err error) {
+	sw := rm.NewStreamWriter(buf, recordType, requestId)
+
+	_, err = sw.Write(data)
+	if err != nil {
+		return err
+	}
+
+	if !isEnded {
+		return nil
+	}
+
+	return sw.Close()
+}
+
+func parseParams(ba []byte) (params []*nvpair.NameValuePair, err error) {
+	params = make([]*nvpair.NameValuePair, 0)
+	rdr := bytes.NewReader(ba)
+
+	var nvp *nvpair.NameValuePair
+	for rdr.Len() > 0 {
+		nvp, err = nvpair.NewNameValuePairFromStream(rdr)
+		if err != nil {
+			return nil, err
+		}
+
+		params = append(params, nvp)
+	}
+
+	return params, nil
+}
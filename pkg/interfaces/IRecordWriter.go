@@ -0,0 +1,7 @@
+package i
+
+// IRecordWriter writes whole records. Record type is one of the 'dm'
+// record types.
+type IRecordWriter interface {
+	WriteRecord(recordType byte, requestId uint16, content []byte) (err error)
+}
@@ -6,7 +6,6 @@ import (
 	"io"
 
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/VariableLength"
-	"github.com/vault-thirteen/auxie/reader"
 )
 
 // NameValuePair is a name-value pair in accordance to the FastCGI
@@ -56,8 +55,6 @@ func NewNameValuePairWithTextValueU(name string, value string) (nvp *NameValuePa
 
 // NewNameValuePairFromStream reads a name-value pair from a byte stream.
 func NewNameValuePairFromStream(stream io.Reader) (nvp *NameValuePair, err error) {
-	rdr := reader.New(stream)
-
 	nvp = &NameValuePair{}
 
 	nvp.NameLength, err = vl.NewFromStream(stream)
@@ -70,12 +67,12 @@ func NewNameValuePairFromStream(stream io.Reader) (nvp *NameValuePair, err error
 		return nil, err
 	}
 
-	nvp.Name, err = rdr.ReadBytes(int(nvp.NameLength.RealValue()))
+	nvp.Name, err = readBytes(stream, nvp.NameLength.RealValue())
 	if err != nil {
 		return nil, err
 	}
 
-	nvp.Value, err = rdr.ReadBytes(int(nvp.ValueLength.RealValue()))
+	nvp.Value, err = readBytes(stream, nvp.ValueLength.RealValue())
 	if err != nil {
 		return nil, err
 	}
@@ -83,6 +80,21 @@ func NewNameValuePairFromStream(stream io.Reader) (nvp *NameValuePair, err error
 	return nvp, nil
 }
 
+// readBytes reads the specified number of bytes. Memory grows with the data
+// read, so a huge length in a short stream does not allocate the length.
+func readBytes(stream io.Reader, size uint32) (ba []byte, err error) {
+	ba, err = io.ReadAll(io.LimitReader(stream, int64(size)))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(ba) < int(size) {
+		return nil, io.ErrUnexpectedEOF
+	}
+
+	return ba, nil
+}
+
 // Measure calculates memory size, or content length, required for storing or
 // transmitting of a single name-value pair as a FastCGI data.
 func (nvp *NameValuePair) Measure() (n int) {
@@ -2,8 +2,10 @@ package nvpair
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"io"
+	"runtime"
 	"testing"
 
 	"github.com/vault-thirteen/auxie/reader"
@@ -197,80 +199,110 @@ func Test_NewNameValuePairWithTextValueU(t *testing.T) {
 	fmt.Println()
 }
 
-func Test_NewNameValuePairFromStream(t *testing.T) {
-	aTest := tester.New(t)
-
-	type InputData = []byte
-
-	type OutputData struct {
-		Name  []byte
-		Value []byte
+// pairFromStreamOutput is the expected result of the
+// NewNameValuePairFromStream function.
+type pairFromStreamOutput struct {
+	Name  []byte
+	Value []byte
 
-		NameLength_RealValue    uint32
-		NameLength_RawValueSize int // Number of bytes to store the raw data.
+	NameLength_RealValue    uint32
+	NameLength_RawValueSize int // Number of bytes to store the raw data.
 
-		ValueLength_RealValue    uint32
-		ValueLength_RawValueSize int // Number of bytes to store the raw data.
-	}
+	ValueLength_RealValue    uint32
+	ValueLength_RawValueSize int // Number of bytes to store the raw data.
+}
 
-	type TestData struct {
-		Data            InputData
-		IsErrorExpected bool
-		ExpectedValue   OutputData
-	}
+// pairFromStreamTest is a test case of the NewNameValuePairFromStream
+// function.
+type pairFromStreamTest struct {
+	Data            []byte
+	IsErrorExpected bool
+	ExpectedValue   pairFromStreamOutput
+}
 
-	tests := []TestData{
-		{
-			Data:            []byte{0, 0},
-			IsErrorExpected: false,
-			ExpectedValue: OutputData{
-				Name:                     []byte{},
-				Value:                    []byte{},
-				NameLength_RealValue:     0,
-				NameLength_RawValueSize:  1,
-				ValueLength_RealValue:    0,
-				ValueLength_RawValueSize: 1,
-			},
+// pairFromStreamTests are test cases of the NewNameValuePairFromStream
+// function. Their data seeds the fuzz test as well.
+var pairFromStreamTests = []pairFromStreamTest{
+	{
+		Data:            []byte{0, 0},
+		IsErrorExpected: false,
+		ExpectedValue: pairFromStreamOutput{
+			Name:                     []byte{},
+			Value:                    []byte{},
+			NameLength_RealValue:     0,
+			NameLength_RawValueSize:  1,
+			ValueLength_RealValue:    0,
+			ValueLength_RawValueSize: 1,
 		},
-		{
-			Data: append(append(append(append(make([]byte, 0),
-				[]byte{byte(16)}...),
-				[]byte{byte(18)}...),
-				[]byte("The Planet Earth")...),
-				[]byte("The Vault Thirteen")...),
-			IsErrorExpected: false,
-			ExpectedValue: OutputData{
-				Name:                     []byte("The Planet Earth"),
-				Value:                    []byte("The Vault Thirteen"),
-				NameLength_RealValue:     16,
-				NameLength_RawValueSize:  1,
-				ValueLength_RealValue:    18,
-				ValueLength_RawValueSize: 1,
-			},
+	},
+	{
+		Data: append(append(append(append(make([]byte, 0),
+			[]byte{byte(16)}...),
+			[]byte{byte(18)}...),
+			[]byte("The Planet Earth")...),
+			[]byte("The Vault Thirteen")...),
+		IsErrorExpected: false,
+		ExpectedValue: pairFromStreamOutput{
+			Name:                     []byte("The Planet Earth"),
+			Value:                    []byte("The Vault Thirteen"),
+			NameLength_RealValue:     16,
+			NameLength_RawValueSize:  1,
+			ValueLength_RealValue:    18,
+			ValueLength_RawValueSize: 1,
 		},
-		{
-			Data: append(append(append(append(make([]byte, 0),
-				[]byte{128, 0, 0, 169}...),
-				[]byte{128, 0, 0, 130}...),
-				[]byte("The name of the range hails from the Sanskrit Himālaya (हिमालय 'abode of the snow'), from himá (हिम 'snow') and ā-laya (आलय 'home, dwelling').")...),
-				[]byte("The Himalayas, or Himalaya is a mountain range in Asia, separating the plains of the Indian subcontinent from the Tibetan Plateau.")...),
-			IsErrorExpected: false,
-			ExpectedValue: OutputData{
-				Name:                     []byte("The name of the range hails from the Sanskrit Himālaya (हिमालय 'abode of the snow'), from himá (हिम 'snow') and ā-laya (आलय 'home, dwelling')."),
-				Value:                    []byte("The Himalayas, or Himalaya is a mountain range in Asia, separating the plains of the Indian subcontinent from the Tibetan Plateau."),
-				NameLength_RealValue:     169,
-				NameLength_RawValueSize:  4,
-				ValueLength_RealValue:    130,
-				ValueLength_RawValueSize: 4,
-			},
+	},
+	{
+		Data: append(append(append(append(make([]byte, 0),
+			[]byte{128, 0, 0, 169}...),
+			[]byte{128, 0, 0, 130}...),
+			[]byte("The name of the range hails from the Sanskrit Himālaya (हिमालय 'abode of the snow'), from himá (हिम 'snow') and ā-laya (आलय 'home, dwelling').")...),
+			[]byte("The Himalayas, or Himalaya is a mountain range in Asia, separating the plains of the Indian subcontinent from the Tibetan Plateau.")...),
+		IsErrorExpected: false,
+		ExpectedValue: pairFromStreamOutput{
+			Name:                     []byte("The name of the range hails from the Sanskrit Himālaya (हिमालय 'abode of the snow'), from himá (हिम 'snow') and ā-laya (आलय 'home, dwelling')."),
+			Value:                    []byte("The Himalayas, or Himalaya is a mountain range in Asia, separating the plains of the Indian subcontinent from the Tibetan Plateau."),
+			NameLength_RealValue:     169,
+			NameLength_RawValueSize:  4,
+			ValueLength_RealValue:    130,
+			ValueLength_RawValueSize: 4,
 		},
-	}
+	},
+	{
+		Data:            append([]byte{128, 0, 0, 4, 1}, "NameV"...),
+		IsErrorExpected: false,
+		ExpectedValue: pairFromStreamOutput{
+			Name:                     []byte("Name"),
+			Value:                    []byte("V"),
+			NameLength_RealValue:     4,
+			NameLength_RawValueSize:  4,
+			ValueLength_RealValue:    1,
+			ValueLength_RawValueSize: 1,
+		},
+	},
+	{
+		// Value is shorter than its length.
+		Data:            []byte{5, 0, 'a'},
+		IsErrorExpected: true,
+	},
+	{
+		// Huge lengths in a short stream.
+		Data:            []byte{0x7F, 0xFF, 0xFF, 0xFF, 0x7F, 0xFF, 0xFF, 0xFF},
+		IsErrorExpected: true,
+	},
+	{
+		Data:            []byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 'x'},
+		IsErrorExpected: true,
+	},
+}
+
+func Test_NewNameValuePairFromStream(t *testing.T) {
+	aTest := tester.New(t)
 
 	var rdr io.Reader
 	var result *NameValuePair
 	var err error
 
-	for i, test := range tests {
+	for i, test := range pairFromStreamTests {
 		fmt.Printf("[%v]", i+1)
 
 		rdr = reader.New(bytes.NewReader(test.Data))
@@ -278,9 +310,10 @@ func Test_NewNameValuePairFromStream(t *testing.T) {
 
 		if test.IsErrorExpected {
 			aTest.MustBeAnError(err)
-		} else {
-			aTest.MustBeNoError(err)
+			aTest.MustBeEqual(result == nil, true)
+			continue
 		}
+		aTest.MustBeNoError(err)
 
 		aTest.MustBeEqual(result.Name, test.ExpectedValue.Name)
 		aTest.MustBeEqual(result.Value, test.ExpectedValue.Value)
@@ -292,6 +325,21 @@ func Test_NewNameValuePairFromStream(t *testing.T) {
 	fmt.Println()
 }
 
+// Test_NewNameValuePairFromStream_HugeLength is a regression test of a
+// crasher found by the fuzz test: memory of a huge length in a short stream was
+// allocated before the data was read.
+func Test_NewNameValuePairFromStream_HugeLength(t *testing.T) {
+	aTest := tester.New(t)
+
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	_, err := NewNameValuePairFromStream(bytes.NewReader([]byte{0xFF, 0xFF, 0xFF, 0xFF, 0, 'x'}))
+	runtime.ReadMemStats(&after)
+
+	aTest.MustBeEqual(errors.Is(err, io.ErrUnexpectedEOF), true)
+	aTest.MustBeEqual(after.TotalAlloc-before.TotalAlloc < 1024*1024, true)
+}
+
 func Test_Measure(t *testing.T) {
 	aTest := tester.New(t)
 
@@ -0,0 +1,38 @@
+package nvpair
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// FuzzNewNameValuePairFromStream checks that a decoded pair is encoded into
+// the bytes it was decoded from.
+func FuzzNewNameValuePairFromStream(f *testing.F) {
+	for _, test := range pairFromStreamTests {
+		f.Add(test.Data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		nvp, err := NewNameValuePairFromStream(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		ba, err := nvp.ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if (len(ba) != nvp.Measure()) || !bytes.Equal(ba, data[:nvp.Measure()]) {
+			t.Fatalf("pair is encoded into %v, decoded from %v", ba, data)
+		}
+
+		nvp2, err := NewNameValuePairFromStream(bytes.NewReader(ba))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(nvp2, nvp) {
+			t.Fatalf("pair %+v is decoded again as %+v", nvp, nvp2)
+		}
+	})
+}
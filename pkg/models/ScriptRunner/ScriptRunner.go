@@ -1,40 +1,72 @@
 package sr
 
 import (
-	"sync"
+	"bytes"
+	"context"
+	"io"
 
 	cl "github.com/vault-thirteen/Fast-CGI/pkg/Client"
 	nvpair "github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	dm "github.com/vault-thirteen/Fast-CGI/pkg/models/data"
 	pm "github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+	ae "github.com/vault-thirteen/auxie/errors"
 )
 
 type ScriptRunner struct {
-	lock      *sync.Mutex
-	requestId uint16
+	doer cl.Doer
 }
 
-func New() (sr *ScriptRunner) {
+// New creates a script runner which sends requests by the doer, e.g. by a
+// pool of connections or by a group of servers.
+func New(doer cl.Doer) (sr *ScriptRunner) {
 	return &ScriptRunner{
-		lock: new(sync.Mutex),
+		doer: doer,
 	}
 }
 
-func (sr *ScriptRunner) RunScript(cgiClient *cl.Client, parameters []*nvpair.NameValuePair, stdin []byte) (phpScriptOutput *pm.Data, phpErr error) {
-	sr.lock.Lock()
-	defer sr.lock.Unlock()
-
-	sr.incRequestId()
-
-	//log.Println(fmt.Sprintf("Request ID = %v.", sr.requestId)) // DEBUG.
+// RunScript runs the script. When the context is done, the script is aborted
+// and the error of the context is returned. When the server rejects the
+// request, the error of the protocol status is returned, see the
+// 'dm.ProtocolStatusToError' function.
+func (sr *ScriptRunner) RunScript(ctx context.Context, parameters []*nvpair.NameValuePair, stdin []byte) (phpScriptOutput *pm.Data, phpErr error) {
+	var stdOut, stdErr []byte
+	var appStatus uint32
+	stdOut, stdErr, appStatus, phpErr = sr.execScript(ctx, parameters, stdin)
+	if phpErr != nil {
+		return nil, phpErr
+	}
 
-	return pm.ExecPhpScriptAndGetHttpData(cgiClient, sr.requestId, parameters, stdin)
+	return pm.NewDataFromOutput(stdOut, stdErr, appStatus)
 }
 
-func (sr *ScriptRunner) incRequestId() {
-	sr.requestId++
+// execScript runs the script. Connections are managed by the doer, which
+// sends the request once more when an idle connection turns out to be closed
+// by the server.
+func (sr *ScriptRunner) execScript(ctx context.Context, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, appStatus uint32, err error) {
+	var stderr bytes.Buffer
 
-	// Zero request ID can not be used by user scripts directly.
-	if sr.requestId == 0 {
-		sr.requestId = 1
+	var rsp *cl.Response
+	rsp, err = sr.doer.Do(ctx, &cl.Request{
+		Role:     dm.FCGI_RESPONDER,
+		KeepConn: true,
+		Params:   parameters,
+		Stdin:    bytes.NewReader(stdin),
+		Stderr:   &stderr,
+	})
+	if err != nil {
+		return nil, nil, 0, err
 	}
+	defer func() {
+		derr := rsp.Close()
+		if derr != nil {
+			err = ae.Combine(err, derr)
+		}
+	}()
+
+	stdOut, err = io.ReadAll(rsp.Stdout)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	return stdOut, stderr.Bytes(), rsp.AppStatus(), nil
 }
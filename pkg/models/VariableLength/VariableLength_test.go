@@ -9,133 +9,151 @@ import (
 	"github.com/vault-thirteen/auxie/tester"
 )
 
-func Test_NewFromStream(t *testing.T) {
-	aTest := tester.New(t)
+// newFromStreamTest is a test case of the NewFromStream function.
+type newFromStreamTest struct {
+	Data            []byte
+	IsErrorExpected bool
+	ExpectedValue   *VariableLength
+}
 
-	type TestData struct {
-		Data            []byte
-		IsErrorExpected bool
-		ExpectedValue   *VariableLength
-	}
+// newFromStreamTests are test cases of the NewFromStream function. Their data
+// seeds the fuzz test as well.
+var newFromStreamTests = []newFromStreamTest{
+	{
+		Data:            []byte{0},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    0,
+			rawValueSize: 1,
+			rawValue1B:   0,
+			rawValue4B:   0,
+		},
+	},
+	{
+		Data:            []byte{1},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    1,
+			rawValueSize: 1,
+			rawValue1B:   1,
+			rawValue4B:   0,
+		},
+	},
+	{
+		Data:            []byte{255 >> 1},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    127,
+			rawValueSize: 1,
+			rawValue1B:   127,
+			rawValue4B:   0,
+		},
+	},
+	{
+		Data:            []byte{128, 0, 0, 128},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    128,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_147_483_776,
+		},
+	},
+	{
+		Data:            []byte{128, 0, 0, 129},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    129,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_147_483_777,
+		},
+	},
+	{
+		Data:            []byte{128, 0, 0, 255},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    255,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_147_483_903,
+		},
+	},
+	{
+		Data:            []byte{128, 0, 1, 0},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    256,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_147_483_904,
+		},
+	},
+	{
+		Data:            []byte{128, 1, 0, 0},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    65536,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_147_549_184,
+		},
+	},
+	{
+		Data:            []byte{129, 0, 0, 0},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    16_777_216,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_164_260_864,
+		},
+	},
+	{
+		Data:            []byte{255, 0, 0, 0},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    2_130_706_432,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   4_278_190_080,
+		},
+	},
+	{
+		Data:            []byte{255, 255, 255, 255},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    MaxVariableLength,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   4_294_967_295,
+		},
+	},
+	{
+		Data:            []byte{128, 0, 0, 1},
+		IsErrorExpected: false,
+		ExpectedValue: &VariableLength{
+			realValue:    1,
+			rawValueSize: 4,
+			rawValue1B:   0,
+			rawValue4B:   2_147_483_649,
+		},
+	},
+	{
+		Data:            []byte{128, 0},
+		IsErrorExpected: true,
+		ExpectedValue:   nil,
+	},
+}
 
-	tests := []TestData{
-		{
-			Data:            []byte{0},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    0,
-				rawValueSize: 1,
-				rawValue1B:   0,
-				rawValue4B:   0,
-			},
-		},
-		{
-			Data:            []byte{1},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    1,
-				rawValueSize: 1,
-				rawValue1B:   1,
-				rawValue4B:   0,
-			},
-		},
-		{
-			Data:            []byte{255 >> 1},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    127,
-				rawValueSize: 1,
-				rawValue1B:   127,
-				rawValue4B:   0,
-			},
-		},
-		{
-			Data:            []byte{128, 0, 0, 128},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    128,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   2_147_483_776,
-			},
-		},
-		{
-			Data:            []byte{128, 0, 0, 129},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    129,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   2_147_483_777,
-			},
-		},
-		{
-			Data:            []byte{128, 0, 0, 255},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    255,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   2_147_483_903,
-			},
-		},
-		{
-			Data:            []byte{128, 0, 1, 0},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    256,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   2_147_483_904,
-			},
-		},
-		{
-			Data:            []byte{128, 1, 0, 0},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    65536,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   2_147_549_184,
-			},
-		},
-		{
-			Data:            []byte{129, 0, 0, 0},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    16_777_216,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   2_164_260_864,
-			},
-		},
-		{
-			Data:            []byte{255, 0, 0, 0},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    2_130_706_432,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   4_278_190_080,
-			},
-		},
-		{
-			Data:            []byte{255, 255, 255, 255},
-			IsErrorExpected: false,
-			ExpectedValue: &VariableLength{
-				realValue:    MaxVariableLength,
-				rawValueSize: 4,
-				rawValue1B:   0,
-				rawValue4B:   4_294_967_295,
-			},
-		},
-	}
+func Test_NewFromStream(t *testing.T) {
+	aTest := tester.New(t)
 
 	var rdr io.Reader
 	var result *VariableLength
 	var err error
 
-	for i, test := range tests {
+	for i, test := range newFromStreamTests {
 		fmt.Printf("[%v]", i+1)
 
 		rdr = bytes.NewReader(test.Data)
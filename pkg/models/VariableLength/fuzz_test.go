@@ -0,0 +1,38 @@
+package vl
+
+import (
+	"bytes"
+	"testing"
+)
+
+// FuzzNewFromStream checks that a decoded length is encoded into the bytes it
+// was decoded from, including the four-byte form of small lengths.
+func FuzzNewFromStream(f *testing.F) {
+	for _, test := range newFromStreamTests {
+		f.Add(test.Data)
+	}
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		vl, err := NewFromStream(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		if vl.RealValue() > MaxVariableLength {
+			t.Fatalf("length %v is too big", vl.RealValue())
+		}
+
+		ba := vl.ToBytes()
+		if (len(ba) != vl.Size()) || !bytes.Equal(ba, data[:vl.Size()]) {
+			t.Fatalf("length is encoded into %v, decoded from %v", ba, data)
+		}
+
+		vl2, err := NewFromStream(bytes.NewReader(ba))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *vl2 != *vl {
+			t.Fatalf("length %+v is decoded again as %+v", vl, vl2)
+		}
+	})
+}
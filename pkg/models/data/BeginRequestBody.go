@@ -1,10 +1,23 @@
 package dm
 
+import (
+	"encoding/binary"
+	"fmt"
+)
+
 // Flags.
 const (
 	FCGI_KEEP_CONN = 1
 )
 
+const (
+	BeginRequestBodyLength = 8
+)
+
+const (
+	ErrBeginRequestBodyLength = "length of begin request body is wrong: %v"
+)
+
 /*
 	typedef struct {
 		unsigned char roleB1;
@@ -26,10 +39,40 @@ func NewBeginRequestBody(role Role, flags byte) (brb BeginRequestBody) {
 	}
 }
 
+// NewBeginRequestBodyFromBytes parses content of the FCGI_BEGIN_REQUEST
+// record.
+func NewBeginRequestBodyFromBytes(ba []byte) (brb BeginRequestBody, err error) {
+	if len(ba) != BeginRequestBodyLength {
+		return brb, fmt.Errorf(ErrBeginRequestBodyLength, len(ba))
+	}
+
+	brb.Role = binary.BigEndian.Uint16(ba[0:2])
+	brb.Flags = ba[2]
+	copy(brb.Reserved[:], ba[3:8])
+
+	return brb, nil
+}
+
 func (brb BeginRequestBody) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 8)
-	ba = append(ba, Uint16ToBytes(brb.Role)...)
-	ba = append(ba, brb.Flags)
-	ba = append(ba, brb.Reserved[:]...)
+	ba, _ = brb.AppendBinary(make([]byte, 0, BeginRequestBodyLength))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (brb BeginRequestBody) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint16(b, brb.Role)
+	b = append(b, brb.Flags)
+	b = append(b, brb.Reserved[:]...)
+	return b, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (brb BeginRequestBody) MarshalBinary() (data []byte, err error) {
+	return brb.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (brb *BeginRequestBody) UnmarshalBinary(data []byte) (err error) {
+	*brb, err = NewBeginRequestBodyFromBytes(data)
+	return err
+}
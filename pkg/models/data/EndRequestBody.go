@@ -1,5 +1,11 @@
 package dm
 
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
 // Protocol Status.
 const (
 	FCGI_REQUEST_COMPLETE = 0
@@ -8,6 +14,24 @@ const (
 	FCGI_UNKNOWN_ROLE     = 3
 )
 
+const (
+	EndRequestBodyLength = 8
+)
+
+const (
+	ErrEndRequestBodyLength = "length of end request body is wrong: %v"
+	ErrProtocolStatus       = "%w: %v"
+)
+
+// Errors of protocol statuses. Each of them means that the server has rejected
+// the request.
+var (
+	ErrCantMpxConn           = errors.New("server can not multiplex connection")
+	ErrOverloaded            = errors.New("server is overloaded")
+	ErrUnknownRole           = errors.New("role is unknown to server")
+	ErrUnknownProtocolStatus = errors.New("protocol status is unknown")
+)
+
 /*
 	typedef struct {
 		unsigned char appStatusB3;
@@ -31,10 +55,72 @@ func NewEndRequestBody(appStatus uint32, protocolStatus byte) (erb EndRequestBod
 	}
 }
 
+// NewEndRequestBodyFromBytes parses content of the FCGI_END_REQUEST record.
+func NewEndRequestBodyFromBytes(ba []byte) (erb EndRequestBody, err error) {
+	if len(ba) != EndRequestBodyLength {
+		return erb, fmt.Errorf(ErrEndRequestBodyLength, len(ba))
+	}
+
+	erb.AppStatus = binary.BigEndian.Uint32(ba[0:4])
+	erb.ProtocolStatus = ba[4]
+	copy(erb.Reserved[:], ba[5:8])
+
+	return erb, nil
+}
+
 func (erb EndRequestBody) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 8)
-	ba = append(ba, Uint32ToBytes(erb.AppStatus)...)
-	ba = append(ba, erb.ProtocolStatus)
-	ba = append(ba, erb.Reserved[:]...)
+	ba, _ = erb.AppendBinary(make([]byte, 0, EndRequestBodyLength))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (erb EndRequestBody) AppendBinary(b []byte) ([]byte, error) {
+	b = binary.BigEndian.AppendUint32(b, erb.AppStatus)
+	b = append(b, erb.ProtocolStatus)
+	b = append(b, erb.Reserved[:]...)
+	return b, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (erb EndRequestBody) MarshalBinary() (data []byte, err error) {
+	return erb.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (erb *EndRequestBody) UnmarshalBinary(data []byte) (err error) {
+	*erb, err = NewEndRequestBodyFromBytes(data)
+	return err
+}
+
+// Err returns the error of the protocol status. A complete request has no
+// error.
+func (erb EndRequestBody) Err() (err error) {
+	return ProtocolStatusToError(erb.ProtocolStatus)
+}
+
+// ProtocolStatusToError returns the error of the protocol status, which is
+// nil for the FCGI_REQUEST_COMPLETE status.
+func ProtocolStatusToError(protocolStatus byte) (err error) {
+	switch protocolStatus {
+	case FCGI_REQUEST_COMPLETE:
+		return nil
+	case FCGI_CANT_MPX_CONN:
+		return ErrCantMpxConn
+	case FCGI_OVERLOADED:
+		return ErrOverloaded
+	case FCGI_UNKNOWN_ROLE:
+		return ErrUnknownRole
+	default:
+		return fmt.Errorf(ErrProtocolStatus, ErrUnknownProtocolStatus, protocolStatus)
+	}
+}
+
+// IsProtocolStatusError tells whether the error is caused by a protocol
+// status. Such a request is rejected by the server, while the connection
+// stays usable.
+func IsProtocolStatusError(err error) bool {
+	return errors.Is(err, ErrCantMpxConn) ||
+		errors.Is(err, ErrOverloaded) ||
+		errors.Is(err, ErrUnknownRole) ||
+		errors.Is(err, ErrUnknownProtocolStatus)
+}
@@ -0,0 +1,35 @@
+package dm
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func Test_NewEndRequestBodyFromBytes(t *testing.T) {
+	aTest := tester.New(t)
+
+	erb, err := NewEndRequestBodyFromBytes(NewEndRequestBody(0x01020304, FCGI_OVERLOADED).ToBytes())
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(erb.AppStatus, uint32(0x01020304))
+	aTest.MustBeEqual(erb.ProtocolStatus, byte(FCGI_OVERLOADED))
+	aTest.MustBeEqual(errors.Is(erb.Err(), ErrOverloaded), true)
+
+	_, err = NewEndRequestBodyFromBytes([]byte{0, 0, 0, 0, 0})
+	aTest.MustBeAnError(err)
+}
+
+func Test_ProtocolStatusToError(t *testing.T) {
+	aTest := tester.New(t)
+
+	aTest.MustBeNoError(ProtocolStatusToError(FCGI_REQUEST_COMPLETE))
+	aTest.MustBeEqual(ProtocolStatusToError(FCGI_CANT_MPX_CONN), ErrCantMpxConn)
+	aTest.MustBeEqual(ProtocolStatusToError(FCGI_OVERLOADED), ErrOverloaded)
+	aTest.MustBeEqual(ProtocolStatusToError(FCGI_UNKNOWN_ROLE), ErrUnknownRole)
+
+	err := ProtocolStatusToError(200)
+	aTest.MustBeEqual(errors.Is(err, ErrUnknownProtocolStatus), true)
+	aTest.MustBeEqual(IsProtocolStatusError(err), true)
+	aTest.MustBeEqual(IsProtocolStatusError(errors.New("other")), false)
+}
@@ -1,5 +1,11 @@
 package dm
 
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
 const (
 	FCGI_HEADER_LEN      = 8
 	FCGI_VERSION_1       = 1
@@ -27,13 +33,79 @@ type Header struct {
 	Reserved      byte
 }
 
+const (
+	ErrHeaderLength = "length of header is wrong: %v"
+)
+
+// NewHeaderFromBytes parses the header of a record. The version of the
+// protocol and the record type are checked, so that a header of an unknown
+// type, which the RecordReader accepts in its lenient mode, is an error here.
+func NewHeaderFromBytes(ba []byte) (h Header, err error) {
+	if len(ba) != FCGI_HEADER_LEN {
+		return h, fmt.Errorf(ErrHeaderLength, len(ba))
+	}
+
+	h = parseHeader(ba)
+
+	err = checkVersion(h)
+	if err != nil {
+		return Header{}, err
+	}
+
+	err = checkType(h)
+	if err != nil {
+		return Header{}, err
+	}
+
+	return h, nil
+}
+
+// parseHeader parses the header of a record without checking it. The data
+// must have the length of the header.
+func parseHeader(ba []byte) (h Header) {
+	return Header{
+		Version:       ba[0],
+		Type:          ba[1],
+		RequestId:     binary.BigEndian.Uint16(ba[2:4]),
+		ContentLength: binary.BigEndian.Uint16(ba[4:6]),
+		PaddingLength: ba[6],
+		Reserved:      ba[7],
+	}
+}
+
+// NewHeaderFromStream reads the header of a record and checks it like the
+// NewHeaderFromBytes function does.
+func NewHeaderFromStream(stream io.Reader) (h Header, err error) {
+	ba := make([]byte, FCGI_HEADER_LEN)
+	_, err = io.ReadFull(stream, ba)
+	if err != nil {
+		return h, err
+	}
+
+	return NewHeaderFromBytes(ba)
+}
+
 func (h Header) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 8)
-	ba = append(ba, h.Version)
-	ba = append(ba, h.Type)
-	ba = append(ba, Uint16ToBytes(h.RequestId)...)
-	ba = append(ba, Uint16ToBytes(h.ContentLength)...)
-	ba = append(ba, h.PaddingLength)
-	ba = append(ba, h.Reserved)
+	ba, _ = h.AppendBinary(make([]byte, 0, FCGI_HEADER_LEN))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (h Header) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, h.Version, h.Type)
+	b = binary.BigEndian.AppendUint16(b, h.RequestId)
+	b = binary.BigEndian.AppendUint16(b, h.ContentLength)
+	b = append(b, h.PaddingLength, h.Reserved)
+	return b, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (h Header) MarshalBinary() (data []byte, err error) {
+	return h.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (h *Header) UnmarshalBinary(data []byte) (err error) {
+	*h, err = NewHeaderFromBytes(data)
+	return err
+}
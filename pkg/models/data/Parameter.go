@@ -45,6 +45,12 @@ const (
 	Parameter_ServerSignature    = "SERVER_SIGNATURE"
 )
 
+// FastCGI Filter Parameters.
+const (
+	Parameter_FcgiDataLastMod = "FCGI_DATA_LAST_MOD"
+	Parameter_FcgiDataLength  = "FCGI_DATA_LENGTH"
+)
+
 const (
 	ParameterPrefix_Http = "HTTP_"
 )
@@ -2,11 +2,11 @@ package dm
 
 import (
 	"bytes"
-	"encoding/binary"
+	"errors"
+	"fmt"
 	"io"
 
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
-	"github.com/vault-thirteen/auxie/reader"
 )
 
 /*
@@ -35,6 +35,10 @@ type Record struct {
 	PaddingData []byte
 }
 
+const (
+	ErrRecordExtraData = "extra data after record: %v bytes"
+)
+
 // Notes on RequestID.
 //
 // *	A Zero RequestId means a Management Record.
@@ -67,100 +71,68 @@ type Record struct {
 //
 // 5.	FCGI_END_REQUEST
 
+// NewRecordFromStream reads a single record in the lenient mode of the
+// RecordReader. To read a sequence of records with meaningful offsets in
+// errors, use the RecordReader.
 func NewRecordFromStream(stream io.Reader) (rec *Record, err error) {
-	rec = &Record{}
-	rdr := reader.New(stream)
-
-	rec.Version, err = rdr.ReadByte()
-	if err != nil {
-		return nil, err
-	}
-
-	rec.Type, err = rdr.ReadByte()
-	if err != nil {
-		return nil, err
-	}
-
-	rec.RequestId, err = rdr.ReadWord_BE()
-	if err != nil {
-		return nil, err
-	}
-
-	rec.ContentLength, err = rdr.ReadWord_BE()
-	if err != nil {
-		return nil, err
-	}
-
-	rec.PaddingLength, err = rdr.ReadByte()
-	if err != nil {
-		return nil, err
-	}
-
-	rec.Reserved, err = rdr.ReadByte()
-	if err != nil {
-		return nil, err
-	}
-
-	rec.ContentData, err = rdr.ReadBytes(int(rec.ContentLength))
-	if err != nil {
-		return nil, err
-	}
+	return NewRecordReader(stream, false).ReadRecord()
+}
 
-	rec.PaddingData, err = rdr.ReadBytes(int(rec.PaddingLength))
-	if err != nil {
-		return nil, err
+// Header returns the header of the record.
+func (r *Record) Header() (h Header) {
+	return Header{
+		Version:       r.Version,
+		Type:          r.Type,
+		RequestId:     r.RequestId,
+		ContentLength: r.ContentLength,
+		PaddingLength: r.PaddingLength,
+		Reserved:      r.Reserved,
 	}
-
-	return rec, nil
 }
 
 func (r *Record) ToBytes() (ba []byte, err error) {
-	var buf bytes.Buffer
-
-	_, err = buf.Write([]byte{r.Version})
-	if err != nil {
-		return nil, err
-	}
+	return r.AppendBinary(make([]byte, 0, FCGI_HEADER_LEN+len(r.ContentData)+len(r.PaddingData)))
+}
 
-	_, err = buf.Write([]byte{r.Type})
-	if err != nil {
-		return nil, err
-	}
+// AppendBinary implements the encoding.BinaryAppender interface. The record
+// is appended as is, without checking its lengths.
+func (r *Record) AppendBinary(b []byte) ([]byte, error) {
+	b, _ = r.Header().AppendBinary(b)
+	b = append(b, r.ContentData...)
+	b = append(b, r.PaddingData...)
+	return b, nil
+}
 
-	var buf2B = []byte{0, 0}
-	binary.BigEndian.PutUint16(buf2B, r.RequestId)
-	_, err = buf.Write(buf2B)
-	if err != nil {
-		return nil, err
-	}
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (r *Record) MarshalBinary() (data []byte, err error) {
+	return r.ToBytes()
+}
 
-	binary.BigEndian.PutUint16(buf2B, r.ContentLength)
-	_, err = buf.Write(buf2B)
-	if err != nil {
-		return nil, err
-	}
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface. The
+// data must be a single record of a known type.
+func (r *Record) UnmarshalBinary(data []byte) (err error) {
+	rdr := bytes.NewReader(data)
 
-	_, err = buf.Write([]byte{r.PaddingLength})
-	if err != nil {
-		return nil, err
+	var rec Record
+	err = NewRecordReader(rdr, false).ReadRecordInto(&rec)
+	if errors.Is(err, io.EOF) {
+		return ErrTruncatedRecord
 	}
-
-	_, err = buf.Write([]byte{r.Reserved})
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	_, err = buf.Write(r.ContentData)
+	err = checkType(rec.Header())
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	_, err = buf.Write(r.PaddingData)
-	if err != nil {
-		return nil, err
+	if rdr.Len() > 0 {
+		return fmt.Errorf(ErrRecordExtraData, rdr.Len())
 	}
 
-	return buf.Bytes(), nil
+	*r = rec
+	return nil
 }
 
 func (r *Record) ParseContentAsNVPs() (nvps []*nvpair.NameValuePair, err error) {
@@ -185,3 +157,8 @@ func (r *Record) ParseContentAsNVPs() (nvps []*nvpair.NameValuePair, err error)
 
 	return nvps, nil
 }
+
+// ParseContentAsEndRequestBody parses content of the FCGI_END_REQUEST record.
+func (r *Record) ParseContentAsEndRequestBody() (erb EndRequestBody, err error) {
+	return NewEndRequestBodyFromBytes(r.ContentData)
+}
@@ -0,0 +1,267 @@
+package dm
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// Parts of a record, used in errors of reading.
+const (
+	RecordPartVersion       = "version"
+	RecordPartType          = "type"
+	RecordPartRequestId     = "request ID"
+	RecordPartContentLength = "content length"
+	RecordPartPaddingLength = "padding length"
+	RecordPartReserved      = "reserved"
+	RecordPartContentData   = "content data"
+	RecordPartPaddingData   = "padding data"
+)
+
+// Formats of the errors of record validation, which wrap the errors below.
+const (
+	ErrVersion              = "%w: %v"
+	ErrRecordType           = "%w: %v"
+	ErrRequestIdForType     = "%w: %v for record type %v"
+	ErrContentLengthForType = "%w: %v for record type %v"
+)
+
+// Errors of record validation.
+var (
+	ErrUnsupportedVersion  = errors.New("unsupported version")
+	ErrUnknownRecordType   = errors.New("unknown record type")
+	ErrTruncatedRecord     = errors.New("truncated record")
+	ErrUnexpectedRequestId = errors.New("unexpected request ID")
+	ErrWrongContentLength  = errors.New("wrong content length")
+)
+
+// RecordError is an error of reading a record. It tells where in the stream
+// the error has happened.
+type RecordError struct {
+	// Offset is the number of bytes of the stream read before the error.
+	Offset int64
+
+	// Part is the part of the record which was being read or checked.
+	Part string
+
+	Err error
+}
+
+func (re *RecordError) Error() string {
+	return fmt.Sprintf("record error at offset %v (%v): %v", re.Offset, re.Part, re.Err)
+}
+
+func (re *RecordError) Unwrap() error {
+	return re.Err
+}
+
+// RecordReader reads records from a stream checking them.
+//
+// In lenient mode, only the version of the protocol and the integrity of a
+// record are checked. In strict mode, the record type must be known, the
+// request ID must suit the type, and bodies of discrete records must have
+// their fixed size.
+//
+// The end of the stream between records is io.EOF, while the end of the
+// stream inside a record is the ErrTruncatedRecord error.
+type RecordReader struct {
+	stream   io.Reader
+	isStrict bool
+	offset   int64
+	header   [FCGI_HEADER_LEN]byte
+}
+
+func NewRecordReader(stream io.Reader, isStrict bool) (rr *RecordReader) {
+	return &RecordReader{
+		stream:   stream,
+		isStrict: isStrict,
+	}
+}
+
+// NewBufferedRecordReader creates a reader which reads the stream through a
+// buffer of the specified size. If the size is not positive, the default size
+// is used. The reader may read ahead of the last returned record, so the
+// stream must not be read by anybody else.
+func NewBufferedRecordReader(stream io.Reader, isStrict bool, size int) (rr *RecordReader) {
+	if size <= 0 {
+		size = RecordBufferSizeDefault
+	}
+
+	return NewRecordReader(bufio.NewReaderSize(stream, size), isStrict)
+}
+
+// Offset returns the number of bytes read from the stream.
+func (rr *RecordReader) Offset() (offset int64) {
+	return rr.offset
+}
+
+// ReadRecord reads the next record.
+func (rr *RecordReader) ReadRecord() (rec *Record, err error) {
+	rec = &Record{}
+
+	err = rr.ReadRecordInto(rec)
+	if err != nil {
+		return nil, err
+	}
+
+	return rec, nil
+}
+
+// ReadRecordInto reads the next record into the existing one, reusing memory
+// of its content and padding. Data of the previous record is overwritten.
+func (rr *RecordReader) ReadRecordInto(rec *Record) (err error) {
+	var n int
+	n, err = io.ReadFull(rr.stream, rr.header[:])
+	rr.offset += int64(n)
+	if err != nil {
+		if (n == 0) && errors.Is(err, io.EOF) {
+			return io.EOF
+		}
+
+		return rr.newReadError(headerPart(n), err)
+	}
+
+	h := parseHeader(rr.header[:])
+	headerOffset := rr.offset - FCGI_HEADER_LEN
+
+	err = checkVersion(h)
+	if err != nil {
+		return &RecordError{
+			Offset: headerOffset,
+			Part:   RecordPartVersion,
+			Err:    err,
+		}
+	}
+
+	if rr.isStrict {
+		err = checkHeader(h, headerOffset)
+		if err != nil {
+			return err
+		}
+	}
+
+	rec.Version = h.Version
+	rec.Type = h.Type
+	rec.RequestId = h.RequestId
+	rec.ContentLength = h.ContentLength
+	rec.PaddingLength = h.PaddingLength
+	rec.Reserved = h.Reserved
+
+	// Content and padding share a single piece of memory, which is kept
+	// by the content slice for the next record.
+	size := int(h.ContentLength) + int(h.PaddingLength)
+	buf := rec.ContentData[:cap(rec.ContentData)]
+	if len(buf) < size {
+		buf = make([]byte, size)
+	}
+	rec.ContentData = buf[:h.ContentLength]
+	rec.PaddingData = buf[h.ContentLength:size]
+
+	n, err = io.ReadFull(rr.stream, rec.ContentData)
+	rr.offset += int64(n)
+	if err != nil {
+		return rr.newReadError(RecordPartContentData, err)
+	}
+
+	n, err = io.ReadFull(rr.stream, rec.PaddingData)
+	rr.offset += int64(n)
+	if err != nil {
+		return rr.newReadError(RecordPartPaddingData, err)
+	}
+
+	return nil
+}
+
+// newReadError creates an error of reading the part of a record at the
+// current offset. The end of the stream means a truncated record.
+func (rr *RecordReader) newReadError(part string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		err = ErrTruncatedRecord
+	}
+
+	return &RecordError{
+		Offset: rr.offset,
+		Part:   part,
+		Err:    err,
+	}
+}
+
+// headerPart returns the part of the header at the specified position.
+func headerPart(position int) (part string) {
+	switch position {
+	case 0:
+		return RecordPartVersion
+	case 1:
+		return RecordPartType
+	case 2, 3:
+		return RecordPartRequestId
+	case 4, 5:
+		return RecordPartContentLength
+	case 6:
+		return RecordPartPaddingLength
+	default:
+		return RecordPartReserved
+	}
+}
+
+// checkVersion checks the version of the protocol of the header.
+func checkVersion(h Header) (err error) {
+	if h.Version != FCGI_VERSION_1 {
+		return fmt.Errorf(ErrVersion, ErrUnsupportedVersion, h.Version)
+	}
+
+	return nil
+}
+
+// checkType checks that the record type of the header is known.
+func checkType(h Header) (err error) {
+	if (h.Type == 0) || (h.Type > FCGI_MAXTYPE) {
+		return fmt.Errorf(ErrRecordType, ErrUnknownRecordType, h.Type)
+	}
+
+	return nil
+}
+
+// checkHeader performs the checks of the strict mode. Offset is the position
+// of the header in the stream.
+func checkHeader(h Header, offset int64) (err error) {
+	err = checkType(h)
+	if err != nil {
+		return &RecordError{
+			Offset: offset + 1,
+			Part:   RecordPartType,
+			Err:    err,
+		}
+	}
+
+	if IsManagementRecordType(h.Type) != (h.RequestId == FCGI_NULL_REQUEST_ID) {
+		return &RecordError{
+			Offset: offset + 2,
+			Part:   RecordPartRequestId,
+			Err:    fmt.Errorf(ErrRequestIdForType, ErrUnexpectedRequestId, h.RequestId, h.Type),
+		}
+	}
+
+	expectedLength := -1
+	switch h.Type {
+	case FCGI_BEGIN_REQUEST:
+		expectedLength = BeginRequestBodyLength
+	case FCGI_END_REQUEST:
+		expectedLength = EndRequestBodyLength
+	case FCGI_UNKNOWN_TYPE:
+		expectedLength = UnknownTypeRequestBodyLength
+	case FCGI_ABORT_REQUEST:
+		expectedLength = 0
+	}
+
+	if (expectedLength >= 0) && (int(h.ContentLength) != expectedLength) {
+		return &RecordError{
+			Offset: offset + 4,
+			Part:   RecordPartContentLength,
+			Err:    fmt.Errorf(ErrContentLengthForType, ErrWrongContentLength, h.ContentLength, h.Type),
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,137 @@
+package dm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func newRecordBytes(h Header, content []byte) (ba []byte) {
+	ba = h.ToBytes()
+	ba = append(ba, content...)
+	ba = append(ba, make([]byte, h.PaddingLength)...)
+	return ba
+}
+
+func Test_RecordReader(t *testing.T) {
+	aTest := tester.New(t)
+
+	stdout := newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_STDOUT, RequestId: 1, ContentLength: 3, PaddingLength: 5}, []byte("abc"))
+	end := newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_END_REQUEST, RequestId: 1, ContentLength: 8}, NewEndRequestBody(0, 0).ToBytes())
+
+	rr := NewRecordReader(bytes.NewReader(append(stdout, end...)), true)
+
+	rec, err := rr.ReadRecord()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(rec.ContentData, []byte("abc"))
+	aTest.MustBeEqual(rr.Offset(), int64(16))
+
+	rec, err = rr.ReadRecord()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(rec.Type, byte(FCGI_END_REQUEST))
+
+	_, err = rr.ReadRecord()
+	aTest.MustBeEqual(err, io.EOF)
+}
+
+func Test_RecordReader_Errors(t *testing.T) {
+	aTest := tester.New(t)
+
+	valid := newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_STDIN, RequestId: 1, ContentLength: 4, PaddingLength: 4}, []byte("data"))
+
+	type TestData struct {
+		Data           []byte
+		IsStrict       bool
+		ExpectedErr    error
+		ExpectedOffset int64
+		ExpectedPart   string
+	}
+
+	tests := []TestData{
+		{
+			Data:           append(valid, valid[:3]...),
+			ExpectedErr:    ErrTruncatedRecord,
+			ExpectedOffset: 16 + 3,
+			ExpectedPart:   RecordPartRequestId,
+		},
+		{
+			Data:           valid[:10],
+			ExpectedErr:    ErrTruncatedRecord,
+			ExpectedOffset: 10,
+			ExpectedPart:   RecordPartContentData,
+		},
+		{
+			Data:           valid[:14],
+			ExpectedErr:    ErrTruncatedRecord,
+			ExpectedOffset: 14,
+			ExpectedPart:   RecordPartPaddingData,
+		},
+		{
+			Data:           append(valid, newRecordBytes(Header{Version: 2, Type: FCGI_STDIN, RequestId: 1}, nil)...),
+			ExpectedErr:    ErrUnsupportedVersion,
+			ExpectedOffset: 16,
+			ExpectedPart:   RecordPartVersion,
+		},
+		{
+			Data:           newRecordBytes(Header{Version: FCGI_VERSION_1, Type: 100, RequestId: 1}, nil),
+			IsStrict:       true,
+			ExpectedErr:    ErrUnknownRecordType,
+			ExpectedOffset: 1,
+			ExpectedPart:   RecordPartType,
+		},
+		{
+			Data:           newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_STDIN, RequestId: 0}, nil),
+			IsStrict:       true,
+			ExpectedErr:    ErrUnexpectedRequestId,
+			ExpectedOffset: 2,
+			ExpectedPart:   RecordPartRequestId,
+		},
+		{
+			Data:           newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_GET_VALUES, RequestId: 3}, nil),
+			IsStrict:       true,
+			ExpectedErr:    ErrUnexpectedRequestId,
+			ExpectedOffset: 2,
+			ExpectedPart:   RecordPartRequestId,
+		},
+		{
+			Data:           newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_ABORT_REQUEST, RequestId: 1, ContentLength: 1}, []byte{0}),
+			IsStrict:       true,
+			ExpectedErr:    ErrWrongContentLength,
+			ExpectedOffset: 4,
+			ExpectedPart:   RecordPartContentLength,
+		},
+	}
+
+	for i, test := range tests {
+		fmt.Printf("[%v]", i+1)
+
+		rr := NewRecordReader(bytes.NewReader(test.Data), test.IsStrict)
+
+		var err error
+		for err == nil {
+			_, err = rr.ReadRecord()
+		}
+
+		aTest.MustBeEqual(errors.Is(err, test.ExpectedErr), true)
+
+		var re *RecordError
+		aTest.MustBeEqual(errors.As(err, &re), true)
+		aTest.MustBeEqual(re.Offset, test.ExpectedOffset)
+		aTest.MustBeEqual(re.Part, test.ExpectedPart)
+	}
+	fmt.Println()
+}
+
+func Test_RecordReader_Lenient(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Unknown types and odd request IDs are passed through.
+	data := newRecordBytes(Header{Version: FCGI_VERSION_1, Type: 100, RequestId: 0, ContentLength: 1, PaddingLength: 7}, []byte{1})
+	rec, err := NewRecordFromStream(bytes.NewReader(data))
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(rec.Type, byte(100))
+}
@@ -17,3 +17,14 @@ const (
 )
 
 type RecordType = byte
+
+// IsManagementRecordType tells whether records of the type are management
+// records, which have the null request ID.
+func IsManagementRecordType(recordType RecordType) bool {
+	switch recordType {
+	case FCGI_GET_VALUES, FCGI_GET_VALUES_RESULT, FCGI_UNKNOWN_TYPE:
+		return true
+	default:
+		return false
+	}
+}
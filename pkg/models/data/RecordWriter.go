@@ -0,0 +1,168 @@
+package dm
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+	"net"
+	"sync"
+)
+
+const (
+	// RecordBufferSizeDefault is the initial size of pooled buffers and the
+	// size of buffers of buffered readers and writers. It fits a header and a
+	// typical small record.
+	RecordBufferSizeDefault = 4 * 1024
+)
+
+const (
+	ErrRecordContentIsTooLong = "record content is too long"
+)
+
+// zeroes is the source of padding bytes.
+var zeroes [math.MaxUint8]byte
+
+// bufferPool keeps buffers for encoding records.
+var bufferPool = sync.Pool{
+	New: func() any {
+		ba := make([]byte, 0, RecordBufferSizeDefault)
+		return &ba
+	},
+}
+
+// AppendRecord appends a record having the specified content to the buffer.
+// Padding aligns the record by 8 bytes.
+func AppendRecord(b []byte, recordType RecordType, requestId uint16, content []byte) ([]byte, error) {
+	if len(content) > math.MaxUint16 {
+		return nil, errors.New(ErrRecordContentIsTooLong)
+	}
+
+	paddingLength := CalculatePadding(len(content))
+
+	b = appendHeader(b, recordType, requestId, uint16(len(content)), byte(paddingLength))
+	b = append(b, content...)
+
+	return AppendPadding(b, byte(paddingLength)), nil
+}
+
+// AppendPadding appends zero bytes of padding to the buffer.
+func AppendPadding(b []byte, paddingLength byte) []byte {
+	return append(b, zeroes[:paddingLength]...)
+}
+
+func appendHeader(b []byte, recordType RecordType, requestId uint16, contentLength uint16, paddingLength byte) []byte {
+	b = append(b, FCGI_VERSION_1, recordType)
+	b = binary.BigEndian.AppendUint16(b, requestId)
+	b = binary.BigEndian.AppendUint16(b, contentLength)
+	b = append(b, paddingLength, 0)
+	return b
+}
+
+// WriteRecord writes a record having the specified content into the writer
+// by a single call. The record is encoded into a pooled buffer.
+func WriteRecord(w io.Writer, recordType RecordType, requestId uint16, content []byte) (err error) {
+	bp := bufferPool.Get().(*[]byte)
+	defer func() {
+		*bp = (*bp)[:0]
+		bufferPool.Put(bp)
+	}()
+
+	*bp, err = AppendRecord((*bp)[:0], recordType, requestId, content)
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(*bp)
+	return err
+}
+
+// RecordWriter writes records without building them in intermediate buffers
+// where it is possible.
+//
+// When the underlying writer is a network connection, header, content and
+// padding of a record are written by a single vectored write. A buffered
+// writer collects records until it is flushed. Otherwise, each record is
+// encoded into a pooled buffer and written by a single call.
+//
+// RecordWriter is not safe for concurrent use.
+type RecordWriter struct {
+	w    io.Writer
+	bw   *bufio.Writer
+	conn net.Conn
+
+	header [FCGI_HEADER_LEN]byte
+	bufs   [3][]byte
+}
+
+func NewRecordWriter(w io.Writer) (rw *RecordWriter) {
+	rw = &RecordWriter{w: w}
+
+	conn, ok := w.(net.Conn)
+	if ok {
+		rw.conn = conn
+	}
+
+	return rw
+}
+
+// NewBufferedRecordWriter creates a writer which collects records in a buffer
+// of the specified size. If the size is not positive, the default size is
+// used. Records reach the underlying writer when the buffer is full or when
+// the writer is flushed.
+func NewBufferedRecordWriter(w io.Writer, size int) (rw *RecordWriter) {
+	if size <= 0 {
+		size = RecordBufferSizeDefault
+	}
+
+	return &RecordWriter{
+		w:  w,
+		bw: bufio.NewWriterSize(w, size),
+	}
+}
+
+// WriteRecord writes a record having the specified content.
+func (rw *RecordWriter) WriteRecord(recordType RecordType, requestId uint16, content []byte) (err error) {
+	if len(content) > math.MaxUint16 {
+		return errors.New(ErrRecordContentIsTooLong)
+	}
+
+	paddingLength := CalculatePadding(len(content))
+	header := appendHeader(rw.header[:0], recordType, requestId, uint16(len(content)), byte(paddingLength))
+
+	switch {
+	case rw.bw != nil:
+		_, err = rw.bw.Write(header)
+		if err != nil {
+			return err
+		}
+
+		_, err = rw.bw.Write(content)
+		if err != nil {
+			return err
+		}
+
+		_, err = rw.bw.Write(zeroes[:paddingLength])
+		return err
+
+	case rw.conn != nil:
+		rw.bufs = [3][]byte{header, content, zeroes[:paddingLength]}
+		nb := net.Buffers(rw.bufs[:])
+		_, err = nb.WriteTo(rw.conn)
+		return err
+
+	default:
+		return WriteRecord(rw.w, recordType, requestId, content)
+	}
+}
+
+// Flush writes the buffered records into the underlying writer. An unbuffered
+// writer has nothing to flush.
+func (rw *RecordWriter) Flush() (err error) {
+	if rw.bw == nil {
+		return nil
+	}
+
+	return rw.bw.Flush()
+}
@@ -0,0 +1,150 @@
+package dm
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func Test_AppendRecord(t *testing.T) {
+	aTest := tester.New(t)
+
+	ba, err := AppendRecord([]byte{0xFF}, FCGI_STDOUT, 0x0102, []byte("abc"))
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(ba, []byte{0xFF, 1, 6, 1, 2, 0, 3, 5, 0, 'a', 'b', 'c', 0, 0, 0, 0, 0})
+
+	_, err = AppendRecord(nil, FCGI_STDOUT, 1, make([]byte, 70_000))
+	aTest.MustBeAnError(err)
+}
+
+func Test_RecordWriter(t *testing.T) {
+	aTest := tester.New(t)
+
+	expected, err := AppendRecord(nil, FCGI_STDIN, 3, []byte("Hello"))
+	aTest.MustBeNoError(err)
+	expected, err = AppendRecord(expected, FCGI_STDIN, 3, nil)
+	aTest.MustBeNoError(err)
+
+	writeRecords := func(rw *RecordWriter) {
+		aTest.MustBeNoError(rw.WriteRecord(FCGI_STDIN, 3, []byte("Hello")))
+		aTest.MustBeNoError(rw.WriteRecord(FCGI_STDIN, 3, nil))
+		aTest.MustBeNoError(rw.Flush())
+	}
+
+	// Plain writer.
+	var buf bytes.Buffer
+	writeRecords(NewRecordWriter(&buf))
+	aTest.MustBeEqual(buf.Bytes(), expected)
+
+	// Buffered writer.
+	buf.Reset()
+	rw := NewBufferedRecordWriter(&buf, 0)
+	aTest.MustBeNoError(rw.WriteRecord(FCGI_STDIN, 3, []byte("Hello")))
+	aTest.MustBeEqual(buf.Len(), 0)
+	aTest.MustBeNoError(rw.WriteRecord(FCGI_STDIN, 3, nil))
+	aTest.MustBeNoError(rw.Flush())
+	aTest.MustBeEqual(buf.Bytes(), expected)
+
+	// Connection.
+	c1, c2 := net.Pipe()
+	done := make(chan []byte)
+	go func() {
+		ba, _ := io.ReadAll(c2)
+		done <- ba
+	}()
+	writeRecords(NewRecordWriter(c1))
+	aTest.MustBeNoError(c1.Close())
+	aTest.MustBeEqual(<-done, expected)
+}
+
+func Test_RecordReader_ReadRecordInto(t *testing.T) {
+	aTest := tester.New(t)
+
+	ba, err := AppendRecord(nil, FCGI_STDOUT, 1, bytes.Repeat([]byte{'x'}, 100))
+	aTest.MustBeNoError(err)
+	ba, err = AppendRecord(ba, FCGI_STDOUT, 1, []byte("yz"))
+	aTest.MustBeNoError(err)
+
+	rr := NewBufferedRecordReader(bytes.NewReader(ba), true, 0)
+
+	var rec Record
+	aTest.MustBeNoError(rr.ReadRecordInto(&rec))
+	aTest.MustBeEqual(len(rec.ContentData), 100)
+	aTest.MustBeEqual(len(rec.PaddingData), 4)
+	memory := &rec.ContentData[0]
+
+	// Memory of the first record is reused.
+	aTest.MustBeNoError(rr.ReadRecordInto(&rec))
+	aTest.MustBeEqual(rec.ContentData, []byte("yz"))
+	aTest.MustBeEqual(len(rec.PaddingData), 6)
+	aTest.MustBeEqual(&rec.ContentData[0] == memory, true)
+
+	aTest.MustBeEqual(rr.ReadRecordInto(&rec), io.EOF)
+}
+
+// benchmarkStream is a stream of small records which are typical for
+// parameters and short outputs.
+func benchmarkStream(b *testing.B) (ba []byte) {
+	content := bytes.Repeat([]byte{'x'}, 100)
+	var err error
+	for i := 0; i < 100; i++ {
+		ba, err = AppendRecord(ba, FCGI_STDOUT, 1, content)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+
+	return ba
+}
+
+func Benchmark_NewRecordFromStream(b *testing.B) {
+	data := benchmarkStream(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		rdr := bytes.NewReader(data)
+		for rdr.Len() > 0 {
+			_, err := NewRecordFromStream(rdr)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_RecordReader_ReadRecordInto(b *testing.B) {
+	data := benchmarkStream(b)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+
+	rdr := bytes.NewReader(data)
+	var rec Record
+	for n := 0; n < b.N; n++ {
+		rdr.Reset(data)
+		rr := NewRecordReader(rdr, false)
+		for rdr.Len() > 0 {
+			err := rr.ReadRecordInto(&rec)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+}
+
+func Benchmark_RecordWriter(b *testing.B) {
+	content := bytes.Repeat([]byte{'x'}, 100)
+	rw := NewRecordWriter(io.Discard)
+	b.SetBytes(int64(FCGI_HEADER_LEN + len(content) + CalculatePadding(len(content))))
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		err := rw.WriteRecord(FCGI_STDOUT, 1, content)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -1,5 +1,17 @@
 package dm
 
+import (
+	"fmt"
+)
+
+const (
+	UnknownTypeRequestBodyLength = 8
+)
+
+const (
+	ErrUnknownTypeRequestBodyLength = "length of unknown type request body is wrong: %v"
+)
+
 /*
 	 typedef struct {
 		unsigned char type;
@@ -17,9 +29,38 @@ func NewUnknownTypeRequestBody(recordType RecordType) (utrb UnknownTypeRequestBo
 	}
 }
 
+// NewUnknownTypeRequestBodyFromBytes parses content of the FCGI_UNKNOWN_TYPE
+// record.
+func NewUnknownTypeRequestBodyFromBytes(ba []byte) (utrb UnknownTypeRequestBody, err error) {
+	if len(ba) != UnknownTypeRequestBodyLength {
+		return utrb, fmt.Errorf(ErrUnknownTypeRequestBodyLength, len(ba))
+	}
+
+	utrb.Type = ba[0]
+	copy(utrb.Reserved[:], ba[1:8])
+
+	return utrb, nil
+}
+
 func (utrb UnknownTypeRequestBody) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 8)
-	ba = append(ba, utrb.Type)
-	ba = append(ba, utrb.Reserved[:]...)
+	ba, _ = utrb.AppendBinary(make([]byte, 0, UnknownTypeRequestBodyLength))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (utrb UnknownTypeRequestBody) AppendBinary(b []byte) ([]byte, error) {
+	b = append(b, utrb.Type)
+	b = append(b, utrb.Reserved[:]...)
+	return b, nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (utrb UnknownTypeRequestBody) MarshalBinary() (data []byte, err error) {
+	return utrb.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (utrb *UnknownTypeRequestBody) UnmarshalBinary(data []byte) (err error) {
+	*utrb, err = NewUnknownTypeRequestBodyFromBytes(data)
+	return err
+}
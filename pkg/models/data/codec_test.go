@@ -0,0 +1,129 @@
+package dm
+
+import (
+	"bytes"
+	"encoding"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+var (
+	_ encoding.BinaryAppender    = Header{}
+	_ encoding.BinaryMarshaler   = Header{}
+	_ encoding.BinaryUnmarshaler = (*Header)(nil)
+	_ encoding.BinaryAppender    = BeginRequestBody{}
+	_ encoding.BinaryUnmarshaler = (*BeginRequestBody)(nil)
+	_ encoding.BinaryAppender    = EndRequestBody{}
+	_ encoding.BinaryUnmarshaler = (*EndRequestBody)(nil)
+	_ encoding.BinaryAppender    = UnknownTypeRequestBody{}
+	_ encoding.BinaryUnmarshaler = (*UnknownTypeRequestBody)(nil)
+	_ encoding.BinaryAppender    = (*Record)(nil)
+	_ encoding.BinaryMarshaler   = (*Record)(nil)
+	_ encoding.BinaryUnmarshaler = (*Record)(nil)
+)
+
+func Test_Header_RoundTrip(t *testing.T) {
+	aTest := tester.New(t)
+
+	h := Header{
+		Version:       FCGI_VERSION_1,
+		Type:          FCGI_STDOUT,
+		RequestId:     0x1234,
+		ContentLength: 0xABCD,
+		PaddingLength: 3,
+		Reserved:      9,
+	}
+
+	ba, err := h.MarshalBinary()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(ba, []byte{1, 6, 0x12, 0x34, 0xAB, 0xCD, 3, 9})
+
+	var h2 Header
+	aTest.MustBeNoError(h2.UnmarshalBinary(ba))
+	aTest.MustBeEqual(h2, h)
+
+	aTest.MustBeAnError(h2.UnmarshalBinary(ba[:7]))
+}
+
+func Test_Header_Checks(t *testing.T) {
+	aTest := tester.New(t)
+
+	_, err := NewHeaderFromBytes([]byte{2, FCGI_STDOUT, 0, 1, 0, 0, 0, 0})
+	aTest.MustBeEqual(errors.Is(err, ErrUnsupportedVersion), true)
+
+	for _, recordType := range []RecordType{0, FCGI_MAXTYPE + 1} {
+		_, err = NewHeaderFromBytes([]byte{FCGI_VERSION_1, recordType, 0, 1, 0, 0, 0, 0})
+		aTest.MustBeEqual(errors.Is(err, ErrUnknownRecordType), true)
+
+		_, err = NewHeaderFromStream(bytes.NewReader([]byte{FCGI_VERSION_1, recordType, 0, 1, 0, 0, 0, 0}))
+		aTest.MustBeEqual(errors.Is(err, ErrUnknownRecordType), true)
+	}
+
+	var h Header
+	err = h.UnmarshalBinary([]byte{3, FCGI_STDOUT, 0, 1, 0, 0, 0, 0})
+	aTest.MustBeEqual(errors.Is(err, ErrUnsupportedVersion), true)
+	aTest.MustBeEqual(h, Header{})
+}
+
+func Test_Record_RoundTrip(t *testing.T) {
+	aTest := tester.New(t)
+
+	rec := &Record{
+		Version:       FCGI_VERSION_1,
+		Type:          FCGI_STDOUT,
+		RequestId:     0x1234,
+		ContentLength: 5,
+		PaddingLength: 3,
+		ContentData:   []byte("Hello"),
+		PaddingData:   []byte{0, 0, 0},
+	}
+
+	ba, err := rec.MarshalBinary()
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(ba, []byte{1, 6, 0x12, 0x34, 0, 5, 3, 0, 'H', 'e', 'l', 'l', 'o', 0, 0, 0})
+
+	var rec2 Record
+	aTest.MustBeNoError(rec2.UnmarshalBinary(ba))
+	aTest.MustBeEqual(&rec2, rec)
+
+	// Broken records do not change the record.
+	aTest.MustBeEqual(errors.Is(rec2.UnmarshalBinary(nil), ErrTruncatedRecord), true)
+	aTest.MustBeEqual(errors.Is(rec2.UnmarshalBinary(ba[:len(ba)-1]), ErrTruncatedRecord), true)
+	aTest.MustBeEqual(rec2.UnmarshalBinary(append(ba, 0)).Error(), fmt.Sprintf(ErrRecordExtraData, 1))
+
+	ba[0] = 2
+	aTest.MustBeEqual(errors.Is(rec2.UnmarshalBinary(ba), ErrUnsupportedVersion), true)
+	ba[0], ba[1] = FCGI_VERSION_1, FCGI_MAXTYPE+1
+	aTest.MustBeEqual(errors.Is(rec2.UnmarshalBinary(ba), ErrUnknownRecordType), true)
+	aTest.MustBeEqual(&rec2, rec)
+}
+
+func Test_Bodies_RoundTrip(t *testing.T) {
+	aTest := tester.New(t)
+
+	brb := BeginRequestBody{Role: FCGI_FILTER, Flags: FCGI_KEEP_CONN, Reserved: [5]byte{1, 2, 3, 4, 5}}
+	ba, err := brb.MarshalBinary()
+	aTest.MustBeNoError(err)
+	var brb2 BeginRequestBody
+	aTest.MustBeNoError(brb2.UnmarshalBinary(ba))
+	aTest.MustBeEqual(brb2, brb)
+	aTest.MustBeAnError(brb2.UnmarshalBinary(ba[1:]))
+
+	erb := NewEndRequestBody(42, FCGI_CANT_MPX_CONN)
+	ba, err = erb.MarshalBinary()
+	aTest.MustBeNoError(err)
+	var erb2 EndRequestBody
+	aTest.MustBeNoError(erb2.UnmarshalBinary(ba))
+	aTest.MustBeEqual(erb2, erb)
+
+	utrb := NewUnknownTypeRequestBody(77)
+	ba, err = utrb.AppendBinary([]byte{})
+	aTest.MustBeNoError(err)
+	var utrb2 UnknownTypeRequestBody
+	aTest.MustBeNoError(utrb2.UnmarshalBinary(ba))
+	aTest.MustBeEqual(utrb2, utrb)
+	aTest.MustBeAnError(utrb2.UnmarshalBinary(append(ba, 0)))
+}
@@ -0,0 +1,58 @@
+package dm
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+// FuzzNewRecordFromStream checks that a decoded record is encoded into the
+// bytes it was decoded from, and that its name-value pairs, when it has them,
+// are encoded back into its content.
+func FuzzNewRecordFromStream(f *testing.F) {
+	f.Add(newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_STDOUT, RequestId: 1, ContentLength: 3, PaddingLength: 5}, []byte("abc")))
+	f.Add(newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_END_REQUEST, RequestId: 1, ContentLength: 8}, NewEndRequestBody(0, 0).ToBytes()))
+	f.Add(newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_ABORT_REQUEST, RequestId: 1, ContentLength: 1}, []byte{0}))
+	f.Add(newRecordBytes(Header{Version: FCGI_VERSION_1, Type: 100, RequestId: 0, ContentLength: 1, PaddingLength: 7}, []byte{1}))
+	f.Add(newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_PARAMS, RequestId: 1, ContentLength: 7, PaddingLength: 1}, []byte{2, 3, 'I', 'D', 'a', 'b', 'c'}))
+	f.Add(newRecordBytes(Header{Version: FCGI_VERSION_1, Type: FCGI_GET_VALUES, RequestId: 0, ContentLength: 2}, []byte{128, 0})[:9])
+	f.Add([]byte{2, 6, 0, 1, 0, 0, 0, 0})
+
+	f.Fuzz(func(t *testing.T, data []byte) {
+		rec, err := NewRecordFromStream(bytes.NewReader(data))
+		if err != nil {
+			return
+		}
+
+		ba, err := rec.ToBytes()
+		if err != nil {
+			t.Fatal(err)
+		}
+		size := FCGI_HEADER_LEN + int(rec.ContentLength) + int(rec.PaddingLength)
+		if (len(ba) != size) || !bytes.Equal(ba, data[:size]) {
+			t.Fatalf("record is encoded into %v, decoded from %v", ba, data)
+		}
+
+		rec2, err := NewRecordFromStream(bytes.NewReader(ba))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(rec2, rec) {
+			t.Fatalf("record %+v is decoded again as %+v", rec, rec2)
+		}
+
+		nvps, err := rec.ParseContentAsNVPs()
+		if err != nil {
+			return
+		}
+
+		var buf bytes.Buffer
+		err = WriteParametersToBytesBuffer(&buf, nvps)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), rec.ContentData) {
+			t.Fatalf("pairs are encoded into %v, decoded from %v", buf.Bytes(), rec.ContentData)
+		}
+	})
+}
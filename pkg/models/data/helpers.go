@@ -35,23 +35,7 @@ func CalculatePadding(dataLength int) (padding int) {
 
 // PaddingToBytes prepares the padding bytes.
 func PaddingToBytes(paddingLength byte) (ba []byte, err error) {
-	if paddingLength == 0 {
-		return []byte{}, nil
-	}
-
-	var buf bytes.Buffer
-
-	padding := make([]byte, paddingLength)
-	for i := 0; i < len(padding); i++ {
-		padding[i] = 0
-	}
-
-	_, err = buf.Write(padding)
-	if err != nil {
-		return nil, err
-	}
-
-	return buf.Bytes(), nil
+	return make([]byte, paddingLength), nil
 }
 
 // WriteParametersToBytesBuffer puts parameters into a buffer of bytes.
@@ -74,13 +58,7 @@ func WriteParametersToBytesBuffer(buf *bytes.Buffer, parameters []*nvpair.NameVa
 
 // WritePaddingToBytesBuffer puts th padding into a buffer of bytes.
 func WritePaddingToBytesBuffer(buf *bytes.Buffer, paddingLength byte) (err error) {
-	var ba []byte
-	ba, err = PaddingToBytes(paddingLength)
-	if err != nil {
-		return err
-	}
-
-	_, err = buf.Write(ba)
+	_, err = buf.Write(zeroes[:paddingLength])
 	if err != nil {
 		return err
 	}
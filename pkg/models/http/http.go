@@ -14,6 +14,12 @@ const (
 	ErrAuthorizationSyntax = "syntax error in authorization header: %v"
 )
 
+const (
+	// RetryAfterOverloadedSec is the delay in seconds which is suggested to
+	// a client when the FastCGI server is overloaded.
+	RetryAfterOverloadedSec = 1
+)
+
 // ParseAuthorizationHeader parses the 'Authorization' HTTP header.
 // https://developer.mozilla.org/en-US/docs/Web/HTTP/Headers/Authorization.
 func ParseAuthorizationHeader(header string) (scheme string, parameters string, err error) {
@@ -0,0 +1,210 @@
+package pm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// Default paths and response of the status and ping pages of php-fpm, see the
+// 'pm.status_path', 'ping.path' and 'ping.response' settings of a pool. The
+// pages are served only over FastCGI.
+const (
+	FpmStatusPathDefault   = "/status"
+	FpmPingPathDefault     = "/ping"
+	FpmPingResponseDefault = "pong"
+
+	// FpmStatusQueryFull asks for the status of the pool and of each of its
+	// processes in JSON.
+	FpmStatusQueryFull = "json&full"
+)
+
+// States of a php-fpm process.
+const (
+	FpmProcessStateIdle           = "Idle"
+	FpmProcessStateRunning        = "Running"
+	FpmProcessStateReadingHeaders = "Reading headers"
+	FpmProcessStateFinishing      = "Finishing"
+	FpmProcessStateEnding         = "Ending"
+)
+
+const (
+	ErrFpmPageHttpStatus = "php-fpm page %v has returned the HTTP status %v %v"
+)
+
+// FpmStatus is the full status of a php-fpm pool.
+type FpmStatus struct {
+	Pool           string `json:"pool"`
+	ProcessManager string `json:"process manager"`
+
+	// Unix time when the pool was started, and seconds since then.
+	StartTime  int64 `json:"start time"`
+	StartSince int64 `json:"start since"`
+
+	AcceptedConn uint64 `json:"accepted conn"`
+
+	// Connections waiting for a free process, the maximum of them since the
+	// start, and the size of the queue.
+	ListenQueue    int `json:"listen queue"`
+	MaxListenQueue int `json:"max listen queue"`
+	ListenQueueLen int `json:"listen queue len"`
+
+	IdleProcesses      int `json:"idle processes"`
+	ActiveProcesses    int `json:"active processes"`
+	TotalProcesses     int `json:"total processes"`
+	MaxActiveProcesses int `json:"max active processes"`
+
+	// Number of times the process manager has hit the 'pm.max_children'
+	// limit.
+	MaxChildrenReached int `json:"max children reached"`
+
+	SlowRequests int `json:"slow requests"`
+
+	// Peak memory of the pool in bytes. Older versions of php-fpm do not
+	// report it.
+	MemoryPeak uint64 `json:"memory peak,omitempty"`
+
+	Processes []*FpmProcess `json:"processes,omitempty"`
+}
+
+// FpmProcess is the status of a php-fpm process. Request fields describe the
+// current request of a running process or the last request of an idle one.
+type FpmProcess struct {
+	Pid        int    `json:"pid"`
+	State      string `json:"state"`
+	StartTime  int64  `json:"start time"`
+	StartSince int64  `json:"start since"`
+	Requests   uint64 `json:"requests"`
+
+	// Duration of the request in microseconds.
+	RequestDuration uint64 `json:"request duration"`
+
+	RequestMethod string `json:"request method"`
+	RequestUri    string `json:"request uri"`
+	ContentLength int64  `json:"content length"`
+	User          string `json:"user"`
+	Script        string `json:"script"`
+
+	// CPU usage in percents and memory in bytes of the last request. They
+	// are zero while a request is running.
+	LastRequestCpu    float64 `json:"last request cpu"`
+	LastRequestMemory uint64  `json:"last request memory"`
+}
+
+// NewFpmStatusParameters returns parameters of a request of the full status
+// page in JSON.
+func NewFpmStatusParameters(statusPath string) (parameters []*nvpair.NameValuePair) {
+	return newFpmPageParameters(statusPath, FpmStatusQueryFull)
+}
+
+// NewFpmPingParameters returns parameters of a request of the ping page.
+func NewFpmPingParameters(pingPath string) (parameters []*nvpair.NameValuePair) {
+	return newFpmPageParameters(pingPath, "")
+}
+
+// newFpmPageParameters returns parameters of a page of php-fpm. The page is
+// recognized by the script name, not by a file.
+func newFpmPageParameters(path string, query string) (parameters []*nvpair.NameValuePair) {
+	requestUri := path
+	if len(query) > 0 {
+		requestUri = path + "?" + query
+	}
+
+	return []*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestMethod, http.MethodGet),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, path),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptName, path),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_RequestUri, requestUri),
+		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_QueryString, query),
+	}
+}
+
+// GetFpmStatus gets the full status of a php-fpm pool by its status page. The
+// PHP server may listen either on a TCP or on a Unix socket, see the 'cl.New'
+// function for details.
+func GetFpmStatus(serverNetwork string, serverAddress string, statusPath string) (status *FpmStatus, err error) {
+	var data *Data
+	data, err = RunOncePhpScriptAndGetHttpData(serverNetwork, serverAddress, 1, NewFpmStatusParameters(statusPath), []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFpmStatus(statusPath, data)
+}
+
+// GetFpmStatusContext is the GetFpmStatus function which uses the specified
+// client and stops when the context is done.
+func GetFpmStatusContext(ctx context.Context, client *cl.Client, statusPath string) (status *FpmStatus, err error) {
+	var data *Data
+	data, err = ExecPhpScriptAndGetHttpDataContext(ctx, client, 0, NewFpmStatusParameters(statusPath), []byte{})
+	if err != nil {
+		return nil, err
+	}
+
+	return ParseFpmStatus(statusPath, data)
+}
+
+// ParseFpmStatus parses the output of the status page in JSON.
+func ParseFpmStatus(statusPath string, data *Data) (status *FpmStatus, err error) {
+	err = checkFpmPage(statusPath, data)
+	if err != nil {
+		return nil, err
+	}
+
+	status = &FpmStatus{}
+	err = json.Unmarshal(data.Body, status)
+	if err != nil {
+		return nil, err
+	}
+
+	return status, nil
+}
+
+// PingFpm runs the ping page of a php-fpm pool and returns its response,
+// which is 'pong' unless the 'ping.response' setting is changed.
+func PingFpm(serverNetwork string, serverAddress string, pingPath string) (response string, err error) {
+	var data *Data
+	data, err = RunOncePhpScriptAndGetHttpData(serverNetwork, serverAddress, 1, NewFpmPingParameters(pingPath), []byte{})
+	if err != nil {
+		return "", err
+	}
+
+	return parseFpmPing(pingPath, data)
+}
+
+// PingFpmContext is the PingFpm function which uses the specified client and
+// stops when the context is done.
+func PingFpmContext(ctx context.Context, client *cl.Client, pingPath string) (response string, err error) {
+	var data *Data
+	data, err = ExecPhpScriptAndGetHttpDataContext(ctx, client, 0, NewFpmPingParameters(pingPath), []byte{})
+	if err != nil {
+		return "", err
+	}
+
+	return parseFpmPing(pingPath, data)
+}
+
+func parseFpmPing(pingPath string, data *Data) (response string, err error) {
+	err = checkFpmPage(pingPath, data)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data.Body)), nil
+}
+
+// checkFpmPage checks the HTTP status of a page. Pages of php-fpm do not set
+// the status when they succeed, while a wrong path is a missing script.
+func checkFpmPage(path string, data *Data) (err error) {
+	if (data.StatusCode != 0) && (data.StatusCode != http.StatusOK) {
+		return fmt.Errorf(ErrFpmPageHttpStatus, path, data.StatusCode, data.StatusText)
+	}
+
+	return nil
+}
@@ -0,0 +1,119 @@
+package pm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	dm "github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// startFpm starts a backend serving the status and ping pages in the way of
+// php-fpm. Other scripts are not found.
+func startFpm(t *testing.T) (srv *fcgitest.Server) {
+	status, err := os.ReadFile("testdata/fpm-status.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err = fcgitest.NewServer(func(r *fcgitest.Request) *fcgitest.Response {
+		scriptName, _ := r.Param(dm.Parameter_ScriptName)
+		switch scriptName {
+		case FpmStatusPathDefault:
+			return &fcgitest.Response{Stdout: append([]byte("Content-Type: application/json\r\n\r\n"), status...)}
+		case FpmPingPathDefault:
+			return &fcgitest.Response{Stdout: []byte("Content-type: text/plain\r\n\r\npong")}
+		default:
+			return &fcgitest.Response{Stdout: []byte("Status: 404 Not Found\r\nContent-type: text/html; charset=UTF-8\r\n\r\nFile not found.\n")}
+		}
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = srv.Close() })
+
+	return srv
+}
+
+func Test_GetFpmStatus(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startFpm(t)
+	status, err := GetFpmStatus(srv.Network, srv.Address, FpmStatusPathDefault)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(status, &FpmStatus{
+		Pool:               "www",
+		ProcessManager:     "dynamic",
+		StartTime:          1718000000,
+		StartSince:         3600,
+		AcceptedConn:       1234,
+		ListenQueue:        0,
+		MaxListenQueue:     3,
+		ListenQueueLen:     4096,
+		IdleProcesses:      1,
+		ActiveProcesses:    1,
+		TotalProcesses:     2,
+		MaxActiveProcesses: 4,
+		MemoryPeak:         4194304,
+		Processes: []*FpmProcess{
+			{
+				Pid:             101,
+				State:           FpmProcessStateRunning,
+				StartTime:       1718000000,
+				StartSince:      3600,
+				Requests:        617,
+				RequestDuration: 184,
+				RequestMethod:   "GET",
+				RequestUri:      "/status?json&full",
+				User:            "-",
+				Script:          "-",
+			},
+			{
+				Pid:               102,
+				State:             FpmProcessStateIdle,
+				StartTime:         1718000010,
+				StartSince:        3590,
+				Requests:          616,
+				RequestDuration:   2051,
+				RequestMethod:     "POST",
+				RequestUri:        "/index.php",
+				ContentLength:     10,
+				User:              "-",
+				Script:            "/srv/www/index.php",
+				LastRequestCpu:    487.57,
+				LastRequestMemory: 2097152,
+			},
+		},
+	})
+
+	requests := srv.Requests()
+	aTest.MustBeEqual(len(requests), 1)
+	for name, value := range map[string]string{
+		dm.Parameter_RequestMethod:  "GET",
+		dm.Parameter_ScriptFilename: "/status",
+		dm.Parameter_RequestUri:     "/status?json&full",
+		dm.Parameter_QueryString:    "json&full",
+	} {
+		v, ok := requests[0].Param(name)
+		aTest.MustBeEqual(ok, true)
+		aTest.MustBeEqual(v, value)
+	}
+
+	// A wrong path is a missing script.
+	_, err = GetFpmStatus(srv.Network, srv.Address, "/fpm-status")
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(err.Error(), "php-fpm page /fpm-status has returned the HTTP status 404 Not Found")
+}
+
+func Test_PingFpm(t *testing.T) {
+	aTest := tester.New(t)
+
+	srv := startFpm(t)
+	response, err := PingFpm(srv.Network, srv.Address, FpmPingPathDefault)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(response, FpmPingResponseDefault)
+
+	_, err = PingFpm(srv.Network, srv.Address, "/fpm-ping")
+	aTest.MustBeAnError(err)
+}
@@ -0,0 +1,57 @@
+package pm
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"reflect"
+	"testing"
+)
+
+// joinHeadersToStdout is the reverse of the SplitHeadersFromStdout function.
+func joinHeadersToStdout(data *Data) (stdout []byte) {
+	var buf bytes.Buffer
+	if (data.StatusCode != 0) || (len(data.StatusText) > 0) {
+		_, _ = fmt.Fprintf(&buf, "Status: %v %v\r\n", data.StatusCode, data.StatusText)
+	}
+	for _, hdr := range data.Headers {
+		_, _ = fmt.Fprintf(&buf, "%v: %v\r\n", hdr.Name, hdr.Value)
+	}
+	buf.WriteString("\r\n")
+	buf.Write(data.Body)
+
+	return buf.Bytes()
+}
+
+// FuzzSplitHeadersFromStdout checks that split output, joined back, is split
+// in the same way. Seeds are outputs of scripts recorded in front of php-fpm.
+func FuzzSplitHeadersFromStdout(f *testing.F) {
+	for _, path := range recordedStdoutFiles {
+		stdout, err := os.ReadFile(path)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(stdout)
+	}
+
+	f.Add([]byte("Status: 404\r\n\r\n"))
+	f.Add([]byte("Status: 201 Created\nContent-Type: text/plain\n\nbody"))
+	f.Add([]byte("Status:\r\n\r\n"))
+	f.Add([]byte("Content-Type: text/html"))
+	f.Add([]byte("\r\n"))
+
+	f.Fuzz(func(t *testing.T, stdout []byte) {
+		data, err := SplitHeadersFromStdout(stdout)
+		if err != nil {
+			return
+		}
+
+		data2, err := SplitHeadersFromStdout(joinHeadersToStdout(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(data2, data) {
+			t.Fatalf("output %+v is split again as %+v", data, data2)
+		}
+	})
+}
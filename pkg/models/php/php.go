@@ -37,6 +37,9 @@ type Data struct {
 	StatusText string
 	Headers    []*Header
 	Body       []byte
+
+	// AppStatus is the exit code of the script.
+	AppStatus uint32
 }
 
 // Header is an HTTP header returned by a PHP script.
@@ -122,17 +125,16 @@ func ParseHeader(line string) (hdr *Header, err error) {
 	return hdr, nil
 }
 
-// ParseStatus parses information about HTTP status returned by PHP.
+// ParseStatus parses information about HTTP status returned by PHP. The
+// status text is optional.
 func ParseStatus(statusValue string) (statusCode uint, statusText string, err error) {
-	n := strings.Index(statusValue, cm.Space)
-	statusCodeStr := statusValue[0:n]
+	statusCodeStr, statusText, _ := strings.Cut(statusValue, cm.Space)
 	statusCode, err = number.ParseUint(statusCodeStr)
 	if err != nil {
-		return statusCode, statusText, err
+		return statusCode, "", err
 	}
 
-	n++
-	statusText = strings.TrimSpace(statusValue[n:])
+	statusText = strings.TrimSpace(statusText)
 	return statusCode, statusText, nil
 }
 
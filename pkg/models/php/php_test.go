@@ -0,0 +1,86 @@
+package pm
+
+import (
+	"os"
+	"testing"
+
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// Files with stdout of scripts recorded in front of php-fpm.
+var recordedStdoutFiles = []string{
+	"testdata/stdout/text.txt",
+	"testdata/stdout/redirect.txt",
+	"testdata/stdout/pre.txt",
+}
+
+// Test_SplitHeadersFromStdout splits stdout of scripts recorded in front of
+// php-fpm.
+func Test_SplitHeadersFromStdout(t *testing.T) {
+	aTest := tester.New(t)
+
+	expected := []*Data{
+		{
+			Headers: []*Header{
+				{Name: "X-Powered-By", Value: "PHP/8.3.6"},
+				{Name: "Content-type", Value: "text/plain;charset=UTF-8"},
+			},
+			Body: []byte("line 1\nline 2\n"),
+		},
+		{
+			StatusCode: 302,
+			StatusText: "Found",
+			Headers: []*Header{
+				{Name: "X-Powered-By", Value: "PHP/8.3.6"},
+				{Name: "Set-Cookie", Value: "a=1; path=/"},
+				{Name: "Set-Cookie", Value: "b=2; path=/"},
+				{Name: "Location", Value: "https://example.com/next?x=1"},
+				{Name: "Content-type", Value: "text/html; charset=UTF-8"},
+			},
+			Body: []byte{},
+		},
+		{
+			Headers: []*Header{
+				{Name: "X-Powered-By", Value: "PHP/8.3.6"},
+				{Name: "Content-type", Value: "text/html; charset=UTF-8"},
+			},
+			Body: []byte("<pre>\r\n\r\n</pre>"),
+		},
+	}
+
+	for i, path := range recordedStdoutFiles {
+		stdout, err := os.ReadFile(path)
+		aTest.MustBeNoError(err)
+
+		data, err := SplitHeadersFromStdout(stdout)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(data, expected[i])
+	}
+}
+
+func Test_ParseStatus(t *testing.T) {
+	aTest := tester.New(t)
+
+	tests := []struct {
+		value           string
+		isErrorExpected bool
+		code            uint
+		text            string
+	}{
+		{"404 Not Found", false, 404, "Not Found"},
+		{"200  OK ", false, 200, "OK"},
+		{"404", false, 404, ""},
+		{"x404 Not Found", true, 0, ""},
+		{"Found", true, 0, ""},
+	}
+	for _, test := range tests {
+		code, text, err := ParseStatus(test.value)
+		if test.isErrorExpected {
+			aTest.MustBeAnError(err)
+		} else {
+			aTest.MustBeNoError(err)
+		}
+		aTest.MustBeEqual(code, test.code)
+		aTest.MustBeEqual(text, test.text)
+	}
+}
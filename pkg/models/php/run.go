@@ -2,7 +2,9 @@ package pm
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"io"
 
 	"github.com/vault-thirteen/Fast-CGI/pkg/Client"
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
@@ -13,13 +15,21 @@ import (
 // RunOnceSimplePhpScript runs a simple PHP script once and gets its output.
 // Only the `SCRIPT_FILENAME` parameter is provided to the PHP script, that is
 // why it is simple. The PHP-CGI server must be started manually before running
-// this function.
+// this function. Server may listen either on a TCP or on a Unix socket, see the
+// 'cl.New' function for details.
 func RunOnceSimplePhpScript(serverNetwork string, serverAddress string, scriptFilePath string) (stdOut []byte, stdErr []byte, err error) {
+	stdOut, stdErr, _, err = RunOnceSimplePhpScriptWithAppStatus(serverNetwork, serverAddress, scriptFilePath)
+	return stdOut, stdErr, err
+}
+
+// RunOnceSimplePhpScriptWithAppStatus is the RunOnceSimplePhpScript function
+// which returns the application status as well.
+func RunOnceSimplePhpScriptWithAppStatus(serverNetwork string, serverAddress string, scriptFilePath string) (stdOut []byte, stdErr []byte, appStatus uint32, err error) {
 	parameters := []*nvpair.NameValuePair{
 		nvpair.NewNameValuePairWithTextValueU(dm.Parameter_ScriptFilename, scriptFilePath),
 	}
 
-	return RunOncePhpScript(serverNetwork, serverAddress, 1, parameters, []byte{})
+	return RunOncePhpScriptWithAppStatus(serverNetwork, serverAddress, 1, parameters, []byte{})
 }
 
 // RunOnceSimplePhpScriptAndGetHttpData runs a simple PHP script once, gets its
@@ -30,26 +40,31 @@ func RunOnceSimplePhpScript(serverNetwork string, serverAddress string, scriptFi
 func RunOnceSimplePhpScriptAndGetHttpData(serverNetwork string, serverAddress string, scriptFilePath string) (data *Data, err error) {
 	var stdOut []byte
 	var stdErr []byte
-	stdOut, stdErr, err = RunOnceSimplePhpScript(serverNetwork, serverAddress, scriptFilePath)
+	var appStatus uint32
+	stdOut, stdErr, appStatus, err = RunOnceSimplePhpScriptWithAppStatus(serverNetwork, serverAddress, scriptFilePath)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(stdErr) > 0 {
-		return nil, errors.New(string(stdErr))
-	}
-
-	return SplitHeadersFromStdout(stdOut)
+	return NewDataFromOutput(stdOut, stdErr, appStatus)
 }
 
 // RunOncePhpScript runs a PHP script once.
 // Path to the script file must be set as a 'SCRIPT_FILENAME' parameter inside
-// the 'parameters' argument.
+// the 'parameters' argument. Server may listen either on a TCP or on a Unix
+// socket, see the 'cl.New' function for details.
 func RunOncePhpScript(serverNetwork string, serverAddress string, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, err error) {
+	stdOut, stdErr, _, err = RunOncePhpScriptWithAppStatus(serverNetwork, serverAddress, requestId, parameters, stdin)
+	return stdOut, stdErr, err
+}
+
+// RunOncePhpScriptWithAppStatus is the RunOncePhpScript function which
+// returns the application status as well.
+func RunOncePhpScriptWithAppStatus(serverNetwork string, serverAddress string, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, appStatus uint32, err error) {
 	var client *cl.Client
 	client, err = cl.New(serverNetwork, serverAddress)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 	defer func() {
 		derr := client.Close()
@@ -58,7 +73,7 @@ func RunOncePhpScript(serverNetwork string, serverAddress string, requestId uint
 		}
 	}()
 
-	return ExecPhpScript(client, requestId, parameters, stdin)
+	return ExecPhpScriptWithAppStatus(client, requestId, parameters, stdin)
 }
 
 // RunOncePhpScriptAndGetHttpData runs a PHP script once, gets its output,
@@ -69,75 +84,74 @@ func RunOncePhpScript(serverNetwork string, serverAddress string, requestId uint
 func RunOncePhpScriptAndGetHttpData(serverNetwork string, serverAddress string, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (data *Data, err error) {
 	var stdOut []byte
 	var stdErr []byte
-	stdOut, stdErr, err = RunOncePhpScript(serverNetwork, serverAddress, requestId, parameters, stdin)
+	var appStatus uint32
+	stdOut, stdErr, appStatus, err = RunOncePhpScriptWithAppStatus(serverNetwork, serverAddress, requestId, parameters, stdin)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(stdErr) > 0 {
-		return nil, errors.New(string(stdErr))
-	}
-
-	return SplitHeadersFromStdout(stdOut)
+	return NewDataFromOutput(stdOut, stdErr, appStatus)
 }
 
 // ExecPhpScript executes a PHP script using the specified client.
 // Path to the script file must be set as a 'SCRIPT_FILENAME' parameter inside
-// the 'parameters' argument.
+// the 'parameters' argument. If the request ID is zero, a free request ID of
+// the connection is used, which allows several scripts to share a single
+// connection to a server supporting multiplexing.
+//
+// When the server rejects the request, the error of the protocol status is
+// returned, such as 'dm.ErrOverloaded'.
 func ExecPhpScript(client *cl.Client, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, err error) {
-	var tcpData bytes.Buffer
-	var ba []byte
-
-	ba = client.CreateBeginRequest(requestId, dm.FCGI_RESPONDER, dm.FCGI_KEEP_CONN)
-	_, err = tcpData.Write(ba)
-	if err != nil {
-		return nil, nil, err
-	}
-
-	ba, err = client.CreateParamsRequest(requestId, parameters)
-	if err != nil {
-		return nil, nil, err
-	}
-	_, err = tcpData.Write(ba)
-	if err != nil {
-		return nil, nil, err
-	}
+	return ExecPhpScriptContext(context.Background(), client, requestId, parameters, stdin)
+}
 
-	ba, err = client.CreateParamsRequest(requestId, nil)
-	if err != nil {
-		return nil, nil, err
-	}
-	_, err = tcpData.Write(ba)
-	if err != nil {
-		return nil, nil, err
-	}
+// ExecPhpScriptWithAppStatus is the ExecPhpScript function which returns the
+// application status as well, which is the exit code of the script.
+func ExecPhpScriptWithAppStatus(client *cl.Client, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, appStatus uint32, err error) {
+	return ExecPhpScriptContextWithAppStatus(context.Background(), client, requestId, parameters, stdin)
+}
 
-	ba, err = client.CreateStdInRequest(requestId, stdin)
-	if err != nil {
-		return nil, nil, err
-	}
-	_, err = tcpData.Write(ba)
-	if err != nil {
-		return nil, nil, err
-	}
+// ExecPhpScriptContext is the ExecPhpScript function which stops when the
+// context is done. In this case the FCGI_ABORT_REQUEST record is sent to the
+// server, the server is given a bounded time to end the request, and then the
+// error of the context is returned. If the server does not end the request in
+// time, the connection is closed.
+func ExecPhpScriptContext(ctx context.Context, client *cl.Client, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, err error) {
+	stdOut, stdErr, _, err = ExecPhpScriptContextWithAppStatus(ctx, client, requestId, parameters, stdin)
+	return stdOut, stdErr, err
+}
 
-	err = client.SendRequest(tcpData.Bytes())
+// ExecPhpScriptContextWithAppStatus is the ExecPhpScriptContext function which
+// returns the application status as well.
+func ExecPhpScriptContextWithAppStatus(ctx context.Context, client *cl.Client, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (stdOut []byte, stdErr []byte, appStatus uint32, err error) {
+	var stdErrBuf bytes.Buffer
+	req := &cl.Request{
+		Role:      dm.FCGI_RESPONDER,
+		RequestId: requestId,
+		KeepConn:  true,
+		Params:    parameters,
+		Stdin:     bytes.NewReader(stdin),
+		Stderr:    &stdErrBuf,
+	}
+
+	var rsp *cl.Response
+	rsp, err = client.Do(ctx, req)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
+	defer func() {
+		derr := rsp.Close()
+		if derr != nil {
+			err = ae.Combine(err, derr)
+		}
+	}()
 
-	var recs []*dm.Record
-	recs, err = client.ReadResponseUntilEnd()
+	stdOut, err = io.ReadAll(rsp.Stdout)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, 0, err
 	}
 
-	recs = dm.FilterRecordsByRequestId(recs, requestId)
-
-	stdOut = dm.GetStdOutFromRecords(recs)
-	stdErr = dm.GetStdErrFromRecords(recs)
-
-	return stdOut, stdErr, nil
+	return stdOut, stdErrBuf.Bytes(), rsp.AppStatus(), nil
 }
 
 // ExecPhpScriptAndGetHttpData executes a PHP script using the specified
@@ -146,16 +160,37 @@ func ExecPhpScript(client *cl.Client, requestId uint16, parameters []*nvpair.Nam
 // the 'parameters' argument. The PHP-CGI server must be started manually
 // before running this function.
 func ExecPhpScriptAndGetHttpData(client *cl.Client, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (data *Data, err error) {
+	return ExecPhpScriptAndGetHttpDataContext(context.Background(), client, requestId, parameters, stdin)
+}
+
+// ExecPhpScriptAndGetHttpDataContext is the ExecPhpScriptAndGetHttpData
+// function which aborts the request when the context is done. See the
+// ExecPhpScriptContext function for details.
+func ExecPhpScriptAndGetHttpDataContext(ctx context.Context, client *cl.Client, requestId uint16, parameters []*nvpair.NameValuePair, stdin []byte) (data *Data, err error) {
 	var stdOut []byte
 	var stdErr []byte
-	stdOut, stdErr, err = ExecPhpScript(client, requestId, parameters, stdin)
+	var appStatus uint32
+	stdOut, stdErr, appStatus, err = ExecPhpScriptContextWithAppStatus(ctx, client, requestId, parameters, stdin)
 	if err != nil {
 		return nil, err
 	}
 
+	return NewDataFromOutput(stdOut, stdErr, appStatus)
+}
+
+// NewDataFromOutput splits the output of a script into HTTP headers and HTTP
+// body. Any data in stderr is an error.
+func NewDataFromOutput(stdOut []byte, stdErr []byte, appStatus uint32) (data *Data, err error) {
 	if len(stdErr) > 0 {
 		return nil, errors.New(string(stdErr))
 	}
 
-	return SplitHeadersFromStdout(stdOut)
+	data, err = SplitHeadersFromStdout(stdOut)
+	if err != nil {
+		return nil, err
+	}
+
+	data.AppStatus = appStatus
+
+	return data, nil
 }
@@ -1,6 +1,10 @@
 package rm
 
-import "github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+import (
+	"io"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
 
 /* {FCGI_ABORT_REQUEST, R} */
 type AbortRequest struct {
@@ -19,6 +23,62 @@ func NewAbortRequest(requestId uint16) (br *AbortRequest) {
 	}
 }
 
+// NewAbortRequestFromRecord takes the request from a record.
+func NewAbortRequestFromRecord(rec *dm.Record) (ar *AbortRequest, err error) {
+	err = checkRecord(rec, dm.FCGI_ABORT_REQUEST)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkContentLength(rec, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	return &AbortRequest{Header: rec.Header()}, nil
+}
+
+// NewAbortRequestFromStream reads the request from a stream.
+func NewAbortRequestFromStream(stream io.Reader) (ar *AbortRequest, err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewAbortRequestFromRecord(rec)
+}
+
 func (ar *AbortRequest) ToBytes() (ba []byte) {
-	return ar.Header.ToBytes()
+	ba, _ = ar.AppendBinary(make([]byte, 0, dm.FCGI_HEADER_LEN+int(ar.Header.PaddingLength)))
+	return ba
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (ar *AbortRequest) AppendBinary(b []byte) ([]byte, error) {
+	b, _ = ar.Header.AppendBinary(b)
+	return dm.AppendPadding(b, ar.Header.PaddingLength), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (ar *AbortRequest) MarshalBinary() (data []byte, err error) {
+	return ar.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (ar *AbortRequest) UnmarshalBinary(data []byte) (err error) {
+	var rec *dm.Record
+	rec, err = newRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	var x *AbortRequest
+	x, err = NewAbortRequestFromRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	*ar = *x
+	return nil
 }
@@ -1,6 +1,8 @@
 package rm
 
 import (
+	"io"
+
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
 )
 
@@ -28,9 +30,69 @@ func NewBeginRequest(requestId uint16, role dm.Role, flags byte) (br *BeginReque
 	}
 }
 
+// NewBeginRequestFromRecord takes the request from a record.
+func NewBeginRequestFromRecord(rec *dm.Record) (br *BeginRequest, err error) {
+	err = checkRecord(rec, dm.FCGI_BEGIN_REQUEST)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkContentLength(rec, dm.BeginRequestBodyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var body dm.BeginRequestBody
+	body, err = dm.NewBeginRequestBodyFromBytes(rec.ContentData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BeginRequest{Header: rec.Header(), Body: body}, nil
+}
+
+// NewBeginRequestFromStream reads the request from a stream.
+func NewBeginRequestFromStream(stream io.Reader) (br *BeginRequest, err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewBeginRequestFromRecord(rec)
+}
+
 func (br *BeginRequest) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 16)
-	ba = append(ba, br.Header.ToBytes()...)
-	ba = append(ba, br.Body.ToBytes()...)
+	ba, _ = br.AppendBinary(make([]byte, 0, dm.FCGI_HEADER_LEN+dm.BeginRequestBodyLength+int(br.Header.PaddingLength)))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (br *BeginRequest) AppendBinary(b []byte) ([]byte, error) {
+	b, _ = br.Header.AppendBinary(b)
+	b, _ = br.Body.AppendBinary(b)
+	return dm.AppendPadding(b, br.Header.PaddingLength), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (br *BeginRequest) MarshalBinary() (data []byte, err error) {
+	return br.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (br *BeginRequest) UnmarshalBinary(data []byte) (err error) {
+	var rec *dm.Record
+	rec, err = newRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	var x *BeginRequest
+	x, err = NewBeginRequestFromRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	*br = *x
+	return nil
+}
@@ -1,8 +1,9 @@
 package rm
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"math"
 
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/common"
@@ -53,23 +54,62 @@ func NewStdErrRequest(requestId uint16, stderr []byte) (ser *ByteStreamRequest,
 	return NewByteStreamRequest(dm.FCGI_STDERR, requestId, stderr)
 }
 
-func (bsr *ByteStreamRequest) ToBytes() (ba []byte, err error) {
-	var buf bytes.Buffer
-
-	_, err = buf.Write(bsr.Header.ToBytes())
+// NewByteStreamRequestFromRecord takes the request from a record of any byte
+// stream type.
+func NewByteStreamRequestFromRecord(rec *dm.Record) (bsr *ByteStreamRequest, err error) {
+	err = checkRecord(rec, dm.FCGI_STDIN, dm.FCGI_DATA, dm.FCGI_STDOUT, dm.FCGI_STDERR)
 	if err != nil {
 		return nil, err
 	}
 
-	_, err = buf.Write(bsr.Bytes)
+	return &ByteStreamRequest{Header: rec.Header(), Bytes: rec.ContentData}, nil
+}
+
+// NewByteStreamRequestFromStream reads the request from a stream.
+func NewByteStreamRequestFromStream(stream io.Reader) (bsr *ByteStreamRequest, err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(stream)
 	if err != nil {
 		return nil, err
 	}
 
-	err = dm.WritePaddingToBytesBuffer(&buf, bsr.Header.PaddingLength)
+	return NewByteStreamRequestFromRecord(rec)
+}
+
+func (bsr *ByteStreamRequest) ToBytes() (ba []byte, err error) {
+	return bsr.AppendBinary(make([]byte, 0, dm.FCGI_HEADER_LEN+len(bsr.Bytes)+int(bsr.Header.PaddingLength)))
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (bsr *ByteStreamRequest) AppendBinary(b []byte) ([]byte, error) {
+	if len(bsr.Bytes) != int(bsr.Header.ContentLength) {
+		return nil, fmt.Errorf(ErrContentLength, len(bsr.Bytes), bsr.Header.ContentLength)
+	}
+
+	b, _ = bsr.Header.AppendBinary(b)
+	b = append(b, bsr.Bytes...)
+	return dm.AppendPadding(b, bsr.Header.PaddingLength), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (bsr *ByteStreamRequest) MarshalBinary() (data []byte, err error) {
+	return bsr.ToBytes()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (bsr *ByteStreamRequest) UnmarshalBinary(data []byte) (err error) {
+	var rec *dm.Record
+	rec, err = newRecordFromBytes(data)
 	if err != nil {
-		return nil, err
+		return err
+	}
+
+	var x *ByteStreamRequest
+	x, err = NewByteStreamRequestFromRecord(rec)
+	if err != nil {
+		return err
 	}
 
-	return buf.Bytes(), nil
+	*bsr = *x
+	return nil
 }
@@ -1,6 +1,8 @@
 package rm
 
 import (
+	"io"
+
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
 )
 
@@ -28,9 +30,69 @@ func NewEndRequest(requestId uint16, appStatus uint32, protocolStatus byte) (er
 	}
 }
 
+// NewEndRequestFromRecord takes the request from a record.
+func NewEndRequestFromRecord(rec *dm.Record) (er *EndRequest, err error) {
+	err = checkRecord(rec, dm.FCGI_END_REQUEST)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkContentLength(rec, dm.EndRequestBodyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var body dm.EndRequestBody
+	body, err = dm.NewEndRequestBodyFromBytes(rec.ContentData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EndRequest{Header: rec.Header(), Body: body}, nil
+}
+
+// NewEndRequestFromStream reads the request from a stream.
+func NewEndRequestFromStream(stream io.Reader) (er *EndRequest, err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewEndRequestFromRecord(rec)
+}
+
 func (er *EndRequest) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 16)
-	ba = append(ba, er.Header.ToBytes()...)
-	ba = append(ba, er.Body.ToBytes()...)
+	ba, _ = er.AppendBinary(make([]byte, 0, dm.FCGI_HEADER_LEN+dm.EndRequestBodyLength+int(er.Header.PaddingLength)))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (er *EndRequest) AppendBinary(b []byte) ([]byte, error) {
+	b, _ = er.Header.AppendBinary(b)
+	b, _ = er.Body.AppendBinary(b)
+	return dm.AppendPadding(b, er.Header.PaddingLength), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (er *EndRequest) MarshalBinary() (data []byte, err error) {
+	return er.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (er *EndRequest) UnmarshalBinary(data []byte) (err error) {
+	var rec *dm.Record
+	rec, err = newRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	var x *EndRequest
+	x, err = NewEndRequestFromRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	*er = *x
+	return nil
+}
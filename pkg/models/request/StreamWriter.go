@@ -0,0 +1,153 @@
+package rm
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/interfaces"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	// MaxStreamRecordContentLength is the maximum length of content of a
+	// single record written by the StreamWriter. It is the greatest length
+	// which fits into the 16-bit field and does not require padding.
+	MaxStreamRecordContentLength = math.MaxUint16 - math.MaxUint16%8
+)
+
+const (
+	ErrStreamIsClosed = "stream is closed"
+)
+
+// StreamWriter writes a stream of any length as a sequence of stream records,
+// such as FCGI_PARAMS, FCGI_STDIN, FCGI_DATA, FCGI_STDOUT and FCGI_STDERR.
+// Data is split into as many records as needed. Closing the writer sends the
+// empty record which ends the stream.
+//
+// Each record is written into the underlying writer by a single call, so
+// records of different streams sharing a single connection are not mixed when
+// the underlying writer serializes its calls. If the underlying writer
+// implements the 'i.IRecordWriter' interface, records are passed to it.
+type StreamWriter struct {
+	w          io.Writer
+	recordType dm.RecordType
+	requestId  uint16
+	isClosed   bool
+}
+
+func NewStreamWriter(w io.Writer, recordType dm.RecordType, requestId uint16) (sw *StreamWriter) {
+	return &StreamWriter{
+		w:          w,
+		recordType: recordType,
+		requestId:  requestId,
+	}
+}
+
+func NewParamsWriter(w io.Writer, requestId uint16) (sw *StreamWriter) {
+	return NewStreamWriter(w, dm.FCGI_PARAMS, requestId)
+}
+
+func NewStdInWriter(w io.Writer, requestId uint16) (sw *StreamWriter) {
+	return NewStreamWriter(w, dm.FCGI_STDIN, requestId)
+}
+
+func NewDataWriter(w io.Writer, requestId uint16) (sw *StreamWriter) {
+	return NewStreamWriter(w, dm.FCGI_DATA, requestId)
+}
+
+func NewStdOutWriter(w io.Writer, requestId uint16) (sw *StreamWriter) {
+	return NewStreamWriter(w, dm.FCGI_STDOUT, requestId)
+}
+
+func NewStdErrWriter(w io.Writer, requestId uint16) (sw *StreamWriter) {
+	return NewStreamWriter(w, dm.FCGI_STDERR, requestId)
+}
+
+// Write writes the data as one or more records. Empty data writes nothing,
+// while an empty record would end the stream.
+func (sw *StreamWriter) Write(p []byte) (n int, err error) {
+	if sw.isClosed {
+		return 0, errors.New(ErrStreamIsClosed)
+	}
+
+	var chunk []byte
+	for len(p) > 0 {
+		chunk = p
+		if len(chunk) > MaxStreamRecordContentLength {
+			chunk = chunk[:MaxStreamRecordContentLength]
+		}
+
+		err = sw.writeRecord(chunk)
+		if err != nil {
+			return n, err
+		}
+
+		n += len(chunk)
+		p = p[len(chunk):]
+	}
+
+	return n, nil
+}
+
+// Close ends the stream by writing the empty record. The underlying writer is
+// not closed.
+func (sw *StreamWriter) Close() (err error) {
+	if sw.isClosed {
+		return nil
+	}
+
+	sw.isClosed = true
+
+	return sw.writeRecord(nil)
+}
+
+// writeRecord writes a record by the writer's own means when it can write
+// records. Otherwise, the record is encoded into a pooled buffer.
+func (sw *StreamWriter) writeRecord(content []byte) (err error) {
+	rw, ok := sw.w.(i.IRecordWriter)
+	if ok {
+		return rw.WriteRecord(sw.recordType, sw.requestId, content)
+	}
+
+	return dm.WriteRecord(sw.w, sw.recordType, sw.requestId, content)
+}
+
+// WriteParams writes the parameters as a stream of FCGI_PARAMS records of any
+// length, including the empty record which ends the stream. As the FastCGI
+// specification allows, a name-value pair may be split between two records.
+func WriteParams(w io.Writer, requestId uint16, params []*nvpair.NameValuePair) (err error) {
+	var buf bytes.Buffer
+	err = dm.WriteParametersToBytesBuffer(&buf, params)
+	if err != nil {
+		return err
+	}
+
+	sw := NewParamsWriter(w, requestId)
+
+	_, err = sw.Write(buf.Bytes())
+	if err != nil {
+		return err
+	}
+
+	return sw.Close()
+}
+
+// WriteStream copies the reader into a stream of records of the specified
+// type, including the empty record which ends the stream. A nil reader is an
+// empty stream.
+func WriteStream(w io.Writer, recordType dm.RecordType, requestId uint16, r io.Reader) (err error) {
+	sw := NewStreamWriter(w, recordType, requestId)
+
+	if r != nil {
+		buf := make([]byte, MaxStreamRecordContentLength)
+		_, err = io.CopyBuffer(sw, r, buf)
+		if err != nil {
+			return err
+		}
+	}
+
+	return sw.Close()
+}
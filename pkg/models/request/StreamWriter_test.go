@@ -0,0 +1,122 @@
+package rm
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+func readAllRecords(aTest *tester.Test, ba []byte) (recs []*dm.Record) {
+	rdr := bytes.NewReader(ba)
+	recs = make([]*dm.Record, 0)
+
+	for rdr.Len() > 0 {
+		rec, err := dm.NewRecordFromStream(rdr)
+		aTest.MustBeNoError(err)
+		recs = append(recs, rec)
+	}
+
+	return recs
+}
+
+func Test_WriteStream(t *testing.T) {
+	aTest := tester.New(t)
+
+	type TestData struct {
+		DataLength             int
+		ExpectedContentLengths []uint16
+	}
+
+	tests := []TestData{
+		{
+			DataLength:             0,
+			ExpectedContentLengths: []uint16{0},
+		},
+		{
+			DataLength:             1,
+			ExpectedContentLengths: []uint16{1, 0},
+		},
+		{
+			DataLength:             MaxStreamRecordContentLength,
+			ExpectedContentLengths: []uint16{MaxStreamRecordContentLength, 0},
+		},
+		{
+			DataLength:             70_000,
+			ExpectedContentLengths: []uint16{MaxStreamRecordContentLength, 70_000 - MaxStreamRecordContentLength, 0},
+		},
+		{
+			DataLength:             3*MaxStreamRecordContentLength + 5,
+			ExpectedContentLengths: []uint16{MaxStreamRecordContentLength, MaxStreamRecordContentLength, MaxStreamRecordContentLength, 5, 0},
+		},
+	}
+
+	for i, test := range tests {
+		fmt.Printf("[%v]", i+1)
+
+		data := bytes.Repeat([]byte{'x'}, test.DataLength)
+		var buf bytes.Buffer
+		aTest.MustBeNoError(WriteStream(&buf, dm.FCGI_STDIN, 7, bytes.NewReader(data)))
+
+		recs := readAllRecords(aTest, buf.Bytes())
+		aTest.MustBeEqual(len(recs), len(test.ExpectedContentLengths))
+		for j, rec := range recs {
+			aTest.MustBeEqual(rec.Type, byte(dm.FCGI_STDIN))
+			aTest.MustBeEqual(rec.RequestId, uint16(7))
+			aTest.MustBeEqual(rec.ContentLength, test.ExpectedContentLengths[j])
+			aTest.MustBeEqual(int(rec.PaddingLength), dm.CalculatePadding(int(rec.ContentLength)))
+		}
+		aTest.MustBeEqual(bytes.Equal(dm.GetContentsFromRecordsByType(recs, dm.FCGI_STDIN), data), true)
+	}
+	fmt.Println()
+}
+
+func Test_StreamWriter_Close(t *testing.T) {
+	aTest := tester.New(t)
+
+	var buf bytes.Buffer
+	sw := NewDataWriter(&buf, 1)
+	aTest.MustBeNoError(sw.Close())
+	aTest.MustBeNoError(sw.Close())
+
+	_, err := sw.Write([]byte{1})
+	aTest.MustBeAnError(err)
+
+	recs := readAllRecords(aTest, buf.Bytes())
+	aTest.MustBeEqual(len(recs), 1)
+	aTest.MustBeEqual(recs[0].Type, byte(dm.FCGI_DATA))
+	aTest.MustBeEqual(recs[0].ContentLength, uint16(0))
+}
+
+func Test_WriteParams(t *testing.T) {
+	aTest := tester.New(t)
+
+	params := []*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU("SHORT", "value"),
+		nvpair.NewNameValuePairWithTextValueU("LONG", strings.Repeat("y", 100_000)),
+		nvpair.NewNameValuePairWithTextValueU("LAST", "z"),
+	}
+
+	var buf bytes.Buffer
+	aTest.MustBeNoError(WriteParams(&buf, 3, params))
+
+	// The long pair is split between two records.
+	recs := readAllRecords(aTest, buf.Bytes())
+	aTest.MustBeEqual(len(recs), 3)
+	aTest.MustBeEqual(recs[2].ContentLength, uint16(0))
+
+	content := dm.GetContentsFromRecordsByType(recs, dm.FCGI_PARAMS)
+	rdr := bytes.NewReader(content)
+	for _, p := range params {
+		nvp, err := nvpair.NewNameValuePairFromStream(rdr)
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(nvp.Name, p.Name)
+		aTest.MustBeEqual(nvp.Value, p.Value)
+	}
+	aTest.MustBeEqual(rdr.Len(), 0)
+	aTest.MustBeEqual(len(content), nvpair.MeasureNameValuePairs(params))
+}
@@ -1,6 +1,8 @@
 package rm
 
 import (
+	"io"
+
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
 )
 
@@ -28,9 +30,69 @@ func NewUnknownTypeRequest(recordType dm.RecordType) (utr *UnknownTypeRequest) {
 	}
 }
 
+// NewUnknownTypeRequestFromRecord takes the request from a record.
+func NewUnknownTypeRequestFromRecord(rec *dm.Record) (utr *UnknownTypeRequest, err error) {
+	err = checkRecord(rec, dm.FCGI_UNKNOWN_TYPE)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkContentLength(rec, dm.UnknownTypeRequestBodyLength)
+	if err != nil {
+		return nil, err
+	}
+
+	var body dm.UnknownTypeRequestBody
+	body, err = dm.NewUnknownTypeRequestBodyFromBytes(rec.ContentData)
+	if err != nil {
+		return nil, err
+	}
+
+	return &UnknownTypeRequest{Header: rec.Header(), Body: body}, nil
+}
+
+// NewUnknownTypeRequestFromStream reads the request from a stream.
+func NewUnknownTypeRequestFromStream(stream io.Reader) (utr *UnknownTypeRequest, err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(stream)
+	if err != nil {
+		return nil, err
+	}
+
+	return NewUnknownTypeRequestFromRecord(rec)
+}
+
 func (utr *UnknownTypeRequest) ToBytes() (ba []byte) {
-	ba = make([]byte, 0, 16)
-	ba = append(ba, utr.Header.ToBytes()...)
-	ba = append(ba, utr.Body.ToBytes()...)
+	ba, _ = utr.AppendBinary(make([]byte, 0, dm.FCGI_HEADER_LEN+dm.UnknownTypeRequestBodyLength+int(utr.Header.PaddingLength)))
 	return ba
 }
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (utr *UnknownTypeRequest) AppendBinary(b []byte) ([]byte, error) {
+	b, _ = utr.Header.AppendBinary(b)
+	b, _ = utr.Body.AppendBinary(b)
+	return dm.AppendPadding(b, utr.Header.PaddingLength), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (utr *UnknownTypeRequest) MarshalBinary() (data []byte, err error) {
+	return utr.ToBytes(), nil
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (utr *UnknownTypeRequest) UnmarshalBinary(data []byte) (err error) {
+	var rec *dm.Record
+	rec, err = newRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	var x *UnknownTypeRequest
+	x, err = NewUnknownTypeRequestFromRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	*utr = *x
+	return nil
+}
@@ -1,8 +1,9 @@
 package rm
 
 import (
-	"bytes"
 	"errors"
+	"fmt"
+	"io"
 	"math"
 
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
@@ -50,23 +51,80 @@ func NewParamsRequest(requestId uint16, params []*nvpair.NameValuePair) (pr *Val
 	return NewValuesRequest(dm.FCGI_PARAMS, requestId, params)
 }
 
-func (vr *ValuesRequest) ToBytes() (ba []byte, err error) {
-	var buf bytes.Buffer
-
-	_, err = buf.Write(vr.Header.ToBytes())
+// NewValuesRequestFromRecord takes the request from a record of any type
+// carrying name-value pairs.
+func NewValuesRequestFromRecord(rec *dm.Record) (vr *ValuesRequest, err error) {
+	err = checkRecord(rec, dm.FCGI_GET_VALUES, dm.FCGI_GET_VALUES_RESULT, dm.FCGI_PARAMS)
 	if err != nil {
 		return nil, err
 	}
 
-	err = dm.WriteParametersToBytesBuffer(&buf, vr.Values)
+	var values []*nvpair.NameValuePair
+	values, err = rec.ParseContentAsNVPs()
 	if err != nil {
 		return nil, err
 	}
 
-	err = dm.WritePaddingToBytesBuffer(&buf, vr.Header.PaddingLength)
+	return &ValuesRequest{Header: rec.Header(), Values: values}, nil
+}
+
+// NewValuesRequestFromStream reads the request from a stream.
+func NewValuesRequestFromStream(stream io.Reader) (vr *ValuesRequest, err error) {
+	var rec *dm.Record
+	rec, err = dm.NewRecordFromStream(stream)
 	if err != nil {
 		return nil, err
 	}
 
-	return buf.Bytes(), nil
+	return NewValuesRequestFromRecord(rec)
+}
+
+func (vr *ValuesRequest) ToBytes() (ba []byte, err error) {
+	return vr.AppendBinary(make([]byte, 0, dm.FCGI_HEADER_LEN+int(vr.Header.ContentLength)+int(vr.Header.PaddingLength)))
+}
+
+// AppendBinary implements the encoding.BinaryAppender interface.
+func (vr *ValuesRequest) AppendBinary(b []byte) ([]byte, error) {
+	contentLength := nvpair.MeasureNameValuePairs(vr.Values)
+	if contentLength != int(vr.Header.ContentLength) {
+		return nil, fmt.Errorf(ErrContentLength, contentLength, vr.Header.ContentLength)
+	}
+
+	b, _ = vr.Header.AppendBinary(b)
+
+	var ba []byte
+	var err error
+	for _, nvp := range vr.Values {
+		ba, err = nvp.ToBytes()
+		if err != nil {
+			return nil, err
+		}
+
+		b = append(b, ba...)
+	}
+
+	return dm.AppendPadding(b, vr.Header.PaddingLength), nil
+}
+
+// MarshalBinary implements the encoding.BinaryMarshaler interface.
+func (vr *ValuesRequest) MarshalBinary() (data []byte, err error) {
+	return vr.ToBytes()
+}
+
+// UnmarshalBinary implements the encoding.BinaryUnmarshaler interface.
+func (vr *ValuesRequest) UnmarshalBinary(data []byte) (err error) {
+	var rec *dm.Record
+	rec, err = newRecordFromBytes(data)
+	if err != nil {
+		return err
+	}
+
+	var x *ValuesRequest
+	x, err = NewValuesRequestFromRecord(rec)
+	if err != nil {
+		return err
+	}
+
+	*vr = *x
+	return nil
 }
@@ -0,0 +1,46 @@
+package rm
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+// Benchmark_ByteStreamRequest_ToBytes is the way records were written before
+// the record writer: a request is built and serialized for each record.
+func Benchmark_ByteStreamRequest_ToBytes(b *testing.B) {
+	content := bytes.Repeat([]byte{'x'}, 100)
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		bsr, err := NewByteStreamRequest(dm.FCGI_STDOUT, 1, content)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		ba, err := bsr.ToBytes()
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		_, err = io.Discard.Write(ba)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func Benchmark_StreamWriter(b *testing.B) {
+	content := bytes.Repeat([]byte{'x'}, 100)
+	sw := NewStdOutWriter(io.Discard, 1)
+	b.ReportAllocs()
+
+	for n := 0; n < b.N; n++ {
+		_, err := sw.Write(content)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package rm
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+)
+
+const (
+	ErrRecordType                 = "record type is wrong: %v"
+	ErrManagementRecordRequestId  = "management record has non-null request ID: %v"
+	ErrApplicationRecordRequestId = "application record has null request ID"
+	ErrContentLength              = "content length is wrong: %v instead of %v"
+	ErrExtraData                  = "extra data after record: %v bytes"
+)
+
+// checkRecord checks that the record has one of the expected types and that
+// its request ID suits the type.
+func checkRecord(rec *dm.Record, recordTypes ...dm.RecordType) (err error) {
+	isTypeExpected := false
+	for _, rt := range recordTypes {
+		if rec.Type == rt {
+			isTypeExpected = true
+			break
+		}
+	}
+	if !isTypeExpected {
+		return fmt.Errorf(ErrRecordType, rec.Type)
+	}
+
+	if dm.IsManagementRecordType(rec.Type) {
+		if rec.RequestId != dm.FCGI_NULL_REQUEST_ID {
+			return fmt.Errorf(ErrManagementRecordRequestId, rec.RequestId)
+		}
+	} else {
+		if rec.RequestId == dm.FCGI_NULL_REQUEST_ID {
+			return errors.New(ErrApplicationRecordRequestId)
+		}
+	}
+
+	return nil
+}
+
+// checkContentLength checks the length of a record having a body of fixed
+// size.
+func checkContentLength(rec *dm.Record, contentLength int) (err error) {
+	if int(rec.ContentLength) != contentLength {
+		return fmt.Errorf(ErrContentLength, rec.ContentLength, contentLength)
+	}
+
+	return nil
+}
+
+// newRecordFromBytes reads a single record which must take all the data.
+func newRecordFromBytes(data []byte) (rec *dm.Record, err error) {
+	rdr := bytes.NewReader(data)
+
+	rec, err = dm.NewRecordFromStream(rdr)
+	if err != nil {
+		return nil, err
+	}
+
+	if rdr.Len() > 0 {
+		return nil, fmt.Errorf(ErrExtraData, rdr.Len())
+	}
+
+	return rec, nil
+}
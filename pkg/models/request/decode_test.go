@@ -0,0 +1,141 @@
+package rm
+
+import (
+	"bytes"
+	"encoding"
+	"fmt"
+	"testing"
+
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
+	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+type binaryCodec interface {
+	encoding.BinaryMarshaler
+	encoding.BinaryUnmarshaler
+	encoding.BinaryAppender
+}
+
+var (
+	_ binaryCodec = (*AbortRequest)(nil)
+	_ binaryCodec = (*BeginRequest)(nil)
+	_ binaryCodec = (*EndRequest)(nil)
+	_ binaryCodec = (*UnknownTypeRequest)(nil)
+	_ binaryCodec = (*ValuesRequest)(nil)
+	_ binaryCodec = (*ByteStreamRequest)(nil)
+)
+
+func Test_RoundTrip(t *testing.T) {
+	aTest := tester.New(t)
+
+	params, err := NewParamsRequest(5, []*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU("SCRIPT_FILENAME", "/var/www/index.php"),
+		nvpair.NewNameValuePairWithTextValueU("EMPTY", ""),
+	})
+	aTest.MustBeNoError(err)
+
+	getValues, err := NewGetValuesRequest([]*nvpair.NameValuePair{
+		nvpair.NewNameValuePairWithTextValueU("FCGI_MAX_CONNS", ""),
+	})
+	aTest.MustBeNoError(err)
+
+	stdout, err := NewStdOutRequest(5, []byte("Hello"))
+	aTest.MustBeNoError(err)
+
+	emptyStdin, err := NewStdInRequest(5, []byte{})
+	aTest.MustBeNoError(err)
+
+	type TestData struct {
+		Original binaryCodec
+		Decoded  binaryCodec
+	}
+
+	tests := []TestData{
+		{Original: NewAbortRequest(5), Decoded: &AbortRequest{}},
+		{Original: NewBeginRequest(5, dm.FCGI_AUTHORIZER, dm.FCGI_KEEP_CONN), Decoded: &BeginRequest{}},
+		{Original: NewEndRequest(5, 0xDEADBEEF, dm.FCGI_UNKNOWN_ROLE), Decoded: &EndRequest{}},
+		{Original: NewUnknownTypeRequest(200), Decoded: &UnknownTypeRequest{}},
+		{Original: params, Decoded: &ValuesRequest{}},
+		{Original: getValues, Decoded: &ValuesRequest{}},
+		{Original: stdout, Decoded: &ByteStreamRequest{}},
+		{Original: emptyStdin, Decoded: &ByteStreamRequest{}},
+	}
+
+	for i, test := range tests {
+		fmt.Printf("[%v]", i+1)
+
+		ba, err := test.Original.MarshalBinary()
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(len(ba)%8, 0)
+
+		// Appending keeps the prefix.
+		ba2, err := test.Original.AppendBinary([]byte{0xFF})
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(bytes.Equal(ba2[1:], ba), true)
+
+		aTest.MustBeNoError(test.Decoded.UnmarshalBinary(ba))
+		ba3, err := test.Decoded.MarshalBinary()
+		aTest.MustBeNoError(err)
+		aTest.MustBeEqual(bytes.Equal(ba3, ba), true)
+
+		// Extra data is not allowed.
+		aTest.MustBeAnError(test.Decoded.UnmarshalBinary(append(ba, 0)))
+	}
+	fmt.Println()
+}
+
+func Test_NewFromStream(t *testing.T) {
+	aTest := tester.New(t)
+
+	var buf bytes.Buffer
+	buf.Write(NewBeginRequest(7, dm.FCGI_RESPONDER, 0).ToBytes())
+	buf.Write(NewEndRequest(7, 1, dm.FCGI_REQUEST_COMPLETE).ToBytes())
+	buf.Write(NewAbortRequest(7).ToBytes())
+
+	br, err := NewBeginRequestFromStream(&buf)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(br.Header.RequestId, uint16(7))
+	aTest.MustBeEqual(br.Body.Role, dm.Role(dm.FCGI_RESPONDER))
+
+	er, err := NewEndRequestFromStream(&buf)
+	aTest.MustBeNoError(err)
+	aTest.MustBeEqual(er.Body.AppStatus, uint32(1))
+
+	// Record of another type is rejected.
+	_, err = NewBeginRequestFromStream(&buf)
+	aTest.MustBeAnError(err)
+
+	// Stream is over.
+	_, err = NewAbortRequestFromStream(&buf)
+	aTest.MustBeAnError(err)
+}
+
+func Test_Validation(t *testing.T) {
+	aTest := tester.New(t)
+
+	// Application record with the null request ID.
+	ba := NewBeginRequest(dm.FCGI_NULL_REQUEST_ID, dm.FCGI_RESPONDER, 0).ToBytes()
+	aTest.MustBeAnError((&BeginRequest{}).UnmarshalBinary(ba))
+
+	// Management record with a request ID.
+	utr := NewUnknownTypeRequest(100)
+	utr.Header.RequestId = 1
+	aTest.MustBeAnError((&UnknownTypeRequest{}).UnmarshalBinary(utr.ToBytes()))
+
+	// Body of a wrong size.
+	er := NewEndRequest(1, 0, 0)
+	er.Header.ContentLength = 0
+	aTest.MustBeAnError((&EndRequest{}).UnmarshalBinary(er.Header.ToBytes()))
+
+	// Truncated record.
+	ba = NewEndRequest(1, 0, 0).ToBytes()
+	aTest.MustBeAnError((&EndRequest{}).UnmarshalBinary(ba[:len(ba)-1]))
+
+	// Byte stream request can not carry name-value pairs.
+	vr, err := NewParamsRequest(1, nil)
+	aTest.MustBeNoError(err)
+	ba, err = vr.ToBytes()
+	aTest.MustBeNoError(err)
+	aTest.MustBeAnError((&ByteStreamRequest{}).UnmarshalBinary(ba))
+}
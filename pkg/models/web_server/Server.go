@@ -12,7 +12,7 @@ import (
 	"strings"
 	"time"
 
-	cl "github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	us "github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
 	sr "github.com/vault-thirteen/Fast-CGI/pkg/models/ScriptRunner"
 	pm "github.com/vault-thirteen/Fast-CGI/pkg/models/php"
 	sfs "github.com/vault-thirteen/Simple-File-Server"
@@ -33,7 +33,7 @@ const (
 type Server struct {
 	settings     *Settings
 	httpServer   *http.Server
-	cgiClient    *cl.Client
+	upstream     *us.Group
 	scriptRunner *sr.ScriptRunner
 	fileServer   *sfs.SimpleFileServer
 
@@ -43,6 +43,12 @@ type Server struct {
 }
 
 func NewServer(settings *Settings) (srv *Server, err error) {
+	// Settings may be made without the NewSettings function.
+	err = settings.checkPhpServer()
+	if err != nil {
+		return nil, err
+	}
+
 	srv = &Server{
 		settings: settings,
 	}
@@ -52,14 +58,11 @@ func NewServer(settings *Settings) (srv *Server, err error) {
 		Handler: http.Handler(http.HandlerFunc(srv.router)),
 	}
 
-	phpServerAddress := net.JoinHostPort(srv.settings.PhpServerHost, srv.settings.PhpServerPort)
-
-	srv.cgiClient, err = cl.New(srv.settings.PhpServerNetwork, phpServerAddress)
+	srv.upstream, err = us.New(srv.settings.UpstreamSettings())
 	if err != nil {
 		return nil, err
 	}
-
-	srv.scriptRunner = sr.New()
+	srv.scriptRunner = sr.New(srv.upstream)
 
 	srv.fileServer, err = sfs.NewSimpleFileServer(
 		srv.settings.DocumentRootPath,
@@ -117,6 +120,11 @@ func (srv *Server) getMimeTypes() (mimeTypes map[string]string) {
 }
 
 func (srv *Server) router(rw http.ResponseWriter, req *http.Request) {
+	if srv.isAdminRequest(req) {
+		srv.serveAdmin(rw, req)
+		return
+	}
+
 	var psi = &pm.PhpScriptInfo{
 		OriginalUrlPath: req.URL.Path,
 		UrlRelPath:      req.URL.Path,
@@ -281,7 +289,7 @@ func (srv *Server) Stop() (err error) {
 	fmt.Println("Done")
 
 	fmt.Print("FastCGI Client Shutdown ... ")
-	err = srv.cgiClient.Close()
+	err = srv.upstream.Close()
 	if err != nil {
 		return err
 	}
@@ -0,0 +1,161 @@
+package ws
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	rc "github.com/vault-thirteen/Fast-CGI/pkg/Recorder"
+	"github.com/vault-thirteen/Fast-CGI/pkg/fcgitest"
+	dm "github.com/vault-thirteen/Fast-CGI/pkg/models/data"
+	pm "github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+	"github.com/vault-thirteen/auxie/tester"
+)
+
+// Test_Server_RecordedSession serves requests by a session recorded in front
+// of php-fpm, so PHP is not needed.
+func Test_Server_RecordedSession(t *testing.T) {
+	aTest := tester.New(t)
+
+	session, err := rc.LoadSession("testdata/session.jsonl")
+	aTest.MustBeNoError(err)
+
+	backend := rc.NewBackend(session, nil)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	go func() { _ = backend.Serve(listener) }()
+
+	host, port, err := net.SplitHostPort(listener.Addr().String())
+	aTest.MustBeNoError(err)
+
+	srv, err := NewServer(&Settings{
+		DocumentRootPath:  t.TempDir(),
+		GatewayInterface:  "CGI/1.1",
+		ServerSoftware:    "test",
+		ServerName:        "localhost",
+		ServerHost:        "127.0.0.1",
+		ServerPort:        "8000",
+		PhpServerNetwork:  "tcp",
+		PhpServerHost:     host,
+		PhpServerPort:     port,
+		PhpServerMaxConns: 1,
+		PhpFileExtensions: []string{".php"},
+	})
+	aTest.MustBeNoError(err)
+
+	tests := []struct {
+		req         *http.Request
+		status      int
+		contentType string
+		body        string
+	}{
+		{httptest.NewRequest(http.MethodGet, "/index.php?page=2", nil), http.StatusOK, "text/html; charset=UTF-8", "<html><body>Query: page=2</body></html>"},
+		{httptest.NewRequest(http.MethodPost, "/form.php", strings.NewReader("name=Alice")), http.StatusCreated, "application/json", `{"received":"name=Alice"}`},
+		{httptest.NewRequest(http.MethodGet, "/missing.php", nil), http.StatusNotFound, "text/html; charset=UTF-8", "No input file specified."},
+		{httptest.NewRequest(http.MethodGet, "/warning.php", nil), http.StatusInternalServerError, "", "PHP Warning:  Undefined variable $x in /srv/warning.php on line 3"},
+	}
+	for _, test := range tests {
+		rw := httptest.NewRecorder()
+		srv.router(rw, test.req)
+
+		aTest.MustBeEqual(rw.Code, test.status)
+		aTest.MustBeEqual(rw.Header().Get("Content-Type"), test.contentType)
+		aTest.MustBeEqual(rw.Header().Get("Server"), "test")
+		aTest.MustBeEqual(rw.Body.String(), test.body)
+	}
+
+	aTest.MustBeNoError(srv.upstream.Close())
+	aTest.MustBeNoError(backend.Close())
+	aTest.MustBeEqual(backend.Mismatches(), []string{})
+}
+
+func Test_Server_Admin(t *testing.T) {
+	aTest := tester.New(t)
+
+	fpm, err := fcgitest.NewServer(func(r *fcgitest.Request) *fcgitest.Response {
+		scriptName, _ := r.Param(dm.Parameter_ScriptName)
+		if scriptName == "/ping" {
+			return &fcgitest.Response{Stdout: []byte("Content-type: text/plain\r\n\r\npong")}
+		}
+		return &fcgitest.Response{Stdout: []byte("Content-Type: application/json\r\n\r\n" + `{"pool":"www","listen queue":1,"idle processes":2}`)}
+	})
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = fpm.Close() })
+
+	// The second PHP server is not listening.
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	aTest.MustBeNoError(err)
+	deadAddress := listener.Addr().String()
+	aTest.MustBeNoError(listener.Close())
+
+	phpServers := []*PhpServerSettings{}
+	for _, address := range []string{fpm.Address, deadAddress} {
+		host, port, err := net.SplitHostPort(address)
+		aTest.MustBeNoError(err)
+		phpServers = append(phpServers, &PhpServerSettings{Network: "tcp", Host: host, Port: port})
+	}
+
+	srv, err := NewServer(&Settings{
+		DocumentRootPath: t.TempDir(),
+		ServerSoftware:   "test",
+		PhpServers:       phpServers,
+		PhpFpmStatusPath: "/status",
+		PhpFpmPingPath:   "/ping",
+		AdminPath:        "/admin/php-servers",
+	})
+	aTest.MustBeNoError(err)
+	t.Cleanup(func() { _ = srv.upstream.Close() })
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/php-servers", nil)
+	req.RemoteAddr = "[::1]:50000"
+	rw := httptest.NewRecorder()
+	srv.router(rw, req)
+
+	aTest.MustBeEqual(rw.Code, http.StatusOK)
+	aTest.MustBeEqual(rw.Header().Get("Content-Type"), "application/json")
+
+	var report AdminReport
+	aTest.MustBeNoError(json.Unmarshal(rw.Body.Bytes(), &report))
+	aTest.MustBeEqual(len(report.PhpServers), 2)
+	aTest.MustBeEqual(report.PhpServers[0], &PhpServerReport{
+		Network:     "tcp",
+		Address:     fpm.Address,
+		IsHealthy:   true,
+		IsAvailable: true,
+		Ping:        "pong",
+		Status:      &pm.FpmStatus{Pool: "www", ListenQueue: 1, IdleProcesses: 2},
+	})
+	aTest.MustBeEqual(report.PhpServers[1].Address, deadAddress)
+	aTest.MustBeEqual(strings.Contains(report.PhpServers[1].PingError, "connection refused"), true)
+	aTest.MustBeEqual(report.PhpServers[1].Status, (*pm.FpmStatus)(nil))
+
+	// The endpoint is not served to other clients.
+	req = httptest.NewRequest(http.MethodGet, "/admin/php-servers", nil)
+	rw = httptest.NewRecorder()
+	srv.router(rw, req)
+	aTest.MustBeEqual(rw.Code, http.StatusForbidden)
+}
+
+func Test_NewSettings_PhpServers(t *testing.T) {
+	aTest := tester.New(t)
+
+	settingsFilePath := filepath.Join(t.TempDir(), "settings.json")
+	aTest.MustBeNoError(os.WriteFile(settingsFilePath, []byte(`{"phpServers": [{"network": "tcp", "host": "127.0.0.1", "port": "9000"}, null]}`), 0o600))
+
+	_, err := NewSettings(settingsFilePath)
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(err.Error(), "PHP server 1 is not set")
+
+	_, err = NewServer(&Settings{
+		DocumentRootPath: t.TempDir(),
+		PhpServers:       []*PhpServerSettings{nil},
+		AdminPath:        "/admin/php-servers",
+	})
+	aTest.MustBeAnError(err)
+	aTest.MustBeEqual(err.Error(), "PHP server 0 is not set")
+}
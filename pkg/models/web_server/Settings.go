@@ -2,10 +2,16 @@ package ws
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"io"
+	"net"
 	"os"
 	"strings"
+	"time"
 
+	cl "github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	us "github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
 	ae "github.com/vault-thirteen/auxie/errors"
 )
 
@@ -13,6 +19,12 @@ const (
 	SymbolDot = '.'
 )
 
+const (
+	ErrPhpServerNetworkIsNotSupported = "PHP server network is not supported: %v"
+	ErrPhpServerSocketIsNotSet        = "PHP server socket is not set"
+	ErrPhpServerIsNotSet              = "PHP server %v is not set"
+)
+
 type Settings struct {
 	DocumentRootPath   string   `json:"documentRootPath"`   // Path to the 'www' folder.
 	FolderDefaultFiles []string `json:"folderDefaultFiles"` // List of default file names for a folder.
@@ -24,11 +36,35 @@ type Settings struct {
 	ServerHost       string `json:"serverHost"`       // IP address or domain name: localhost.
 	ServerPort       string `json:"serverPort"`       // 8000.
 
-	PhpServerNetwork  string   `json:"phpServerNetwork"`  // tcp.
+	PhpServerNetwork  string   `json:"phpServerNetwork"`  // tcp or unix.
 	PhpServerHost     string   `json:"phpServerHost"`     // 127.0.0.1.
 	PhpServerPort     string   `json:"phpServerPort"`     // 9000.
+	PhpServerSocket   string   `json:"phpServerSocket"`   // /run/php/php-fpm.sock or @php-fpm.
+	PhpServerMaxConns int      `json:"phpServerMaxConns"` // 16.
 	PhpFileExtensions []string `json:"phpFileExtensions"` // "php", "phtml", ...
 
+	// Several PHP servers, e.g. several php-fpm pools. When they are set, the
+	// single PHP server above is not used.
+	PhpServers                       []*PhpServerSettings `json:"phpServers"`
+	PhpServersStrategy               string               `json:"phpServersStrategy"`               // round-robin, least-outstanding or consistent-hash.
+	PhpServersHealthCheckIntervalSec int                  `json:"phpServersHealthCheckIntervalSec"` // 0 disables health checks.
+	PhpServersHealthCheckPingScript  string               `json:"phpServersHealthCheckPingScript"`  // /ping, or empty for FCGI_GET_VALUES probes.
+	PhpServersEjectionSec            int                  `json:"phpServersEjectionSec"`            // 0 disables passive ejection.
+
+	// Status and ping pages of php-fpm, see the 'pm.status_path' and
+	// 'ping.path' settings of php-fpm. Empty paths disable the pages. When
+	// health checks are enabled, the status is read by the checks, and a PHP
+	// server having more connections in its listen queue than the limit is
+	// not healthy.
+	PhpFpmStatusPath                    string `json:"phpFpmStatusPath"`                    // /status.
+	PhpFpmPingPath                      string `json:"phpFpmPingPath"`                      // /ping.
+	PhpServersHealthCheckMaxListenQueue int    `json:"phpServersHealthCheckMaxListenQueue"` // 0 does not limit the queue.
+
+	// Path of the admin endpoint which shows the PHP servers, their health
+	// and the pages of php-fpm in JSON. It is served only to clients from
+	// loopback addresses. Empty path disables the endpoint.
+	AdminPath string `json:"adminPath"` // /admin/php-servers.
+
 	// PHP is known to use an old-school variant of the 'Location' HTTP header.
 	// FixRelativeRedirects, when enabled, fixed outdated URLs.
 	// This feature is experimental and not safe.
@@ -50,6 +86,15 @@ type Settings struct {
 	PhpbbDoNotRedirectExtraPathInstallerStatus bool `json:"phpbbDoNotRedirectExtraPathInstallerStatus"`
 }
 
+// PhpServerSettings are settings of one of several PHP servers.
+type PhpServerSettings struct {
+	Network  string `json:"network"`  // tcp or unix.
+	Host     string `json:"host"`     // 127.0.0.1.
+	Port     string `json:"port"`     // 9000.
+	Socket   string `json:"socket"`   // /run/php/php-fpm.sock or @php-fpm.
+	MaxConns int    `json:"maxConns"` // 16.
+}
+
 func NewSettings(settingsFilePath string) (set *Settings, err error) {
 	var file *os.File
 	file, err = os.Open(settingsFilePath)
@@ -77,9 +122,113 @@ func NewSettings(settingsFilePath string) (set *Settings, err error) {
 
 	set.PhpFileExtensions = convertFileExtensionsFromNormalToGolang(set.PhpFileExtensions)
 
+	err = set.checkPhpServer()
+	if err != nil {
+		return nil, err
+	}
+
 	return set, nil
 }
 
+// PhpServerAddress returns the address of the PHP server in the format
+// required by its network. For a Unix network it is a path to the socket,
+// for TCP networks it is a host and a port.
+func (set *Settings) PhpServerAddress() (address string) {
+	return set.singlePhpServer().Address()
+}
+
+// Address returns the address of the PHP server in the format required by
+// its network.
+func (pss *PhpServerSettings) Address() (address string) {
+	if pss.Network == cl.NetworkUnix {
+		return pss.Socket
+	}
+
+	return net.JoinHostPort(pss.Host, pss.Port)
+}
+
+// UpstreamSettings returns settings of the group of PHP servers. The single
+// PHP server makes a group of one server.
+func (set *Settings) UpstreamSettings() (uss *us.Settings) {
+	phpServers := set.PhpServers
+	if len(phpServers) == 0 {
+		phpServers = []*PhpServerSettings{set.singlePhpServer()}
+	}
+
+	uss = &us.Settings{
+		Backends: make([]us.BackendSettings, 0, len(phpServers)),
+		Strategy: set.PhpServersStrategy,
+	}
+
+	for _, pss := range phpServers {
+		uss.Backends = append(uss.Backends, us.BackendSettings{
+			Network:  pss.Network,
+			Address:  pss.Address(),
+			MaxConns: pss.MaxConns,
+		})
+	}
+
+	if set.PhpServersHealthCheckIntervalSec > 0 {
+		uss.HealthCheck = &us.HealthCheckSettings{
+			Interval:       time.Duration(set.PhpServersHealthCheckIntervalSec) * time.Second,
+			PingScript:     set.PhpServersHealthCheckPingScript,
+			StatusScript:   set.PhpFpmStatusPath,
+			MaxListenQueue: set.PhpServersHealthCheckMaxListenQueue,
+		}
+	}
+
+	if set.PhpServersEjectionSec > 0 {
+		uss.PassiveEjection = us.PassiveEjectionSettings{
+			OnConnectError: true,
+			OnOverloaded:   true,
+			Duration:       time.Duration(set.PhpServersEjectionSec) * time.Second,
+		}
+	}
+
+	return uss
+}
+
+func (set *Settings) singlePhpServer() (pss *PhpServerSettings) {
+	return &PhpServerSettings{
+		Network:  set.PhpServerNetwork,
+		Host:     set.PhpServerHost,
+		Port:     set.PhpServerPort,
+		Socket:   set.PhpServerSocket,
+		MaxConns: set.PhpServerMaxConns,
+	}
+}
+
+func (set *Settings) checkPhpServer() (err error) {
+	if len(set.PhpServers) == 0 {
+		return set.singlePhpServer().check()
+	}
+
+	for i, pss := range set.PhpServers {
+		if pss == nil {
+			return fmt.Errorf(ErrPhpServerIsNotSet, i)
+		}
+
+		err = pss.check()
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (pss *PhpServerSettings) check() (err error) {
+	if !cl.IsNetworkSupported(pss.Network) {
+		return fmt.Errorf(ErrPhpServerNetworkIsNotSupported, pss.Network)
+	}
+
+	if (pss.Network == cl.NetworkUnix) && (len(pss.Socket) == 0) {
+		return errors.New(ErrPhpServerSocketIsNotSet)
+	}
+
+	return nil
+}
+
 func convertFileExtensionsFromNormalToGolang(exts []string) (golangExts []string) {
 	golangExts = make([]string, 0, len(exts))
 
@@ -0,0 +1,142 @@
+package ws
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	cl "github.com/vault-thirteen/Fast-CGI/pkg/Client"
+	us "github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
+	pm "github.com/vault-thirteen/Fast-CGI/pkg/models/php"
+	mime "github.com/vault-thirteen/auxie/MIME"
+	"github.com/vault-thirteen/auxie/header"
+)
+
+const (
+	// AdminTimeout limits reading of the pages of php-fpm by the admin
+	// endpoint.
+	AdminTimeout = 5 * time.Second
+)
+
+// AdminReport is the response of the admin endpoint.
+type AdminReport struct {
+	PhpServers []*PhpServerReport `json:"phpServers"`
+}
+
+// PhpServerReport shows the state of a PHP server. The ping and the status
+// are read when the report is made, errors of reading are shown instead of
+// them.
+type PhpServerReport struct {
+	Network     string `json:"network"`
+	Address     string `json:"address"`
+	IsHealthy   bool   `json:"isHealthy"`
+	IsAvailable bool   `json:"isAvailable"`
+	Outstanding int    `json:"outstanding"`
+
+	Ping        string        `json:"ping,omitempty"`
+	PingError   string        `json:"pingError,omitempty"`
+	Status      *pm.FpmStatus `json:"status,omitempty"`
+	StatusError string        `json:"statusError,omitempty"`
+}
+
+func (srv *Server) isAdminRequest(req *http.Request) bool {
+	return (len(srv.settings.AdminPath) > 0) && (req.URL.Path == srv.settings.AdminPath)
+}
+
+func (srv *Server) serveAdmin(rw http.ResponseWriter, req *http.Request) {
+	if !isLoopbackAddr(req.RemoteAddr) {
+		srv.respondWithNotAllowed(rw)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(req.Context(), AdminTimeout)
+	defer cancel()
+
+	backends := srv.upstream.Backends()
+	report := &AdminReport{
+		PhpServers: make([]*PhpServerReport, len(backends)),
+	}
+
+	var wg sync.WaitGroup
+	for i, b := range backends {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			report.PhpServers[i] = srv.reportPhpServer(ctx, b)
+		}()
+	}
+	wg.Wait()
+
+	data, err := json.Marshal(report)
+	if err != nil {
+		srv.respondWithInternalServerError(rw, err)
+		return
+	}
+
+	rw.Header().Set(header.HttpHeaderContentType, mime.TypeApplicationJson)
+	rw.Header().Set(header.HttpHeaderServer, srv.settings.ServerSoftware)
+
+	_, err = rw.Write(data)
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// reportPhpServer makes the report of a PHP server. The pages of php-fpm are
+// read using a new connection, so that they are not queued behind ordinary
+// requests.
+func (srv *Server) reportPhpServer(ctx context.Context, b *us.Backend) (psr *PhpServerReport) {
+	psr = &PhpServerReport{
+		Network:     b.Network(),
+		Address:     b.Address(),
+		IsHealthy:   b.IsHealthy(),
+		IsAvailable: b.IsAvailable(),
+		Outstanding: b.Outstanding(),
+	}
+
+	pingPath, statusPath := srv.settings.PhpFpmPingPath, srv.settings.PhpFpmStatusPath
+	if (len(pingPath) == 0) && (len(statusPath) == 0) {
+		return psr
+	}
+
+	c, err := cl.New(b.Network(), b.Address())
+	if err != nil {
+		psr.PingError, psr.StatusError = err.Error(), err.Error()
+		return psr
+	}
+	defer func() {
+		_ = c.Close()
+	}()
+
+	if len(pingPath) > 0 {
+		psr.Ping, err = pm.PingFpmContext(ctx, c, pingPath)
+		if err != nil {
+			psr.PingError = err.Error()
+		}
+	}
+
+	if len(statusPath) > 0 {
+		psr.Status, err = pm.GetFpmStatusContext(ctx, c, statusPath)
+		if err != nil {
+			psr.StatusError = err.Error()
+		}
+	}
+
+	return psr
+}
+
+// isLoopbackAddr tells whether the remote address of an HTTP request is a
+// loopback address.
+func isLoopbackAddr(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		return false
+	}
+
+	ip := net.ParseIP(host)
+	return (ip != nil) && ip.IsLoopback()
+}
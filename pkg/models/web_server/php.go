@@ -1,6 +1,7 @@
 package ws
 
 import (
+	"context"
 	"errors"
 	"io"
 	"log"
@@ -9,6 +10,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/vault-thirteen/Fast-CGI/pkg/Upstream"
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/NameValuePair"
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/data"
 	"github.com/vault-thirteen/Fast-CGI/pkg/models/http"
@@ -128,13 +130,29 @@ func (srv *Server) runPhpScript(rw http.ResponseWriter, req *http.Request, psi *
 	}
 	//nvpair.PrintParameters(parameters) // DEBUG.
 
-	phpScriptOutput, phpErr := srv.scriptRunner.RunScript(srv.cgiClient, parameters, stdin)
+	phpScriptOutput, phpErr := srv.scriptRunner.RunScript(req.Context(), parameters, stdin)
+	if errors.Is(phpErr, context.Canceled) {
+		// Client has gone away, the script is aborted, nobody needs a reply.
+		log.Println(phpErr)
+		return
+	}
 	if phpErr != nil {
 		// Headers.
 		rw.Header().Set(header.HttpHeaderServer, srv.settings.ServerSoftware)
 
 		// Status.
-		rw.WriteHeader(http.StatusInternalServerError)
+		switch {
+		case errors.Is(phpErr, dm.ErrOverloaded), errors.Is(phpErr, us.ErrNoAvailableBackend):
+			rw.Header().Set(header.HttpHeaderRetryAfter, strconv.Itoa(hm.RetryAfterOverloadedSec))
+			rw.WriteHeader(http.StatusServiceUnavailable)
+
+		case dm.IsProtocolStatusError(phpErr):
+			// Unknown role and other rejections are problems of the gateway.
+			rw.WriteHeader(http.StatusBadGateway)
+
+		default:
+			rw.WriteHeader(http.StatusInternalServerError)
+		}
 
 		// Body.
 		_, err = rw.Write([]byte(phpErr.Error()))